@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	schema "bitbucket.org/ibros_nsk/krisenkompass-backend/db"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/config"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+)
+
+const usage = "Usage: migrate up|down|status"
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	db, err := repository.NewMariaDB(config.Get().Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := schema.NewMigrator(db.DB)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+	case "down":
+		migration, err := migrator.Down()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Reverted %04d_%s\n", migration.Version, migration.Name)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-32s %s\n", status.Version, status.Name, appliedAt)
+		}
+		err = migrator.Check()
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,30 @@
+// Package db contains migrations of the database schema.
+package db
+
+import (
+	"database/sql"
+	"embed"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/migrate"
+)
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+func Migrations() ([]migrate.Migration, error) {
+	return migrate.Load(files, "migrations")
+}
+
+// NewMigrator returns migrator of the application schema. Databases created from the
+// old init.sql are recognised by the users table.
+func NewMigrator(conn *sql.DB) (*migrate.Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	migrator := migrate.New(conn, migrations)
+	migrator.BaselineTable = "users"
+
+	return migrator, nil
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/migrate"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("Got no migrations")
+	}
+
+	for _, migration := range migrations {
+		for _, script := range []string{migration.Up, migration.Down} {
+			statements := migrate.Split(script)
+			if len(statements) == 0 {
+				t.Errorf("Migration %d_%s has empty script", migration.Version, migration.Name)
+			}
+
+			for _, statement := range statements {
+				if strings.Contains(statement, ";") {
+					t.Errorf("Migration %d_%s has unsplit statement %q", migration.Version, migration.Name, statement)
+				}
+			}
+		}
+	}
+}
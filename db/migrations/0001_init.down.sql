@@ -0,0 +1,23 @@
+DROP TABLE IF EXISTS `files`;
+
+DROP TABLE IF EXISTS `blocks`;
+
+DROP TABLE IF EXISTS `default_pages`;
+
+DROP TABLE IF EXISTS `pages`;
+
+DROP TABLE IF EXISTS `languages`;
+
+DROP TABLE IF EXISTS `addresses`;
+
+DROP TABLE IF EXISTS `organizations_users`;
+
+DROP TABLE IF EXISTS `organizations`;
+
+DROP TABLE IF EXISTS `refresh_sessions`;
+
+DROP TABLE IF EXISTS `user_verifications`;
+
+DROP TABLE IF EXISTS `password_reset`;
+
+DROP TABLE IF EXISTS `users`;
@@ -0,0 +1,3 @@
+ALTER TABLE `organizations` CHANGE COLUMN IF EXISTS `invoice_address` `invoiceAddress` varchar(2048) NOT NULL;
+
+ALTER TABLE `users` DROP COLUMN IF EXISTS `salutation`;
@@ -0,0 +1,5 @@
+-- Databases created from the old init.sql don't match the code. Statements are written
+-- so they can be applied to databases which were already fixed by hand.
+ALTER TABLE `users` ADD COLUMN IF NOT EXISTS `salutation` varchar(32) AFTER `lastname`;
+
+ALTER TABLE `organizations` CHANGE COLUMN IF EXISTS `invoiceAddress` `invoice_address` varchar(2048) NOT NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE `revisions` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `page_id` bigint NOT NULL,
+  `block_id` bigint,
+  `data` longtext NOT NULL,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE `revisions` ADD FOREIGN KEY (`page_id`) REFERENCES `pages` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE INDEX `revisions_block_id` ON `revisions` (`block_id`);
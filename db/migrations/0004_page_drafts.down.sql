@@ -0,0 +1,5 @@
+ALTER TABLE `pages` DROP FOREIGN KEY `pages_published_revision_id`;
+
+ALTER TABLE `pages` DROP COLUMN `published_revision_id`;
+
+ALTER TABLE `pages` DROP COLUMN `draft`;
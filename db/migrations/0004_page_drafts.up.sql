@@ -0,0 +1,5 @@
+ALTER TABLE `pages` ADD COLUMN `draft` boolean NOT NULL DEFAULT false AFTER `sort`;
+
+ALTER TABLE `pages` ADD COLUMN `published_revision_id` bigint AFTER `draft`;
+
+ALTER TABLE `pages` ADD CONSTRAINT `pages_published_revision_id` FOREIGN KEY (`published_revision_id`) REFERENCES `revisions` (`id`) ON DELETE SET NULL ON UPDATE CASCADE;
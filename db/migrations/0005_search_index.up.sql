@@ -0,0 +1,18 @@
+CREATE TABLE `search_index` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `page_id` bigint NOT NULL,
+  `block_id` bigint,
+  `language_tag` varchar(2) NOT NULL,
+  `status` ENUM ('hidden', 'visible', 'deleted') NOT NULL,
+  `draft` boolean NOT NULL DEFAULT false,
+  `title` varchar(256) NOT NULL,
+  `content` longtext
+);
+
+ALTER TABLE `search_index` ADD FOREIGN KEY (`page_id`) REFERENCES `pages` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE INDEX `search_index_page_id` ON `search_index` (`page_id`);
+
+CREATE FULLTEXT INDEX `search_index_title` ON `search_index` (`title`);
+
+CREATE FULLTEXT INDEX `search_index_title_content` ON `search_index` (`title`, `content`);
@@ -0,0 +1,14 @@
+CREATE TABLE `audit_log` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `organization_id` bigint,
+  `actor_id` bigint,
+  `action` varchar(64) NOT NULL,
+  `entity_type` varchar(64) NOT NULL,
+  `entity_id` bigint,
+  `diff` longtext NOT NULL,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX `audit_log_organization_id` ON `audit_log` (`organization_id`, `id`);
+
+CREATE INDEX `audit_log_entity` ON `audit_log` (`entity_type`, `entity_id`);
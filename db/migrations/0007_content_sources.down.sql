@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `block_sources`;
+
+DROP TABLE IF EXISTS `page_sources`;
@@ -0,0 +1,24 @@
+CREATE TABLE `page_sources` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `organization_id` bigint NOT NULL,
+  `page_id` bigint,
+  `source_page_id` bigint,
+  `source_hash` char(64) NOT NULL,
+  `local_hash` char(64) NOT NULL,
+  `synced_at` timestamp DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE `block_sources` (
+  `block_id` bigint PRIMARY KEY,
+  `source_block_id` bigint
+);
+
+ALTER TABLE `page_sources` ADD FOREIGN KEY (`organization_id`) REFERENCES `organizations` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+ALTER TABLE `page_sources` ADD FOREIGN KEY (`page_id`) REFERENCES `pages` (`id`) ON DELETE SET NULL ON UPDATE CASCADE;
+
+ALTER TABLE `page_sources` ADD FOREIGN KEY (`source_page_id`) REFERENCES `pages` (`id`) ON DELETE SET NULL ON UPDATE CASCADE;
+
+ALTER TABLE `block_sources` ADD FOREIGN KEY (`block_id`) REFERENCES `blocks` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+ALTER TABLE `block_sources` ADD FOREIGN KEY (`source_block_id`) REFERENCES `blocks` (`id`) ON DELETE SET NULL ON UPDATE CASCADE;
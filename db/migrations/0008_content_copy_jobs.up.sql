@@ -0,0 +1,15 @@
+CREATE TABLE `content_copy_jobs` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `organization_id` bigint NOT NULL,
+  `plan` ENUM ('basic', 'conference', 'school', 'pro') NOT NULL,
+  `mode` ENUM ('all_or_nothing', 'best_effort') NOT NULL DEFAULT "all_or_nothing",
+  `status` ENUM ('pending', 'running', 'completed', 'partial', 'failed') NOT NULL DEFAULT "pending",
+  `total` int NOT NULL DEFAULT 0,
+  `copied` int NOT NULL DEFAULT 0,
+  `errors` longtext NOT NULL,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  `finished_at` timestamp NULL
+);
+
+ALTER TABLE `content_copy_jobs` ADD FOREIGN KEY (`organization_id`) REFERENCES `organizations` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
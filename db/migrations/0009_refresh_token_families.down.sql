@@ -0,0 +1,10 @@
+-- Rotated tokens must not become valid again.
+DELETE FROM `refresh_sessions` WHERE `rotated_at` IS NOT NULL;
+
+DROP INDEX `refresh_sessions_expires_at` ON `refresh_sessions`;
+
+DROP INDEX `refresh_sessions_family_id` ON `refresh_sessions`;
+
+ALTER TABLE `refresh_sessions` DROP COLUMN `rotated_at`;
+
+ALTER TABLE `refresh_sessions` DROP COLUMN `family_id`;
@@ -0,0 +1,10 @@
+ALTER TABLE `refresh_sessions` ADD COLUMN `family_id` varchar(64) NOT NULL DEFAULT "" AFTER `user_id`;
+
+ALTER TABLE `refresh_sessions` ADD COLUMN `rotated_at` timestamp NULL AFTER `expires_at`;
+
+-- Every existing session starts its own family.
+UPDATE `refresh_sessions` SET `family_id` = CONCAT("legacy-", `id`);
+
+CREATE INDEX `refresh_sessions_family_id` ON `refresh_sessions` (`family_id`);
+
+CREATE INDEX `refresh_sessions_expires_at` ON `refresh_sessions` (`expires_at`);
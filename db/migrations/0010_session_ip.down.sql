@@ -0,0 +1,3 @@
+DROP INDEX `refresh_sessions_user_id_rotated_at` ON `refresh_sessions`;
+
+ALTER TABLE `refresh_sessions` DROP COLUMN `ip`;
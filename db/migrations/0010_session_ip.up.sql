@@ -0,0 +1,3 @@
+ALTER TABLE `refresh_sessions` ADD COLUMN `ip` varchar(64) NOT NULL DEFAULT "" AFTER `ua`;
+
+CREATE INDEX `refresh_sessions_user_id_rotated_at` ON `refresh_sessions` (`user_id`, `rotated_at`);
@@ -0,0 +1,5 @@
+ALTER TABLE `organizations` DROP COLUMN `require_2fa`;
+
+DROP TABLE IF EXISTS `user_recovery_codes`;
+
+DROP TABLE IF EXISTS `user_totp`;
@@ -0,0 +1,23 @@
+CREATE TABLE `user_totp` (
+  `user_id` bigint PRIMARY KEY,
+  `secret` varchar(64) NOT NULL,
+  `last_used_step` bigint NOT NULL DEFAULT 0,
+  `enabled_at` timestamp NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE `user_totp` ADD FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE TABLE `user_recovery_codes` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `user_id` bigint NOT NULL,
+  `code_hash` varchar(64) NOT NULL,
+  `used_at` timestamp NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE `user_recovery_codes` ADD FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE INDEX `user_recovery_codes_user_id_code_hash` ON `user_recovery_codes` (`user_id`, `code_hash`);
+
+ALTER TABLE `organizations` ADD COLUMN `require_2fa` boolean NOT NULL DEFAULT false AFTER `status`;
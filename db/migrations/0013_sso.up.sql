@@ -0,0 +1,26 @@
+CREATE TABLE `organization_sso` (
+  `organization_id` bigint PRIMARY KEY,
+  `issuer` varchar(512) NOT NULL,
+  `client_id` varchar(256) NOT NULL,
+  `client_secret` varchar(512) NOT NULL,
+  `role_claim` varchar(128) NOT NULL DEFAULT "",
+  `role_mapping` text NOT NULL,
+  `default_role` ENUM ('owner', 'admin', 'editor', 'user'),
+  `enabled` boolean NOT NULL DEFAULT false,
+  `created_at` timestamp DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+ALTER TABLE `organization_sso` ADD FOREIGN KEY (`organization_id`) REFERENCES `organizations` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE TABLE `user_identities` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `user_id` bigint NOT NULL,
+  `issuer` varchar(512) NOT NULL,
+  `subject` varchar(255) NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE `user_identities` ADD FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE UNIQUE INDEX `user_identities_issuer_subject` ON `user_identities` (`issuer`(255), `subject`);
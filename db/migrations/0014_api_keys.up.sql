@@ -0,0 +1,19 @@
+CREATE TABLE `api_keys` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `user_id` bigint,
+  `organization_id` bigint,
+  `name` varchar(128) NOT NULL,
+  `prefix` varchar(16) NOT NULL,
+  `key_hash` varchar(64) UNIQUE NOT NULL,
+  `scopes` varchar(256) NOT NULL,
+  `expires_at` timestamp NULL,
+  `last_used_at` timestamp NULL,
+  `created_by` bigint,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE `api_keys` ADD FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+ALTER TABLE `api_keys` ADD FOREIGN KEY (`organization_id`) REFERENCES `organizations` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+ALTER TABLE `api_keys` ADD FOREIGN KEY (`created_by`) REFERENCES `users` (`id`) ON DELETE SET NULL ON UPDATE CASCADE;
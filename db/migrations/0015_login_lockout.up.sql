@@ -0,0 +1,3 @@
+ALTER TABLE `users` ADD COLUMN `failed_logins` int NOT NULL DEFAULT 0 AFTER `token_version`;
+
+ALTER TABLE `users` ADD COLUMN `locked_until` timestamp NULL AFTER `failed_logins`;
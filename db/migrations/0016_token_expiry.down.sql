@@ -0,0 +1,11 @@
+DROP INDEX `password_reset_expires_at` ON `password_reset`;
+
+ALTER TABLE `password_reset` DROP COLUMN `created_at`;
+
+ALTER TABLE `password_reset` DROP COLUMN `expires_at`;
+
+DROP INDEX `user_verifications_expires_at` ON `user_verifications`;
+
+ALTER TABLE `user_verifications` DROP COLUMN `created_at`;
+
+ALTER TABLE `user_verifications` DROP COLUMN `expires_at`;
@@ -0,0 +1,17 @@
+ALTER TABLE `user_verifications` ADD COLUMN `expires_at` timestamp NULL AFTER `status`;
+ALTER TABLE `user_verifications` ADD COLUMN `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER `expires_at`;
+
+-- Tokens of verified users are already used. Pending invites get the full lifetime.
+UPDATE `user_verifications` SET `token` = NULL WHERE `status` = "verified";
+UPDATE `user_verifications` SET `expires_at` = NOW() + INTERVAL 7 DAY WHERE `status` = "not_verified";
+
+CREATE INDEX `user_verifications_expires_at` ON `user_verifications` (`expires_at`);
+
+ALTER TABLE `password_reset` ADD COLUMN `expires_at` timestamp NULL AFTER `token`;
+ALTER TABLE `password_reset` ADD COLUMN `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER `expires_at`;
+
+UPDATE `password_reset` SET `expires_at` = NOW() + INTERVAL 1 HOUR;
+
+ALTER TABLE `password_reset` MODIFY `expires_at` timestamp NOT NULL;
+
+CREATE INDEX `password_reset_expires_at` ON `password_reset` (`expires_at`);
@@ -0,0 +1,11 @@
+CREATE TABLE `signing_keys` (
+  `id` varchar(64) PRIMARY KEY,
+  `algorithm` varchar(16) NOT NULL,
+  `private_key` blob NOT NULL,
+  `active_from` timestamp NOT NULL,
+  `retire_at` timestamp NOT NULL,
+  `expires_at` timestamp NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX `signing_keys_expires_at` ON `signing_keys` (`expires_at`);
@@ -0,0 +1 @@
+ALTER TABLE `audit_log` ADD COLUMN `impersonator_id` bigint AFTER `actor_id`;
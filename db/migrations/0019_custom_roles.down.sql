@@ -0,0 +1,5 @@
+ALTER TABLE `organizations_users` DROP FOREIGN KEY `organizations_users_role_id`;
+
+ALTER TABLE `organizations_users` DROP COLUMN `role_id`;
+
+DROP TABLE IF EXISTS `organization_roles`;
@@ -0,0 +1,15 @@
+CREATE TABLE `organization_roles` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `organization_id` bigint NOT NULL,
+  `name` varchar(64) NOT NULL,
+  `permissions` varchar(1024) NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  UNIQUE (`organization_id`, `name`)
+);
+
+ALTER TABLE `organization_roles` ADD FOREIGN KEY (`organization_id`) REFERENCES `organizations` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+ALTER TABLE `organizations_users` ADD COLUMN `role_id` bigint AFTER `role`;
+
+ALTER TABLE `organizations_users` ADD CONSTRAINT `organizations_users_role_id` FOREIGN KEY (`role_id`) REFERENCES `organization_roles` (`id`) ON DELETE SET NULL ON UPDATE CASCADE;
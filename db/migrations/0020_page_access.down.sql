@@ -0,0 +1,3 @@
+ALTER TABLE `pages` DROP COLUMN `restricted`;
+
+DROP TABLE IF EXISTS `page_access`;
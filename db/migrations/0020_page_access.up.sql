@@ -0,0 +1,17 @@
+CREATE TABLE `page_access` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `page_id` bigint NOT NULL,
+  `user_id` bigint,
+  `role` ENUM ('owner', 'admin', 'editor', 'user'),
+  `role_id` bigint,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (`page_id`)
+);
+
+ALTER TABLE `page_access` ADD FOREIGN KEY (`page_id`) REFERENCES `pages` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+ALTER TABLE `page_access` ADD FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+ALTER TABLE `page_access` ADD FOREIGN KEY (`role_id`) REFERENCES `organization_roles` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+ALTER TABLE `pages` ADD COLUMN `restricted` boolean NOT NULL DEFAULT false AFTER `draft`;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `passkeys`;
+
+DROP TABLE IF EXISTS `magic_links`;
@@ -0,0 +1,22 @@
+CREATE TABLE `magic_links` (
+  `id` bigint PRIMARY KEY,
+  `token_hash` varchar(64) UNIQUE NOT NULL,
+  `expires_at` timestamp NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (`expires_at`)
+);
+
+ALTER TABLE `magic_links` ADD FOREIGN KEY (`id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE TABLE `passkeys` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `user_id` bigint NOT NULL,
+  `credential_id` varbinary(1023) UNIQUE NOT NULL,
+  `public_key` blob NOT NULL,
+  `sign_count` int unsigned NOT NULL DEFAULT 0,
+  `name` varchar(64) NOT NULL,
+  `last_used_at` timestamp NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE `passkeys` ADD FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
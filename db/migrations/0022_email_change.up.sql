@@ -0,0 +1,15 @@
+CREATE TABLE `email_changes` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `user_id` bigint NOT NULL,
+  `old_email` varchar(256) NOT NULL,
+  `new_email` varchar(256) NOT NULL,
+  `token_hash` varchar(64) UNIQUE NULL,
+  `revert_token_hash` varchar(64) UNIQUE NOT NULL,
+  `expires_at` timestamp NOT NULL,
+  `revert_expires_at` timestamp NOT NULL,
+  `confirmed_at` timestamp NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (`revert_expires_at`)
+);
+
+ALTER TABLE `email_changes` ADD FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
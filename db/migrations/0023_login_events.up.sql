@@ -0,0 +1,14 @@
+CREATE TABLE `login_events` (
+  `id` bigint PRIMARY KEY AUTO_INCREMENT,
+  `user_id` bigint NOT NULL,
+  `method` varchar(32) NOT NULL,
+  `success` boolean NOT NULL,
+  `error` varchar(256),
+  `ua` varchar(256) NOT NULL,
+  `ip` varchar(64) NOT NULL,
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (`user_id`, `id`),
+  INDEX (`created_at`)
+);
+
+ALTER TABLE `login_events` ADD FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
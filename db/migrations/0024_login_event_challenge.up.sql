@@ -0,0 +1 @@
+ALTER TABLE `login_events` ADD COLUMN `challenge` boolean NOT NULL DEFAULT false AFTER `success`;
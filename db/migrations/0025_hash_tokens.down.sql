@@ -0,0 +1,6 @@
+-- Hashes can't be turned back into tokens, pending links have to be sent again.
+ALTER TABLE `password_reset` CHANGE `token_hash` `token` varchar(256);
+DELETE FROM `password_reset`;
+
+ALTER TABLE `user_verifications` CHANGE `token_hash` `token` varchar(256);
+UPDATE `user_verifications` SET `token` = NULL;
@@ -0,0 +1,7 @@
+-- Verification and password reset tokens are stored as SHA-256 hashes like magic links.
+-- Tokens are hashed in place, so links which were already sent keep working.
+UPDATE `user_verifications` SET `token` = SHA2(`token`, 256) WHERE `token` IS NOT NULL;
+ALTER TABLE `user_verifications` CHANGE `token` `token_hash` varchar(64);
+
+UPDATE `password_reset` SET `token` = SHA2(`token`, 256) WHERE `token` IS NOT NULL;
+ALTER TABLE `password_reset` CHANGE `token` `token_hash` varchar(64);
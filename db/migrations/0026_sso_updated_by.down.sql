@@ -0,0 +1,3 @@
+ALTER TABLE `organization_sso` DROP FOREIGN KEY `organization_sso_updated_by`;
+
+ALTER TABLE `organization_sso` DROP COLUMN `updated_by`;
@@ -0,0 +1,4 @@
+-- Roles granted by SSO are limited by the permissions of the user who saved the config.
+ALTER TABLE `organization_sso` ADD COLUMN `updated_by` bigint NULL AFTER `enabled`;
+
+ALTER TABLE `organization_sso` ADD CONSTRAINT `organization_sso_updated_by` FOREIGN KEY (`updated_by`) REFERENCES `users` (`id`) ON DELETE SET NULL ON UPDATE CASCADE;
@@ -10,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	schema "bitbucket.org/ibros_nsk/krisenkompass-backend/db"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/config"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/handler"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
@@ -28,7 +29,13 @@ func Run() {
 	multitemplate.AddTemplate("userVerification", "email", "userVerification.html")
 	multitemplate.AddTemplate("userVerificationWithInvite", "email", "userVerificationWithInvite.html")
 	multitemplate.AddTemplate("userPasswordReset", "email", "userPasswordReset.html")
+	multitemplate.AddTemplate("userMagicLink", "email", "userMagicLink.html")
+	multitemplate.AddTemplate("userEmailChange", "email", "userEmailChange.html")
+	multitemplate.AddTemplate("userEmailChangeNotice", "email", "userEmailChangeNotice.html")
+	multitemplate.AddTemplate("userEmailChangeTaken", "email", "userEmailChangeTaken.html")
+	multitemplate.AddTemplate("userLoginAlert", "email", "userLoginAlert.html")
 	multitemplate.AddTemplate("userInvite", "email", "userInvite.html")
+	multitemplate.AddTemplate("userAccountLocked", "email", "userAccountLocked.html")
 
 	db, err := repository.NewMariaDB(cfg.Database)
 	if err != nil {
@@ -37,11 +44,61 @@ func Run() {
 		log.Printf("DB connection established")
 	}
 
+	migrator, err := schema.NewMigrator(db.DB)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	// Unknown schema version means the database was migrated by a newer version of the application.
+	applied, err := migrator.Up()
+	if err != nil {
+		log.Fatalf("Failed to migrate DB: %v", err)
+	}
+	for _, migration := range applied {
+		log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+	}
+
 	cache := cache.NewMemoryCache()
 	repos := repository.NewRepository(db)
 	service := service.NewService(repos, cache)
 	handlers := handler.NewHandler(service)
 
+	// Signing keys are rotated by every instance, the first key is created before the
+	// server starts.
+	err = service.SigningKey.Rotate()
+	if err != nil {
+		log.Fatalf("Failed to rotate signing keys: %v", err)
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := service.SigningKey.Rotate()
+			if err != nil {
+				log.Println("Failed to rotate signing keys: ", err)
+			}
+		}
+	}()
+
+	// Expired refresh sessions and tokens are removed periodically.
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			err := service.Auth.CleanupSessions()
+			if err != nil {
+				log.Println("Failed to clean up sessions: ", err)
+			}
+			err = service.Auth.CleanupTokens()
+			if err != nil {
+				log.Println("Failed to clean up tokens: ", err)
+			}
+			<-ticker.C
+		}
+	}()
+
 	r := handlers.InitRoutes()
 
 	srv := server.NewServer(cfg, r)
@@ -8,13 +8,17 @@ import (
 )
 
 // Checks if user is one of specified types. If user types are not specified then user
-// will be tested for having "superadmin" type.
+// will be tested for having "superadmin" type. API keys are always denied.
 func Authorize(c context.Context, types ...string) (*domain.Claims, error) {
 	claims, ok := c.Value(domain.UserClaimsKey).(*domain.Claims)
 	if !ok {
 		return claims, errors.New("access denied")
 	}
 
+	if claims.APIKeyID != 0 {
+		return claims, errors.New("access denied")
+	}
+
 	if claims.Type == "superadmin" {
 		return claims, nil
 	}
@@ -28,23 +32,49 @@ func Authorize(c context.Context, types ...string) (*domain.Claims, error) {
 	return claims, errors.New("access denied")
 }
 
-func AuthorizeOrganization(c context.Context, organizationID int64, role string) (*domain.Claims, error) {
+// AuthorizeOrganization checks if user has the permission in the organization. API keys
+// are allowed only if they have one of the scopes.
+func AuthorizeOrganization(c context.Context, organizationID int64, permission string, scopes ...string) (*domain.Claims, error) {
 	claims, ok := c.Value(domain.UserClaimsKey).(*domain.Claims)
 	if !ok {
 		return nil, errors.New("access denied")
 	}
 
-	if claims.Roles[organizationID] == "owner" {
-		return claims, nil
-	} else if claims.Roles[organizationID] == "admin" && role != "owner" {
-		return claims, nil
-	} else if claims.Roles[organizationID] == "editor" && role != "owner" && role != "admin" {
-		return claims, nil
-	} else if claims.Roles[organizationID] == "user" && role == "user" {
-		return claims, nil
-	} else if claims.Type == "superadmin" {
+	if claims.APIKeyID != 0 && !hasScope(claims, scopes) {
+		return nil, errors.New("access denied")
+	}
+
+	if claims.Type == "superadmin" {
 		return claims, nil
 	}
 
+	for _, p := range claims.Permissions[organizationID] {
+		if p == permission {
+			return claims, nil
+		}
+	}
+
 	return nil, errors.New("access denied")
 }
+
+// NotImpersonated denies sensitive actions, like password or second factor changes, to
+// superadmins impersonating the user. Such actions can be done only by the user.
+func NotImpersonated(c context.Context) error {
+	claims, ok := c.Value(domain.UserClaimsKey).(*domain.Claims)
+	if ok && claims.ImpersonatorID != 0 {
+		return errors.New("not allowed while impersonating")
+	}
+
+	return nil
+}
+
+func hasScope(claims *domain.Claims, scopes []string) bool {
+	for _, scope := range scopes {
+		for _, s := range claims.Scopes {
+			if s == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package authorize
+
+import (
+	"context"
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	claims := &domain.Claims{
+		UserID:      1,
+		Type:        "user",
+		Roles:       map[int64]string{10: "editor"},
+		Permissions: map[int64][]string{10: domain.RolePermissions["editor"]},
+		APIKeyID:    5,
+		Scopes:      []string{domain.ScopeContentRead},
+	}
+	ctx := context.WithValue(context.Background(), domain.UserClaimsKey, claims)
+
+	_, err := AuthorizeOrganization(ctx, 10, domain.PermissionPagesRead, domain.ScopeContentRead)
+	if err != nil {
+		t.Errorf("Key with the scope must be allowed: %v", err)
+	}
+
+	_, err = AuthorizeOrganization(ctx, 10, domain.PermissionAddressesManage, domain.ScopeAddressesWrite)
+	if err == nil {
+		t.Errorf("Key without the scope must be denied")
+	}
+
+	_, err = AuthorizeOrganization(ctx, 10, domain.PermissionPagesRead)
+	if err == nil {
+		t.Errorf("Key must be denied for operations without scope")
+	}
+
+	_, err = Authorize(ctx, "user")
+	if err == nil {
+		t.Errorf("Key must be denied for user operations")
+	}
+
+	claims.APIKeyID = 0
+	_, err = AuthorizeOrganization(ctx, 10, domain.PermissionPagesWrite)
+	if err != nil {
+		t.Errorf("Access token must not be limited by scopes: %v", err)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	claims := &domain.Claims{
+		UserID:      1,
+		Type:        "user",
+		Roles:       map[int64]string{10: "user"},
+		Permissions: map[int64][]string{10: {domain.PermissionPagesRead, domain.PermissionAddressesManage}},
+	}
+	ctx := context.WithValue(context.Background(), domain.UserClaimsKey, claims)
+
+	_, err := AuthorizeOrganization(ctx, 10, domain.PermissionAddressesManage)
+	if err != nil {
+		t.Errorf("Member with the permission must be allowed: %v", err)
+	}
+
+	_, err = AuthorizeOrganization(ctx, 10, domain.PermissionPagesWrite)
+	if err == nil {
+		t.Errorf("Member without the permission must be denied")
+	}
+
+	_, err = AuthorizeOrganization(ctx, 11, domain.PermissionPagesRead)
+	if err == nil {
+		t.Errorf("Permissions of other organization must be denied")
+	}
+
+	claims.Type = "superadmin"
+	_, err = AuthorizeOrganization(ctx, 11, domain.PermissionOrganizationDelete)
+	if err != nil {
+		t.Errorf("Superadmin must be allowed: %v", err)
+	}
+}
+
+func TestNotImpersonated(t *testing.T) {
+	claims := &domain.Claims{UserID: 1, Type: "user"}
+	ctx := context.WithValue(context.Background(), domain.UserClaimsKey, claims)
+
+	err := NotImpersonated(ctx)
+	if err != nil {
+		t.Errorf("User must be allowed: %v", err)
+	}
+
+	claims.ImpersonatorID = 2
+	_, err = Authorize(ctx, "user")
+	if err != nil {
+		t.Errorf("Impersonating superadmin must act as the user: %v", err)
+	}
+	err = NotImpersonated(ctx)
+	if err == nil {
+		t.Errorf("Sensitive actions must be denied while impersonating")
+	}
+}
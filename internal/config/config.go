@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"sync"
 )
 
 type DatabaseConfig struct {
@@ -15,14 +16,21 @@ type DatabaseConfig struct {
 
 type Config struct {
 	App struct {
-		Mode      string   `json:"mode"`
-		Key       []byte   `json:"key"`
-		Languages []string `json:"languages"`
-		Client    string   `json:"client"`
+		Mode string `json:"mode"`
+		// Key encrypts signing keys of access tokens.
+		Key []byte `json:"key"`
+		// SigningAlgorithm of access tokens, RS256 or EdDSA. Change takes effect on the
+		// next key rotation.
+		SigningAlgorithm string   `json:"signingAlgorithm"`
+		Languages        []string `json:"languages"`
+		Client           string   `json:"client"`
 	} `json:"app"`
 	Server struct {
 		Host string `json:"host"`
 		Port string `json:"port"`
+		// TrustedProxies are IPs or CIDR ranges of reverse proxies. Client IP is taken
+		// from X-Forwarded-For and X-Real-IP only if the request comes from one of them.
+		TrustedProxies []string `json:"trustedProxies"`
 	} `json:"server"`
 	Database DatabaseConfig `json:"database"`
 	Mail     struct {
@@ -39,11 +47,10 @@ type Config struct {
 	} `json:"services"`
 }
 
-var config *Config
-
-func init() {
-	config = loadConfig("../../config.json")
-}
+var (
+	config     *Config
+	configOnce sync.Once
+)
 
 func loadConfig(file string) *Config {
 	f, err := os.Open(file)
@@ -60,6 +67,12 @@ func loadConfig(file string) *Config {
 	return config
 }
 
+// Get returns application config. Config is loaded on the first call, so packages can be
+// imported by tests without config file.
 func Get() *Config {
+	configOnce.Do(func() {
+		config = loadConfig("../../config.json")
+	})
+
 	return config
 }
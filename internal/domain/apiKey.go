@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// Scopes of API keys. Operations which are not available for any scope can't be
+// called with API keys.
+const (
+	ScopeContentRead    = "content:read"
+	ScopeAddressesWrite = "addresses:write"
+	ScopeFilesWrite     = "files:write"
+)
+
+var APIKeyScopes = []string{ScopeContentRead, ScopeAddressesWrite, ScopeFilesWrite}
+
+// APIKey is a personal access token of the user if UserID is set, otherwise a key of
+// the organization. Only hash of the key is saved.
+type APIKey struct {
+	ID             int64     `db:"id" json:"id"`
+	UserID         null.Int  `db:"user_id" json:"userID"`
+	OrganizationID null.Int  `db:"organization_id" json:"organizationID"`
+	Name           string    `db:"name" json:"name"`
+	Prefix         string    `db:"prefix" json:"prefix"`
+	KeyHash        string    `db:"key_hash" json:"-"`
+	Scopes         string    `db:"scopes" json:"scopes"` // Comma separated.
+	ExpiresAt      null.Time `db:"expires_at" json:"expiresAt"`
+	LastUsedAt     null.Time `db:"last_used_at" json:"lastUsedAt"`
+	CreatedBy      null.Int  `db:"created_by" json:"createdBy"`
+	CreatedAt      time.Time `db:"created_at" json:"createdAt"`
+}
+
+// NewAPIKey is returned once after creation, the key can't be shown later.
+type NewAPIKey struct {
+	APIKey APIKey `json:"apiKey"`
+	Key    string `json:"key"`
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+type AuditEntry struct {
+	ID             int64     `db:"id" json:"id"`
+	OrganizationID null.Int  `db:"organization_id" json:"organizationID"`
+	ActorID        null.Int  `db:"actor_id" json:"actorID"`
+	ImpersonatorID null.Int  `db:"impersonator_id" json:"impersonatorID"`
+	Action         string    `db:"action" json:"action"`
+	EntityType     string    `db:"entity_type" json:"entityType"`
+	EntityID       null.Int  `db:"entity_id" json:"entityID"`
+	Diff           string    `db:"diff" json:"diff"`
+	CreatedAt      time.Time `db:"created_at" json:"createdAt"`
+}
+
+type AuditFilter struct {
+	ActorID    null.Int
+	Action     null.String
+	EntityType null.String
+	EntityID   null.Int
+	From       null.Time
+	To         null.Time
+}
@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// CopyJobStaleAfter is time without progress after which unfinished copy job is
+// considered crashed, e.g. because the server was restarted, and can be run again.
+const CopyJobStaleAfter = 30 * time.Minute
+
+type ContentCopyJob struct {
+	ID             int64     `db:"id" json:"id"`
+	OrganizationID int64     `db:"organization_id" json:"organizationID"`
+	Plan           string    `db:"plan" json:"plan"`
+	Mode           string    `db:"mode" json:"mode"`
+	Status         string    `db:"status" json:"status"`
+	Total          int       `db:"total" json:"total"`
+	Copied         int       `db:"copied" json:"copied"`
+	Errors         string    `db:"errors" json:"-"`
+	CreatedAt      time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updatedAt"`
+	FinishedAt     null.Time `db:"finished_at" json:"finishedAt"`
+}
+
+// Stale reports whether the job is running or pending without progress for too long.
+func (j ContentCopyJob) Stale() bool {
+	if j.Status != "running" && j.Status != "pending" {
+		return false
+	}
+
+	return time.Since(j.UpdatedAt) > CopyJobStaleAfter
+}
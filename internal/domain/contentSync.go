@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// Link between organization page and the default page it was copied from.
+type PageSource struct {
+	ID             int64     `db:"id" json:"id"`
+	OrganizationID int64     `db:"organization_id" json:"organizationID"`
+	PageID         null.Int  `db:"page_id" json:"pageID"`
+	SourcePageID   null.Int  `db:"source_page_id" json:"sourcePageID"`
+	SourceHash     string    `db:"source_hash" json:"sourceHash"`
+	LocalHash      string    `db:"local_hash" json:"localHash"`
+	SyncedAt       time.Time `db:"synced_at" json:"syncedAt"`
+}
+
+type BlockSource struct {
+	BlockID       int64    `db:"block_id" json:"blockID"`
+	SourceBlockID null.Int `db:"source_block_id" json:"sourceBlockID"`
+}
+
+type SyncChange struct {
+	SourcePageID null.Int          `json:"sourcePageID"`
+	PageID       null.Int          `json:"pageID"`
+	Title        string            `json:"title"`
+	Action       string            `json:"action"`
+	Applied      bool              `json:"applied"`
+	Fields       []SyncFieldChange `json:"fields"`
+}
+
+type SyncFieldChange struct {
+	BlockID       null.Int    `json:"blockID"`
+	SourceBlockID null.Int    `json:"sourceBlockID"`
+	Field         string      `json:"field"`
+	Before        null.String `json:"before"`
+	After         null.String `json:"after"`
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// Handbook is published content of an organization prepared for offline use.
+type Handbook struct {
+	Organization Organization
+	LanguageTag  string
+	Pages        []HandbookPage
+	Addresses    []Address
+	CreatedAt    time.Time
+}
+
+type HandbookPage struct {
+	Page      Page
+	Blocks    []Block
+	File      *FileBlock
+	Childrens []HandbookPage
+}
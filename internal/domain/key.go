@@ -4,4 +4,6 @@ type key int
 
 const (
 	UserClaimsKey key = iota
+	RequestInfoKey
+	ImpersonatorIDKey
 )
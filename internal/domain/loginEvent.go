@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// Login methods recorded in login history.
+const (
+	LoginMethodPassword  = "password"
+	LoginMethodRefresh   = "refresh"
+	LoginMethodMagicLink = "magic_link"
+	LoginMethodPasskey   = "passkey"
+	LoginMethodSSO       = "sso"
+	// Verification link sets password and logs the new user in.
+	LoginMethodVerification = "verification"
+)
+
+// LoginEvent is a successful or failed login of the user. Error is set for failed logins.
+// Challenge is set if the first factor was correct and the second one was requested,
+// such login is successful only after another event.
+type LoginEvent struct {
+	ID        int64       `db:"id" json:"id"`
+	UserID    int64       `db:"user_id" json:"userID"`
+	Method    string      `db:"method" json:"method"`
+	Success   bool        `db:"success" json:"success"`
+	Challenge bool        `db:"challenge" json:"challenge"`
+	Error     null.String `db:"error" json:"error"`
+	UA        string      `db:"ua" json:"ua"`
+	IP        string      `db:"ip" json:"ip"`
+	CreatedAt time.Time   `db:"created_at" json:"createdAt"`
+}
@@ -17,6 +17,7 @@ type Organization struct {
 	InvoiceAddress string      `db:"invoice_address" json:"invoiceAddress"`
 	Plan           string      `db:"plan" json:"plan"`
 	Status         string      `db:"status" json:"status"`
+	Require2FA     bool        `db:"require_2fa" json:"require2FA"`
 	CreatedAt      time.Time   `db:"created_at" json:"createdAt"`
 	UpdatedAt      time.Time   `db:"updated_at" json:"updatedAt"`
 }
@@ -1,7 +1,22 @@
 package domain
 
+import "gopkg.in/guregu/null.v4"
+
+// OrganizationUser is a member of the organization. Member with a custom role has the
+// "user" role and only permissions of the custom role.
 type OrganizationUser struct {
-	OrganizationID int64  `db:"organization_id" json:"organizationID"`
-	UserID         int64  `db:"user_id" json:"userID"`
-	Role           string `db:"role" json:"role"`
+	OrganizationID    int64       `db:"organization_id" json:"organizationID"`
+	UserID            int64       `db:"user_id" json:"userID"`
+	Role              string      `db:"role" json:"role"`
+	RoleID            null.Int    `db:"role_id" json:"roleID"`
+	CustomRole        null.String `db:"custom_role" json:"customRole"`
+	CustomPermissions null.String `db:"custom_permissions" json:"-"`
+}
+
+// Permissions returns permissions of the custom role if it's set, otherwise of the role.
+func (u OrganizationUser) Permissions() []string {
+	if u.RoleID.Valid {
+		return splitPermissions(u.CustomPermissions)
+	}
+	return RolePermissions[u.Role]
 }
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// PageAccess allows a user, built-in role or custom role to see the restricted page.
+// Exactly one of UserID, Role and RoleID is set.
+type PageAccess struct {
+	ID        int64       `db:"id" json:"id"`
+	PageID    int64       `db:"page_id" json:"pageID"`
+	UserID    null.Int    `db:"user_id" json:"userID"`
+	Role      null.String `db:"role" json:"role"`
+	RoleID    null.Int    `db:"role_id" json:"roleID"`
+	CreatedAt time.Time   `db:"created_at" json:"createdAt"`
+}
+
+// PageViewer is a member of the organization whose access to the pages is checked.
+type PageViewer struct {
+	UserID int64
+	Role   string
+	RoleID null.Int
+}
+
+// Allows reports whether the entry gives access to the viewer.
+func (a PageAccess) Allows(viewer PageViewer) bool {
+	switch {
+	case a.UserID.Valid:
+		return viewer.UserID != 0 && a.UserID.Int64 == viewer.UserID
+	case a.RoleID.Valid:
+		return viewer.RoleID.Valid && a.RoleID.Int64 == viewer.RoleID.Int64
+	case a.Role.Valid:
+		return !viewer.RoleID.Valid && a.Role.String == viewer.Role
+	}
+	return false
+}
+
+// PageRestrictions tells which pages of the organization are hidden from the viewer.
+// Zero value hides nothing.
+type PageRestrictions struct {
+	Hidden map[int64]bool
+}
+
+func (r PageRestrictions) Allowed(pageID int64) bool {
+	return !r.Hidden[pageID]
+}
+
+// Filter drops hidden pages.
+func (r PageRestrictions) Filter(pages []Page) []Page {
+	if len(r.Hidden) == 0 {
+		return pages
+	}
+
+	result := make([]Page, 0, len(pages))
+	for _, page := range pages {
+		if r.Allowed(page.ID) {
+			result = append(result, page)
+		}
+	}
+	return result
+}
@@ -0,0 +1,20 @@
+package domain
+
+// PageTreeVersion is the version of the page tree format. It is increased when the
+// format is changed in an incompatible way.
+const PageTreeVersion = 1
+
+// PageTree is a page with all childrens and referenced storage files, used to move
+// content between organizations and instances.
+type PageTree struct {
+	Version int               `json:"version"`
+	Root    PageTreeNode      `json:"root"`
+	Files   map[string]string `json:"files"` // Base64 content by storage path.
+}
+
+type PageTreeNode struct {
+	Page      Page           `json:"page"`
+	Blocks    []Block        `json:"blocks"`
+	File      *FileBlock     `json:"file"`
+	Childrens []PageTreeNode `json:"childrens"`
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// Passkey is a WebAuthn credential of the user.
+type Passkey struct {
+	ID           int64     `db:"id" json:"id"`
+	UserID       int64     `db:"user_id" json:"userID"`
+	CredentialID []byte    `db:"credential_id" json:"-"`
+	PublicKey    []byte    `db:"public_key" json:"-"`
+	SignCount    uint32    `db:"sign_count" json:"-"`
+	Name         string    `db:"name" json:"name"`
+	LastUsedAt   null.Time `db:"last_used_at" json:"lastUsedAt"`
+	CreatedAt    time.Time `db:"created_at" json:"createdAt"`
+}
+
+// PasskeyLogin is returned when passkey login starts. Options are passed to
+// navigator.credentials.get, challenge token identifies the login when it's finished.
+type PasskeyLogin struct {
+	ChallengeToken string `json:"challengeToken"`
+	Options        string `json:"options"`
+}
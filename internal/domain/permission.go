@@ -0,0 +1,131 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// Permissions of organization members. Built-in roles and custom roles of organizations
+// are sets of them.
+const (
+	PermissionPagesRead            = "pages.read"
+	PermissionPagesWrite           = "pages.write"
+	PermissionPagesPublish         = "pages.publish"
+	PermissionPagesRestrict        = "pages.restrict"
+	PermissionFilesRead            = "files.read"
+	PermissionFilesUpload          = "files.upload"
+	PermissionFilesManage          = "files.manage"
+	PermissionAddressesRead        = "addresses.read"
+	PermissionAddressesManage      = "addresses.manage"
+	PermissionUsersRead            = "users.read"
+	PermissionUsersInvite          = "users.invite"
+	PermissionUsersManage          = "users.manage"
+	PermissionRolesManage          = "roles.manage"
+	PermissionOrganizationUpdate   = "organization.update"
+	PermissionOrganizationSecurity = "organization.security"
+	PermissionOrganizationDelete   = "organization.delete"
+	PermissionContentSync          = "content.sync"
+	PermissionAuditRead            = "audit.read"
+)
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// PermissionCatalog lists all permissions which can be given to custom roles.
+var PermissionCatalog = []Permission{
+	{PermissionPagesRead, "Read published pages and blocks, search and export the handbook."},
+	{PermissionPagesWrite, "Create, edit and delete pages and blocks, see drafts and revisions."},
+	{PermissionPagesPublish, "Publish drafts of pages."},
+	{PermissionPagesRestrict, "Restrict pages to users or roles and see all restricted pages."},
+	{PermissionFilesRead, "List files of the organization."},
+	{PermissionFilesUpload, "Upload files to the organization."},
+	{PermissionFilesManage, "Create folders, rename and delete files."},
+	{PermissionAddressesRead, "Read the address book."},
+	{PermissionAddressesManage, "Create, edit, sort and delete addresses."},
+	{PermissionUsersRead, "See members of the organization."},
+	{PermissionUsersInvite, "Invite users to the organization."},
+	{PermissionUsersManage, "Change roles of members and remove them."},
+	{PermissionRolesManage, "Create, edit and delete custom roles."},
+	{PermissionOrganizationUpdate, "Edit details of the organization."},
+	{PermissionOrganizationSecurity, "Manage single sign-on, two-factor requirement and API keys."},
+	{PermissionOrganizationDelete, "Delete the organization."},
+	{PermissionContentSync, "Sync default content into the organization."},
+	{PermissionAuditRead, "Read the audit log."},
+}
+
+var userPermissions = []string{
+	PermissionPagesRead,
+	PermissionFilesRead,
+	PermissionFilesUpload,
+	PermissionAddressesRead,
+	PermissionUsersRead,
+}
+
+var editorPermissions = withPermissions(userPermissions,
+	PermissionPagesWrite,
+	PermissionFilesManage,
+	PermissionAddressesManage,
+	PermissionOrganizationUpdate,
+)
+
+var adminPermissions = withPermissions(editorPermissions,
+	PermissionPagesPublish,
+	PermissionPagesRestrict,
+	PermissionUsersInvite,
+	PermissionUsersManage,
+	PermissionRolesManage,
+	PermissionOrganizationSecurity,
+	PermissionContentSync,
+	PermissionAuditRead,
+)
+
+var ownerPermissions = withPermissions(adminPermissions,
+	PermissionOrganizationDelete,
+)
+
+// RolePermissions are permissions of built-in roles. Every role has all permissions of
+// the roles below it.
+var RolePermissions = map[string][]string{
+	"user":   userPermissions,
+	"editor": editorPermissions,
+	"admin":  adminPermissions,
+	"owner":  ownerPermissions,
+}
+
+func withPermissions(base []string, permissions ...string) []string {
+	return append(append([]string{}, base...), permissions...)
+}
+
+func IsPermission(name string) bool {
+	for _, permission := range PermissionCatalog {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// OrganizationRole is a custom role of the organization.
+type OrganizationRole struct {
+	ID             int64     `db:"id" json:"id"`
+	OrganizationID int64     `db:"organization_id" json:"organizationID"`
+	Name           string    `db:"name" json:"name"`
+	Permissions    string    `db:"permissions" json:"permissions"` // Comma separated.
+	CreatedAt      time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+func (r OrganizationRole) PermissionList() []string {
+	return splitPermissions(null.StringFrom(r.Permissions))
+}
+
+func splitPermissions(permissions null.String) []string {
+	if !permissions.Valid || permissions.String == "" {
+		return []string{}
+	}
+	return strings.Split(permissions.String, ",")
+}
@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+type Revision struct {
+	ID        int64     `db:"id" json:"id"`
+	PageID    int64     `db:"page_id" json:"pageID"`
+	BlockID   null.Int  `db:"block_id" json:"blockID"`
+	Data      string    `db:"data" json:"-"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
+// Snapshot of a page and its block set at the moment the revision was created.
+type RevisionData struct {
+	Page   Page       `json:"page"`
+	Blocks []Block    `json:"blocks"`
+	File   *FileBlock `json:"file,omitempty"`
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "gopkg.in/guregu/null.v4"
+
+type SearchHit struct {
+	OrganizationID null.Int    `db:"organization_id" json:"organizationID"`
+	PageID         int64       `db:"page_id" json:"pageID"`
+	BlockID        null.Int    `db:"block_id" json:"blockID"`
+	Title          string      `db:"title" json:"title"`
+	Content        null.String `db:"content" json:"-"`
+	Score          float64     `db:"score" json:"score"`
+	Snippet        string      `db:"-" json:"snippet"`
+	Link           string      `db:"-" json:"link"`
+	Breadcrumbs    []Page      `db:"-" json:"breadcrumbs"`
+}
@@ -4,26 +4,73 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/guregu/null.v4"
 )
 
+// Tokens are returned after login. If second factor is needed, only ChallengeToken is
+// set and TwoFactor tells whether the user has to enter a code ("required") or set up
+// TOTP first ("enrollment_required").
 type Tokens struct {
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
+	AccessToken    string   `json:"accessToken"`
+	RefreshToken   string   `json:"refreshToken"`
+	ChallengeToken string   `json:"challengeToken,omitempty"`
+	TwoFactor      string   `json:"twoFactor,omitempty"`
+	RecoveryCodes  []string `json:"recoveryCodes,omitempty"`
 }
 
 type Claims struct {
-	UserID int64            `json:"userID"`
-	Roles  map[int64]string `json:"roles"`
-	Type   string           `json:"type"`
+	UserID       int64            `json:"userID"`
+	Roles        map[int64]string `json:"roles"`
+	Type         string           `json:"type"`
+	SessionID    string           `json:"sid,omitempty"` // Family of the refresh token.
+	TokenVersion int64            `json:"tv"`
+	// ImpersonatorID is the superadmin acting as the user. Set only in impersonation tokens.
+	ImpersonatorID int64 `json:"imp,omitempty"`
+	// Permissions by organization. They are not saved in the token, current permissions
+	// are set on every request.
+	Permissions map[int64][]string `json:"-"`
+	APIKeyID    int64              `json:"-"`
+	Scopes      []string           `json:"-"` // Scopes of the API key.
 	jwt.StandardClaims
 }
 
+// UserAccess is the current state of user permissions. Claims of access tokens are
+// replaced with it on every request.
+type UserAccess struct {
+	TokenVersion int64
+	Type         string
+	Roles        map[int64]string
+	Permissions  map[int64][]string
+}
+
+// RequestInfo describes the client which made the request.
+type RequestInfo struct {
+	IP          string
+	UserAgent   string
+	Fingerprint string
+}
+
 type RefreshSession struct {
 	ID           int64     `db:"id" json:"id"`
 	UserID       int64     `db:"user_id" json:"userID"`
+	FamilyID     string    `db:"family_id" json:"familyID"`
 	RefreshToken string    `db:"refresh_token" json:"refreshToken"`
 	UA           string    `db:"ua" json:"ua"`
+	IP           string    `db:"ip" json:"ip"`
 	Fingerprint  string    `db:"fingerprint" json:"fingerprint"`
 	ExpiresAt    time.Time `db:"expires_at" json:"expiresAt"`
+	RotatedAt    null.Time `db:"rotated_at" json:"rotatedAt"`
 	CreatedAt    time.Time `db:"created_at" json:"createdAt"`
 }
+
+// Session is an active refresh token family of the user.
+type Session struct {
+	ID         int64     `db:"id" json:"id"`
+	FamilyID   string    `db:"family_id" json:"-"`
+	UA         string    `db:"ua" json:"ua"`
+	IP         string    `db:"ip" json:"ip"`
+	StartedAt  time.Time `db:"started_at" json:"startedAt"`
+	LastUsedAt time.Time `db:"created_at" json:"lastUsedAt"`
+	ExpiresAt  time.Time `db:"expires_at" json:"expiresAt"`
+	Current    bool      `db:"-" json:"current"`
+}
@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// SigningKey signs access tokens from ActiveFrom till RetireAt. It's published before
+// ActiveFrom and till ExpiresAt, so tokens can be verified by other services during
+// rotation. Private key is encrypted with the application key.
+type SigningKey struct {
+	ID         string    `db:"id" json:"id"`
+	Algorithm  string    `db:"algorithm" json:"algorithm"`
+	PrivateKey []byte    `db:"private_key" json:"-"`
+	ActiveFrom time.Time `db:"active_from" json:"activeFrom"`
+	RetireAt   time.Time `db:"retire_at" json:"retireAt"`
+	ExpiresAt  time.Time `db:"expires_at" json:"expiresAt"`
+	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// SSOConfig is the OpenID Connect provider of the organization. RoleMapping is a JSON
+// object which maps values of RoleClaim (string or list of strings, e.g. groups) to
+// organization roles. Users without mapped role get DefaultRole or are denied if it's null.
+// UpdatedBy is the user who saved the config, SSO can't grant more than they have.
+type SSOConfig struct {
+	OrganizationID int64       `db:"organization_id" json:"organizationID"`
+	Issuer         string      `db:"issuer" json:"issuer"`
+	ClientID       string      `db:"client_id" json:"clientID"`
+	ClientSecret   string      `db:"client_secret" json:"-"`
+	RoleClaim      string      `db:"role_claim" json:"roleClaim"`
+	RoleMapping    string      `db:"role_mapping" json:"roleMapping"`
+	DefaultRole    null.String `db:"default_role" json:"defaultRole"`
+	Enabled        bool        `db:"enabled" json:"enabled"`
+	UpdatedBy      null.Int    `db:"updated_by" json:"updatedBy"`
+	CreatedAt      time.Time   `db:"created_at" json:"createdAt"`
+	UpdatedAt      time.Time   `db:"updated_at" json:"updatedAt"`
+}
+
+// Roles returns all roles the config can grant, including the default role.
+func (c SSOConfig) Roles() ([]string, error) {
+	var mapping map[string]string
+	if c.RoleMapping != "" {
+		err := json.Unmarshal([]byte(c.RoleMapping), &mapping)
+		if err != nil {
+			return nil, errors.New("role mapping must be JSON object")
+		}
+	}
+
+	roles := make([]string, 0, len(mapping)+1)
+	for _, role := range mapping {
+		roles = append(roles, role)
+	}
+	if c.DefaultRole.Valid {
+		roles = append(roles, c.DefaultRole.String)
+	}
+
+	return roles, nil
+}
+
+// UserIdentity links the user to the account at an identity provider.
+type UserIdentity struct {
+	ID        int64     `db:"id" json:"id"`
+	UserID    int64     `db:"user_id" json:"userID"`
+	Issuer    string    `db:"issuer" json:"issuer"`
+	Subject   string    `db:"subject" json:"subject"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// UserTOTP is the TOTP secret of the user. Secret is not enabled until the user
+// confirms enrollment with a valid code.
+type UserTOTP struct {
+	UserID       int64     `db:"user_id" json:"userID"`
+	Secret       string    `db:"secret" json:"-"`
+	LastUsedStep int64     `db:"last_used_step" json:"-"`
+	EnabledAt    null.Time `db:"enabled_at" json:"enabledAt"`
+	CreatedAt    time.Time `db:"created_at" json:"createdAt"`
+}
+
+// TOTPEnrollment is shown to the user once to set up an authenticator app.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
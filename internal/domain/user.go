@@ -7,25 +7,49 @@ import (
 )
 
 type User struct {
-	ID         int64       `db:"id" json:"id"`
-	Firstname  null.String `db:"firstname" json:"firstname"`
-	Lastname   null.String `db:"lastname" json:"lastname"`
-	Salutation null.String `db:"salutation" json:"salutation"`
-	Email      string      `db:"email" json:"email"`
-	Image      null.String `db:"image" json:"image"`
-	Password   null.String `db:"password" json:"password"`
-	Type       string      `db:"type" json:"type"`
-	CreatedAt  time.Time   `db:"created_at" json:"createdAt"`
-	UpdatedAt  time.Time   `db:"updated_at" json:"updatedAt"`
+	ID           int64       `db:"id" json:"id"`
+	Firstname    null.String `db:"firstname" json:"firstname"`
+	Lastname     null.String `db:"lastname" json:"lastname"`
+	Salutation   null.String `db:"salutation" json:"salutation"`
+	Email        string      `db:"email" json:"email"`
+	Image        null.String `db:"image" json:"image"`
+	Password     null.String `db:"password" json:"password"`
+	Type         string      `db:"type" json:"type"`
+	TokenVersion int64       `db:"token_version" json:"-"`
+	FailedLogins int         `db:"failed_logins" json:"-"`
+	LockedUntil  null.Time   `db:"locked_until" json:"lockedUntil"`
+	CreatedAt    time.Time   `db:"created_at" json:"createdAt"`
+	UpdatedAt    time.Time   `db:"updated_at" json:"updatedAt"`
 }
 
+// UserVerification token hash is cleared once used. ExpiresAt is null for verified users.
 type UserVerification struct {
-	ID     int64  `db:"id" json:"id"`
-	Token  string `db:"token" json:"token"`
-	Status string `db:"status" json:"status"`
+	ID        int64       `db:"id" json:"id"`
+	TokenHash null.String `db:"token_hash" json:"-"`
+	Status    string      `db:"status" json:"status"`
+	ExpiresAt null.Time   `db:"expires_at" json:"expiresAt"`
+	CreatedAt time.Time   `db:"created_at" json:"createdAt"`
 }
 
 type UserPasswordReset struct {
-	ID    int64  `db:"id" json:"id"`
-	Token string `db:"token" json:"token"`
+	ID        int64     `db:"id" json:"id"`
+	TokenHash string    `db:"token_hash" json:"-"`
+	ExpiresAt time.Time `db:"expires_at" json:"expiresAt"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
+// UserEmailChange is requested by the user and applied once the new address confirms
+// it. Until the revert link expires the old address can undo the change. Token hash is
+// cleared when the change is confirmed.
+type UserEmailChange struct {
+	ID              int64       `db:"id" json:"id"`
+	UserID          int64       `db:"user_id" json:"userID"`
+	OldEmail        string      `db:"old_email" json:"oldEmail"`
+	NewEmail        string      `db:"new_email" json:"newEmail"`
+	TokenHash       null.String `db:"token_hash" json:"-"`
+	RevertTokenHash string      `db:"revert_token_hash" json:"-"`
+	ExpiresAt       time.Time   `db:"expires_at" json:"expiresAt"`
+	RevertExpiresAt time.Time   `db:"revert_expires_at" json:"revertExpiresAt"`
+	ConfirmedAt     null.Time   `db:"confirmed_at" json:"confirmedAt"`
+	CreatedAt       time.Time   `db:"created_at" json:"createdAt"`
 }
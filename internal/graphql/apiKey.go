@@ -0,0 +1,87 @@
+package graphql
+
+import (
+	"strings"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/graphql-go/graphql"
+	"gopkg.in/guregu/null.v4"
+)
+
+var apiKeyType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "APIKey",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"userID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"organizationID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"name": &graphql.Field{
+				Type: graphql.String,
+			},
+			"prefix": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Beginning of the key to recognize it.",
+			},
+			"scopes": &graphql.Field{
+				Type: graphql.NewList(apiKeyScopeEnum),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return strings.Split(p.Source.(domain.APIKey).Scopes, ","), nil
+				},
+			},
+			"expiresAt": &graphql.Field{
+				Type: graphql.DateTime,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.APIKey).ExpiresAt.Ptr(), nil
+				},
+			},
+			"lastUsedAt": &graphql.Field{
+				Type: graphql.DateTime,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.APIKey).LastUsedAt.Ptr(), nil
+				},
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+var newAPIKeyType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "NewAPIKey",
+		Fields: graphql.Fields{
+			"apiKey": &graphql.Field{
+				Type: apiKeyType,
+			},
+			"key": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Send as \"Authorization: ApiKey <key>\" header. It's shown only once.",
+			},
+		},
+	},
+)
+
+// apiKeyArgs parses arguments shared by mutations creating API keys.
+func apiKeyArgs(p graphql.ResolveParams) (string, []string, null.Time) {
+	name := p.Args["name"].(string)
+
+	scopes := make([]string, 0)
+	for _, scope := range p.Args["scopes"].([]interface{}) {
+		scopes = append(scopes, scope.(string))
+	}
+
+	var expiresAt null.Time
+	if temp, ok := p.Args["expiresAt"].(time.Time); ok {
+		expiresAt = null.TimeFrom(temp)
+	}
+
+	return name, scopes, expiresAt
+}
@@ -0,0 +1,151 @@
+package graphql
+
+import (
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/logger"
+	"github.com/graphql-go/graphql"
+	"gopkg.in/guregu/null.v4"
+)
+
+var auditEntryType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "AuditEntry",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"organizationID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"actorID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"impersonatorID": &graphql.Field{
+				Type:        NullableInt,
+				Description: "Superadmin who acted as the actor.",
+			},
+			"action": &graphql.Field{
+				Type: graphql.String,
+			},
+			"entityType": &graphql.Field{
+				Type: graphql.String,
+			},
+			"entityID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"diff": &graphql.Field{
+				Type:        graphql.String,
+				Description: "JSON object with changed fields before and after the action",
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+var auditLogType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "AuditLog",
+		Fields: graphql.Fields{
+			"entries": &graphql.Field{
+				Type: graphql.NewList(auditEntryType),
+			},
+			"nextCursor": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Pass as cursor to get next entries. Null if there are no more entries.",
+			},
+		},
+	},
+)
+
+var auditFilterInput = graphql.NewInputObject(
+	graphql.InputObjectConfig{
+		Name: "AuditLogFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"actorID": &graphql.InputObjectFieldConfig{
+				Type: graphql.Int,
+			},
+			"action": &graphql.InputObjectFieldConfig{
+				Type: graphql.String,
+			},
+			"entityType": &graphql.InputObjectFieldConfig{
+				Type: graphql.String,
+			},
+			"entityID": &graphql.InputObjectFieldConfig{
+				Type: graphql.Int,
+			},
+			"from": &graphql.InputObjectFieldConfig{
+				Type: graphql.DateTime,
+			},
+			"to": &graphql.InputObjectFieldConfig{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+type auditLog struct {
+	Entries    []domain.AuditEntry `json:"entries"`
+	NextCursor *int64              `json:"nextCursor"`
+}
+
+func auditFilter(args map[string]interface{}) domain.AuditFilter {
+	var filter domain.AuditFilter
+
+	if temp, ok := args["actorID"].(int); ok {
+		filter.ActorID = null.IntFrom(int64(temp))
+	}
+	if temp, ok := args["action"].(string); ok {
+		filter.Action = null.StringFrom(temp)
+	}
+	if temp, ok := args["entityType"].(string); ok {
+		filter.EntityType = null.StringFrom(temp)
+	}
+	if temp, ok := args["entityID"].(int); ok {
+		filter.EntityID = null.IntFrom(int64(temp))
+	}
+	if temp, ok := args["from"].(time.Time); ok {
+		filter.From = null.TimeFrom(temp)
+	}
+	if temp, ok := args["to"].(time.Time); ok {
+		filter.To = null.TimeFrom(temp)
+	}
+
+	return filter
+}
+
+// audit writes mutation to the audit log on behalf of the current user. Errors are only
+// logged, because the mutation itself has already been applied.
+func audit(p graphql.ResolveParams, organizationID null.Int, action, entityType string, entityID null.Int, before, after interface{}) {
+	var actorID, impersonatorID null.Int
+	if claims, ok := p.Context.Value(domain.UserClaimsKey).(*domain.Claims); ok && claims.UserID != 0 {
+		actorID = null.IntFrom(claims.UserID)
+		if claims.ImpersonatorID != 0 {
+			impersonatorID = null.IntFrom(claims.ImpersonatorID)
+		}
+	}
+
+	err := service.Audit.Log(organizationID, actorID, impersonatorID, action, entityType, entityID, before, after)
+	if err != nil {
+		logger.Println(p.Context, "Failed to write audit log: ", err)
+	}
+}
+
+// organizationUserRole returns role of the user in organization as audit state.
+func organizationUserRole(organizationID, userID int64) interface{} {
+	organizationUsers, err := service.OrganizationUser.GetByUserID(userID)
+	if err != nil {
+		return nil
+	}
+
+	for _, organizationUser := range organizationUsers {
+		if organizationUser.OrganizationID == organizationID {
+			return map[string]interface{}{"role": organizationUser.Role, "roleID": organizationUser.RoleID}
+		}
+	}
+
+	return nil
+}
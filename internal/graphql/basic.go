@@ -1,6 +1,9 @@
 package graphql
 
-import "github.com/graphql-go/graphql"
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/graphql-go/graphql"
+)
 
 var tokenType = graphql.NewObject(
 	graphql.ObjectConfig{
@@ -12,6 +15,18 @@ var tokenType = graphql.NewObject(
 			"refreshToken": &graphql.Field{
 				Type: graphql.String,
 			},
+			"challengeToken": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Set instead of tokens if second factor is needed. Pass it to verifyTwoFactor.",
+			},
+			"twoFactor": &graphql.Field{
+				Type:        graphql.String,
+				Description: "\"required\" if TOTP code is needed, \"enrollment_required\" if TOTP has to be set up with enrollTOTP first.",
+			},
+			"recoveryCodes": &graphql.Field{
+				Type:        graphql.NewList(graphql.String),
+				Description: "Recovery codes returned once after enrollment during login.",
+			},
 		},
 	},
 )
@@ -26,6 +41,20 @@ var roleType = graphql.NewObject(
 			"role": &graphql.Field{
 				Type: roleEnum,
 			},
+			"roleID": &graphql.Field{
+				Type:        NullableInt,
+				Description: "ID of the custom role. Only its permissions apply if set.",
+			},
+			"customRole": &graphql.Field{
+				Type:        NullableString,
+				Description: "Name of the custom role.",
+			},
+			"permissions": &graphql.Field{
+				Type: graphql.NewList(permissionEnum),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.OrganizationUser).Permissions(), nil
+				},
+			},
 		},
 	},
 )
@@ -50,6 +79,23 @@ var fileType = graphql.NewObject(
 	},
 )
 
+var userEmailChangeType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "UserEmailChange",
+		Fields: graphql.Fields{
+			"newEmail": &graphql.Field{
+				Type: graphql.String,
+			},
+			"expiresAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
 var userVerificationType = graphql.NewObject(
 	graphql.ObjectConfig{
 		Name: "UserVerification",
@@ -57,12 +103,15 @@ var userVerificationType = graphql.NewObject(
 			"id": &graphql.Field{
 				Type: graphql.Int,
 			},
-			"token": &graphql.Field{
-				Type: graphql.String,
-			},
 			"status": &graphql.Field{
 				Type: verificationStatusEnum,
 			},
+			"expiresAt": &graphql.Field{
+				Type: graphql.DateTime,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.UserVerification).ExpiresAt.Ptr(), nil
+				},
+			},
 		},
 	},
 )
@@ -0,0 +1,66 @@
+package graphql
+
+import (
+	"encoding/json"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/graphql-go/graphql"
+)
+
+var contentCopyJobType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "ContentCopyJob",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"organizationID": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"plan": &graphql.Field{
+				Type: planEnum,
+			},
+			"mode": &graphql.Field{
+				Type: copyJobModeEnum,
+			},
+			"status": &graphql.Field{
+				Type: copyJobStatusEnum,
+			},
+			"total": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Number of pages to copy.",
+			},
+			"copied": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Number of copied pages. In all_or_nothing mode pages are saved only when the job is completed.",
+			},
+			"errors": &graphql.Field{
+				Type: graphql.NewList(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					job := p.Source.(domain.ContentCopyJob)
+
+					var errs []string
+					err := json.Unmarshal([]byte(job.Errors), &errs)
+					if err != nil {
+						return nil, err
+					}
+
+					return errs, nil
+				},
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"updatedAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"finishedAt": &graphql.Field{
+				Type: graphql.DateTime,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					job := p.Source.(domain.ContentCopyJob)
+					return job.FinishedAt.Ptr(), nil
+				},
+			},
+		},
+	},
+)
@@ -0,0 +1,55 @@
+package graphql
+
+import "github.com/graphql-go/graphql"
+
+var syncFieldChangeType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "SyncFieldChange",
+		Fields: graphql.Fields{
+			"blockID": &graphql.Field{
+				Type:        NullableInt,
+				Description: "Organization block. Null if the field belongs to the page or the block is new.",
+			},
+			"sourceBlockID": &graphql.Field{
+				Type:        NullableInt,
+				Description: "Default block. Null if the field belongs to the page or the block was removed.",
+			},
+			"field": &graphql.Field{
+				Type: graphql.String,
+			},
+			"before": &graphql.Field{
+				Type: NullableString,
+			},
+			"after": &graphql.Field{
+				Type: NullableString,
+			},
+		},
+	},
+)
+
+var syncChangeType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "SyncChange",
+		Fields: graphql.Fields{
+			"sourcePageID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"pageID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"title": &graphql.Field{
+				Type: graphql.String,
+			},
+			"action": &graphql.Field{
+				Type:        graphql.String,
+				Description: "One of create, update, customised (not applied because organization changed the page) or source_removed.",
+			},
+			"applied": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"fields": &graphql.Field{
+				Type: graphql.NewList(syncFieldChangeType),
+			},
+		},
+	},
+)
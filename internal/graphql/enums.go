@@ -1,6 +1,9 @@
 package graphql
 
-import "github.com/graphql-go/graphql"
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/graphql-go/graphql"
+)
 
 var statusEnum = graphql.NewEnum(graphql.EnumConfig{
 	Name: "status",
@@ -157,3 +160,57 @@ var blockTypeEnum = graphql.NewEnum(graphql.EnumConfig{
 	},
 	Description: "Block type enum",
 })
+
+var copyJobModeEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "copyJobMode",
+	Values: map[string]*graphql.EnumValueConfig{
+		"all_or_nothing": {
+			Value: "all_or_nothing",
+		},
+		"best_effort": {
+			Value: "best_effort",
+		},
+	},
+	Description: "Copy job mode enum",
+})
+
+var copyJobStatusEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "copyJobStatus",
+	Values: map[string]*graphql.EnumValueConfig{
+		"pending": {
+			Value: "pending",
+		},
+		"running": {
+			Value: "running",
+		},
+		"completed": {
+			Value: "completed",
+		},
+		"partial": {
+			Value: "partial",
+		},
+		"failed": {
+			Value: "failed",
+		},
+	},
+	Description: "Copy job status enum",
+})
+
+var apiKeyScopeEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "apiKeyScope",
+	Values: map[string]*graphql.EnumValueConfig{
+		"content_read": {
+			Value:       domain.ScopeContentRead,
+			Description: "Read published pages, blocks, addresses and handbook export.",
+		},
+		"addresses_write": {
+			Value:       domain.ScopeAddressesWrite,
+			Description: "Read and manage addresses.",
+		},
+		"files_write": {
+			Value:       domain.ScopeFilesWrite,
+			Description: "List and upload files of the organization.",
+		},
+	},
+	Description: "API key scope enum",
+})
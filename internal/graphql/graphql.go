@@ -1,11 +1,14 @@
 package graphql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"log"
 
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/authorize"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/logger"
 	s "bitbucket.org/ibros_nsk/krisenkompass-backend/internal/service"
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/handler"
@@ -13,6 +16,12 @@ import (
 
 var service *s.Service
 
+// isReader reports whether current user may only see published content of the organization.
+func isReader(p graphql.ResolveParams, organizationID int64) bool {
+	_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionPagesWrite)
+	return err != nil
+}
+
 func supplementTypes() {
 	userType.AddFieldConfig("organizations", &graphql.Field{
 		Type: graphql.NewList(organizationType),
@@ -32,12 +41,24 @@ func supplementTypes() {
 		Type: graphql.NewList(pageType),
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 			organizationID := p.Source.(domain.Organization).ID
-			_, err := authorize.AuthorizeOrganization(p.Context, organizationID, "user")
+			_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionPagesRead, domain.ScopeContentRead)
 			if err != nil {
 				return nil, err
 			}
 
 			pages, err := service.Page.GetRootPages(&organizationID)
+			if err != nil {
+				return nil, err
+			}
+
+			pages, err = filterPages(p, organizationID, pages)
+			if err != nil {
+				return nil, err
+			}
+
+			if isReader(p, organizationID) {
+				return service.Page.FilterPublished(pages)
+			}
 
 			return pages, err
 		},
@@ -54,10 +75,25 @@ func supplementTypes() {
 		Type:        graphql.NewList(pageType),
 		Description: "Get child pages",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			pages, err := service.Page.GetChildrens(p.Source.(domain.Page).ID)
+			page := p.Source.(domain.Page)
+			if page.OrganizationID.Valid && isReader(p, page.OrganizationID.Int64) {
+				pages, err := service.Page.GetPublishedChildrens(page.ID)
+				if err != nil {
+					return nil, err
+				}
+
+				return filterPages(p, page.OrganizationID.Int64, pages)
+			}
+
+			pages, err := service.Page.GetChildrens(page.ID)
 			if err != nil {
 				return nil, err
 			}
+
+			if page.OrganizationID.Valid {
+				pages, err = filterPages(p, page.OrganizationID.Int64, pages)
+			}
+
 			return pages, err
 		},
 	})
@@ -66,7 +102,17 @@ func supplementTypes() {
 		Type:        graphql.NewList(blockType),
 		Description: "Get blocks for a page",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			blocks, err := service.Block.GetByPageID(p.Source.(domain.Page).ID)
+			page := p.Source.(domain.Page)
+			err := authorizePage(p, page)
+			if err != nil {
+				return nil, err
+			}
+
+			if page.OrganizationID.Valid && isReader(p, page.OrganizationID.Int64) {
+				return service.Block.GetPublishedByPageID(page)
+			}
+
+			blocks, err := service.Block.GetByPageID(page.ID)
 			if err != nil {
 				return nil, err
 			}
@@ -78,7 +124,20 @@ func supplementTypes() {
 		Type:        fileBlockType,
 		Description: "Get file for a page",
 		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			file, err := service.FileBlock.GetByPageID(p.Source.(domain.Page).ID)
+			var file domain.FileBlock
+			var err error
+
+			page := p.Source.(domain.Page)
+			err = authorizePage(p, page)
+			if err != nil {
+				return nil, err
+			}
+
+			if page.OrganizationID.Valid && isReader(p, page.OrganizationID.Int64) {
+				file, err = service.FileBlock.GetPublishedByPageID(page)
+			} else {
+				file, err = service.FileBlock.GetByPageID(page.ID)
+			}
 			if err != nil && err != sql.ErrNoRows {
 				return nil, err
 			}
@@ -90,6 +149,51 @@ func supplementTypes() {
 			return file, nil
 		},
 	})
+
+	pageType.AddFieldConfig("access", &graphql.Field{
+		Type:        graphql.NewList(pageAccessType),
+		Description: "Get users and roles allowed to see the page if it is restricted",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			page := p.Source.(domain.Page)
+			if !page.OrganizationID.Valid {
+				return nil, nil
+			}
+
+			_, err := authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesRestrict)
+			if err != nil {
+				return nil, err
+			}
+
+			return service.PageAccess.GetByPageID(page.ID)
+		},
+	})
+
+	pageType.AddFieldConfig("publishedRevision", &graphql.Field{
+		Type:        revisionType,
+		Description: "Get revision which readers currently see",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			page := p.Source.(domain.Page)
+			if !page.PublishedRevisionID.Valid {
+				return nil, nil
+			}
+
+			if page.OrganizationID.Valid && isReader(p, page.OrganizationID.Int64) {
+				return nil, errors.New("access denied")
+			}
+
+			err := authorizePage(p, page)
+			if err != nil {
+				return nil, err
+			}
+
+			revision, err := service.Revision.GetByID(page.PublishedRevisionID.Int64)
+			if err != nil {
+				return nil, err
+			}
+
+			return revision, nil
+		},
+	})
 }
 
 func schema() *graphql.Schema {
@@ -108,9 +212,22 @@ func Handler(s *s.Service) *handler.Handler {
 	service = s
 
 	return handler.New(&handler.Config{
-		Schema:     schema(),
-		Pretty:     true,
-		GraphiQL:   false,
-		Playground: true,
+		Schema:           schema(),
+		Pretty:           true,
+		GraphiQL:         false,
+		Playground:       true,
+		ResultCallbackFn: logImpersonatedErrors,
 	})
 }
+
+// logImpersonatedErrors logs errors of requests which a superadmin makes on behalf of
+// another user, so failed actions can be traced back to the impersonator.
+func logImpersonatedErrors(ctx context.Context, params *graphql.Params, result *graphql.Result, responseBody []byte) {
+	if _, ok := ctx.Value(domain.ImpersonatorIDKey).(int64); !ok {
+		return
+	}
+
+	for _, err := range result.Errors {
+		logger.Println(ctx, "Failed to resolve impersonated request: ", err.Message)
+	}
+}
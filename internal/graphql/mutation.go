@@ -2,13 +2,15 @@ package graphql
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/authorize"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/logger"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/contains"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/password"
 	"github.com/graphql-go/graphql"
@@ -32,10 +34,363 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 				email := p.Args["email"].(string)
 				password := p.Args["password"].(string)
-				tokens, err := service.Auth.Login(email, password)
+
+				err := service.RateLimit.Check("login", requestInfo(p).IP, email)
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := service.Auth.Login(email, password, requestInfo(p))
+				if err != nil {
+					service.RateLimit.Fail("login", email)
+				}
+				return tokens, err
+			},
+		},
+		"verifyTwoFactor": &graphql.Field{
+			Type:        tokenType,
+			Description: "Finish login with TOTP or recovery code. Return JWT tokens if correct.",
+			Args: graphql.FieldConfigArgument{
+				"challengeToken": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				challengeToken := p.Args["challengeToken"].(string)
+				code := p.Args["code"].(string)
+
+				err := service.RateLimit.Check("login", requestInfo(p).IP, "")
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := service.Auth.VerifyTwoFactor(challengeToken, code, requestInfo(p))
+				return tokens, err
+			},
+		},
+		"sendMagicLink": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Send single-use login link on email.",
+			Args: graphql.FieldConfigArgument{
+				"email": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				email := p.Args["email"].(string)
+
+				err := service.RateLimit.Check("magic_link", requestInfo(p).IP, email)
+				if err != nil {
+					return false, err
+				}
+
+				err = service.Auth.SendMagicLink(email)
+				if err != nil {
+					return false, errors.New("failed to send login link")
+				}
+
+				return true, nil
+			},
+		},
+		"loginWithMagicLink": &graphql.Field{
+			Type:        tokenType,
+			Description: "Log in with token from the login link. Return JWT tokens or two-factor challenge.",
+			Args: graphql.FieldConfigArgument{
+				"token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				err := service.RateLimit.Check("login", requestInfo(p).IP, "")
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := service.Auth.LoginWithMagicLink(p.Args["token"].(string), requestInfo(p))
 				return tokens, err
 			},
 		},
+		"beginPasskeyLogin": &graphql.Field{
+			Type:        passkeyLoginType,
+			Description: "Start login with passkey.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				err := service.RateLimit.Check("login", requestInfo(p).IP, "")
+				if err != nil {
+					return nil, err
+				}
+
+				return service.Passkey.BeginLogin()
+			},
+		},
+		"finishPasskeyLogin": &graphql.Field{
+			Type:        tokenType,
+			Description: "Finish login with response of navigator.credentials.get. Binary values are base64url encoded. Return JWT tokens if correct.",
+			Args: graphql.FieldConfigArgument{
+				"challengeToken": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"credentialID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"clientDataJSON": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"authenticatorData": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"signature": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				err := service.RateLimit.Check("login", requestInfo(p).IP, "")
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := service.Passkey.FinishLogin(
+					p.Args["challengeToken"].(string),
+					p.Args["credentialID"].(string),
+					p.Args["clientDataJSON"].(string),
+					p.Args["authenticatorData"].(string),
+					p.Args["signature"].(string),
+					requestInfo(p),
+				)
+				return tokens, err
+			},
+		},
+		"beginPasskeyRegistration": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Start registration of passkey of the current user. Return JSON of options for navigator.credentials.create.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				claims, err := authorize.Authorize(p.Context, "user", "demo")
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				return service.Passkey.BeginRegistration(claims.UserID)
+			},
+		},
+		"finishPasskeyRegistration": &graphql.Field{
+			Type:        passkeyType,
+			Description: "Save passkey from response of navigator.credentials.create. Binary values are base64url encoded.",
+			Args: graphql.FieldConfigArgument{
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"clientDataJSON": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"attestationObject": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				claims, err := authorize.Authorize(p.Context, "user", "demo")
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				name := ""
+				if temp, ok := p.Args["name"].(string); ok {
+					name = temp
+				}
+
+				passkey, err := service.Passkey.FinishRegistration(claims.UserID, name, p.Args["clientDataJSON"].(string), p.Args["attestationObject"].(string))
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, null.Int{}, "create", "passkey", null.IntFrom(passkey.ID), nil, passkey)
+
+				return passkey, nil
+			},
+		},
+		"deletePasskey": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Delete passkey of the current user.",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				claims, err := authorize.Authorize(p.Context, "user", "demo")
+				if err != nil {
+					return false, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return false, err
+				}
+
+				id := int64(p.Args["id"].(int))
+				err = service.Passkey.Delete(claims.UserID, id)
+				if err != nil {
+					return false, err
+				}
+
+				audit(p, null.Int{}, "delete", "passkey", null.IntFrom(id), nil, nil)
+
+				return true, nil
+			},
+		},
+		"enrollTOTP": &graphql.Field{
+			Type:        totpEnrollmentType,
+			Description: "Create TOTP secret of the current user. During login challenge token is used instead of access token.",
+			Args: graphql.FieldConfigArgument{
+				"challengeToken": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if challengeToken, ok := p.Args["challengeToken"].(string); ok {
+					return service.Auth.EnrollTOTPWithChallenge(challengeToken)
+				}
+
+				claims, err := authorize.Authorize(p.Context, "user", "demo")
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				return service.Auth.EnrollTOTP(claims.UserID)
+			},
+		},
+		"confirmTOTP": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "Enable TOTP with the first code from authenticator app. Return recovery codes.",
+			Args: graphql.FieldConfigArgument{
+				"code": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				claims, err := authorize.Authorize(p.Context, "user", "demo")
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				codes, err := service.Auth.ConfirmTOTP(claims.UserID, p.Args["code"].(string))
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, null.Int{}, "enable_2fa", "user", null.IntFrom(claims.UserID), nil, nil)
+
+				return codes, nil
+			},
+		},
+		"disableTOTP": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Disable two-factor authentication of the current user.",
+			Args: graphql.FieldConfigArgument{
+				"code": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "TOTP or recovery code.",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				claims, err := authorize.Authorize(p.Context, "user", "demo")
+				if err != nil {
+					return false, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return false, err
+				}
+
+				err = service.Auth.DisableTOTP(claims.UserID, p.Args["code"].(string))
+				if err != nil {
+					return false, err
+				}
+
+				audit(p, null.Int{}, "disable_2fa", "user", null.IntFrom(claims.UserID), nil, nil)
+
+				return true, nil
+			},
+		},
+		"regenerateRecoveryCodes": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "Replace recovery codes of the current user.",
+			Args: graphql.FieldConfigArgument{
+				"code": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "TOTP or recovery code.",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				claims, err := authorize.Authorize(p.Context, "user", "demo")
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				codes, err := service.Auth.RegenerateRecoveryCodes(claims.UserID, p.Args["code"].(string))
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, null.Int{}, "regenerate_recovery_codes", "user", null.IntFrom(claims.UserID), nil, nil)
+
+				return codes, nil
+			},
+		},
+		"resetTwoFactor": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Remove TOTP and recovery codes of the user who lost access to them.",
+			Args: graphql.FieldConfigArgument{
+				"userID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				_, err := authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return false, err
+				}
+
+				userID := int64(p.Args["userID"].(int))
+
+				err = service.Auth.ResetTwoFactor(userID)
+				if err != nil {
+					logger.Println(p.Context, "Failed to reset two-factor authentication: ", err)
+					return false, errors.New("failed to reset two-factor authentication")
+				}
+
+				audit(p, null.Int{}, "reset_2fa", "user", null.IntFrom(userID), nil, nil)
+
+				return true, nil
+			},
+		},
 		"signup": &graphql.Field{
 			Type:        userType,
 			Description: "Create organization",
@@ -98,6 +453,11 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				plan := p.Args["plan"].(string)
 				notes := p.Args["notes"].(string)
 
+				err := service.RateLimit.Check("signup", requestInfo(p).IP, "")
+				if err != nil {
+					return nil, err
+				}
+
 				userID, organizationID, err := service.User.CreateWithOrganization(&firstname, &lastname, email, name, city, address, invoiceAddress, plan, population, role)
 				if err != nil {
 					fmt.Println(err)
@@ -110,6 +470,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("user was created but failed to get")
 				}
 
+				audit(p, null.IntFrom(organizationID), "signup", "user", null.IntFrom(userID), nil, user)
+
 				go service.Email.SendAdminNewOrganization(organizationID, plan, user.Email, fmt.Sprintf("%s %s %s", user.Salutation.String, user.Firstname.String, user.Lastname.String), role, name, website, city, population, phone, address, invoiceAddress, notes)
 				go service.Email.SendUserNewOrganization(organizationID, plan, user.Email, fmt.Sprintf("%s %s %s", user.Salutation.String, user.Firstname.String, user.Lastname.String), role, name, website, city, population, phone, address, invoiceAddress, notes)
 
@@ -130,7 +492,7 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 				token := p.Args["token"].(string)
 				password := p.Args["password"].(string)
-				tokens, err := service.Auth.Verify(token, password)
+				tokens, err := service.Auth.Verify(token, password, requestInfo(p))
 				return tokens, err
 			},
 		},
@@ -145,7 +507,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 				email := p.Args["email"].(string)
 
-				err := service.User.CreatePasswordReset(email)
+				err := service.RateLimit.Check("password_reset", requestInfo(p).IP, email)
+				if err != nil {
+					return false, err
+				}
+
+				err = service.User.CreatePasswordReset(email)
 				if err != nil {
 					return false, errors.New("failed to send reset link")
 				}
@@ -153,6 +520,78 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				return true, nil
 			},
 		},
+		"resendVerification": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Send new verification link to the unverified user. Previous link stops working.",
+			Args: graphql.FieldConfigArgument{
+				"email": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				email := p.Args["email"].(string)
+
+				err := service.RateLimit.Check("verification", requestInfo(p).IP, email)
+				if err != nil {
+					return false, err
+				}
+
+				err = service.User.ResendVerification(email)
+				if err != nil {
+					return false, errors.New("failed to send verification link")
+				}
+
+				return true, nil
+			},
+		},
+		"confirmEmailChange": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Change email of the user with token from the link sent to the new address.",
+			Args: graphql.FieldConfigArgument{
+				"token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				err := service.RateLimit.Check("verification", requestInfo(p).IP, "")
+				if err != nil {
+					return false, err
+				}
+
+				change, err := service.User.ConfirmEmailChange(p.Args["token"].(string))
+				if err != nil {
+					return false, err
+				}
+
+				audit(p, null.Int{}, "change_email", "user", null.IntFrom(change.UserID), map[string]interface{}{"email": change.OldEmail}, map[string]interface{}{"email": change.NewEmail})
+
+				return true, nil
+			},
+		},
+		"revertEmailChange": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Cancel email change or restore the old email with token from the link sent to the old address. All sessions of the user are revoked.",
+			Args: graphql.FieldConfigArgument{
+				"token": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				err := service.RateLimit.Check("verification", requestInfo(p).IP, "")
+				if err != nil {
+					return false, err
+				}
+
+				change, err := service.User.RevertEmailChange(p.Args["token"].(string))
+				if err != nil {
+					return false, err
+				}
+
+				audit(p, null.Int{}, "revert_email_change", "user", null.IntFrom(change.UserID), map[string]interface{}{"email": change.NewEmail}, map[string]interface{}{"email": change.OldEmail})
+
+				return true, nil
+			},
+		},
 		"updateUserPassword": &graphql.Field{
 			Type:        graphql.Boolean,
 			Description: "Update user password using password reset token or old password.",
@@ -181,17 +620,30 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 
 				var userID int64
 				if token.Valid {
-					user, err := service.User.GetByPasswordResetToken(token.String)
+					var err error
+					userID, err = service.User.ResetPassword(token.String, newPassword)
 					if err != nil {
-						return false, errors.New("wrong password reset token")
+						if err == sql.ErrNoRows {
+							return false, errors.New("wrong password reset token")
+						}
+						logger.Println(p.Context, "Failed to reset password: ", err)
+						return false, errors.New("failed to update password")
 					}
-					userID = user.ID
+
+					audit(p, null.Int{}, "reset_password", "user", null.IntFrom(userID), nil, nil)
+
+					return true, nil
 				} else if oldPassword.Valid {
 					claims, err := authorize.Authorize(p.Context, "user")
 					if err != nil {
 						return nil, err
 					}
 
+					err = authorize.NotImpersonated(p.Context)
+					if err != nil {
+						return nil, err
+					}
+
 					userID = claims.UserID
 
 					user, err := service.User.GetByID(userID)
@@ -199,33 +651,201 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 						return false, errors.New("user not found")
 					}
 
-					err = password.CheckPassword(oldPassword.String, user.Password.String)
-					if err != nil {
-						return false, errors.New("wrong old password")
-					}
+					err = password.CheckPassword(oldPassword.String, user.Password.String)
+					if err != nil {
+						return false, errors.New("wrong old password")
+					}
+				}
+
+				err := service.User.UpdatePassword(userID, newPassword)
+				if err != nil {
+					logger.Println(p.Context, "Failed to update password: ", err)
+					return false, errors.New("failed to update password")
+				}
+
+				audit(p, null.Int{}, "update_password", "user", null.IntFrom(userID), nil, nil)
+
+				return true, err
+			},
+		},
+		"refreshToken": &graphql.Field{
+			Type:        tokenType,
+			Description: "Get new pair of tokens using refreshToken.",
+			Args: graphql.FieldConfigArgument{
+				"refreshToken": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				refreshToken := p.Args["refreshToken"].(string)
+				tokens, err := service.Auth.RefreshToken(refreshToken, requestInfo(p))
+				return tokens, err
+			},
+		},
+		"logout": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Revoke refresh token of the current session.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				claims, err := authorize.Authorize(p.Context, "user", "demo")
+				if err != nil {
+					return false, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return false, err
+				}
+
+				err = service.Auth.Logout(claims.SessionID)
+				if err != nil {
+					return false, err
+				}
+
+				return true, nil
+			},
+		},
+		"revokeSession": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Revoke one of the sessions of the current user.",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				claims, err := authorize.Authorize(p.Context, "user", "demo")
+				if err != nil {
+					return false, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return false, err
+				}
+
+				id := int64(p.Args["id"].(int))
+
+				err = service.Auth.RevokeSession(claims.UserID, id)
+				if err != nil {
+					return false, err
+				}
+
+				audit(p, null.Int{}, "revoke_session", "user", null.IntFrom(claims.UserID), nil, map[string]interface{}{"sessionID": id})
+
+				return true, nil
+			},
+		},
+		"revokeAllOtherSessions": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Revoke all sessions of the current user except the current one.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				claims, err := authorize.Authorize(p.Context, "user", "demo")
+				if err != nil {
+					return false, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return false, err
+				}
+
+				err = service.Auth.RevokeOtherSessions(claims.UserID, claims.SessionID)
+				if err != nil {
+					return false, err
+				}
+
+				audit(p, null.Int{}, "revoke_other_sessions", "user", null.IntFrom(claims.UserID), nil, nil)
+
+				return true, nil
+			},
+		},
+		"revokeUserSessions": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Revoke all sessions of the user, e.g. after the account was compromised.",
+			Args: graphql.FieldConfigArgument{
+				"userID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				_, err := authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return false, err
+				}
+
+				userID := int64(p.Args["userID"].(int))
+
+				err = service.Auth.RevokeUserSessions(userID)
+				if err != nil {
+					logger.Println(p.Context, "Failed to revoke sessions: ", err)
+					return false, errors.New("failed to revoke sessions")
+				}
+
+				audit(p, null.Int{}, "revoke_sessions", "user", null.IntFrom(userID), nil, nil)
+
+				return true, nil
+			},
+		},
+		"unlockUser": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Unlock the user locked after too many failed logins.",
+			Args: graphql.FieldConfigArgument{
+				"userID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				_, err := authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return false, err
 				}
 
-				err := service.User.UpdatePassword(userID, newPassword)
+				userID := int64(p.Args["userID"].(int))
+
+				err = service.Auth.Unlock(userID)
 				if err != nil {
-					log.Println("Failed to update password: ", err)
-					return false, errors.New("failed to update password")
+					logger.Println(p.Context, "Failed to unlock user: ", err)
+					return false, errors.New("failed to unlock user")
 				}
 
-				return true, err
+				audit(p, null.Int{}, "unlock", "user", null.IntFrom(userID), nil, nil)
+
+				return true, nil
 			},
 		},
-		"refreshToken": &graphql.Field{
+		"impersonateUser": &graphql.Field{
 			Type:        tokenType,
-			Description: "Get new pair of tokens using refreshToken.",
+			Description: "Get short-lived access token to act as the user, e.g. to debug permissions. Token can't be refreshed, sensitive actions are not allowed with it.",
 			Args: graphql.FieldConfigArgument{
-				"refreshToken": &graphql.ArgumentConfig{
-					Type: graphql.NewNonNull(graphql.String),
+				"userID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"reason": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "Why the user is impersonated, e.g. support ticket. Saved in the audit log.",
 				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				refreshToken := p.Args["refreshToken"].(string)
-				tokens, err := service.Auth.RefreshToken(refreshToken)
-				return tokens, err
+				claims, err := authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return nil, err
+				}
+
+				userID := int64(p.Args["userID"].(int))
+				reason := strings.TrimSpace(p.Args["reason"].(string))
+				if reason == "" {
+					return nil, errors.New("reason is required")
+				}
+
+				tokens, err := service.Auth.Impersonate(claims.UserID, userID)
+				if err != nil {
+					return nil, err
+				}
+
+				logger.Printf(p.Context, "User %d impersonates user %d: %s", claims.UserID, userID, reason)
+				audit(p, null.Int{}, "impersonate", "user", null.IntFrom(userID), nil, map[string]interface{}{"reason": reason})
+
+				return tokens, nil
 			},
 		},
 		"createOrganization": &graphql.Field{
@@ -307,12 +927,314 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("organization was created but failed to get")
 				}
 
+				audit(p, null.IntFrom(id), "create", "organization", null.IntFrom(id), nil, organization)
+
 				go service.Email.SendAdminNewOrganization(organization.ID, organization.Plan, user.Email, fmt.Sprintf("%s %s %s", user.Salutation.String, user.Firstname.String, user.Lastname.String), role, name, website, city, population, phone, address, invoiceAddress, notes)
 				go service.Email.SendUserNewOrganization(organization.ID, organization.Plan, user.Email, fmt.Sprintf("%s %s %s", user.Salutation.String, user.Firstname.String, user.Lastname.String), role, name, website, city, population, phone, address, invoiceAddress, notes)
 
 				return organization, err
 			},
 		},
+		"updateOrganizationRequire2FA": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Require two-factor authentication for owners and admins of the organization.",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"require": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Boolean),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id := int64(p.Args["id"].(int))
+				require := p.Args["require"].(bool)
+
+				_, err := authorize.AuthorizeOrganization(p.Context, id, domain.PermissionOrganizationSecurity)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return false, err
+				}
+
+				before, err := service.Organization.GetByID(id)
+				if err != nil {
+					return false, err
+				}
+
+				err = service.Organization.UpdateRequire2FA(id, require)
+				if err != nil {
+					logger.Println(p.Context, "Failed to update organization: ", err)
+					return false, errors.New("failed to update organization")
+				}
+
+				audit(p, null.IntFrom(id), "update", "organization", null.IntFrom(id), map[string]interface{}{"require2FA": before.Require2FA}, map[string]interface{}{"require2FA": require})
+
+				return true, nil
+			},
+		},
+		"updateSSOConfig": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Configure OpenID Connect provider of the organization. Users log in at /sso/{organizationID}/login.",
+			Args: graphql.FieldConfigArgument{
+				"organizationID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"issuer": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"clientID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"clientSecret": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Saved secret is kept if empty.",
+				},
+				"roleClaim": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"roleMapping": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "JSON object, e.g. {\"krisenstab\": \"editor\"}.",
+				},
+				"defaultRole": &graphql.ArgumentConfig{
+					Type: roleEnum,
+				},
+				"enabled": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Boolean),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				organizationID := int64(p.Args["organizationID"].(int))
+				config := domain.SSOConfig{
+					OrganizationID: organizationID,
+					Issuer:         p.Args["issuer"].(string),
+					ClientID:       p.Args["clientID"].(string),
+					Enabled:        p.Args["enabled"].(bool),
+				}
+				if temp, ok := p.Args["clientSecret"].(string); ok {
+					config.ClientSecret = temp
+				}
+				if temp, ok := p.Args["roleClaim"].(string); ok {
+					config.RoleClaim = temp
+				}
+				if temp, ok := p.Args["roleMapping"].(string); ok {
+					config.RoleMapping = temp
+				}
+				if temp, ok := p.Args["defaultRole"].(string); ok {
+					config.DefaultRole = null.StringFrom(temp)
+				}
+
+				claims, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionOrganizationSecurity)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return false, err
+				}
+
+				// Users get mapped roles on login, so they are checked like assigned roles.
+				roles, err := config.Roles()
+				if err != nil {
+					return false, err
+				}
+				for _, role := range roles {
+					err = canGrant(p, organizationID, domain.RolePermissions[role])
+					if err != nil {
+						return false, err
+					}
+				}
+				config.UpdatedBy = null.IntFrom(claims.UserID)
+
+				before, err := service.SSO.GetConfig(organizationID)
+				if err != nil && err != sql.ErrNoRows {
+					return false, err
+				}
+				isNew := err == sql.ErrNoRows
+
+				err = service.SSO.SaveConfig(config)
+				if err != nil {
+					return false, err
+				}
+
+				if isNew {
+					audit(p, null.IntFrom(organizationID), "create", "sso_config", null.IntFrom(organizationID), nil, config)
+				} else {
+					audit(p, null.IntFrom(organizationID), "update", "sso_config", null.IntFrom(organizationID), before, config)
+				}
+
+				return true, nil
+			},
+		},
+		"deleteSSOConfig": &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"organizationID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				organizationID := int64(p.Args["organizationID"].(int))
+
+				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionOrganizationSecurity)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return false, err
+				}
+
+				before, err := service.SSO.GetConfig(organizationID)
+				if err != nil {
+					return false, errors.New("single sign-on is not configured")
+				}
+
+				err = service.SSO.DeleteConfig(organizationID)
+				if err != nil {
+					logger.Println(p.Context, "Failed to delete SSO config: ", err)
+					return false, errors.New("failed to delete SSO config")
+				}
+
+				audit(p, null.IntFrom(organizationID), "delete", "sso_config", null.IntFrom(organizationID), before, nil)
+
+				return true, nil
+			},
+		},
+		"createPersonalAccessToken": &graphql.Field{
+			Type:        newAPIKeyType,
+			Description: "Create API key which acts on behalf of the current user within its scopes.",
+			Args: graphql.FieldConfigArgument{
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"scopes": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(apiKeyScopeEnum))),
+				},
+				"expiresAt": &graphql.ArgumentConfig{
+					Type:        graphql.DateTime,
+					Description: "Key doesn't expire if not set.",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				claims, err := authorize.Authorize(p.Context, "user")
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				name, scopes, expiresAt := apiKeyArgs(p)
+
+				key, err := service.APIKey.Create(null.IntFrom(claims.UserID), null.Int{}, name, scopes, expiresAt, claims.UserID)
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, null.Int{}, "create", "api_key", null.IntFrom(key.APIKey.ID), nil, key.APIKey)
+
+				return key, nil
+			},
+		},
+		"createOrganizationAPIKey": &graphql.Field{
+			Type:        newAPIKeyType,
+			Description: "Create API key of the organization, e.g. for address synchronization.",
+			Args: graphql.FieldConfigArgument{
+				"organizationID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"scopes": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(apiKeyScopeEnum))),
+				},
+				"expiresAt": &graphql.ArgumentConfig{
+					Type:        graphql.DateTime,
+					Description: "Key doesn't expire if not set.",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				organizationID := int64(p.Args["organizationID"].(int))
+
+				claims, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionOrganizationSecurity)
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				name, scopes, expiresAt := apiKeyArgs(p)
+
+				key, err := service.APIKey.Create(null.Int{}, null.IntFrom(organizationID), name, scopes, expiresAt, claims.UserID)
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, null.IntFrom(organizationID), "create", "api_key", null.IntFrom(key.APIKey.ID), nil, key.APIKey)
+
+				return key, nil
+			},
+		},
+		"revokeAPIKey": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Delete personal access token of the current user or API key of the organization.",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id := int64(p.Args["id"].(int))
+
+				err := authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return false, err
+				}
+
+				key, err := service.APIKey.GetByID(id)
+				if err != nil {
+					return false, errors.New("unable to find API key with given id")
+				}
+
+				if key.UserID.Valid {
+					claims, err := authorize.Authorize(p.Context, "user")
+					if err != nil {
+						return false, err
+					}
+					if claims.UserID != key.UserID.Int64 && claims.Type != "superadmin" {
+						return false, errors.New("access denied")
+					}
+				} else {
+					_, err = authorize.AuthorizeOrganization(p.Context, key.OrganizationID.Int64, domain.PermissionOrganizationSecurity)
+					if err != nil {
+						return false, err
+					}
+				}
+
+				err = service.APIKey.Delete(id)
+				if err != nil {
+					logger.Println(p.Context, "Failed to delete API key: ", err)
+					return false, errors.New("failed to revoke API key")
+				}
+
+				audit(p, key.OrganizationID, "delete", "api_key", null.IntFrom(id), key, nil)
+
+				return true, nil
+			},
+		},
 		"updateOrganization": &graphql.Field{
 			Type: graphql.Boolean,
 			Args: graphql.FieldConfigArgument{
@@ -373,20 +1295,18 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					population = null.IntFrom(int64(temp))
 				}
 
-				claims, err := authorize.AuthorizeOrganization(p.Context, id, "editor")
+				claims, err := authorize.AuthorizeOrganization(p.Context, id, domain.PermissionOrganizationUpdate)
 				if err != nil {
 					return false, err
 				}
 
-				if claims.Type != "superadmin" {
-					organization, err := service.Organization.GetByID(id)
-					if err != nil {
-						return nil, err
-					}
+				before, err := service.Organization.GetByID(id)
+				if err != nil {
+					return nil, err
+				}
 
-					if organization.Status == "blocked" {
-						return nil, errors.New("access denied")
-					}
+				if claims.Type != "superadmin" && before.Status == "blocked" {
+					return nil, errors.New("access denied")
 				}
 
 				err = service.Organization.Update(id, image, name, city, address, invoiceAddress, plan, status, population)
@@ -394,6 +1314,11 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, errors.New("failed to update organization")
 				}
 
+				after, err := service.Organization.GetByID(id)
+				if err == nil {
+					audit(p, null.IntFrom(id), "update", "organization", null.IntFrom(id), before, after)
+				}
+
 				return true, nil
 			},
 		},
@@ -407,16 +1332,28 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 				id := int64(p.Args["id"].(int))
 
-				_, err := authorize.AuthorizeOrganization(p.Context, id, "owner")
+				_, err := authorize.AuthorizeOrganization(p.Context, id, domain.PermissionOrganizationDelete)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorize.NotImpersonated(p.Context)
 				if err != nil {
 					return false, err
 				}
 
+				organization, err := service.Organization.GetByID(id)
+				if err != nil {
+					return false, errors.New("organization not found")
+				}
+
 				err = service.Organization.Delete(id)
 				if err != nil {
 					return false, errors.New("failed to delete organization")
 				}
 
+				audit(p, null.IntFrom(id), "delete", "organization", null.IntFrom(id), organization, nil)
+
 				return true, nil
 			},
 		},
@@ -467,6 +1404,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, err
 				}
 
+				audit(p, null.Int{}, "create", "user", null.IntFrom(id), nil, user)
+
 				return user, nil
 			},
 		},
@@ -485,11 +1424,23 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("access denied")
 				}
 
+				err = authorize.NotImpersonated(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				user, err := service.User.GetByID(id)
+				if err != nil {
+					return false, errors.New("user not found")
+				}
+
 				err = service.User.Delete(id)
 				if err != nil {
 					return false, errors.New("failed to delete user")
 				}
 
+				audit(p, null.Int{}, "delete", "user", null.IntFrom(id), user, nil)
+
 				return true, nil
 			},
 		},
@@ -545,7 +1496,17 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				}
 
 				if organizationID != nil {
-					_, err := authorize.AuthorizeOrganization(p.Context, *organizationID, "editor")
+					_, err := authorize.AuthorizeOrganization(p.Context, *organizationID, domain.PermissionPagesWrite)
+					if err != nil {
+						return nil, err
+					}
+
+					parent, err := service.Page.GetByID(int64(parentID))
+					if err != nil {
+						return nil, errors.New("unable to find page with given id")
+					}
+
+					err = authorizePage(p, parent)
 					if err != nil {
 						return nil, err
 					}
@@ -562,7 +1523,13 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				}
 
 				page, err := service.Page.GetByID(id)
-				return page, err
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, page.OrganizationID, "create", "page", null.IntFrom(id), nil, page)
+
+				return page, nil
 			},
 		},
 		"createBlock": &graphql.Field{
@@ -615,7 +1582,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("unable to find page with given id")
 				}
 
-				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, "editor")
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorizePage(p, page)
 				if err != nil {
 					return nil, err
 				}
@@ -626,7 +1598,13 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				}
 
 				block, err := service.Block.GetByID(id)
-				return block, err
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, page.OrganizationID, "create", "block", null.IntFrom(id), nil, block)
+
+				return block, nil
 			},
 		},
 		"createFileBlock": &graphql.Field{
@@ -648,7 +1626,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				if err != nil {
 					return nil, errors.New("unable to find page with given id")
 				}
-				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, "editor")
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorizePage(p, page)
 				if err != nil {
 					return nil, err
 				}
@@ -659,7 +1642,13 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				}
 
 				file, err := service.FileBlock.GetByID(id)
-				return file, err
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, page.OrganizationID, "create", "file_block", null.IntFrom(id), nil, file)
+
+				return file, nil
 			},
 		},
 		"updatePage": &graphql.Field{
@@ -717,10 +1706,27 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				}
 
 				if page.OrganizationID.Valid {
-					_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, "editor")
+					_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
 					if err != nil {
 						return false, ErrFailedToUpdate
 					}
+
+					err = authorizePage(p, page)
+					if err != nil {
+						return false, err
+					}
+
+					if parentID != nil {
+						parent, err := service.Page.GetByID(*parentID)
+						if err != nil || parent.OrganizationID != page.OrganizationID {
+							return false, errors.New("unable to find page with given id")
+						}
+
+						err = authorizePage(p, parent)
+						if err != nil {
+							return false, err
+						}
+					}
 				} else {
 					_, err := authorize.Authorize(p.Context, "superadmin")
 					if err != nil {
@@ -764,9 +1770,296 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, ErrFailedToUpdate
 				}
 
+				after, err := service.Page.GetByID(int64(id))
+				if err == nil {
+					audit(p, page.OrganizationID, "update", "page", null.IntFrom(int64(id)), page, after)
+				}
+
+				return true, nil
+			},
+		},
+		"restoreRevision": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Roll page with all its blocks back to the given revision",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id := int64(p.Args["id"].(int))
+
+				revision, err := service.Revision.GetByID(id)
+				if err != nil {
+					return false, errors.New("unable to find revision with given id")
+				}
+
+				page, err := service.Page.GetByID(revision.PageID)
+				if err != nil {
+					return false, errors.New("unable to find page for a given revision")
+				}
+
+				if page.OrganizationID.Valid {
+					_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+					if err != nil {
+						return false, err
+					}
+
+					err = authorizePage(p, page)
+					if err != nil {
+						return false, err
+					}
+				} else {
+					_, err := authorize.Authorize(p.Context, "superadmin")
+					if err != nil {
+						return false, err
+					}
+				}
+
+				err = service.Revision.Restore(id)
+				if err != nil {
+					logger.Println(p.Context, "Failed to restore revision: ", err)
+					return false, errors.New("failed to restore revision")
+				}
+
+				audit(p, page.OrganizationID, "restore", "page", null.IntFrom(page.ID), nil, map[string]interface{}{"revisionID": id})
+
+				return true, nil
+			},
+		},
+		"publishPage": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Make current draft of the page visible to readers",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id := int64(p.Args["id"].(int))
+
+				page, err := service.Page.GetByID(id)
+				if err != nil {
+					return false, errors.New("unable to find page with given id")
+				}
+
+				if !page.OrganizationID.Valid {
+					return false, errors.New("only organization pages can be published")
+				}
+
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesPublish)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorizePage(p, page)
+				if err != nil {
+					return false, err
+				}
+
+				err = service.Page.Publish(id)
+				if err != nil {
+					logger.Println(p.Context, "Failed to publish page: ", err)
+					return false, errors.New("failed to publish page")
+				}
+
+				audit(p, page.OrganizationID, "publish", "page", null.IntFrom(id), nil, nil)
+
+				return true, nil
+			},
+		},
+		"importPageTree": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "Import pages exported with exportPageTree under the target page. Returns ID of the imported root page.",
+			Args: graphql.FieldConfigArgument{
+				"targetParentID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"payload": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				parentID := int64(p.Args["targetParentID"].(int))
+
+				parent, err := service.Page.GetByID(parentID)
+				if err != nil {
+					return nil, errors.New("unable to find page with given id")
+				}
+
+				if parent.OrganizationID.Valid {
+					_, err = authorize.AuthorizeOrganization(p.Context, parent.OrganizationID.Int64, domain.PermissionPagesWrite)
+				} else {
+					_, err = authorize.Authorize(p.Context, "superadmin")
+				}
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorizePage(p, parent)
+				if err != nil {
+					return nil, err
+				}
+
+				var tree domain.PageTree
+				err = json.Unmarshal([]byte(p.Args["payload"].(string)), &tree)
+				if err != nil {
+					return nil, errors.New("invalid payload")
+				}
+
+				id, err := service.Page.ImportTree(parentID, tree)
+				if err != nil {
+					logger.Println(p.Context, "Failed to import page tree: ", err)
+					return nil, errors.New("failed to import page tree")
+				}
+
+				page, err := service.Page.GetByID(id)
+				if err == nil {
+					audit(p, page.OrganizationID, "import", "page", null.IntFrom(id), nil, page)
+				}
+
+				return id, nil
+			},
+		},
+		"discardDraft": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Drop unpublished changes of the page and return it to the published version",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id := int64(p.Args["id"].(int))
+
+				page, err := service.Page.GetByID(id)
+				if err != nil {
+					return false, errors.New("unable to find page with given id")
+				}
+
+				if !page.OrganizationID.Valid {
+					return false, errors.New("only organization pages have drafts")
+				}
+
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorizePage(p, page)
+				if err != nil {
+					return false, err
+				}
+
+				if !page.Draft {
+					return true, nil
+				}
+
+				err = service.Page.Discard(id)
+				if err != nil {
+					logger.Println(p.Context, "Failed to discard draft: ", err)
+					return false, errors.New("failed to discard draft")
+				}
+
+				audit(p, page.OrganizationID, "discard", "page", null.IntFrom(id), nil, nil)
+
+				return true, nil
+			},
+		},
+		"rebuildSearchIndex": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Rebuild search index of organization. Admin pages are reindexed if organization is not specified.",
+			Args: graphql.FieldConfigArgument{
+				"organizationID": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				_, err := authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return false, err
+				}
+
+				var organizationID *int64
+				if temp, ok := p.Args["organizationID"].(int); ok && temp != 0 {
+					tempID := int64(temp)
+					organizationID = &tempID
+				}
+
+				err = service.Search.Reindex(organizationID)
+				if err != nil {
+					logger.Println(p.Context, "Failed to rebuild search index: ", err)
+					return false, errors.New("failed to rebuild search index")
+				}
+
+				audit(p, null.IntFromPtr(organizationID), "reindex", "organization", null.IntFromPtr(organizationID), nil, nil)
+
 				return true, nil
 			},
 		},
+		"updatePageAccess": &graphql.Field{
+			Type:        pageType,
+			Description: "Restrict page with its childrens to the users and roles. Members who may restrict pages always see them.",
+			Args: graphql.FieldConfigArgument{
+				"pageID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"restricted": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Boolean),
+				},
+				"userIDs": &graphql.ArgumentConfig{
+					Type: graphql.NewList(graphql.NewNonNull(graphql.Int)),
+				},
+				"roles": &graphql.ArgumentConfig{
+					Type: graphql.NewList(graphql.NewNonNull(roleEnum)),
+				},
+				"roleIDs": &graphql.ArgumentConfig{
+					Type:        graphql.NewList(graphql.NewNonNull(graphql.Int)),
+					Description: "IDs of custom roles",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				pageID := int64(p.Args["pageID"].(int))
+				restricted := p.Args["restricted"].(bool)
+
+				page, err := service.Page.GetByID(pageID)
+				if err != nil || !page.OrganizationID.Valid {
+					return nil, errors.New("unable to find page with given id")
+				}
+
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesRestrict)
+				if err != nil {
+					return nil, err
+				}
+
+				entries, err := pageAccessArgs(p, page.OrganizationID.Int64)
+				if err != nil {
+					return nil, err
+				}
+
+				before, err := service.PageAccess.GetByPageID(pageID)
+				if err != nil {
+					return nil, err
+				}
+
+				err = service.PageAccess.Set(pageID, restricted, entries)
+				if err != nil {
+					logger.Println(p.Context, "Failed to update page access: ", err)
+					return nil, errors.New("failed to update page access")
+				}
+
+				after, err := service.PageAccess.GetByPageID(pageID)
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, page.OrganizationID, "update", "page_access", null.IntFrom(pageID),
+					map[string]interface{}{"restricted": page.Restricted, "access": before},
+					map[string]interface{}{"restricted": restricted, "access": after})
+
+				return service.Page.GetByID(pageID)
+			},
+		},
 		"updatePagesSort": &graphql.Field{
 			Type:        graphql.Boolean,
 			Description: "Update pages order",
@@ -791,7 +2084,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("unable to find page with given id")
 				}
 
-				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, "editor")
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorizePage(p, page)
 				if err != nil {
 					return false, err
 				}
@@ -801,6 +2099,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
+				audit(p, page.OrganizationID, "sort", "page", null.IntFrom(page.ID), nil, map[string]interface{}{"sort": sort})
+
 				return true, nil
 			},
 		},
@@ -857,7 +2157,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("unable to find page fora given block")
 				}
 
-				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, "editor")
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorizePage(p, page)
 				if err != nil {
 					return false, err
 				}
@@ -867,6 +2172,11 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
+				after, err := service.Block.GetByID(int64(id))
+				if err == nil {
+					audit(p, page.OrganizationID, "update", "block", null.IntFrom(block.ID), block, after)
+				}
+
 				return true, nil
 			},
 		},
@@ -894,7 +2204,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("unable to find page with given id")
 				}
 
-				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, "editor")
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorizePage(p, page)
 				if err != nil {
 					return false, err
 				}
@@ -904,6 +2219,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
+				audit(p, page.OrganizationID, "sort", "block", null.Int{}, nil, map[string]interface{}{"pageID": page.ID, "sort": sort})
+
 				return true, nil
 			},
 		},
@@ -932,7 +2249,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("unable to find page for a given file")
 				}
 
-				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, "editor")
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorizePage(p, page)
 				if err != nil {
 					return false, err
 				}
@@ -942,12 +2264,17 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
+				after, err := service.FileBlock.GetByID(int64(id))
+				if err == nil {
+					audit(p, page.OrganizationID, "update", "file_block", null.IntFrom(file.ID), file, after)
+				}
+
 				return true, nil
 			},
 		},
 		"deletePage": &graphql.Field{
 			Type:        graphql.Boolean,
-			Description: "Delete page and all related data",
+			Description: "Delete page and all related data. Published pages stay visible to readers until the deletion is published",
 			Args: graphql.FieldConfigArgument{
 				"id": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Int),
@@ -961,7 +2288,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
-				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, "editor")
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorizePage(p, page)
 				if err != nil {
 					return false, err
 				}
@@ -971,6 +2303,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
+				audit(p, page.OrganizationID, "delete", "page", null.IntFrom(page.ID), page, nil)
+
 				return true, err
 			},
 		},
@@ -995,7 +2329,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
-				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, "editor")
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return false, err
+				}
+
+				err = authorizePage(p, page)
 				if err != nil {
 					return false, err
 				}
@@ -1005,6 +2344,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
+				audit(p, page.OrganizationID, "delete", "block", null.IntFrom(block.ID), block, nil)
+
 				return true, err
 			},
 		},
@@ -1024,7 +2365,7 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, errors.New("unable to find address with given id")
 				}
 
-				_, err = authorize.AuthorizeOrganization(p.Context, block.OrganizationID, "editor")
+				_, err = authorize.AuthorizeOrganization(p.Context, block.OrganizationID, domain.PermissionAddressesManage, domain.ScopeAddressesWrite)
 				if err != nil {
 					return false, err
 				}
@@ -1034,6 +2375,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
+				audit(p, null.IntFrom(block.OrganizationID), "delete", "address", null.IntFrom(addressID), block, nil)
+
 				return true, err
 			},
 		},
@@ -1060,16 +2403,18 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				}
 
 				// Check if user has rights to access requested path.
+				var organizationID null.Int
 				if pathParts[0] == "organization" {
 					id, err := strconv.ParseInt(pathParts[1], 10, 64)
 					if err != nil {
 						return nil, errors.New("invalid organization id")
 					}
 
-					_, err = authorize.AuthorizeOrganization(p.Context, id, "editor")
+					_, err = authorize.AuthorizeOrganization(p.Context, id, domain.PermissionFilesManage)
 					if err != nil {
 						return nil, err
 					}
+					organizationID = null.IntFrom(id)
 				} else if pathParts[0] == "user" {
 					id, err := strconv.ParseInt(pathParts[1], 10, 64)
 					if err != nil {
@@ -1098,6 +2443,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
+				audit(p, organizationID, "delete", "file", null.Int{}, map[string]interface{}{"path": path}, nil)
+
 				return true, err
 			},
 		},
@@ -1129,16 +2476,18 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				}
 
 				// Check if user has rights to access requested path.
+				var organizationID null.Int
 				if pathParts[0] == "organization" {
 					id, err := strconv.ParseInt(pathParts[1], 10, 64)
 					if err != nil {
 						return nil, errors.New("invalid organization id")
 					}
 
-					_, err = authorize.AuthorizeOrganization(p.Context, id, "editor")
+					_, err = authorize.AuthorizeOrganization(p.Context, id, domain.PermissionFilesManage)
 					if err != nil {
 						return nil, err
 					}
+					organizationID = null.IntFrom(id)
 				} else if pathParts[0] == "user" {
 					id, err := strconv.ParseInt(pathParts[1], 10, 64)
 					if err != nil {
@@ -1162,11 +2511,13 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("wrong path")
 				}
 
-				err := service.File.CreateFolder(name, path)
+				err := service.File.CreateFolder(p.Context, name, path)
 				if err != nil {
 					return false, err
 				}
 
+				audit(p, organizationID, "create", "folder", null.Int{}, nil, map[string]interface{}{"path": path + "/" + name})
+
 				return true, nil
 			},
 		},
@@ -1198,16 +2549,18 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				}
 
 				// Check if user has rights to access requested path.
+				var organizationID null.Int
 				if pathParts[0] == "organization" {
 					id, err := strconv.ParseInt(pathParts[1], 10, 64)
 					if err != nil {
 						return nil, errors.New("invalid organization id")
 					}
 
-					_, err = authorize.AuthorizeOrganization(p.Context, id, "editor")
+					_, err = authorize.AuthorizeOrganization(p.Context, id, domain.PermissionFilesManage)
 					if err != nil {
 						return nil, err
 					}
+					organizationID = null.IntFrom(id)
 				} else if pathParts[0] == "user" {
 					id, err := strconv.ParseInt(pathParts[1], 10, 64)
 					if err != nil {
@@ -1234,11 +2587,13 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				pathParts = pathParts[:len(pathParts)-1]
 				newPath := "/" + strings.Join(pathParts, "/") + "/" + name
 
-				err := service.File.RenameFile(path, newPath)
+				err := service.File.RenameFile(p.Context, path, newPath)
 				if err != nil {
 					return false, errors.New("failed to rename")
 				}
 
+				audit(p, organizationID, "rename", "file", null.Int{}, map[string]interface{}{"path": path}, map[string]interface{}{"path": newPath})
+
 				return true, nil
 			},
 		},
@@ -1288,7 +2643,7 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					info = null.StringFrom(temp)
 				}
 
-				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, "editor")
+				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionAddressesManage, domain.ScopeAddressesWrite)
 				if err != nil {
 					return nil, err
 				}
@@ -1303,6 +2658,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, errors.New("failed to get created address")
 				}
 
+				audit(p, null.IntFrom(organizationID), "create", "address", null.IntFrom(id), nil, address)
+
 				return address, nil
 			},
 		},
@@ -1366,7 +2723,7 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, errors.New("address with given id not found")
 				}
 
-				_, err = authorize.AuthorizeOrganization(p.Context, address.OrganizationID, "editor")
+				_, err = authorize.AuthorizeOrganization(p.Context, address.OrganizationID, domain.PermissionAddressesManage, domain.ScopeAddressesWrite)
 				if err != nil {
 					return false, err
 				}
@@ -1376,6 +2733,11 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, errors.New("failed to update address")
 				}
 
+				after, err := service.Address.GetByID(id)
+				if err == nil {
+					audit(p, null.IntFrom(address.OrganizationID), "update", "address", null.IntFrom(id), address, after)
+				}
+
 				return true, nil
 			},
 		},
@@ -1398,7 +2760,7 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					sort[i] = int64(sortTemp[i].(int))
 				}
 
-				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, "editor")
+				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionAddressesManage, domain.ScopeAddressesWrite)
 				if err != nil {
 					return false, err
 				}
@@ -1408,6 +2770,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
+				audit(p, null.IntFrom(organizationID), "sort", "address", null.Int{}, nil, map[string]interface{}{"sort": sort})
+
 				return true, nil
 			},
 		},
@@ -1428,7 +2792,8 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					Type: graphql.String,
 				},
 				"email": &graphql.ArgumentConfig{
-					Type: graphql.String,
+					Type:        graphql.String,
+					Description: "Email is changed once the new address confirms it.",
 				},
 				"type": &graphql.ArgumentConfig{
 					Type: userTypeEnum,
@@ -1459,15 +2824,44 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, errors.New("access denied")
 				}
 
-				if (email != nil || userType != nil) && claims.Type != "superadmin" {
+				if userType != nil && claims.Type != "superadmin" {
 					return false, errors.New("access denied")
 				}
 
-				err = service.User.Update(id, image, firstname, lastname, email, userType)
+				before, err := service.User.GetByID(id)
+				if err != nil {
+					return false, errors.New("user not found")
+				}
+
+				if email != nil && !strings.EqualFold(*email, before.Email) {
+					err = authorize.NotImpersonated(p.Context)
+					if err != nil {
+						return false, err
+					}
+
+					err = service.RateLimit.Check("email_change", requestInfo(p).IP, strconv.FormatInt(id, 10))
+					if err != nil {
+						return false, err
+					}
+
+					err = service.User.RequestEmailChange(id, *email)
+					if err != nil {
+						return false, err
+					}
+
+					audit(p, null.Int{}, "request_email_change", "user", null.IntFrom(id), nil, map[string]interface{}{"email": *email})
+				}
+
+				err = service.User.Update(id, image, firstname, lastname, userType)
 				if err != nil {
 					return false, errors.New("failed to update user")
 				}
 
+				after, err := service.User.GetByID(id)
+				if err == nil {
+					audit(p, null.Int{}, "update", "user", null.IntFrom(id), before, after)
+				}
+
 				return true, nil
 			},
 		},
@@ -1478,6 +2872,10 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				"organizationID": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Int),
 				},
+				"mode": &graphql.ArgumentConfig{
+					Type:         copyJobModeEnum,
+					DefaultValue: "all_or_nothing",
+				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 				_, err := authorize.Authorize(p.Context, "superadmin")
@@ -1486,19 +2884,92 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				}
 
 				organizationID := int64(p.Args["organizationID"].(int))
+				mode, _ := p.Args["mode"].(string)
+
 				organization, err := service.Organization.GetByID(organizationID)
 				if err != nil {
 					return false, errors.New("organization not found")
 				}
 
-				err = service.Organization.CopyDefaultContent(organizationID, organization.Plan)
+				err = service.Organization.CopyDefaultContent(organizationID, organization.Plan, mode)
 				if err != nil {
 					return false, errors.New("failed to copy content")
 				}
 
+				audit(p, null.IntFrom(organizationID), "copy_content", "organization", null.IntFrom(organizationID), nil, map[string]interface{}{"plan": organization.Plan, "mode": mode})
+
+				return true, nil
+			},
+		},
+		"retryContentCopyJob": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Run the last content copy job of organization again. Already copied pages are skipped. Unfinished job can be run again only after it made no progress for 30 minutes.",
+			Args: graphql.FieldConfigArgument{
+				"organizationID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				_, err := authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return nil, err
+				}
+
+				organizationID := int64(p.Args["organizationID"].(int))
+
+				err = service.Organization.RetryCopyJob(organizationID)
+				if err != nil {
+					return false, err
+				}
+
+				audit(p, null.IntFrom(organizationID), "retry_copy_content", "organization", null.IntFrom(organizationID), nil, nil)
+
 				return true, nil
 			},
 		},
+		"syncDefaultContent": &graphql.Field{
+			Type:        graphql.NewList(syncChangeType),
+			Description: "Apply changes of default content to the organization pages which were not customised. With dryRun changes are only listed.",
+			Args: graphql.FieldConfigArgument{
+				"organizationID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"dryRun": &graphql.ArgumentConfig{
+					Type:         graphql.Boolean,
+					DefaultValue: true,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				organizationID := int64(p.Args["organizationID"].(int))
+				dryRun, _ := p.Args["dryRun"].(bool)
+
+				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionContentSync)
+				if err != nil {
+					return nil, err
+				}
+
+				organization, err := service.Organization.GetByID(organizationID)
+				if err != nil {
+					return nil, errors.New("organization not found")
+				}
+
+				if organization.Status == "blocked" {
+					return nil, errors.New("access denied")
+				}
+
+				changes, err := service.Organization.SyncDefaultContent(organizationID, dryRun)
+				if err != nil {
+					logger.Println(p.Context, "Failed to sync default content: ", err)
+					return nil, errors.New("failed to sync default content")
+				}
+
+				if !dryRun {
+					audit(p, null.IntFrom(organizationID), "sync_content", "organization", null.IntFrom(organizationID), nil, map[string]interface{}{"changes": len(changes)})
+				}
+
+				return changes, nil
+			},
+		},
 		"inviteUser": &graphql.Field{
 			Type:        graphql.Boolean,
 			Description: "Invite user to the organization.",
@@ -1518,7 +2989,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				email := p.Args["email"].(string)
 				role := p.Args["role"].(string)
 
-				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, "admin")
+				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionUsersInvite)
+				if err != nil {
+					return false, err
+				}
+
+				err = canGrant(p, organizationID, domain.RolePermissions[role])
 				if err != nil {
 					return false, err
 				}
@@ -1537,6 +3013,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return false, err
 				}
 
+				var userID null.Int
+				if user, err := service.User.GetByEmail(email); err == nil {
+					userID = null.IntFrom(user.ID)
+				}
+				audit(p, null.IntFrom(organizationID), "invite", "organization_user", userID, nil, map[string]interface{}{"email": email, "role": role})
+
 				return true, nil
 			},
 		},
@@ -1555,7 +3037,7 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				organizationID := int64(p.Args["organizationID"].(int))
 				userID := int64(p.Args["userID"].(int))
 
-				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, "admin")
+				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionUsersManage)
 				if err != nil {
 					return false, err
 				}
@@ -1569,11 +3051,15 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("access denied")
 				}
 
+				before := organizationUserRole(organizationID, userID)
+
 				err = service.User.DeleteOrganizationUser(organizationID, userID)
 				if err != nil {
 					return false, err
 				}
 
+				audit(p, null.IntFrom(organizationID), "delete", "organization_user", null.IntFrom(userID), before, nil)
+
 				return true, nil
 			},
 		},
@@ -1596,7 +3082,12 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				userID := int64(p.Args["userID"].(int))
 				role := p.Args["role"].(string)
 
-				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, "admin")
+				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionUsersManage)
+				if err != nil {
+					return false, err
+				}
+
+				err = canGrant(p, organizationID, append(memberPermissions(organizationID, userID), domain.RolePermissions[role]...))
 				if err != nil {
 					return false, err
 				}
@@ -1610,11 +3101,194 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 					return nil, errors.New("access denied")
 				}
 
+				before := organizationUserRole(organizationID, userID)
+
 				err = service.User.UpdateOrganizationUser(organizationID, userID, role)
 				if err != nil {
 					return false, err
 				}
 
+				audit(p, null.IntFrom(organizationID), "update", "organization_user", null.IntFrom(userID), before, map[string]interface{}{"role": role})
+
+				return true, nil
+			},
+		},
+		"createOrganizationRole": &graphql.Field{
+			Type:        organizationRoleType,
+			Description: "Create custom role of the organization.",
+			Args: graphql.FieldConfigArgument{
+				"organizationID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"permissions": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(permissionEnum))),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				organizationID := int64(p.Args["organizationID"].(int))
+				name := p.Args["name"].(string)
+				permissions := permissionsArg(p)
+
+				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionRolesManage)
+				if err != nil {
+					return nil, err
+				}
+
+				err = canGrant(p, organizationID, permissions)
+				if err != nil {
+					return nil, err
+				}
+
+				id, err := service.Role.Create(organizationID, name, permissions)
+				if err != nil {
+					return nil, err
+				}
+
+				role, err := service.Role.GetByID(id)
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, null.IntFrom(organizationID), "create", "organization_role", null.IntFrom(id), nil, role)
+
+				return role, nil
+			},
+		},
+		"updateOrganizationRole": &graphql.Field{
+			Type:        organizationRoleType,
+			Description: "Update custom role. Members of the role get the new permissions immediately.",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"permissions": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(permissionEnum))),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id := int64(p.Args["id"].(int))
+				name := p.Args["name"].(string)
+				permissions := permissionsArg(p)
+
+				before, err := service.Role.GetByID(id)
+				if err != nil {
+					return nil, errors.New("unable to find role with given id")
+				}
+
+				_, err = authorize.AuthorizeOrganization(p.Context, before.OrganizationID, domain.PermissionRolesManage)
+				if err != nil {
+					return nil, err
+				}
+
+				err = canGrant(p, before.OrganizationID, append(before.PermissionList(), permissions...))
+				if err != nil {
+					return nil, err
+				}
+
+				err = service.Role.Update(id, name, permissions)
+				if err != nil {
+					return nil, err
+				}
+
+				role, err := service.Role.GetByID(id)
+				if err != nil {
+					return nil, err
+				}
+
+				audit(p, null.IntFrom(role.OrganizationID), "update", "organization_role", null.IntFrom(id), before, role)
+
+				return role, nil
+			},
+		},
+		"deleteOrganizationRole": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Delete custom role. Role assigned to users can't be deleted.",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id := int64(p.Args["id"].(int))
+
+				role, err := service.Role.GetByID(id)
+				if err != nil {
+					return false, errors.New("unable to find role with given id")
+				}
+
+				_, err = authorize.AuthorizeOrganization(p.Context, role.OrganizationID, domain.PermissionRolesManage)
+				if err != nil {
+					return false, err
+				}
+
+				err = service.Role.Delete(id)
+				if err != nil {
+					return false, err
+				}
+
+				audit(p, null.IntFrom(role.OrganizationID), "delete", "organization_role", null.IntFrom(id), role, nil)
+
+				return true, nil
+			},
+		},
+		"assignOrganizationRole": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Give custom role to the member of the organization. Use updateOrganizationUser to go back to a built-in role.",
+			Args: graphql.FieldConfigArgument{
+				"organizationID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"userID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"roleID": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				organizationID := int64(p.Args["organizationID"].(int))
+				userID := int64(p.Args["userID"].(int))
+				roleID := int64(p.Args["roleID"].(int))
+
+				_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionUsersManage)
+				if err != nil {
+					return false, err
+				}
+
+				role, err := service.Role.GetByID(roleID)
+				if err != nil || role.OrganizationID != organizationID {
+					return false, errors.New("unable to find role with given id")
+				}
+
+				err = canGrant(p, organizationID, append(memberPermissions(organizationID, userID), role.PermissionList()...))
+				if err != nil {
+					return false, err
+				}
+
+				organization, err := service.Organization.GetByID(organizationID)
+				if err != nil {
+					return nil, err
+				}
+
+				if organization.Status == "blocked" {
+					return nil, errors.New("access denied")
+				}
+
+				before := organizationUserRole(organizationID, userID)
+
+				err = service.Role.Assign(organizationID, userID, roleID)
+				if err != nil {
+					return false, err
+				}
+
+				audit(p, null.IntFrom(organizationID), "update", "organization_user", null.IntFrom(userID), before, map[string]interface{}{"role": "user", "roleID": roleID})
+
 				return true, nil
 			},
 		},
@@ -42,6 +42,10 @@ var organizationType = graphql.NewObject(
 			"status": &graphql.Field{
 				Type: organizationStatusEnum,
 			},
+			"require2FA": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Owners and admins have to use two-factor authentication.",
+			},
 			"createdAt": &graphql.Field{
 				Type: graphql.DateTime,
 			},
@@ -53,7 +57,7 @@ var organizationType = graphql.NewObject(
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 					organizationID := p.Source.(domain.Organization).ID
 
-					_, err := authorize.AuthorizeOrganization(p.Context, organizationID, "user")
+					_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionUsersRead)
 					if err != nil {
 						return nil, err
 					}
@@ -72,12 +76,24 @@ var organizationType = graphql.NewObject(
 						return nil, errors.New("access denied")
 					}
 
-					_, err := authorize.AuthorizeOrganization(p.Context, organizationID, "user")
+					_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionPagesRead, domain.ScopeContentRead)
 					if err != nil {
 						return nil, err
 					}
 
 					pages, err := service.Page.GetPages(&organizationID)
+					if err != nil {
+						return nil, err
+					}
+
+					pages, err = filterPages(p, organizationID, pages)
+					if err != nil {
+						return nil, err
+					}
+
+					if isReader(p, organizationID) {
+						return service.Page.FilterPublished(pages)
+					}
 
 					return pages, err
 				},
@@ -91,7 +107,7 @@ var organizationType = graphql.NewObject(
 						return nil, errors.New("access denied")
 					}
 
-					_, err := authorize.AuthorizeOrganization(p.Context, organizationID, "user")
+					_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionAddressesRead, domain.ScopeContentRead, domain.ScopeAddressesWrite)
 					if err != nil {
 						return nil, err
 					}
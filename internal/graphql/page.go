@@ -44,6 +44,17 @@ var pageType = graphql.NewObject(
 			"sort": &graphql.Field{
 				Type: graphql.Int,
 			},
+			"draft": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Page has changes which are not published yet",
+			},
+			"restricted": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Page and its childrens are visible only to the users and roles in access",
+			},
+			"publishedRevisionID": &graphql.Field{
+				Type: NullableInt,
+			},
 			"plans": &graphql.Field{
 				Type: graphql.NewList(planEnum),
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
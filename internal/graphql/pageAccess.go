@@ -0,0 +1,108 @@
+package graphql
+
+import (
+	"errors"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/graphql-go/graphql"
+	"gopkg.in/guregu/null.v4"
+)
+
+var pageAccessType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name:        "PageAccess",
+		Description: "User, role or custom role allowed to see the restricted page",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"pageID": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"userID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"role": &graphql.Field{
+				Type: roleEnum,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.PageAccess).Role.Ptr(), nil
+				},
+			},
+			"roleID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+// pageRestrictions returns pages of the organization hidden from the current user.
+func pageRestrictions(p graphql.ResolveParams, organizationID int64) (domain.PageRestrictions, error) {
+	claims, ok := p.Context.Value(domain.UserClaimsKey).(*domain.Claims)
+	if !ok {
+		return domain.PageRestrictions{}, errors.New("access denied")
+	}
+
+	return service.PageAccess.Restrictions(organizationID, claims)
+}
+
+// authorizePage checks that the page of the organization isn't hidden from the current
+// user. Pages without organization are never restricted.
+func authorizePage(p graphql.ResolveParams, page domain.Page) error {
+	if !page.OrganizationID.Valid {
+		return nil
+	}
+
+	restrictions, err := pageRestrictions(p, page.OrganizationID.Int64)
+	if err != nil {
+		return err
+	}
+
+	if !restrictions.Allowed(page.ID) {
+		return errors.New("access denied")
+	}
+
+	return nil
+}
+
+// filterPages drops pages of the organization hidden from the current user.
+func filterPages(p graphql.ResolveParams, organizationID int64, pages []domain.Page) ([]domain.Page, error) {
+	restrictions, err := pageRestrictions(p, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return restrictions.Filter(pages), nil
+}
+
+func pageAccessArgs(p graphql.ResolveParams, organizationID int64) ([]domain.PageAccess, error) {
+	entries := make([]domain.PageAccess, 0)
+
+	if temp, ok := p.Args["userIDs"].([]interface{}); ok {
+		for _, id := range temp {
+			userID := int64(id.(int))
+			if memberPermissions(organizationID, userID) == nil {
+				return nil, errors.New("user is not a member of the organization")
+			}
+			entries = append(entries, domain.PageAccess{UserID: null.IntFrom(userID)})
+		}
+	}
+	if temp, ok := p.Args["roles"].([]interface{}); ok {
+		for _, role := range temp {
+			entries = append(entries, domain.PageAccess{Role: null.StringFrom(role.(string))})
+		}
+	}
+	if temp, ok := p.Args["roleIDs"].([]interface{}); ok {
+		for _, id := range temp {
+			role, err := service.Role.GetByID(int64(id.(int)))
+			if err != nil || role.OrganizationID != organizationID {
+				return nil, errors.New("unable to find role with given id")
+			}
+			entries = append(entries, domain.PageAccess{RoleID: null.IntFrom(role.ID)})
+		}
+	}
+
+	return entries, nil
+}
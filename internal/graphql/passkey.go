@@ -0,0 +1,45 @@
+package graphql
+
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/graphql-go/graphql"
+)
+
+var passkeyType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Passkey",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"name": &graphql.Field{
+				Type: graphql.String,
+			},
+			"lastUsedAt": &graphql.Field{
+				Type: graphql.DateTime,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.Passkey).LastUsedAt.Ptr(), nil
+				},
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+var passkeyLoginType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "PasskeyLogin",
+		Fields: graphql.Fields{
+			"challengeToken": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Pass to finishPasskeyLogin.",
+			},
+			"options": &graphql.Field{
+				Type:        graphql.String,
+				Description: "JSON of options for navigator.credentials.get. Binary values are base64url encoded.",
+			},
+		},
+	},
+)
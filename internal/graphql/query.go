@@ -2,6 +2,7 @@ package graphql
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
@@ -9,6 +10,8 @@ import (
 
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/authorize"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/logger"
+	s "bitbucket.org/ibros_nsk/krisenkompass-backend/internal/service"
 	"github.com/graphql-go/graphql"
 )
 
@@ -89,6 +92,192 @@ var queryType = graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: gr
 			return users, nil
 		},
 	},
+	"twoFactor": &graphql.Field{
+		Type:        twoFactorStatusType,
+		Description: "Get two-factor authentication status of the current user",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			claims, err := authorize.Authorize(p.Context, "user", "demo")
+			if err != nil {
+				return nil, err
+			}
+
+			return service.Auth.GetTwoFactor(claims.UserID)
+		},
+	},
+	"ssoConfig": &graphql.Field{
+		Type:        ssoConfigType,
+		Description: "Get OpenID Connect configuration of the organization",
+		Args: graphql.FieldConfigArgument{
+			"organizationID": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.Int),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			organizationID := int64(p.Args["organizationID"].(int))
+
+			_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionOrganizationSecurity)
+			if err != nil {
+				return nil, err
+			}
+
+			config, err := service.SSO.GetConfig(organizationID)
+			if err == sql.ErrNoRows {
+				return nil, nil
+			}
+			return config, err
+		},
+	},
+	"myAPIKeys": &graphql.Field{
+		Type:        graphql.NewList(apiKeyType),
+		Description: "Get personal access tokens of the current user",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			claims, err := authorize.Authorize(p.Context, "user")
+			if err != nil {
+				return nil, err
+			}
+
+			return service.APIKey.GetByUserID(claims.UserID)
+		},
+	},
+	"organizationAPIKeys": &graphql.Field{
+		Type:        graphql.NewList(apiKeyType),
+		Description: "Get API keys of the organization",
+		Args: graphql.FieldConfigArgument{
+			"organizationID": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.Int),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			organizationID := int64(p.Args["organizationID"].(int))
+
+			_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionOrganizationSecurity)
+			if err != nil {
+				return nil, err
+			}
+
+			return service.APIKey.GetByOrganizationID(organizationID)
+		},
+	},
+	"permissions": &graphql.Field{
+		Type:        graphql.NewList(permissionType),
+		Description: "Get permissions which custom roles can be built from",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			_, err := authorize.Authorize(p.Context, "user")
+			if err != nil {
+				return nil, err
+			}
+
+			return domain.PermissionCatalog, nil
+		},
+	},
+	"organizationRoles": &graphql.Field{
+		Type:        graphql.NewList(organizationRoleType),
+		Description: "Get custom roles of the organization",
+		Args: graphql.FieldConfigArgument{
+			"organizationID": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.Int),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			organizationID := int64(p.Args["organizationID"].(int))
+
+			_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionUsersRead)
+			if err != nil {
+				return nil, err
+			}
+
+			return service.Role.GetByOrganizationID(organizationID)
+		},
+	},
+	"myEmailChange": &graphql.Field{
+		Type:        userEmailChangeType,
+		Description: "Get email change of the current user waiting for confirmation",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			claims, err := authorize.Authorize(p.Context, "user", "demo")
+			if err != nil {
+				return nil, err
+			}
+
+			change, err := service.User.GetPendingEmailChange(claims.UserID)
+			if err == sql.ErrNoRows {
+				return nil, nil
+			}
+			return change, err
+		},
+	},
+	"myPasskeys": &graphql.Field{
+		Type:        graphql.NewList(passkeyType),
+		Description: "Get passkeys of the current user",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			claims, err := authorize.Authorize(p.Context, "user", "demo")
+			if err != nil {
+				return nil, err
+			}
+
+			return service.Passkey.GetByUserID(claims.UserID)
+		},
+	},
+	"loginHistory": &graphql.Field{
+		Type:        loginHistoryType,
+		Description: "Get successful and failed logins of the user, newest first. Superadmins can get history of any user, others only their own.",
+		Args: graphql.FieldConfigArgument{
+			"userID": &graphql.ArgumentConfig{
+				Type:        graphql.Int,
+				Description: "Current user if not set.",
+			},
+			"cursor": &graphql.ArgumentConfig{
+				Type: graphql.Int,
+			},
+			"limit": &graphql.ArgumentConfig{
+				Type: graphql.Int,
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			claims, err := authorize.Authorize(p.Context, "user", "demo")
+			if err != nil {
+				return nil, err
+			}
+
+			userID := claims.UserID
+			if temp, ok := p.Args["userID"].(int); ok && int64(temp) != claims.UserID {
+				if claims.Type != "superadmin" {
+					return nil, errors.New("access denied")
+				}
+				userID = int64(temp)
+			}
+
+			cursor, _ := p.Args["cursor"].(int)
+			limit, ok := p.Args["limit"].(int)
+			if !ok || limit <= 0 || limit > s.LoginHistoryLimit {
+				limit = s.LoginHistoryLimit
+			}
+
+			events, err := service.Auth.GetLoginHistory(userID, int64(cursor), limit)
+			if err != nil {
+				return nil, err
+			}
+
+			result := loginHistory{Events: events}
+			if len(events) == limit {
+				next := events[len(events)-1].ID
+				result.NextCursor = &next
+			}
+
+			return result, nil
+		},
+	},
+	"mySessions": &graphql.Field{
+		Type:        graphql.NewList(sessionType),
+		Description: "Get active sessions of the current user",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			claims, err := authorize.Authorize(p.Context, "user", "demo")
+			if err != nil {
+				return nil, err
+			}
+
+			return service.Auth.GetSessions(claims.UserID, claims.SessionID)
+		},
+	},
 	"userVerification": &graphql.Field{
 		Type:        userVerificationType,
 		Description: "Get user verification",
@@ -121,7 +310,7 @@ var queryType = graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: gr
 			}
 
 			if page.OrganizationID.Valid {
-				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, "user")
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesRead, domain.ScopeContentRead)
 				if err != nil {
 					return nil, err
 				}
@@ -134,6 +323,24 @@ var queryType = graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: gr
 				if organization.Status == "blocked" {
 					return nil, errors.New("access denied")
 				}
+
+				err = authorizePage(p, page)
+				if err != nil {
+					return nil, err
+				}
+
+				if isReader(p, page.OrganizationID.Int64) {
+					published, ok, err := service.Page.GetPublished(page)
+					if err != nil {
+						return nil, err
+					}
+
+					if !ok {
+						return nil, errors.New("page is not published")
+					}
+
+					return published, nil
+				}
 			} else {
 				_, err := authorize.Authorize(p.Context, "superadmin")
 				if err != nil {
@@ -161,11 +368,10 @@ var queryType = graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: gr
 			}
 
 			if organizationID != nil {
-				_, err := authorize.AuthorizeOrganization(p.Context, *organizationID, "user")
+				_, err := authorize.AuthorizeOrganization(p.Context, *organizationID, domain.PermissionPagesRead, domain.ScopeContentRead)
 				if err != nil {
 					return nil, err
 				}
-				
 				organization, err := service.Organization.GetByID(*organizationID)
 				if err != nil {
 					return nil, err
@@ -183,10 +389,48 @@ var queryType = graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: gr
 			}
 
 			pages, err := service.Page.GetPages(organizationID)
+			if err != nil {
+				return nil, err
+			}
+
+			if organizationID != nil {
+				pages, err = filterPages(p, *organizationID, pages)
+				if err != nil {
+					return nil, err
+				}
+
+				if isReader(p, *organizationID) {
+					return service.Page.FilterPublished(pages)
+				}
+			}
 
 			return pages, err
 		},
 	},
+	"drafts": &graphql.Field{
+		Type:        graphql.NewList(pageType),
+		Description: "Get pages of organization with unpublished changes",
+		Args: graphql.FieldConfigArgument{
+			"organizationID": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.Int),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			organizationID := int64(p.Args["organizationID"].(int))
+
+			_, err := authorize.AuthorizeOrganization(p.Context, organizationID, domain.PermissionPagesWrite)
+			if err != nil {
+				return nil, err
+			}
+
+			pages, err := service.Page.GetDrafts(organizationID)
+			if err != nil {
+				return nil, err
+			}
+
+			return filterPages(p, organizationID, pages)
+		},
+	},
 	"fileBlock": &graphql.Field{
 		Type:        fileBlockType,
 		Description: "Get file block by id",
@@ -200,6 +444,48 @@ var queryType = graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: gr
 			if err != nil {
 				return nil, err
 			}
+
+			// File block has the ID of its page.
+			page, err := service.Page.GetByID(file.ID)
+			if err != nil {
+				return nil, errors.New("unable to find page for a given file")
+			}
+
+			if page.OrganizationID.Valid {
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesRead, domain.ScopeContentRead)
+				if err != nil {
+					return nil, err
+				}
+
+				organization, err := service.Organization.GetByID(page.OrganizationID.Int64)
+				if err != nil {
+					return nil, err
+				}
+
+				if organization.Status == "blocked" {
+					return nil, errors.New("access denied")
+				}
+
+				err = authorizePage(p, page)
+				if err != nil {
+					return nil, err
+				}
+
+				// Readers get the file of published revision, not the draft.
+				if isReader(p, page.OrganizationID.Int64) {
+					_, ok, err := service.Page.GetPublished(page)
+					if err != nil {
+						return nil, err
+					}
+
+					if !ok {
+						return nil, errors.New("page is not published")
+					}
+
+					return service.FileBlock.GetPublishedByPageID(page)
+				}
+			}
+
 			return file, err
 		},
 	},
@@ -231,7 +517,7 @@ var queryType = graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: gr
 					return nil, errors.New("invalid organization id")
 				}
 
-				_, err = authorize.AuthorizeOrganization(p.Context, id, "user")
+				_, err = authorize.AuthorizeOrganization(p.Context, id, domain.PermissionFilesRead, domain.ScopeFilesWrite)
 				if err != nil {
 					return nil, err
 				}
@@ -290,4 +576,293 @@ var queryType = graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: gr
 			return pages, err
 		},
 	},
+	"search": &graphql.Field{
+		Type:        graphql.NewList(searchHitType),
+		Description: "Search pages and blocks of organization. Admin pages are searched if organization is not specified.",
+		Args: graphql.FieldConfigArgument{
+			"organizationID": &graphql.ArgumentConfig{
+				Type: graphql.Int,
+			},
+			"query": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+			"languageTag": &graphql.ArgumentConfig{
+				Type: graphql.String,
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			var organizationID *int64
+			tempOrganizationID, ok := p.Args["organizationID"].(int)
+			if ok && tempOrganizationID != 0 {
+				tempID := int64(tempOrganizationID)
+				organizationID = &tempID
+			}
+
+			published := false
+			if organizationID != nil {
+				_, err := authorize.AuthorizeOrganization(p.Context, *organizationID, domain.PermissionPagesRead, domain.ScopeContentRead)
+				if err != nil {
+					return nil, err
+				}
+
+				organization, err := service.Organization.GetByID(*organizationID)
+				if err != nil {
+					return nil, err
+				}
+
+				if organization.Status == "blocked" {
+					return nil, errors.New("access denied")
+				}
+
+				published = isReader(p, *organizationID)
+			} else {
+				_, err := authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			languageTag, _ := p.Args["languageTag"].(string)
+
+			hits, err := service.Search.Search(organizationID, p.Args["query"].(string), languageTag, published)
+			if err != nil || organizationID == nil {
+				return hits, err
+			}
+
+			restrictions, err := pageRestrictions(p, *organizationID)
+			if err != nil {
+				return nil, err
+			}
+
+			allowed := make([]domain.SearchHit, 0, len(hits))
+			for _, hit := range hits {
+				if restrictions.Allowed(hit.PageID) {
+					allowed = append(allowed, hit)
+				}
+			}
+
+			return allowed, nil
+		},
+	},
+	"auditLog": &graphql.Field{
+		Type:        auditLogType,
+		Description: "Get audit log of organization, newest first. Log of all organizations is returned if organization is not specified.",
+		Args: graphql.FieldConfigArgument{
+			"organizationID": &graphql.ArgumentConfig{
+				Type: graphql.Int,
+			},
+			"filter": &graphql.ArgumentConfig{
+				Type: auditFilterInput,
+			},
+			"cursor": &graphql.ArgumentConfig{
+				Type: graphql.Int,
+			},
+			"limit": &graphql.ArgumentConfig{
+				Type: graphql.Int,
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			var organizationID *int64
+			tempOrganizationID, ok := p.Args["organizationID"].(int)
+			if ok && tempOrganizationID != 0 {
+				tempID := int64(tempOrganizationID)
+				organizationID = &tempID
+			}
+
+			if organizationID != nil {
+				_, err := authorize.AuthorizeOrganization(p.Context, *organizationID, domain.PermissionAuditRead)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				_, err := authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			var filter domain.AuditFilter
+			if temp, ok := p.Args["filter"].(map[string]interface{}); ok {
+				filter = auditFilter(temp)
+			}
+
+			cursor, _ := p.Args["cursor"].(int)
+			limit, ok := p.Args["limit"].(int)
+			if !ok || limit <= 0 || limit > s.AuditLimit {
+				limit = s.AuditLimit
+			}
+
+			entries, err := service.Audit.Get(organizationID, filter, int64(cursor), limit)
+			if err != nil {
+				return nil, err
+			}
+
+			result := auditLog{Entries: entries}
+			if len(entries) == limit {
+				next := entries[len(entries)-1].ID
+				result.NextCursor = &next
+			}
+
+			return result, nil
+		},
+	},
+	"exportPageTree": &graphql.Field{
+		Type:        graphql.String,
+		Description: "Export page with all childrens, blocks and used files as JSON, which can be imported with importPageTree",
+		Args: graphql.FieldConfigArgument{
+			"pageID": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.Int),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			pageID := int64(p.Args["pageID"].(int))
+
+			page, err := service.Page.GetByID(pageID)
+			if err != nil {
+				return nil, errors.New("unable to find page with given id")
+			}
+
+			var restrictions domain.PageRestrictions
+			if page.OrganizationID.Valid {
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return nil, err
+				}
+
+				restrictions, err = pageRestrictions(p, page.OrganizationID.Int64)
+				if err != nil {
+					return nil, err
+				}
+
+				if !restrictions.Allowed(page.ID) {
+					return nil, errors.New("access denied")
+				}
+			} else {
+				_, err = authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			tree, err := service.Page.ExportTree(pageID, restrictions)
+			if err != nil {
+				logger.Println(p.Context, "Failed to export page tree: ", err)
+				return nil, errors.New("failed to export page tree")
+			}
+
+			payload, err := json.Marshal(tree)
+			if err != nil {
+				return nil, err
+			}
+
+			return string(payload), nil
+		},
+	},
+	"contentCopyJob": &graphql.Field{
+		Type:        contentCopyJobType,
+		Description: "Get the last default content copy job of organization",
+		Args: graphql.FieldConfigArgument{
+			"organizationID": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.Int),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			_, err := authorize.Authorize(p.Context, "superadmin")
+			if err != nil {
+				return nil, err
+			}
+
+			organizationID := int64(p.Args["organizationID"].(int))
+
+			job, err := service.Organization.GetCopyJob(organizationID)
+			if err != nil {
+				return nil, errors.New("content copy job not found")
+			}
+
+			return job, nil
+		},
+	},
+	"pageRevisions": &graphql.Field{
+		Type:        graphql.NewList(revisionType),
+		Description: "Get history of the page, newest first",
+		Args: graphql.FieldConfigArgument{
+			"pageID": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.Int),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			pageID := int64(p.Args["pageID"].(int))
+
+			page, err := service.Page.GetByID(pageID)
+			if err != nil {
+				return nil, errors.New("unable to find page with given id")
+			}
+
+			if page.OrganizationID.Valid {
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorizePage(p, page)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				_, err := authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			revisions, err := service.Revision.GetByPageID(pageID)
+
+			return revisions, err
+		},
+	},
+	"blockRevisions": &graphql.Field{
+		Type:        graphql.NewList(revisionType),
+		Description: "Get history of the block, newest first",
+		Args: graphql.FieldConfigArgument{
+			"blockID": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.Int),
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			blockID := int64(p.Args["blockID"].(int))
+
+			revisions, err := service.Revision.GetByBlockID(blockID)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(revisions) == 0 {
+				return revisions, nil
+			}
+
+			page, err := service.Page.GetByID(revisions[0].PageID)
+			if err != nil {
+				return nil, errors.New("unable to find page for a given block")
+			}
+
+			if page.OrganizationID.Valid {
+				_, err = authorize.AuthorizeOrganization(p.Context, page.OrganizationID.Int64, domain.PermissionPagesWrite)
+				if err != nil {
+					return nil, err
+				}
+
+				err = authorizePage(p, page)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				_, err := authorize.Authorize(p.Context, "superadmin")
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			return revisions, nil
+		},
+	},
 }})
@@ -0,0 +1,56 @@
+package graphql
+
+import (
+	"encoding/json"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/graphql-go/graphql"
+)
+
+var revisionType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Revision",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"pageID": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"blockID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"page": &graphql.Field{
+				Type:        pageType,
+				Description: "Page as it was at the moment of the revision",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					data, err := revisionData(p.Source.(domain.Revision))
+					if err != nil {
+						return nil, err
+					}
+					return data.Page, nil
+				},
+			},
+			"blocks": &graphql.Field{
+				Type:        graphql.NewList(blockType),
+				Description: "Blocks of the page in the saved sort order",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					data, err := revisionData(p.Source.(domain.Revision))
+					if err != nil {
+						return nil, err
+					}
+					return data.Blocks, nil
+				},
+			},
+		},
+	},
+)
+
+func revisionData(revision domain.Revision) (domain.RevisionData, error) {
+	var data domain.RevisionData
+	err := json.Unmarshal([]byte(revision.Data), &data)
+	return data, err
+}
@@ -0,0 +1,123 @@
+package graphql
+
+import (
+	"errors"
+	"strings"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/graphql-go/graphql"
+)
+
+var permissionEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name:        "permission",
+	Values:      permissionEnumValues(),
+	Description: "Permission enum",
+})
+
+// permissionEnumValues builds the enum from the catalog, e.g. "pages.read" is pages_read.
+func permissionEnumValues() graphql.EnumValueConfigMap {
+	values := make(graphql.EnumValueConfigMap)
+	for _, permission := range domain.PermissionCatalog {
+		values[strings.ReplaceAll(permission.Name, ".", "_")] = &graphql.EnumValueConfig{
+			Value:       permission.Name,
+			Description: permission.Description,
+		}
+	}
+	return values
+}
+
+var permissionType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Permission",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{
+				Type: permissionEnum,
+			},
+			"description": &graphql.Field{
+				Type: graphql.String,
+			},
+		},
+	},
+)
+
+var organizationRoleType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name:        "OrganizationRole",
+		Description: "Custom role of the organization",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"organizationID": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"name": &graphql.Field{
+				Type: graphql.String,
+			},
+			"permissions": &graphql.Field{
+				Type: graphql.NewList(permissionEnum),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.OrganizationRole).PermissionList(), nil
+				},
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"updatedAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+func permissionsArg(p graphql.ResolveParams) []string {
+	permissions := make([]string, 0)
+	if temp, ok := p.Args["permissions"].([]interface{}); ok {
+		for _, permission := range temp {
+			permissions = append(permissions, permission.(string))
+		}
+	}
+	return permissions
+}
+
+// canGrant checks that the current user has all the permissions in the organization,
+// so nobody can give more access than they have.
+func canGrant(p graphql.ResolveParams, organizationID int64, permissions []string) error {
+	claims, ok := p.Context.Value(domain.UserClaimsKey).(*domain.Claims)
+	if !ok {
+		return errors.New("access denied")
+	}
+	if claims.Type == "superadmin" {
+		return nil
+	}
+
+	own := make(map[string]bool)
+	for _, permission := range claims.Permissions[organizationID] {
+		own[permission] = true
+	}
+
+	for _, permission := range permissions {
+		if !own[permission] {
+			return errors.New("permission " + permission + " can't be granted")
+		}
+	}
+
+	return nil
+}
+
+// memberPermissions returns a copy of current permissions of the user in the
+// organization, so it's safe to append to it.
+func memberPermissions(organizationID, userID int64) []string {
+	organizationUsers, err := service.OrganizationUser.GetByUserID(userID)
+	if err != nil {
+		return nil
+	}
+
+	for _, organizationUser := range organizationUsers {
+		if organizationUser.OrganizationID == organizationID {
+			return append([]string{}, organizationUser.Permissions()...)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package graphql
+
+import "github.com/graphql-go/graphql"
+
+var searchHitType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "SearchHit",
+		Fields: graphql.Fields{
+			"pageID": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"blockID": &graphql.Field{
+				Type: NullableInt,
+			},
+			"title": &graphql.Field{
+				Type: graphql.String,
+			},
+			"snippet": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Part of the block text around the match, without HTML",
+			},
+			"score": &graphql.Field{
+				Type: graphql.Float,
+			},
+			"link": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Link to the page with #block-N anchor",
+			},
+			"breadcrumbs": &graphql.Field{
+				Type:        graphql.NewList(pageType),
+				Description: "Pages from the root page to the found page",
+			},
+		},
+	},
+)
@@ -0,0 +1,98 @@
+package graphql
+
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/graphql-go/graphql"
+)
+
+var sessionType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Session",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"ua": &graphql.Field{
+				Type:        graphql.String,
+				Description: "User agent of the last request.",
+			},
+			"ip": &graphql.Field{
+				Type:        graphql.String,
+				Description: "IP address of the last request.",
+			},
+			"startedAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"lastUsedAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"expiresAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"current": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+		},
+	},
+)
+
+var loginEventType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "LoginEvent",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"method": &graphql.Field{
+				Type:        graphql.String,
+				Description: "password, refresh, magic_link, passkey, sso or verification.",
+			},
+			"success": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"challenge": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Method was correct and second factor was requested. Successful login follows as another event.",
+			},
+			"error": &graphql.Field{
+				Type:        NullableString,
+				Description: "Why the login failed.",
+			},
+			"ua": &graphql.Field{
+				Type: graphql.String,
+			},
+			"ip": &graphql.Field{
+				Type: graphql.String,
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+var loginHistoryType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "LoginHistory",
+		Fields: graphql.Fields{
+			"events": &graphql.Field{
+				Type: graphql.NewList(loginEventType),
+			},
+			"nextCursor": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Pass as cursor to get next events. Null if there are no more events.",
+			},
+		},
+	},
+)
+
+type loginHistory struct {
+	Events     []domain.LoginEvent `json:"events"`
+	NextCursor *int64              `json:"nextCursor"`
+}
+
+// requestInfo returns client info saved by the RequestInfo middleware.
+func requestInfo(p graphql.ResolveParams) domain.RequestInfo {
+	info, _ := p.Context.Value(domain.RequestInfoKey).(domain.RequestInfo)
+	return info
+}
@@ -0,0 +1,47 @@
+package graphql
+
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/graphql-go/graphql"
+)
+
+var ssoConfigType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "SSOConfig",
+		Fields: graphql.Fields{
+			"organizationID": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"issuer": &graphql.Field{
+				Type: graphql.String,
+			},
+			"clientID": &graphql.Field{
+				Type: graphql.String,
+			},
+			"roleClaim": &graphql.Field{
+				Type:        graphql.String,
+				Description: "ID token claim with groups or roles of the user.",
+			},
+			"roleMapping": &graphql.Field{
+				Type:        graphql.String,
+				Description: "JSON object which maps values of the role claim to organization roles.",
+			},
+			"defaultRole": &graphql.Field{
+				Type:        roleEnum,
+				Description: "Role of users without mapped role. Such users are denied if null.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.SSOConfig).DefaultRole.Ptr(), nil
+				},
+			},
+			"enabled": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"updatedAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
@@ -0,0 +1,37 @@
+package graphql
+
+import "github.com/graphql-go/graphql"
+
+var totpEnrollmentType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "TOTPEnrollment",
+		Fields: graphql.Fields{
+			"secret": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Secret for manual entry into authenticator app.",
+			},
+			"uri": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Provisioning URI to show as QR code.",
+			},
+		},
+	},
+)
+
+var twoFactorStatusType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "TwoFactorStatus",
+		Fields: graphql.Fields{
+			"enabled": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"required": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Required by an organization where the user is owner or admin.",
+			},
+			"recoveryCodesLeft": &graphql.Field{
+				Type: graphql.Int,
+			},
+		},
+	},
+)
@@ -37,6 +37,13 @@ var userType = graphql.NewObject(
 					return rows, err
 				},
 			},
+			"lockedUntil": &graphql.Field{
+				Type:        graphql.DateTime,
+				Description: "User can't log in until this time after too many failed logins.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.User).LockedUntil.Ptr(), nil
+				},
+			},
 			"createdAt": &graphql.Field{
 				Type: graphql.DateTime,
 			},
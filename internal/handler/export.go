@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/authorize"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/logger"
+	"github.com/go-chi/chi/v5"
+)
+
+// ExportHandbook returns published content of the organization for offline use. With
+// format=zip attached files are added to the archive, otherwise single HTML page is
+// returned. Pages can be limited to one language with the language parameter.
+func (h *Handler) ExportHandbook(w http.ResponseWriter, r *http.Request) {
+	organizationID, err := strconv.ParseInt(chi.URLParam(r, "organizationID"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	claims, err := authorize.AuthorizeOrganization(r.Context(), organizationID, domain.PermissionPagesRead, domain.ScopeContentRead)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	organization, err := h.service.Organization.GetByID(organizationID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Content of blocked organization isn't available, like in GraphQL.
+	if organization.Status == "blocked" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	restrictions, err := h.service.PageAccess.Restrictions(organizationID, claims)
+	if err != nil {
+		logger.Println(r.Context(), "Failed to get page restrictions: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "zip" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	handbook, err := h.service.Export.Handbook(organizationID, r.URL.Query().Get("language"), restrictions)
+	if err != nil {
+		logger.Println(r.Context(), "Failed to export handbook: ", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	if format == "zip" {
+		err = h.service.Export.WriteHandbookZIP(&buf, handbook)
+	} else {
+		err = h.service.Export.WriteHandbookHTML(&buf, handbook, "")
+	}
+	if err != nil {
+		logger.Println(r.Context(), "Failed to render handbook: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("handbook-%d-%s.%s", organizationID, handbook.CreatedAt.Format("2006-01-02"), format)
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	buf.WriteTo(w)
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/authorize"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/randstring"
 )
 
@@ -30,7 +31,7 @@ func (h *Handler) UploadFile(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		_, err = authorize.AuthorizeOrganization(r.Context(), id, "user")
+		_, err = authorize.AuthorizeOrganization(r.Context(), id, domain.PermissionFilesUpload, domain.ScopeFilesWrite)
 		if err != nil {
 			w.WriteHeader(http.StatusForbidden)
 			return
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -16,11 +18,17 @@ import (
 )
 
 type Handler struct {
-	service *service.Service
+	service        *service.Service
+	trustedProxies []*net.IPNet
 }
 
 func NewHandler(services *service.Service) *Handler {
-	return &Handler{service: services}
+	trustedProxies, err := parseTrustedProxies(config.Get().Server.TrustedProxies)
+	if err != nil {
+		log.Fatalln("Invalid trusted proxies: ", err)
+	}
+
+	return &Handler{service: services, trustedProxies: trustedProxies}
 }
 
 func (h *Handler) InitRoutes() *chi.Mux {
@@ -33,7 +41,7 @@ func (h *Handler) InitRoutes() *chi.Mux {
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Fingerprint"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
@@ -44,9 +52,14 @@ func (h *Handler) InitRoutes() *chi.Mux {
 	}
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5))
+	r.Use(h.RequestInfo)
 	r.Use(h.AuthJWT)
 	r.Handle("/graphql", graphqlHandler)
 	r.Post("/upload", h.UploadFile)
+	r.Get("/export/{organizationID}", h.ExportHandbook)
+	r.Get("/sso/callback", h.SSOCallback)
+	r.Get("/sso/{organizationID}/login", h.SSOLogin)
+	r.Get("/.well-known/jwks.json", h.JWKS)
 
 	r.Group(func(r chi.Router) {
 
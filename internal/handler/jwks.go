@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// JWKS publishes public keys of access tokens, so other services can verify them.
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := h.service.SigningKey.JWKS()
+	if err != nil {
+		log.Println("Failed to get signing keys: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// Next key is published a day before it's used, so clients can cache keys for a while.
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(set)
+}
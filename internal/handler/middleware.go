@@ -2,12 +2,13 @@ package handler
 
 import (
 	"context"
-	"errors"
+	"database/sql"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"strings"
 
-	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/config"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
 	"github.com/dgrijalva/jwt-go"
 )
@@ -22,17 +23,30 @@ func (h *Handler) AuthJWT(next http.Handler) http.Handler {
 		}
 
 		headerParts := strings.Split(header, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		if len(headerParts) != 2 {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(headerParts[1], &domain.Claims{}, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("wrong singing method")
+		// Scripts authenticate with "Authorization: ApiKey kk_...".
+		if headerParts[0] == "ApiKey" {
+			claims, err := h.service.APIKey.Authenticate(headerParts[1])
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
 			}
-			return []byte(config.Get().App.Key), nil
-		})
+
+			ctx := context.WithValue(r.Context(), domain.UserClaimsKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		if headerParts[0] != "Bearer" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := jwt.ParseWithClaims(headerParts[1], &domain.Claims{}, h.service.SigningKey.Keyfunc)
 		if err != nil {
 			fmt.Println(err)
 			next.ServeHTTP(w, r)
@@ -45,7 +59,39 @@ func (h *Handler) AuthJWT(next http.Handler) http.Handler {
 			return
 		}
 
+		// Roles in the token may be outdated, so current access of the user is used.
+		// Tokens issued before revocation or to deleted users are rejected.
+		access, err := h.service.Auth.GetAccess(claims.UserID)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				log.Println("Failed to get user access: ", err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if claims.TokenVersion != access.TokenVersion {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims.Type = access.Type
+		claims.Roles = access.Roles
+		claims.Permissions = access.Permissions
+
+		// Impersonation ends as soon as the impersonator is not superadmin anymore.
+		if claims.ImpersonatorID != 0 {
+			impersonator, err := h.service.Auth.GetAccess(claims.ImpersonatorID)
+			if err != nil || impersonator.Type != "superadmin" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			log.Printf("Impersonated request: user %d as user %d: %s %s", claims.ImpersonatorID, claims.UserID, r.Method, r.URL.Path)
+		}
+
 		ctx := context.WithValue(r.Context(), domain.UserClaimsKey, claims)
+		if claims.ImpersonatorID != 0 {
+			ctx = context.WithValue(ctx, domain.ImpersonatorIDKey, claims.ImpersonatorID)
+		}
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
@@ -54,3 +100,109 @@ func (h *Handler) AuthJWT(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 
 }
+
+// RequestInfo saves IP, user agent and fingerprint of the client into request context.
+// Fingerprint is sent by the client in the X-Fingerprint header.
+func (h *Handler) RequestInfo(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		info := domain.RequestInfo{
+			IP:          clientIP(r, h.trustedProxies),
+			UserAgent:   truncate(r.UserAgent(), 256),
+			Fingerprint: truncate(r.Header.Get("X-Fingerprint"), 256),
+		}
+
+		ctx := context.WithValue(r.Context(), domain.RequestInfoKey, info)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func requestInfo(r *http.Request) domain.RequestInfo {
+	info, _ := r.Context().Value(domain.RequestInfoKey).(domain.RequestInfo)
+	return info
+}
+
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	return s[:length]
+}
+
+// clientIP returns IP of the client. Forwarded headers are read only if the request
+// comes from a trusted proxy, otherwise any client could choose its IP. Proxies append
+// to X-Forwarded-For, so the client is the last address which isn't a trusted proxy.
+func clientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	if !isTrustedProxy(ip, trustedProxies) {
+		return ip
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		addresses := strings.Split(forwarded, ",")
+		for i := len(addresses) - 1; i >= 0; i-- {
+			address := strings.TrimSpace(addresses[i])
+			if net.ParseIP(address) == nil {
+				break
+			}
+			ip = address
+			if !isTrustedProxy(address, trustedProxies) {
+				break
+			}
+		}
+		return ip
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return ip
+}
+
+func isTrustedProxy(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses IPs and CIDR ranges. Single IP is a range of one address.
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", proxy)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"direct", "203.0.113.5:1234", "", "", "203.0.113.5"},
+		{"spoofed header from client", "203.0.113.5:1234", "198.51.100.7", "198.51.100.7", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2:1234", "198.51.100.7", "", "198.51.100.7"},
+		{"client prepends fake address", "10.0.0.2:1234", "1.1.1.1, 198.51.100.7", "", "198.51.100.7"},
+		{"chain of proxies", "192.0.2.1:1234", "198.51.100.7, 10.0.0.3", "", "198.51.100.7"},
+		{"real IP header", "10.0.0.2:1234", "", "198.51.100.7", "198.51.100.7"},
+		{"invalid header", "10.0.0.2:1234", "", "unknown", "10.0.0.2"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+
+		if got := clientIP(r, trusted); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+
+	_, err = parseTrustedProxies([]string{"proxy"})
+	if err == nil {
+		t.Error("Invalid proxy must be rejected")
+	}
+}
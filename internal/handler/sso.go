@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/config"
+	"github.com/go-chi/chi/v5"
+)
+
+// SSOLogin redirects the user to the identity provider of the organization.
+func (h *Handler) SSOLogin(w http.ResponseWriter, r *http.Request) {
+	organizationID, err := strconv.ParseInt(chi.URLParam(r, "organizationID"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	loginURL, err := h.service.SSO.LoginURL(organizationID, ssoCallbackURL(r))
+	if err != nil {
+		log.Println("Failed to start SSO login: ", err)
+		redirectSSOResult(w, r, url.Values{"error": {"sso_unavailable"}})
+		return
+	}
+
+	http.Redirect(w, r, loginURL, http.StatusFound)
+}
+
+// SSOCallback is called by the identity provider after login. Tokens are passed to the
+// client in URL fragment, so they don't get into server logs.
+func (h *Handler) SSOCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		redirectSSOResult(w, r, url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	tokens, err := h.service.SSO.Callback(query.Get("code"), query.Get("state"), requestInfo(r))
+	if err != nil {
+		log.Println("Failed to finish SSO login: ", err)
+		redirectSSOResult(w, r, url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	// Client finishes login with verifyTwoFactor if the user has to pass second factor.
+	if tokens.ChallengeToken != "" {
+		redirectSSOResult(w, r, url.Values{
+			"challengeToken": {tokens.ChallengeToken},
+			"twoFactor":      {tokens.TwoFactor},
+		})
+		return
+	}
+
+	redirectSSOResult(w, r, url.Values{
+		"accessToken":  {tokens.AccessToken},
+		"refreshToken": {tokens.RefreshToken},
+	})
+}
+
+func redirectSSOResult(w http.ResponseWriter, r *http.Request, result url.Values) {
+	client := strings.TrimSuffix(config.Get().App.Client, "/")
+	http.Redirect(w, r, client+"/sso#"+result.Encode(), http.StatusFound)
+}
+
+// ssoCallbackURL returns absolute URL of the callback route as seen by the browser.
+func ssoCallbackURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host + "/sso/callback"
+}
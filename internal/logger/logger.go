@@ -0,0 +1,32 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+)
+
+// Println writes to the standard logger like log.Println. Output of requests which a
+// superadmin makes on behalf of another user is prefixed with the impersonator.
+func Println(ctx context.Context, v ...interface{}) {
+	log.Output(2, prefix(ctx)+fmt.Sprintln(v...))
+}
+
+// Printf writes to the standard logger like log.Printf, see Println.
+func Printf(ctx context.Context, format string, v ...interface{}) {
+	log.Output(2, prefix(ctx)+fmt.Sprintf(format, v...))
+}
+
+func prefix(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	if id, ok := ctx.Value(domain.ImpersonatorIDKey).(int64); ok && id != 0 {
+		return fmt.Sprintf("[impersonator %d] ", id)
+	}
+
+	return ""
+}
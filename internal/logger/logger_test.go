@@ -0,0 +1,34 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+)
+
+func TestImpersonatorPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer log.SetFlags(flags)
+
+	Println(context.Background(), "Failed to publish page: ", "error")
+	if got := buf.String(); got != "Failed to publish page:  error\n" {
+		t.Errorf("Got %q for a request without impersonation", got)
+	}
+
+	buf.Reset()
+	ctx := context.WithValue(context.Background(), domain.ImpersonatorIDKey, int64(7))
+	Printf(ctx, "User %d", 3)
+	if got := buf.String(); !strings.HasPrefix(got, "[impersonator 7] User 3") {
+		t.Errorf("Got %q, want impersonator prefix", got)
+	}
+}
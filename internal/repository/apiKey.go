@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type APIKeyRepo struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyRepo(db *sqlx.DB) *APIKeyRepo {
+	return &APIKeyRepo{db: db}
+}
+
+func (r *APIKeyRepo) GetByID(id int64) (domain.APIKey, error) {
+	var key domain.APIKey
+	err := r.db.Get(&key, "SELECT * FROM api_keys WHERE id = ?", id)
+	return key, err
+}
+
+func (r *APIKeyRepo) GetByHash(keyHash string) (domain.APIKey, error) {
+	var key domain.APIKey
+	err := r.db.Get(&key, "SELECT * FROM api_keys WHERE key_hash = ?", keyHash)
+	return key, err
+}
+
+// GetByUserID returns personal access tokens of the user.
+func (r *APIKeyRepo) GetByUserID(userID int64) ([]domain.APIKey, error) {
+	keys := make([]domain.APIKey, 0)
+	err := r.db.Select(&keys, "SELECT * FROM api_keys WHERE user_id = ? ORDER BY id", userID)
+	return keys, err
+}
+
+// GetByOrganizationID returns keys of the organization.
+func (r *APIKeyRepo) GetByOrganizationID(organizationID int64) ([]domain.APIKey, error) {
+	keys := make([]domain.APIKey, 0)
+	err := r.db.Select(&keys, "SELECT * FROM api_keys WHERE organization_id = ? AND user_id IS NULL ORDER BY id", organizationID)
+	return keys, err
+}
+
+func (r *APIKeyRepo) Create(key domain.APIKey) (int64, error) {
+	result, err := r.db.Exec(`INSERT INTO api_keys (user_id, organization_id, name, prefix, key_hash, scopes, expires_at, created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.UserID, key.OrganizationID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.ExpiresAt, key.CreatedBy)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// UpdateLastUsed saves time of the last use. It's written at most once a minute to
+// avoid a write on every request.
+func (r *APIKeyRepo) UpdateLastUsed(id int64) error {
+	_, err := r.db.Exec(`UPDATE api_keys SET last_used_at = NOW() WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE)`, id)
+	return err
+}
+
+func (r *APIKeyRepo) Delete(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM api_keys WHERE id = ?`, id)
+	return err
+}
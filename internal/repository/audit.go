@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"strings"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditRepo struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepo(db *sqlx.DB) *AuditRepo {
+	return &AuditRepo{db: db}
+}
+
+// Get returns entries newest first. Entries with ID lower than cursor are returned if
+// cursor is not 0. Nil organization ID returns entries of all organizations.
+func (r *AuditRepo) Get(organizationID *int64, filter domain.AuditFilter, cursor int64, limit int) ([]domain.AuditEntry, error) {
+	fields := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if organizationID != nil {
+		fields = append(fields, "organization_id = ?")
+		args = append(args, *organizationID)
+	}
+	if cursor != 0 {
+		fields = append(fields, "id < ?")
+		args = append(args, cursor)
+	}
+	if filter.ActorID.Valid {
+		fields = append(fields, "actor_id = ?")
+		args = append(args, filter.ActorID.Int64)
+	}
+	if filter.Action.Valid {
+		fields = append(fields, "action = ?")
+		args = append(args, filter.Action.String)
+	}
+	if filter.EntityType.Valid {
+		fields = append(fields, "entity_type = ?")
+		args = append(args, filter.EntityType.String)
+	}
+	if filter.EntityID.Valid {
+		fields = append(fields, "entity_id = ?")
+		args = append(args, filter.EntityID.Int64)
+	}
+	if filter.From.Valid {
+		fields = append(fields, "created_at >= ?")
+		args = append(args, filter.From.Time)
+	}
+	if filter.To.Valid {
+		fields = append(fields, "created_at < ?")
+		args = append(args, filter.To.Time)
+	}
+
+	where := ""
+	if len(fields) != 0 {
+		where = "WHERE " + strings.Join(fields, " AND ")
+	}
+	args = append(args, limit)
+
+	entries := make([]domain.AuditEntry, 0)
+	err := r.db.Select(&entries, "SELECT * FROM audit_log "+where+" ORDER BY id DESC LIMIT ?", args...)
+
+	return entries, err
+}
+
+func (r *AuditRepo) Create(entry domain.AuditEntry) (int64, error) {
+	result, err := r.db.Exec(`INSERT 
+		INTO audit_log (organization_id, actor_id, impersonator_id, action, entity_type, entity_id, diff) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.OrganizationID, entry.ActorID, entry.ImpersonatorID, entry.Action, entry.EntityType, entry.EntityID, entry.Diff)
+	if err != nil {
+		return 0, err
+	}
+
+	id, _ := result.LastInsertId()
+
+	return id, nil
+}
@@ -36,7 +36,25 @@ func (r *BlockRepo) Create(pageID int64, title, blockType string, content, readm
 	img := null.StringFromPtr(image)
 	imgHover := null.StringFromPtr(imageHover)
 
-	result, err := r.db.Exec(`INSERT 
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	// Revision is saved before every change of the block set, so it can be restored.
+	revisionID, err := createRevision(tx, pageID, null.Int{})
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = markDraft(tx, pageID, revisionID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	result, err := tx.Exec(`INSERT 
 		INTO blocks (page_id, title, content, readmore, image, image_hover, type, sort) 
 		VALUES (?, ?, ?, ?, ?, ?, ?, (
 			SELECT COALESCE((MAX(B.sort) + 1), 1) 
@@ -45,10 +63,22 @@ func (r *BlockRepo) Create(pageID int64, title, blockType string, content, readm
 		)`,
 		pageID, title, cnt, rdmr, img, imgHover, blockType, pageID)
 	if err != nil {
+		tx.Rollback()
 		return 0, err
 	}
 	blockID, _ := result.LastInsertId()
 
+	err = indexPage(tx, pageID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
 	go r.pageRepo.UpdateUpdatedAt(pageID)
 
 	return blockID, nil
@@ -90,24 +120,65 @@ func (r *BlockRepo) Update(id int64, title, content, readmore, image, imageHover
 	args = append(args, id)
 	query := "UPDATE blocks SET " + strings.Join(fields, ", ") + " WHERE id = ?"
 
-	_, err := r.db.Exec(query, args...)
+	block, err := r.GetByID(id)
 	if err != nil {
 		return err
 	}
 
-	go func() {
-		block, err := r.GetByID(id)
-		if err == nil {
-			r.pageRepo.UpdateUpdatedAt(block.PageID)
-		}
-	}()
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	revisionID, err := createRevision(tx, block.PageID, null.IntFrom(id))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = markDraft(tx, block.PageID, revisionID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = indexPage(tx, block.PageID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	go r.pageRepo.UpdateUpdatedAt(block.PageID)
 
 	return nil
 }
 
 func (r *BlockRepo) UpdateSort(pageID int64, sort []int) error {
-	tx, err := r.db.Begin()
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	revisionID, err := createRevision(tx, pageID, null.Int{})
 	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = markDraft(tx, pageID, revisionID)
+	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
@@ -125,6 +196,40 @@ func (r *BlockRepo) UpdateSort(pageID int64, sort []int) error {
 }
 
 func (r *BlockRepo) Delete(id int64) error {
-	_, err := r.db.Exec("DELETE FROM blocks WHERE id = ?", id)
-	return err
+	block, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	// Revision is listed in the history of the deleted block, so it can be brought back.
+	revisionID, err := createRevision(tx, block.PageID, null.IntFrom(id))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = markDraft(tx, block.PageID, revisionID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM blocks WHERE id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = indexPage(tx, block.PageID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
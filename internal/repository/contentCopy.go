@@ -0,0 +1,411 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// copyUnit is a default page which is copied with all its childrens under the parent
+// organization page.
+type copyUnit struct {
+	page     domain.Page
+	parentID int64
+}
+
+func (r *OrganizationRepo) GetCopyJob(organizationID int64) (domain.ContentCopyJob, error) {
+	var job domain.ContentCopyJob
+	err := r.db.Get(&job, "SELECT * FROM content_copy_jobs WHERE organization_id = ? ORDER BY id DESC LIMIT 1", organizationID)
+	return job, err
+}
+
+func (r *OrganizationRepo) GetCopyJobByID(id int64) (domain.ContentCopyJob, error) {
+	var job domain.ContentCopyJob
+	err := r.db.Get(&job, "SELECT * FROM content_copy_jobs WHERE id = ?", id)
+	return job, err
+}
+
+// CreateCopyJob registers copying of default content for the plan to the organization.
+// Mode is either "all_or_nothing" or "best_effort".
+func (r *OrganizationRepo) CreateCopyJob(organizationID int64, plan, mode string) (int64, error) {
+	result, err := r.db.Exec(`INSERT 
+		INTO content_copy_jobs (organization_id, plan, mode, status, errors) 
+		VALUES (?, ?, ?, "pending", "[]")`, organizationID, plan, mode)
+	if err != nil {
+		return 0, err
+	}
+
+	id, _ := result.LastInsertId()
+
+	return id, nil
+}
+
+// CopyDefaultContent copies default content to the organization and waits for the result.
+func (r *OrganizationRepo) CopyDefaultContent(organizationID int64, plan, mode string) error {
+	jobID, err := r.CreateCopyJob(organizationID, plan, mode)
+	if err != nil {
+		return err
+	}
+
+	return r.RunCopyJob(jobID)
+}
+
+// RunCopyJob copies default pages which were not copied to the organization yet, so
+// failed jobs can be run again. In all_or_nothing mode everything is copied in one
+// transaction. In best_effort mode every top level page is copied in its own
+// transaction and failed pages are skipped.
+func (r *OrganizationRepo) RunCopyJob(id int64) error {
+	job, err := r.GetCopyJobByID(id)
+	if err != nil {
+		return err
+	}
+
+	// Running job without progress is taken over, its run was most likely interrupted.
+	result, err := r.db.Exec(`UPDATE content_copy_jobs 
+		SET status = "running", copied = 0, errors = "[]", finished_at = NULL, updated_at = NOW() 
+		WHERE id = ? AND (status != "running" OR updated_at < NOW() - INTERVAL ? MINUTE)`,
+		id, int(domain.CopyJobStaleAfter.Minutes()))
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("job is already running")
+	}
+
+	if job.Status == "running" {
+		log.Printf("Content copy job %d was stale and is run again", id)
+	}
+
+	_, sm, err := r.loadSyncMaps(job.OrganizationID)
+	if err != nil {
+		return r.finishCopyJob(id, 0, err)
+	}
+
+	units, total, err := r.copyUnits(job.OrganizationID, job.Plan, sm)
+	if err != nil {
+		return r.finishCopyJob(id, 0, err)
+	}
+
+	_, err = r.db.Exec("UPDATE content_copy_jobs SET total = ? WHERE id = ?", total, id)
+	if err != nil {
+		return r.finishCopyJob(id, 0, err)
+	}
+
+	copied := make([]int64, 0, total)
+
+	if job.Mode == "all_or_nothing" {
+		tx, err := r.db.Beginx()
+		if err != nil {
+			return r.finishCopyJob(id, 0, err)
+		}
+
+		for _, unit := range units {
+			err = r.copyTree(tx, unit.page, unit.parentID, sm, &copied)
+			if err != nil {
+				tx.Rollback()
+				return r.finishCopyJob(id, 0, err)
+			}
+
+			r.updateCopyProgress(id, len(copied))
+		}
+
+		err = fixPageLinks(tx, copied, sm)
+		if err != nil {
+			tx.Rollback()
+			return r.finishCopyJob(id, 0, err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return r.finishCopyJob(id, 0, err)
+		}
+
+		return r.finishCopyJob(id, len(copied))
+	}
+
+	errs := make([]error, 0)
+	for _, unit := range units {
+		// Maps are restored if the page fails, so later pages don't link to rolled back ones.
+		saved := sm.clone()
+		count := len(copied)
+
+		err = r.copyUnit(unit, sm, &copied)
+		if err != nil {
+			sm = saved
+			copied = copied[:count]
+			errs = append(errs, err)
+			continue
+		}
+
+		r.updateCopyProgress(id, len(copied))
+	}
+
+	// Links are fixed after all pages are copied, because they can point to any page.
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return r.finishCopyJob(id, len(copied), append(errs, err)...)
+	}
+
+	err = fixPageLinks(tx, copied, sm)
+	if err != nil {
+		tx.Rollback()
+		return r.finishCopyJob(id, len(copied), append(errs, err)...)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return r.finishCopyJob(id, len(copied), append(errs, err)...)
+	}
+
+	return r.finishCopyJob(id, len(copied), errs...)
+}
+
+func (r *OrganizationRepo) copyUnit(unit copyUnit, sm *syncMaps, copied *[]int64) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	err = r.copyTree(tx, unit.page, unit.parentID, sm, copied)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// copyUnits returns top level default pages for the plan together with the organization
+// root pages they are copied to, and the number of pages which are still to be copied.
+func (r *OrganizationRepo) copyUnits(organizationID int64, plan string, sm *syncMaps) ([]copyUnit, int, error) {
+	adminRootPages, err := r.pageRepo.GetRootPages(nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	units := make([]copyUnit, 0)
+	total := 0
+
+	for _, root := range adminRootPages {
+		var pages []domain.Page
+		err = r.db.Select(&pages, `
+			SELECT pages.* FROM pages INNER JOIN default_pages ON default_pages.id = pages.id
+			WHERE pages.status = "visible" 
+				AND default_pages.plan = ?
+				AND pages.parent_id = ? 
+				AND pages.theme = ?
+			ORDER BY pages.sort`, plan, root.ID, root.Theme)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if len(pages) == 0 {
+			continue
+		}
+
+		var parentID int64
+		err = r.db.Get(&parentID, "SELECT id FROM pages WHERE organization_id = ? AND parent_id IS NULL AND theme = ?", organizationID, root.Theme)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, page := range pages {
+			count, err := r.countUncopied(page, sm)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			units = append(units, copyUnit{page: page, parentID: parentID})
+			total += count
+		}
+	}
+
+	return units, total, nil
+}
+
+func (r *OrganizationRepo) countUncopied(page domain.Page, sm *syncMaps) (int, error) {
+	count := 0
+	if !sm.tracked[page.ID] {
+		count = 1
+	} else if _, ok := sm.pages[page.ID]; !ok {
+		// Page was deleted by the organization, so its childrens are not copied too.
+		return 0, nil
+	}
+
+	if page.Type != "section" {
+		return count, nil
+	}
+
+	childrens, err := r.pageRepo.GetChildrens(page.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, children := range childrens {
+		childrenCount, err := r.countUncopied(children, sm)
+		if err != nil {
+			return 0, err
+		}
+		count += childrenCount
+	}
+
+	return count, nil
+}
+
+// copyTree copies default page with blocks, file and childrens. Pages copied before are
+// skipped. Links are left as is, they are fixed by fixPageLinks.
+func (r *OrganizationRepo) copyTree(q sqlx.Ext, page domain.Page, parentID int64, sm *syncMaps, copied *[]int64) error {
+	pageID, ok := sm.pages[page.ID]
+
+	if !ok {
+		// Page was deleted by the organization.
+		if sm.tracked[page.ID] {
+			return nil
+		}
+
+		result, err := q.Exec(`INSERT 
+			INTO pages (organization_id, parent_id, language_tag, pages.type, theme, pages.status, title, image, image_hover, pages.sort)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			sm.organizationID, parentID, page.LanguageTag, page.Type, page.Theme, page.Status, page.Title, page.Image, page.ImageHover, page.Sort)
+		if err != nil {
+			return err
+		}
+
+		pageID, _ = result.LastInsertId()
+		sm.pages[page.ID] = pageID
+		sm.tracked[page.ID] = true
+		*copied = append(*copied, pageID)
+
+		content, err := pageContent(q, page.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, block := range content.Blocks {
+			blockID, err := insertSyncedBlock(q, pageID, block.ID, block)
+			if err != nil {
+				return err
+			}
+			sm.blocks[block.ID] = blockID
+		}
+
+		if content.File != nil {
+			_, err = q.Exec("INSERT INTO files (id, path) VALUES (?, ?)", pageID, content.File.Path)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = trackPageSource(q, sm.organizationID, page.ID, pageID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if page.Type != "section" {
+		return nil
+	}
+
+	var childrens []domain.Page
+	err := sqlx.Select(q, &childrens, "SELECT * FROM pages WHERE parent_id = ? ORDER BY sort", page.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, children := range childrens {
+		err = r.copyTree(q, children, pageID, sm, copied)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fixPageLinks replaces links to admin pages inside copied blocks with links to the
+// organization pages and updates search index of the copied pages.
+func fixPageLinks(q sqlx.Ext, pageIDs []int64, sm *syncMaps) error {
+	for _, pageID := range pageIDs {
+		var blocks []domain.Block
+		err := sqlx.Select(q, &blocks, "SELECT * FROM blocks WHERE page_id = ?", pageID)
+		if err != nil {
+			return err
+		}
+
+		for _, block := range blocks {
+			local := sm.localBlock(block)
+			if local.Content == block.Content && local.Readmore == block.Readmore {
+				continue
+			}
+
+			_, err = q.Exec("UPDATE blocks SET content = ?, readmore = ? WHERE id = ?", local.Content, local.Readmore, block.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		local, err := pageContent(q, pageID)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.Exec("UPDATE page_sources SET local_hash = ? WHERE page_id = ?", contentHash(local), pageID)
+		if err != nil {
+			return err
+		}
+
+		err = indexPage(q, pageID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *OrganizationRepo) updateCopyProgress(id int64, copied int) {
+	// Updated at is set even if nothing was copied, it shows that the job is alive.
+	_, err := r.db.Exec("UPDATE content_copy_jobs SET copied = ?, updated_at = NOW() WHERE id = ?", copied, id)
+	if err != nil {
+		log.Println("Failed to update content copy progress: ", err)
+	}
+}
+
+// finishCopyJob saves result of the job. Job is completed if there are no errors,
+// partial if some pages were copied and failed otherwise. First error is returned.
+func (r *OrganizationRepo) finishCopyJob(id int64, copied int, errs ...error) error {
+	status := "completed"
+	if len(errs) != 0 && copied != 0 {
+		status = "partial"
+	} else if len(errs) != 0 {
+		status = "failed"
+	}
+
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+		log.Println("Error during content copying: ", err)
+	}
+
+	raw, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`UPDATE content_copy_jobs 
+		SET status = ?, copied = ?, errors = ?, finished_at = NOW() 
+		WHERE id = ?`, status, copied, string(raw), id)
+	if err != nil {
+		return err
+	}
+
+	if len(errs) != 0 {
+		return errs[0]
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestRunCopyJob(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db).Organization.(*OrganizationRepo)
+	adminRoots := testdb.RootPages(t, db, null.Int{})
+
+	pages, blocks := testdb.PageTree(t, db, adminRoots["precautions"],
+		testdb.Page{Title: "Section", Plans: []string{"basic"}, Childrens: []testdb.Page{
+			{Title: "Target", Blocks: []testdb.Block{{Title: "Target block", Content: "<p>Target</p>"}}},
+		}},
+		testdb.Page{Title: "Pro only", Plans: []string{"pro"}},
+	)
+	linking, _ := testdb.PageTree(t, db, pages["Section"], testdb.Page{Title: "Linking", Blocks: []testdb.Block{
+		{Title: "Link", Content: fmt.Sprintf(`<a href="/admin/page/%d#block-%d">Target</a>`, pages["Target"], blocks["Target block"])},
+	}})
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+
+	jobID, err := repo.CreateCopyJob(organizationID, "basic", "all_or_nothing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.RunCopyJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := repo.GetCopyJob(organizationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != "completed" || job.Total != 3 || job.Copied != 3 || job.Errors != "[]" {
+		t.Errorf("Wrong job result: %+v", job)
+	}
+
+	copiedPage := func(title string) int64 {
+		var id int64
+		err := db.Get(&id, "SELECT id FROM pages WHERE organization_id = ? AND title = ?", organizationID, title)
+		if err != nil {
+			t.Fatalf("Page %s was not copied: %v", title, err)
+		}
+		return id
+	}
+
+	targetID := copiedPage("Target")
+	linkingID := copiedPage("Linking")
+
+	var targetBlockID int64
+	err = db.Get(&targetBlockID, "SELECT id FROM blocks WHERE page_id = ?", targetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var content string
+	err = db.Get(&content, "SELECT content FROM blocks WHERE page_id = ?", linkingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantLink := fmt.Sprintf("/organization/%d/page/%d#block-%d", organizationID, targetID, targetBlockID)
+	if !strings.Contains(content, wantLink) {
+		t.Errorf("Link was not fixed, got %q, want link %s", content, wantLink)
+	}
+
+	var proPages int
+	err = db.Get(&proPages, "SELECT COUNT(*) FROM pages WHERE organization_id = ? AND title = ?", organizationID, "Pro only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proPages != 0 {
+		t.Error("Page of other plan was copied")
+	}
+
+	var sourcePageID int64
+	err = db.Get(&sourcePageID, "SELECT source_page_id FROM page_sources WHERE page_id = ?", linkingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sourcePageID != linking["Linking"] {
+		t.Errorf("Got source page %d, want %d", sourcePageID, linking["Linking"])
+	}
+
+	// Second run skips pages which were copied before.
+	jobID, err = repo.CreateCopyJob(organizationID, "basic", "best_effort")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.RunCopyJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err = repo.GetCopyJob(organizationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != "completed" || job.Total != 0 || job.Copied != 0 {
+		t.Errorf("Wrong result of the second job: %+v", job)
+	}
+
+	var targets int
+	err = db.Get(&targets, "SELECT COUNT(*) FROM pages WHERE organization_id = ? AND title = ?", organizationID, "Target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets != 1 {
+		t.Errorf("Got %d copies of the page, want 1", targets)
+	}
+}
+
+func TestRunStaleCopyJob(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db).Organization.(*OrganizationRepo)
+	testdb.RootPages(t, db, null.Int{})
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+
+	jobID, err := repo.CreateCopyJob(organizationID, "basic", "best_effort")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(`UPDATE content_copy_jobs SET status = "running" WHERE id = ?`, jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.RunCopyJob(jobID)
+	if err == nil {
+		t.Fatal("Job in progress must not be run again")
+	}
+
+	// Job of crashed server doesn't make progress anymore.
+	_, err = db.Exec(`UPDATE content_copy_jobs SET updated_at = NOW() - INTERVAL 1 HOUR WHERE id = ?`, jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := repo.GetCopyJobByID(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !job.Stale() {
+		t.Errorf("Job must be stale: %+v", job)
+	}
+
+	err = repo.RunCopyJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err = repo.GetCopyJobByID(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != "completed" || job.Stale() {
+		t.Errorf("Wrong job result: %+v", job)
+	}
+}
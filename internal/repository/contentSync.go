@@ -0,0 +1,540 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v4"
+)
+
+// SyncDefaultContent applies changes of default pages to the organization pages copied
+// from them. Pages changed by the organization since the last sync are not touched and
+// reported as customised. New default pages are copied. If dry run is true then changes
+// are only reported.
+func (r *OrganizationRepo) SyncDefaultContent(organizationID int64, dryRun bool) ([]domain.SyncChange, error) {
+	organization, err := r.GetByID(organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	sources, sm, err := r.loadSyncMaps(organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var q sqlx.Ext = r.db
+	var tx *sqlx.Tx
+	if !dryRun {
+		tx, err = r.db.Beginx()
+		if err != nil {
+			return nil, err
+		}
+		q = tx
+	}
+
+	// New pages are created first, so links in updated pages can point to them.
+	changes, err := r.syncNewPages(q, organization, sm, dryRun)
+	if err != nil {
+		if tx != nil {
+			tx.Rollback()
+		}
+		return nil, err
+	}
+
+	for _, source := range sources {
+		// Page was deleted by the organization.
+		if !source.PageID.Valid {
+			continue
+		}
+
+		change, err := r.syncPage(q, source, sm, dryRun)
+		if err != nil {
+			if tx != nil {
+				tx.Rollback()
+			}
+			return nil, err
+		}
+
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	if tx != nil {
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// syncMaps holds IDs of default pages and blocks mapped to the organization ones.
+type syncMaps struct {
+	organizationID int64
+	pages          map[int64]int64
+	blocks         map[int64]int64
+	// Default pages which were ever copied, including ones deleted by the organization.
+	tracked map[int64]bool
+}
+
+// loadSyncMaps returns sources of the organization pages and maps of copied pages and blocks.
+func (r *OrganizationRepo) loadSyncMaps(organizationID int64) ([]domain.PageSource, *syncMaps, error) {
+	var sources []domain.PageSource
+	err := r.db.Select(&sources, "SELECT * FROM page_sources WHERE organization_id = ? ORDER BY id", organizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var blockSources []domain.BlockSource
+	err = r.db.Select(&blockSources, `
+		SELECT block_sources.* FROM block_sources
+		INNER JOIN blocks ON blocks.id = block_sources.block_id
+		INNER JOIN pages ON pages.id = blocks.page_id
+		WHERE pages.organization_id = ? AND block_sources.source_block_id IS NOT NULL`, organizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sm := &syncMaps{organizationID: organizationID, pages: make(map[int64]int64), blocks: make(map[int64]int64), tracked: make(map[int64]bool)}
+	for _, source := range sources {
+		if !source.SourcePageID.Valid {
+			continue
+		}
+		sm.tracked[source.SourcePageID.Int64] = true
+		if source.PageID.Valid {
+			sm.pages[source.SourcePageID.Int64] = source.PageID.Int64
+		}
+	}
+	for _, source := range blockSources {
+		sm.blocks[source.SourceBlockID.Int64] = source.BlockID
+	}
+
+	return sources, sm, nil
+}
+
+func (sm *syncMaps) clone() *syncMaps {
+	c := &syncMaps{organizationID: sm.organizationID, pages: make(map[int64]int64), blocks: make(map[int64]int64), tracked: make(map[int64]bool)}
+	for k, v := range sm.pages {
+		c.pages[k] = v
+	}
+	for k, v := range sm.blocks {
+		c.blocks[k] = v
+	}
+	for k, v := range sm.tracked {
+		c.tracked[k] = v
+	}
+
+	return c
+}
+
+func (sm *syncMaps) page(id int64) (int64, bool) {
+	newID, ok := sm.pages[id]
+	return newID, ok
+}
+
+func (sm *syncMaps) block(id int64) (int64, bool) {
+	newID, ok := sm.blocks[id]
+	return newID, ok
+}
+
+// localBlock returns default block with links rewritten to the organization pages.
+func (sm *syncMaps) localBlock(block domain.Block) domain.Block {
+	if block.Content.Valid {
+		block.Content.String, _ = replacePageLinks(block.Content.String, sm.organizationID, sm.page, sm.block)
+	}
+	if block.Readmore.Valid {
+		block.Readmore.String, _ = replacePageLinks(block.Readmore.String, sm.organizationID, sm.page, sm.block)
+	}
+
+	return block
+}
+
+func (r *OrganizationRepo) syncPage(q sqlx.Ext, source domain.PageSource, sm *syncMaps, dryRun bool) (*domain.SyncChange, error) {
+	local, err := pageContent(q, source.PageID.Int64)
+	if err != nil {
+		return nil, err
+	}
+
+	if !source.SourcePageID.Valid {
+		return &domain.SyncChange{PageID: source.PageID, Title: local.Page.Title, Action: "source_removed"}, nil
+	}
+
+	upstream, err := pageContent(q, source.SourcePageID.Int64)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamHash := contentHash(upstream)
+	if upstreamHash == source.SourceHash {
+		return nil, nil
+	}
+
+	change := domain.SyncChange{
+		SourcePageID: source.SourcePageID,
+		PageID:       source.PageID,
+		Title:        upstream.Page.Title,
+		Action:       "update",
+		Fields:       syncDiff(local, upstream, sm),
+	}
+
+	if local.Page.Draft || contentHash(local) != source.LocalHash {
+		change.Action = "customised"
+		return &change, nil
+	}
+
+	if dryRun {
+		return &change, nil
+	}
+
+	pageID := source.PageID.Int64
+
+	_, err = createRevision(q, pageID, null.Int{})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = q.Exec("UPDATE pages SET updated_at = NOW(), status = ?, title = ?, image = ?, image_hover = ? WHERE id = ?",
+		upstream.Page.Status, upstream.Page.Title, upstream.Page.Image, upstream.Page.ImageHover, pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	localBlocks := make(map[int64]bool)
+	for _, block := range local.Blocks {
+		localBlocks[block.ID] = true
+	}
+
+	keep := make(map[int64]bool)
+	for _, upstreamBlock := range upstream.Blocks {
+		block := sm.localBlock(upstreamBlock)
+
+		if blockID, ok := sm.blocks[upstreamBlock.ID]; ok && localBlocks[blockID] {
+			_, err = q.Exec(`UPDATE blocks
+				SET title = ?, content = ?, readmore = ?, image = ?, image_hover = ?, type = ?, sort = ?
+				WHERE id = ?`,
+				block.Title, block.Content, block.Readmore, block.Image, block.ImageHover, block.Type, block.Sort, blockID)
+			if err != nil {
+				return nil, err
+			}
+			keep[blockID] = true
+			continue
+		}
+
+		blockID, err := insertSyncedBlock(q, pageID, upstreamBlock.ID, block)
+		if err != nil {
+			return nil, err
+		}
+		sm.blocks[upstreamBlock.ID] = blockID
+		keep[blockID] = true
+	}
+
+	for _, block := range local.Blocks {
+		if !keep[block.ID] {
+			_, err = q.Exec("DELETE FROM blocks WHERE id = ?", block.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if upstream.File != nil {
+		_, err = q.Exec("INSERT INTO files (id, path) VALUES (?, ?) ON DUPLICATE KEY UPDATE path = ?", pageID, upstream.File.Path, upstream.File.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = indexPage(q, pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := pageContent(q, pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = q.Exec("UPDATE page_sources SET source_hash = ?, local_hash = ?, synced_at = NOW() WHERE id = ?",
+		upstreamHash, contentHash(updated), source.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	change.Applied = true
+
+	return &change, nil
+}
+
+// syncNewPages copies default pages which appeared after the organization content was
+// copied. Pages deleted by the organization are not copied again.
+func (r *OrganizationRepo) syncNewPages(q sqlx.Ext, organization domain.Organization, sm *syncMaps, dryRun bool) ([]domain.SyncChange, error) {
+	changes := make([]domain.SyncChange, 0)
+
+	var adminRootPages []domain.Page
+	err := sqlx.Select(q, &adminRootPages, "SELECT * FROM pages WHERE organization_id IS NULL AND parent_id IS NULL ORDER BY sort")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, root := range adminRootPages {
+		var rootID int64
+		err = sqlx.Get(q, &rootID, "SELECT id FROM pages WHERE organization_id = ? AND parent_id IS NULL AND theme = ?", organization.ID, root.Theme)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return nil, err
+		}
+
+		var pages []domain.Page
+		err = sqlx.Select(q, &pages, `
+			SELECT pages.* FROM pages INNER JOIN default_pages ON default_pages.id = pages.id
+			WHERE pages.status = "visible"
+				AND default_pages.plan = ?
+				AND pages.parent_id = ?
+				AND pages.theme = ?
+			ORDER BY pages.sort`, organization.Plan, root.ID, root.Theme)
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.syncNewPagesLevel(q, pages, rootID, sm, dryRun, &changes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+func (r *OrganizationRepo) syncNewPagesLevel(q sqlx.Ext, pages []domain.Page, parentID int64, sm *syncMaps, dryRun bool, changes *[]domain.SyncChange) error {
+	for _, page := range pages {
+		pageID, copied := sm.pages[page.ID]
+
+		if !copied {
+			if sm.tracked[page.ID] {
+				continue
+			}
+
+			change := domain.SyncChange{SourcePageID: null.IntFrom(page.ID), Title: page.Title, Action: "create"}
+
+			if !dryRun {
+				var err error
+				pageID, err = r.copySyncedPage(q, page, parentID, sm)
+				if err != nil {
+					return err
+				}
+				change.PageID = null.IntFrom(pageID)
+				change.Applied = true
+			}
+
+			*changes = append(*changes, change)
+		}
+
+		if page.Type != "section" {
+			continue
+		}
+
+		var childrens []domain.Page
+		err := sqlx.Select(q, &childrens, "SELECT * FROM pages WHERE parent_id = ? ORDER BY sort", page.ID)
+		if err != nil {
+			return err
+		}
+
+		err = r.syncNewPagesLevel(q, childrens, pageID, sm, dryRun, changes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *OrganizationRepo) copySyncedPage(q sqlx.Ext, page domain.Page, parentID int64, sm *syncMaps) (int64, error) {
+	result, err := q.Exec(`INSERT
+		INTO pages (organization_id, parent_id, language_tag, pages.type, theme, pages.status, title, image, image_hover, pages.sort)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sm.organizationID, parentID, page.LanguageTag, page.Type, page.Theme, page.Status, page.Title, page.Image, page.ImageHover, page.Sort)
+	if err != nil {
+		return 0, err
+	}
+
+	pageID, _ := result.LastInsertId()
+	sm.pages[page.ID] = pageID
+	sm.tracked[page.ID] = true
+
+	upstream, err := pageContent(q, page.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, block := range upstream.Blocks {
+		blockID, err := insertSyncedBlock(q, pageID, block.ID, sm.localBlock(block))
+		if err != nil {
+			return 0, err
+		}
+		sm.blocks[block.ID] = blockID
+	}
+
+	if upstream.File != nil {
+		_, err = q.Exec("INSERT INTO files (id, path) VALUES (?, ?)", pageID, upstream.File.Path)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = indexPage(q, pageID)
+	if err != nil {
+		return 0, err
+	}
+
+	return pageID, trackPageSource(q, sm.organizationID, page.ID, pageID)
+}
+
+func insertSyncedBlock(q sqlx.Ext, pageID, sourceBlockID int64, block domain.Block) (int64, error) {
+	result, err := q.Exec(`INSERT
+		INTO blocks (page_id, title, content, readmore, image, image_hover, type, sort)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		pageID, block.Title, block.Content, block.Readmore, block.Image, block.ImageHover, block.Type, block.Sort)
+	if err != nil {
+		return 0, err
+	}
+
+	blockID, _ := result.LastInsertId()
+
+	_, err = q.Exec("INSERT INTO block_sources (block_id, source_block_id) VALUES (?, ?)", blockID, sourceBlockID)
+	if err != nil {
+		return 0, err
+	}
+
+	return blockID, nil
+}
+
+// trackPageSource remembers current state of the default page and its copy, so later
+// changes on both sides can be detected.
+func trackPageSource(q sqlx.Ext, organizationID, sourcePageID, pageID int64) error {
+	upstream, err := pageContent(q, sourcePageID)
+	if err != nil {
+		return err
+	}
+
+	local, err := pageContent(q, pageID)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`INSERT
+		INTO page_sources (organization_id, page_id, source_page_id, source_hash, local_hash)
+		VALUES (?, ?, ?, ?, ?)`,
+		organizationID, pageID, sourcePageID, contentHash(upstream), contentHash(local))
+
+	return err
+}
+
+// contentHash returns hash of the page fields which are synced from default pages.
+func contentHash(data domain.RevisionData) string {
+	type hashedBlock struct {
+		Title      string
+		Content    null.String
+		Readmore   null.String
+		Image      null.String
+		ImageHover null.String
+		Type       string
+		Sort       int
+	}
+
+	hashed := struct {
+		Title      string
+		Status     string
+		Image      null.String
+		ImageHover null.String
+		Blocks     []hashedBlock
+		File       string
+	}{
+		Title:      data.Page.Title,
+		Status:     data.Page.Status,
+		Image:      data.Page.Image,
+		ImageHover: data.Page.ImageHover,
+		Blocks:     make([]hashedBlock, len(data.Blocks)),
+	}
+
+	for i, block := range data.Blocks {
+		hashed.Blocks[i] = hashedBlock{block.Title, block.Content, block.Readmore, block.Image, block.ImageHover, block.Type, block.Sort}
+	}
+	if data.File != nil {
+		hashed.File = data.File.Path
+	}
+
+	raw, _ := json.Marshal(hashed)
+	sum := sha256.Sum256(raw)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// syncDiff lists fields of the organization page which differ from the default page.
+func syncDiff(local, upstream domain.RevisionData, sm *syncMaps) []domain.SyncFieldChange {
+	fields := make([]domain.SyncFieldChange, 0)
+
+	add := func(blockID, sourceBlockID null.Int, field string, before, after null.String) {
+		if before != after {
+			fields = append(fields, domain.SyncFieldChange{BlockID: blockID, SourceBlockID: sourceBlockID, Field: field, Before: before, After: after})
+		}
+	}
+
+	add(null.Int{}, null.Int{}, "title", null.StringFrom(local.Page.Title), null.StringFrom(upstream.Page.Title))
+	add(null.Int{}, null.Int{}, "status", null.StringFrom(local.Page.Status), null.StringFrom(upstream.Page.Status))
+	add(null.Int{}, null.Int{}, "image", local.Page.Image, upstream.Page.Image)
+	add(null.Int{}, null.Int{}, "imageHover", local.Page.ImageHover, upstream.Page.ImageHover)
+
+	var localFile, upstreamFile null.String
+	if local.File != nil {
+		localFile = null.StringFrom(local.File.Path)
+	}
+	if upstream.File != nil {
+		upstreamFile = null.StringFrom(upstream.File.Path)
+	}
+	add(null.Int{}, null.Int{}, "file", localFile, upstreamFile)
+
+	localBlocks := make(map[int64]domain.Block)
+	for _, block := range local.Blocks {
+		localBlocks[block.ID] = block
+	}
+
+	matched := make(map[int64]bool)
+	for _, upstreamBlock := range upstream.Blocks {
+		sourceBlockID := null.IntFrom(upstreamBlock.ID)
+		after := sm.localBlock(upstreamBlock)
+
+		blockID, ok := sm.blocks[upstreamBlock.ID]
+		before, exists := localBlocks[blockID]
+		if !ok || !exists {
+			add(null.Int{}, sourceBlockID, "block", null.String{}, null.StringFrom(after.Title))
+			continue
+		}
+		matched[blockID] = true
+
+		id := null.IntFrom(blockID)
+		add(id, sourceBlockID, "title", null.StringFrom(before.Title), null.StringFrom(after.Title))
+		add(id, sourceBlockID, "content", before.Content, after.Content)
+		add(id, sourceBlockID, "readmore", before.Readmore, after.Readmore)
+		add(id, sourceBlockID, "image", before.Image, after.Image)
+		add(id, sourceBlockID, "imageHover", before.ImageHover, after.ImageHover)
+		add(id, sourceBlockID, "type", null.StringFrom(before.Type), null.StringFrom(after.Type))
+		add(id, sourceBlockID, "sort", null.StringFrom(fmt.Sprint(before.Sort)), null.StringFrom(fmt.Sprint(after.Sort)))
+	}
+
+	for _, block := range local.Blocks {
+		if !matched[block.ID] {
+			add(null.IntFrom(block.ID), null.Int{}, "block", null.StringFrom(block.Title), null.String{})
+		}
+	}
+
+	return fields
+}
@@ -27,19 +27,53 @@ func (r *FileRepo) GetByPageID(pageID int64) (domain.FileBlock, error) {
 }
 
 func (r *FileRepo) Create(pageID int64, path string) (int64, error) {
-	result, err := r.db.Exec(`INSERT INTO files (id, path) VALUES (?, ?) ON DUPLICATE KEY UPDATE path = ?`, pageID, path, path)
+	tx, err := r.db.Beginx()
 	if err != nil {
 		return 0, err
 	}
+
+	err = markDraft(tx, pageID, 0)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO files (id, path) VALUES (?, ?) ON DUPLICATE KEY UPDATE path = ?`, pageID, path, path)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
 	fileID, _ := result.LastInsertId()
 
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
 	go r.pageRepo.UpdateUpdatedAt(pageID)
 
 	return fileID, nil
 }
 
 func (r *FileRepo) Update(id int64, path string) error {
-	_, err := r.db.Exec("UPDATE files SET path = ? WHERE id = ?", path, id)
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	err = markDraft(tx, id, 0)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE files SET path = ? WHERE id = ?", path, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type LoginEventRepo struct {
+	db *sqlx.DB
+}
+
+func NewLoginEventRepo(db *sqlx.DB) *LoginEventRepo {
+	return &LoginEventRepo{db: db}
+}
+
+// GetByUserID returns login events of the user older than cursor, newest first. Cursor 0
+// returns the newest events.
+func (r *LoginEventRepo) GetByUserID(userID, cursor int64, limit int) ([]domain.LoginEvent, error) {
+	events := make([]domain.LoginEvent, 0)
+	if cursor != 0 {
+		err := r.db.Select(&events, `SELECT * FROM login_events WHERE user_id = ? AND id < ? ORDER BY id DESC LIMIT ?`, userID, cursor, limit)
+		return events, err
+	}
+
+	err := r.db.Select(&events, `SELECT * FROM login_events WHERE user_id = ? ORDER BY id DESC LIMIT ?`, userID, limit)
+	return events, err
+}
+
+// HasSuccessfulLogin reports whether the user has logged in with the user agent. Any
+// successful login counts if user agent is nil.
+func (r *LoginEventRepo) HasSuccessfulLogin(userID int64, ua *string) (bool, error) {
+	var exists bool
+	if ua != nil {
+		err := r.db.Get(&exists, `SELECT EXISTS (SELECT 1 FROM login_events WHERE user_id = ? AND success = true AND ua = ?)`, userID, *ua)
+		return exists, err
+	}
+
+	err := r.db.Get(&exists, `SELECT EXISTS (SELECT 1 FROM login_events WHERE user_id = ? AND success = true)`, userID)
+	return exists, err
+}
+
+func (r *LoginEventRepo) Create(event domain.LoginEvent) (int64, error) {
+	result, err := r.db.Exec(`INSERT INTO login_events (user_id, method, success, challenge, error, ua, ip) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		event.UserID, event.Method, event.Success, event.Challenge, event.Error, event.UA, event.IP)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// DeleteOlderThan removes events created before the time. Returns number of deleted rows.
+func (r *LoginEventRepo) DeleteOlderThan(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM login_events WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -3,11 +3,9 @@ package repository
 import (
 	"database/sql"
 	"fmt"
-	"log"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
 	"github.com/jmoiron/sqlx"
@@ -68,7 +66,12 @@ func (r *OrganizationRepo) Create(image *string, name, city, address, invoiceAdd
 		return 0, err
 	}
 
-	go r.CopyDefaultContent(organizationID, plan)
+	jobID, err := r.CreateCopyJob(organizationID, plan, "all_or_nothing")
+	if err != nil {
+		return 0, err
+	}
+
+	go r.RunCopyJob(jobID)
 
 	return organizationID, nil
 }
@@ -91,7 +94,7 @@ func (r *OrganizationRepo) CreateTx(tx *sql.Tx, image *string, name, city, addre
 
 	_, err = tx.Exec(`INSERT 
 		INTO pages (organization_id, language_tag, pages.type, theme, pages.status, title, sort) 
-		VALUES (?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?)`,
+		VALUES (?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?)`,
 		organizationID, "de", "section", "precautions", "visible", "Vorsorgen", 1,
 		organizationID, "de", "section", "deal_with", "visible", "Bewältigen", 2,
 		organizationID, "de", "section", "e_restore", "visible", "Wiederherstellen", 3,
@@ -158,292 +161,49 @@ func (r *OrganizationRepo) Update(id int64, name, image, city, address, invoiceA
 	return nil
 }
 
-func (r *OrganizationRepo) Delete(id int64) error {
-	_, err := r.db.Exec(`DELETE FROM organizations WHERE id = ?`, id)
+func (r *OrganizationRepo) UpdateRequire2FA(id int64, require bool) error {
+	_, err := r.db.Exec(`UPDATE organizations SET require_2fa = ? WHERE id = ?`, require, id)
 	return err
 }
 
-func (r *OrganizationRepo) CopyDefaultContent(organizationID int64, plan string) error {
-	adminRootPages, err := r.pageRepo.GetRootPages(nil)
-	if err != nil {
-		return err
-	}
-
-	// Create maps to save new page and block IDs, so then page links can be fixed.
-	var pageIDs sync.Map
-	var blockIDs sync.Map
-
-	c := make(chan error)
-	for _, root := range adminRootPages {
-		var pages []domain.Page
-
-		err = r.db.Select(&pages, `
-		SELECT pages.* FROM pages INNER JOIN default_pages ON default_pages.id = pages.id
-		WHERE pages.status = "visible" 
-			AND default_pages.plan = ?
-			AND pages.parent_id = ? 
-			AND pages.theme = ?`, plan, root.ID, root.Theme)
-		if err != nil {
-			log.Println("Failed to get default pages: ", err)
-		}
-
-		var newParentID int64
-		err = r.db.Get(&newParentID, "SELECT id FROM pages WHERE organization_id = ? AND parent_id IS NULL AND theme = ?", organizationID, root.Theme)
-		if err != nil {
-			log.Println("Failed to get organization root page: ", err)
-		}
-
-		go func() {
-			c <- r.copyPages(pages, newParentID, organizationID, &pageIDs, &blockIDs)
-		}()
-	}
-
-	for range adminRootPages {
-		err := <-c
-		if err != nil {
-			log.Println("Error during content copying: ", err)
-		}
-	}
-
-	err = r.fixPageLinks(organizationID, &pageIDs, &blockIDs)
-	if err != nil {
-		log.Println("Failed to fix links: ", err)
-	}
-
-	return nil
-}
-
-func (r *OrganizationRepo) copyPages(pages []domain.Page, newParentID, organizationID int64, pageIDs *sync.Map, blockIDs *sync.Map) error {
-	tx, err := r.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	newPageIDs := make([]int64, len(pages))
-
-	for i, page := range pages {
-		result, err := tx.Exec(`INSERT 
-			INTO pages (organization_id, parent_id, language_tag, pages.type, theme, pages.status, title, image, image_hover, pages.sort)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			organizationID, newParentID, page.LanguageTag, page.Type, page.Theme, page.Status, page.Title, page.Image, page.ImageHover, page.Sort)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-
-		newID, _ := result.LastInsertId()
-		newPageIDs[i] = newID
-
-		pageIDs.Store(page.ID, newID)
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-
-	for i, page := range pages {
-		if page.Type == "section" {
-			childrens, err := r.pageRepo.GetChildrens(page.ID)
-			if err != nil {
-				return err
-			}
-
-			err = r.copyPages(childrens, newPageIDs[i], organizationID, pageIDs, blockIDs)
-			if err != nil {
-				log.Println(err)
-			}
-		} else if page.Type == "file" {
-			err = r.copyFile(page.ID, newPageIDs[i])
-			if err != nil {
-				log.Println(err)
-				return err
-			}
-
-		} else if page.Type == "content" {
-			err = r.copyBlocks(page.ID, newPageIDs[i], blockIDs)
-			if err != nil {
-				log.Println(err)
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-func (r *OrganizationRepo) copyBlocks(targetID, destID int64, blockIDs *sync.Map) error {
-	blocks, err := r.blockRepo.GetByPageID(targetID)
-	if err != nil {
-		return err
-	}
-
-	tx, err := r.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	for _, block := range blocks {
-		result, err := tx.Exec(`INSERT 
-		INTO blocks (page_id, title, content, readmore, image, image_hover, type, sort) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-			destID, block.Title, block.Content, block.Readmore, block.Image, block.ImageHover, block.Type, block.Sort)
-		if err != nil {
-			return err
-		}
-
-		newID, _ := result.LastInsertId()
-		blockIDs.Store(block.ID, newID)
-	}
-
-	return tx.Commit()
-}
-
-func (r *OrganizationRepo) copyFile(targetID, destID int64) error {
-	file, err := r.fileBlockRepo.GetByPageID(targetID)
-	if err != nil {
-		return err
-	}
-
-	_, err = r.fileBlockRepo.Create(destID, file.Path)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func (r *OrganizationRepo) Delete(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM organizations WHERE id = ?`, id)
+	return err
 }
 
-func (r *OrganizationRepo) fixPageLinks(organizationID int64, pageIDs *sync.Map, blockIDs *sync.Map) error {
-	countBlocks := 0
-	countPages := 0
-
-	pageIDs.Range(func(key, value interface{}) bool {
-		countPages += 1
-		return true
-	})
-
-	blockIDs.Range(func(key, value interface{}) bool {
-		countBlocks += 1
-		return true
-	})
-
-	if countPages == 0 || countBlocks == 0 {
-		return nil
-	}
+var adminPageLinkRegexp = regexp.MustCompile(`\/admin\/page\/([0-9]+)(#block-[0-9]+)?`)
 
-	selectIDs := ""
-	blockIDs.Range(func(key, value interface{}) bool {
-		selectIDs += strconv.FormatInt(value.(int64), 10) + ", "
-		return true
-	})
-	selectIDs = strings.TrimRight(selectIDs, ", ")
+// replacePageLinks rewrites links to admin pages into links to the organization pages
+// they were copied to. Links to pages which were not copied lead to the organization
+// itself. Returns true if at least one link was mapped to a copied page.
+func replacePageLinks(text string, organizationID int64, pageID, blockID func(int64) (int64, bool)) (string, bool) {
+	changed := false
 
-	limit := 1
-	offset := 0
+	matches := adminPageLinkRegexp.FindAllStringSubmatch(text, -1)
+	for _, match := range matches {
+		newLink := fmt.Sprintf("/organization/%d", organizationID)
 
-	for {
-		var block domain.Block
+		if len(match) > 1 {
+			oldPageID, err := strconv.ParseInt(match[1], 10, 64)
 
-		err := r.db.Get(&block, "SELECT id, content, readmore  FROM blocks WHERE id IN ("+selectIDs+") LIMIT ? OFFSET ?", limit, offset)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				break
-			}
-			return err
-		}
-
-		tx, err := r.db.Begin()
-		if err != nil {
-			return err
-		}
-
-		re := regexp.MustCompile(`\/admin\/page\/([0-9]+)(#block-[0-9]+)?`)
-
-		newContent := block.Content.String
-		newReadmore := block.Readmore.String
-		contentChanged := false
-		readmoreChanged := false
-
-		// Replace links inside content.
-		matches := re.FindAllStringSubmatch(newContent, -1)
-		for _, match := range matches {
-			newLink := fmt.Sprintf("/organization/%d", organizationID)
-
-			if len(match) > 1 {
-				oldPageID, err := strconv.ParseInt(match[1], 10, 64)
-
-				if _, ok := pageIDs.Load(oldPageID); err == nil && ok {
-					contentChanged = true
-					pageID, _ := pageIDs.Load(oldPageID)
-					newLink += "/page/" + strconv.FormatInt(pageID.(int64), 10)
-
-					if len(match) == 3 && strings.Contains(match[2], "#block-") {
-						oldBlockID, err := strconv.ParseInt(strings.Split(match[2], "#block-")[1], 10, 64)
-						if err == nil {
-							blockID, ok := blockIDs.Load(oldBlockID)
-							if ok {
-								newLink += "#block-" + strconv.FormatInt(blockID.(int64), 10)
-							}
-						}
-					}
-				}
-			}
-			newContent = strings.Replace(newContent, match[0], newLink, -1)
-		}
+			if newPageID, ok := pageID(oldPageID); err == nil && ok {
+				changed = true
+				newLink += "/page/" + strconv.FormatInt(newPageID, 10)
 
-		// Replace links inside readmore.
-		matches = re.FindAllStringSubmatch(newReadmore, -1)
-		for _, match := range matches {
-			newLink := fmt.Sprintf("/organization/%d", organizationID)
-
-			if len(match) > 1 {
-				oldPageID, err := strconv.ParseInt(match[1], 10, 64)
-
-				if _, ok := pageIDs.Load(oldPageID); err == nil && ok {
-					readmoreChanged = true
-					pageID, _ := pageIDs.Load(oldPageID)
-					newLink += "/page/" + strconv.FormatInt(pageID.(int64), 10)
-
-					if len(match) == 3 && strings.Contains(match[2], "#block-") {
-						oldBlockID, err := strconv.ParseInt(strings.Split(match[2], "#block-")[1], 10, 64)
-						if err == nil {
-							blockID, ok := blockIDs.Load(oldBlockID)
-							if ok {
-								newLink += "#block-" + strconv.FormatInt(blockID.(int64), 10)
-							}
+				if len(match) == 3 && strings.Contains(match[2], "#block-") {
+					oldBlockID, err := strconv.ParseInt(strings.Split(match[2], "#block-")[1], 10, 64)
+					if err == nil {
+						newBlockID, ok := blockID(oldBlockID)
+						if ok {
+							newLink += "#block-" + strconv.FormatInt(newBlockID, 10)
 						}
 					}
 				}
 			}
-
-			newReadmore = strings.Replace(newReadmore, match[0], newLink, -1)
 		}
 
-		if contentChanged && readmoreChanged {
-			_, err := tx.Exec("UPDATE blocks SET content = ?, readmore = ? WHERE id = ?", newContent, newReadmore, block.ID)
-			if err != nil {
-				return err
-			}
-		} else if contentChanged {
-			_, err := tx.Exec("UPDATE blocks SET content = ? WHERE id = ?", newContent, block.ID)
-			if err != nil {
-				return err
-			}
-		} else if readmoreChanged {
-			_, err := tx.Exec("UPDATE blocks SET readmore = ? WHERE id = ?", newReadmore, block.ID)
-			if err != nil {
-				return err
-			}
-		}
-
-		err = tx.Commit()
-		if err != nil {
-			return err
-		}
-
-		offset++
+		text = strings.Replace(text, match[0], newLink, -1)
 	}
 
-	return nil
+	return text, changed
 }
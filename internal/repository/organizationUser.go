@@ -15,6 +15,18 @@ func NewOrganizationUserRepo(db *sqlx.DB) *OrganizationUserRepo {
 
 func (r *OrganizationUserRepo) GetByUserID(id int64) ([]domain.OrganizationUser, error) {
 	var rows []domain.OrganizationUser
-	err := r.db.Select(&rows, "SELECT * FROM organizations_users WHERE user_id = ?", id)
+	err := r.db.Select(&rows, `
+		SELECT
+			ou.*,
+			r.name AS custom_role,
+			r.permissions AS custom_permissions
+		FROM
+			organizations_users AS ou
+		LEFT JOIN organization_roles AS r
+		ON
+			r.id = ou.role_id
+		WHERE
+			ou.user_id = ?
+		`, id)
 	return rows, err
 }
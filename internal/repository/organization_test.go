@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestOrganizationCreateTx(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db)
+	userID := testdb.User(t, db, "owner@example.com", "user")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := repo.Organization.CreateTx(tx, nil, "Gemeinde", "Stans", "Address", "Invoice address", "basic", 1000, userID)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rootPages int
+	err = db.Get(&rootPages, "SELECT COUNT(*) FROM pages WHERE organization_id = ? AND parent_id IS NULL", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootPages != len(testdb.Themes) {
+		t.Errorf("Got %d root pages, want %d", rootPages, len(testdb.Themes))
+	}
+
+	var role string
+	err = db.Get(&role, "SELECT role FROM organizations_users WHERE organization_id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "owner" {
+		t.Errorf("Got role %s, want owner", role)
+	}
+}
+
+func TestOrganizationUpdate(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db)
+	id := testdb.Organization(t, db, "Gemeinde", "basic")
+
+	err := repo.Organization.Update(id, null.StringFrom("Kanton"), null.String{}, null.String{}, null.String{}, null.StringFrom("New invoice address"), null.String{}, null.StringFrom("paid"), null.IntFrom(2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	organization, err := repo.Organization.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if organization.Name != "Kanton" || organization.InvoiceAddress != "New invoice address" || organization.Status != "paid" || organization.Population != 2000 {
+		t.Errorf("Fields were not updated: %+v", organization)
+	}
+	if organization.City != "Stans" || organization.Address != "Address" || organization.Plan != "basic" {
+		t.Errorf("Fields which were not specified were changed: %+v", organization)
+	}
+
+	err = repo.Organization.Update(id, null.String{}, null.String{}, null.String{}, null.String{}, null.String{}, null.String{}, null.String{}, null.Int{})
+	if err != nil {
+		t.Errorf("Update without fields failed: %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -29,12 +31,29 @@ func (r *PageRepo) GetChildrens(id int64) ([]domain.Page, error) {
 	return pages, err
 }
 
+// GetPublishedChildrens returns pages which are children of the page in their
+// published version. Draft pages are matched by the parent stored in their
+// published revision, so moves stay hidden from readers until published.
+func (r *PageRepo) GetPublishedChildrens(id int64) ([]domain.Page, error) {
+	var pages []domain.Page
+	err := r.db.Select(&pages, `SELECT pages.* FROM pages
+		LEFT JOIN revisions ON revisions.id = pages.published_revision_id
+		WHERE IF(pages.draft, JSON_VALUE(revisions.data, '$.page.parentID'), pages.parent_id) = ?`, id)
+	return pages, err
+}
+
 func (r *PageRepo) GetDefaultPage(pageID int64) ([]domain.DefaultPage, error) {
 	var pages []domain.DefaultPage
 	err := r.db.Select(&pages, "SELECT * FROM default_pages WHERE id = ?", pageID)
 	return pages, err
 }
 
+func (r *PageRepo) GetDrafts(organizationID int64) ([]domain.Page, error) {
+	var pages []domain.Page
+	err := r.db.Select(&pages, "SELECT * FROM pages WHERE organization_id = ? AND draft = true ORDER BY updated_at DESC", organizationID)
+	return pages, err
+}
+
 func (r *PageRepo) GetRootPages(organizationID *int64) ([]domain.Page, error) {
 	var pages []domain.Page
 	var err error
@@ -74,19 +93,27 @@ func (r *PageRepo) Create(organizationID *int64, parentID int64, languageTag, pa
 	img := null.StringFromPtr(image)
 	imgHover := null.StringFromPtr(imageHover)
 
+	// Organization pages stay hidden from readers until they are published.
+	draft := organizationID != nil
+
 	result, err := r.db.Exec(`INSERT 
-			INTO pages (organization_id, parent_id, language_tag, pages.type, theme, pages.status, title, image, image_hover, pages.sort)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, (
+			INTO pages (organization_id, parent_id, language_tag, pages.type, theme, pages.status, title, image, image_hover, draft, pages.sort)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, (
 				SELECT COALESCE((MAX(P.sort) + 1), 1) 
 				FROM pages AS P
 				WHERE P.parent_id = ?))`,
-		NullOrganizationID, parentID, languageTag, pageType, theme, status, title, img, imgHover, parentID)
+		NullOrganizationID, parentID, languageTag, pageType, theme, status, title, img, imgHover, draft, parentID)
 
 	if err != nil {
 		return 0, err
 	}
 	pageID, _ := result.LastInsertId()
 
+	err = indexPage(r.db, pageID)
+	if err != nil {
+		return 0, err
+	}
+
 	go r.UpdateUpdatedAt(parentID)
 
 	return pageID, nil
@@ -154,22 +181,76 @@ func (r *PageRepo) Update(id int64, parentID *int64, status, title, image, image
 	args = append(args, id)
 	query := "UPDATE pages SET updated_at = NOW(), " + strings.Join(fields, ", ") + " WHERE id = ?"
 
-	_, err := r.db.Exec(query, args...)
+	tx, err := r.db.Beginx()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	revisionID, err := createRevision(tx, id, null.Int{})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = markDraft(tx, id, revisionID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = indexPage(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
+// UpdateSort orders childrens of the page. Revision of every children is saved before,
+// so their previous position is kept in history.
 func (r *PageRepo) UpdateSort(parentID int64, sort []int) error {
-	tx, err := r.db.Begin()
+	tx, err := r.db.Beginx()
 	if err != nil {
 		return err
 	}
 
+	var childIDs []int64
+	err = tx.Select(&childIDs, "SELECT id FROM pages WHERE parent_id = ?", parentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	childrens := make(map[int64]bool, len(childIDs))
+	for _, id := range childIDs {
+		childrens[id] = true
+	}
+
 	for i := range sort {
-		_, err = tx.Exec("UPDATE pages SET sort = ? WHERE id = ? AND parent_id = ?", i, sort[i], parentID)
+		id := int64(sort[i])
+		if !childrens[id] {
+			continue
+		}
+
+		revisionID, err := createRevision(tx, id, null.Int{})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = markDraft(tx, id, revisionID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE pages SET sort = ? WHERE id = ? AND parent_id = ?", i, id, parentID)
 		if err != nil {
 			tx.Rollback()
 			return err
@@ -181,21 +262,162 @@ func (r *PageRepo) UpdateSort(parentID int64, sort []int) error {
 	return tx.Commit()
 }
 
+// Publish makes current content of the page visible for readers.
+func (r *PageRepo) Publish(id int64) error {
+	page, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	// Deletion is kept in draft until published.
+	if page.Status == "deleted" {
+		_, err = r.db.Exec("DELETE FROM pages WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+
+		go r.UpdateUpdatedAt(page.ParentID.Int64)
+
+		return nil
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	revisionID, err := createRevision(tx, id, null.Int{})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE pages SET draft = false, published_revision_id = ? WHERE id = ?", revisionID, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = indexPage(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Discard drops unpublished changes and restores the published content of the page.
+// Draft itself is saved as revision, so it can be restored later.
+func (r *PageRepo) Discard(id int64) error {
+	page, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if !page.Draft {
+		return nil
+	}
+
+	if !page.PublishedRevisionID.Valid {
+		return errors.New("page has never been published")
+	}
+
+	var revision domain.Revision
+	err = r.db.Get(&revision, "SELECT * FROM revisions WHERE id = ?", page.PublishedRevisionID.Int64)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = createRevision(tx, id, null.Int{})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = restoreRevision(tx, revision)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Moves are part of the draft as well.
+	var data domain.RevisionData
+	err = json.Unmarshal([]byte(revision.Data), &data)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE pages SET draft = false, parent_id = ?, sort = ? WHERE id = ?", data.Page.ParentID, data.Page.Sort, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = indexPage(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (r *PageRepo) UpdateUpdatedAt(pageID int64) error {
 	_, err := r.db.Exec("UPDATE pages SET updated_at = NOW() WHERE id = ?", pageID)
 
 	return err
 }
 
+// Delete removes the page. Published organization pages are only marked as
+// deleted in draft, readers keep seeing them until the deletion is published.
 func (r *PageRepo) Delete(id int64) error {
 	page, err := r.GetByID(id)
 	if err == nil {
 		go r.UpdateUpdatedAt(page.ParentID.Int64)
 	}
 
-	_, err = r.db.Exec("DELETE FROM pages WHERE id = ?", id)
+	if err != nil || !page.OrganizationID.Valid || !page.PublishedRevisionID.Valid {
+		_, err = r.db.Exec("DELETE FROM pages WHERE id = ?", id)
+		return err
+	}
 
-	return err
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	revisionID, err := createRevision(tx, id, null.Int{})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = markDraft(tx, id, revisionID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE pages SET status = \"deleted\", updated_at = NOW() WHERE id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = indexPage(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *PageRepo) DeleteDefaultPage(pageID int64, plans []string) error {
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type PageAccessRepo struct {
+	db *sqlx.DB
+}
+
+func NewPageAccessRepo(db *sqlx.DB) *PageAccessRepo {
+	return &PageAccessRepo{db: db}
+}
+
+func (r *PageAccessRepo) GetByPageID(pageID int64) ([]domain.PageAccess, error) {
+	entries := make([]domain.PageAccess, 0)
+	err := r.db.Select(&entries, "SELECT * FROM page_access WHERE page_id = ? ORDER BY id", pageID)
+	return entries, err
+}
+
+// GetByOrganizationID returns entries of all restricted pages of the organization.
+func (r *PageAccessRepo) GetByOrganizationID(organizationID int64) ([]domain.PageAccess, error) {
+	entries := make([]domain.PageAccess, 0)
+	err := r.db.Select(&entries, `SELECT page_access.* FROM page_access
+		INNER JOIN pages ON pages.id = page_access.page_id
+		WHERE pages.organization_id = ? AND pages.restricted = true`, organizationID)
+	return entries, err
+}
+
+// IsRestricted reports whether any page of the organization is restricted.
+func (r *PageAccessRepo) IsRestricted(organizationID int64) (bool, error) {
+	var restricted bool
+	err := r.db.Get(&restricted, "SELECT EXISTS(SELECT 1 FROM pages WHERE organization_id = ? AND restricted = true)", organizationID)
+	return restricted, err
+}
+
+// Set replaces entries of the page. Entries are kept only if the page is restricted.
+func (r *PageAccessRepo) Set(pageID int64, restricted bool, entries []domain.PageAccess) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE pages SET restricted = ? WHERE id = ?", restricted, pageID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM page_access WHERE page_id = ?", pageID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if restricted {
+		for _, entry := range entries {
+			_, err = tx.Exec("INSERT INTO page_access (page_id, user_id, role, role_id) VALUES (?, ?, ?, ?)", pageID, entry.UserID, entry.Role, entry.RoleID)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// Matches links to admin and organization pages with optional block anchor.
+var pageLinkRegexp = regexp.MustCompile(`\/(?:admin|organization\/[0-9]+)\/page\/([0-9]+)(?:#block-([0-9]+))?`)
+
+// GetTree returns current content of the page and all its childrens.
+func (r *PageRepo) GetTree(pageID int64) (domain.PageTreeNode, error) {
+	var node domain.PageTreeNode
+
+	content, err := pageContent(r.db, pageID)
+	if err != nil {
+		return node, err
+	}
+
+	node.Page = content.Page
+	node.Blocks = content.Blocks
+	node.File = content.File
+
+	childrens, err := r.GetChildrens(pageID)
+	if err != nil {
+		return node, err
+	}
+
+	node.Childrens = make([]domain.PageTreeNode, 0, len(childrens))
+	for _, children := range childrens {
+		childrenNode, err := r.GetTree(children.ID)
+		if err != nil {
+			return node, err
+		}
+		node.Childrens = append(node.Childrens, childrenNode)
+	}
+
+	return node, nil
+}
+
+// ImportTree creates copy of the page tree under the parent page. Theme and organization
+// are taken from the parent. Links between imported pages and blocks are rewritten to
+// the new IDs, other links are left as is. Returns ID of the new root page.
+func (r *PageRepo) ImportTree(parentID int64, root domain.PageTreeNode) (int64, error) {
+	parent, err := r.GetByID(parentID)
+	if err != nil {
+		return 0, err
+	}
+
+	if parent.Type != "section" {
+		return 0, errors.New("pages can be imported only into sections")
+	}
+
+	pageIDs := make(map[int64]int64)
+	blockIDs := make(map[int64]int64)
+	created := make([]int64, 0)
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	rootID, err := importTreeNode(tx, parent, root, true, pageIDs, blockIDs, &created)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = remapTreeLinks(tx, parent.OrganizationID.Ptr(), created, pageIDs, blockIDs)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	go r.UpdateUpdatedAt(parentID)
+
+	return rootID, nil
+}
+
+func importTreeNode(q sqlx.Ext, parent domain.Page, node domain.PageTreeNode, root bool, pageIDs, blockIDs map[int64]int64, created *[]int64) (int64, error) {
+	page := node.Page
+
+	// Organization pages stay hidden from readers until they are published.
+	draft := parent.OrganizationID.Valid
+
+	var sort interface{} = page.Sort
+	if root {
+		var maxSort sql.NullInt64
+		err := sqlx.Get(q, &maxSort, "SELECT MAX(sort) FROM pages WHERE parent_id = ?", parent.ID)
+		if err != nil {
+			return 0, err
+		}
+		sort = maxSort.Int64 + 1
+	}
+
+	result, err := q.Exec(`INSERT 
+		INTO pages (organization_id, parent_id, language_tag, pages.type, theme, pages.status, title, image, image_hover, draft, pages.sort)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		parent.OrganizationID, parent.ID, page.LanguageTag, page.Type, parent.Theme, page.Status, page.Title, page.Image, page.ImageHover, draft, sort)
+	if err != nil {
+		return 0, err
+	}
+
+	pageID, _ := result.LastInsertId()
+	pageIDs[page.ID] = pageID
+	*created = append(*created, pageID)
+
+	for _, block := range node.Blocks {
+		result, err := q.Exec(`INSERT
+			INTO blocks (page_id, title, content, readmore, image, image_hover, type, sort)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			pageID, block.Title, block.Content, block.Readmore, block.Image, block.ImageHover, block.Type, block.Sort)
+		if err != nil {
+			return 0, err
+		}
+
+		blockIDs[block.ID], _ = result.LastInsertId()
+	}
+
+	if node.File != nil {
+		_, err = q.Exec("INSERT INTO files (id, path) VALUES (?, ?)", pageID, node.File.Path)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	page.ID = pageID
+	page.OrganizationID = parent.OrganizationID
+	page.Theme = parent.Theme
+	for _, children := range node.Childrens {
+		_, err = importTreeNode(q, page, children, false, pageIDs, blockIDs, created)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return pageID, nil
+}
+
+// remapTreeLinks rewrites links to imported pages in the blocks of created pages and
+// indexes the pages for search.
+func remapTreeLinks(q sqlx.Ext, organizationID *int64, pageIDs []int64, pageMap, blockMap map[int64]int64) error {
+	for _, pageID := range pageIDs {
+		var blocks []domain.Block
+		err := sqlx.Select(q, &blocks, "SELECT * FROM blocks WHERE page_id = ?", pageID)
+		if err != nil {
+			return err
+		}
+
+		for _, block := range blocks {
+			content := remapPageLinks(block.Content.String, organizationID, pageMap, blockMap)
+			readmore := remapPageLinks(block.Readmore.String, organizationID, pageMap, blockMap)
+			if content == block.Content.String && readmore == block.Readmore.String {
+				continue
+			}
+
+			block.Content.String = content
+			block.Readmore.String = readmore
+
+			_, err = q.Exec("UPDATE blocks SET content = ?, readmore = ? WHERE id = ?", block.Content, block.Readmore, block.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = indexPage(q, pageID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remapPageLinks rewrites links to the pages found in the page map. Links to admin pages
+// are created if organization is nil.
+func remapPageLinks(text string, organizationID *int64, pageMap, blockMap map[int64]int64) string {
+	prefix := "/admin"
+	if organizationID != nil {
+		prefix = "/organization/" + strconv.FormatInt(*organizationID, 10)
+	}
+
+	return pageLinkRegexp.ReplaceAllStringFunc(text, func(link string) string {
+		match := pageLinkRegexp.FindStringSubmatch(link)
+
+		oldPageID, _ := strconv.ParseInt(match[1], 10, 64)
+		newPageID, ok := pageMap[oldPageID]
+		if !ok {
+			return link
+		}
+
+		newLink := prefix + "/page/" + strconv.FormatInt(newPageID, 10)
+
+		if match[2] != "" {
+			oldBlockID, _ := strconv.ParseInt(match[2], 10, 64)
+			if newBlockID, ok := blockMap[oldBlockID]; ok {
+				newLink += "#block-" + strconv.FormatInt(newBlockID, 10)
+			}
+		}
+
+		return newLink
+	})
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestRemapPageLinks(t *testing.T) {
+	organizationID := int64(9)
+	pages := map[int64]int64{3: 30, 5: 50}
+	blocks := map[int64]int64{4: 40}
+
+	tests := []struct {
+		in             string
+		organizationID *int64
+		want           string
+	}{
+		{`<a href="/admin/page/3">a</a>`, &organizationID, `<a href="/organization/9/page/30">a</a>`},
+		{`<a href="/admin/page/3#block-4">a</a>`, &organizationID, `<a href="/organization/9/page/30#block-40">a</a>`},
+		{`<a href="https://example.com/organization/2/page/5">a</a>`, &organizationID, `<a href="https://example.com/organization/9/page/50">a</a>`},
+		{`<a href="/organization/2/page/5#block-6">a</a>`, nil, `<a href="/admin/page/50">a</a>`},
+		{`<a href="/organization/2/page/7">a</a>`, &organizationID, `<a href="/organization/2/page/7">a</a>`},
+		{`/admin/page/3 and /admin/page/35`, &organizationID, `/organization/9/page/30 and /admin/page/35`},
+	}
+
+	for _, test := range tests {
+		got := remapPageLinks(test.in, test.organizationID, pages, blocks)
+		if got != test.want {
+			t.Errorf("remapPageLinks(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestImportTree(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db)
+	adminRoots := testdb.RootPages(t, db, null.Int{})
+
+	pages, blocks := testdb.PageTree(t, db, adminRoots["deal_with"], testdb.Page{Title: "Section", Childrens: []testdb.Page{
+		{Title: "Target", Blocks: []testdb.Block{{Title: "Target block"}}},
+		{Title: "File", Type: "file", File: "/common/plan.pdf"},
+	}})
+	testdb.PageTree(t, db, pages["Section"], testdb.Page{Title: "Linking", Blocks: []testdb.Block{
+		{Title: "Link", Readmore: fmt.Sprintf(`<a href="/admin/page/%d#block-%d">Target</a>`, pages["Target"], blocks["Target block"])},
+	}})
+
+	tree, err := repo.Page.GetTree(pages["Section"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	parentID := testdb.RootPage(t, db, null.IntFrom(organizationID), "precautions")
+
+	rootID, err := repo.Page.ImportTree(parentID, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var imported []struct {
+		ID    int64  `db:"id"`
+		Title string `db:"title"`
+		Theme string `db:"theme"`
+		Draft bool   `db:"draft"`
+	}
+	err = db.Select(&imported, "SELECT id, title, theme, draft FROM pages WHERE organization_id = ? AND parent_id IS NOT NULL", organizationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 4 {
+		t.Fatalf("Got %d imported pages, want 4", len(imported))
+	}
+
+	ids := make(map[string]int64)
+	for _, page := range imported {
+		ids[page.Title] = page.ID
+		if page.Theme != "precautions" || !page.Draft {
+			t.Errorf("Imported page must be a draft with theme of the parent: %+v", page)
+		}
+	}
+	if ids["Section"] != rootID {
+		t.Errorf("Got root %d, want %d", rootID, ids["Section"])
+	}
+
+	var targetBlockID int64
+	err = db.Get(&targetBlockID, "SELECT id FROM blocks WHERE page_id = ?", ids["Target"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var readmore string
+	err = db.Get(&readmore, "SELECT readmore FROM blocks WHERE page_id = ?", ids["Linking"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantLink := fmt.Sprintf("/organization/%d/page/%d#block-%d", organizationID, ids["Target"], targetBlockID)
+	if !strings.Contains(readmore, wantLink) {
+		t.Errorf("Link was not remapped, got %q, want link %s", readmore, wantLink)
+	}
+
+	var filePath string
+	err = db.Get(&filePath, "SELECT path FROM files WHERE id = ?", ids["File"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filePath != "/common/plan.pdf" {
+		t.Errorf("Got file path %s, want /common/plan.pdf", filePath)
+	}
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestPageUpdateSort(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db)
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	rootID := testdb.RootPage(t, db, null.IntFrom(organizationID), "precautions")
+
+	pages, _ := testdb.PageTree(t, db, rootID, testdb.Page{Title: "A"}, testdb.Page{Title: "B"}, testdb.Page{Title: "C"})
+
+	err := repo.Page.UpdateSort(rootID, []int{int(pages["C"]), int(pages["A"]), int(pages["B"])})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	childrens, err := repo.Page.GetChildrens(rootID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"C", "A", "B"}
+	if len(childrens) != len(want) {
+		t.Fatalf("Got %d childrens, want %d", len(childrens), len(want))
+	}
+	for i, children := range childrens {
+		if children.Title != want[i] {
+			t.Errorf("Got %s at position %d, want %s", children.Title, i, want[i])
+		}
+	}
+}
+
+func TestPagePublishDiscard(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db)
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	rootID := testdb.RootPage(t, db, null.IntFrom(organizationID), "precautions")
+
+	id, err := repo.Page.Create(&organizationID, rootID, "de", "content", "precautions", "visible", "Published", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := repo.Page.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.Draft {
+		t.Error("New organization page is not a draft")
+	}
+
+	err = repo.Page.Publish(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	title := "Changed"
+	err = repo.Page.Update(id, nil, nil, &title, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = repo.Page.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.Draft || !page.PublishedRevisionID.Valid {
+		t.Errorf("Changed page must be a draft with published revision: %+v", page)
+	}
+
+	err = repo.Page.Discard(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = repo.Page.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Draft || page.Title != "Published" {
+		t.Errorf("Draft was not discarded: %+v", page)
+	}
+}
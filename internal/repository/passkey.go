@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"database/sql"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type PasskeyRepo struct {
+	db *sqlx.DB
+}
+
+func NewPasskeyRepo(db *sqlx.DB) *PasskeyRepo {
+	return &PasskeyRepo{db: db}
+}
+
+func (r *PasskeyRepo) GetByUserID(userID int64) ([]domain.Passkey, error) {
+	passkeys := make([]domain.Passkey, 0)
+	err := r.db.Select(&passkeys, "SELECT * FROM passkeys WHERE user_id = ? ORDER BY id", userID)
+	return passkeys, err
+}
+
+func (r *PasskeyRepo) GetByCredentialID(credentialID []byte) (domain.Passkey, error) {
+	var passkey domain.Passkey
+	err := r.db.Get(&passkey, "SELECT * FROM passkeys WHERE credential_id = ?", credentialID)
+	return passkey, err
+}
+
+func (r *PasskeyRepo) Create(passkey domain.Passkey) (int64, error) {
+	result, err := r.db.Exec(`INSERT INTO passkeys (user_id, credential_id, public_key, sign_count, name) VALUES (?, ?, ?, ?, ?)`,
+		passkey.UserID, passkey.CredentialID, passkey.PublicKey, passkey.SignCount, passkey.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (r *PasskeyRepo) UpdateSignCount(id int64, signCount uint32) error {
+	_, err := r.db.Exec(`UPDATE passkeys SET sign_count = ?, last_used_at = NOW() WHERE id = ?`, signCount, id)
+	return err
+}
+
+// Delete removes passkey of the user. sql.ErrNoRows is returned if the user has no such
+// passkey.
+func (r *PasskeyRepo) Delete(userID, id int64) error {
+	result, err := r.db.Exec(`DELETE FROM passkeys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -13,26 +13,89 @@ type User interface {
 	GetAll() ([]domain.User, error)
 	GetByID(id int64) (domain.User, error)
 	GetByEmail(email string) (domain.User, error)
-	GetByVerificationToken(token string) (domain.User, error)
-	GetByPasswordResetToken(token string) (domain.User, error)
+	GetByVerificationToken(tokenHash string) (domain.User, error)
+	GetByPasswordResetToken(tokenHash string) (domain.User, error)
 	GetByOrganizationID(organizationID int64) ([]domain.User, error)
 	GetVerification(id int64) (domain.UserVerification, error)
 	GetPasswordReset(email string) (domain.UserPasswordReset, error)
 	GetRefreshSession(refreshToken string) (domain.RefreshSession, error)
+	GetRefreshSessionByID(id int64) (domain.RefreshSession, error)
+	GetSessions(userID int64) ([]domain.Session, error)
 	Create(firstname, lastname *string, email string, image *string) (int64, error)
 	CreateWithOrganization(firstname, lastname *string, email string, name, city, address, invoiceAddress, plan string, population int) (userID int64, organizationID int64, err error)
 	CreateTx(tx *sql.Tx, firstname, lastname *string, email string, image *string) (int64, error)
-	CreateVerification(id int64, token string) error
-	CreatePasswordReset(email string, token string) error
-	CreateRefreshSession(userID int64, refreshToken, ua, fingerprint string, expiresAt time.Time) error
+	CreateVerification(id int64, tokenHash string, expiresAt time.Time) error
+	CreatePasswordReset(email string, tokenHash string, expiresAt time.Time) error
+	CreateRefreshSession(userID int64, familyID, refreshToken string, info domain.RequestInfo, expiresAt time.Time) error
 	CreateOrganizationUser(organizationID, userID int64, role string) error
-	Update(id int64, image, firstname, lastname, email, userType *string) error
+	Update(id int64, image, firstname, lastname, userType *string) error
 	UpdatePassword(id int64, password string) error
-	UpdateVerificationByToken(token, status string) error
-	UpdateRefreshSession(id int64, refreshToken, ua, fingerprint string, expiresAt time.Time) error
+	VerifyByToken(tokenHash, password string) (int64, error)
+	ResetPasswordByToken(tokenHash, password string) (int64, error)
+	CreateMagicLink(id int64, tokenHash string, expiresAt time.Time) error
+	UseMagicLink(tokenHash string) (int64, error)
+	GetPendingEmailChange(userID int64) (domain.UserEmailChange, error)
+	CreateEmailChange(change domain.UserEmailChange) error
+	ConfirmEmailChange(tokenHash string) (domain.UserEmailChange, error)
+	RevertEmailChange(revertTokenHash string) (domain.UserEmailChange, error)
+	IncrementTokenVersion(id int64) error
+	IncrementFailedLogins(id int64) (int, error)
+	Lock(id int64, until time.Time) error
+	Unlock(id int64) error
+	RotateRefreshSession(session domain.RefreshSession, refreshToken string, info domain.RequestInfo) error
 	UpdateOrganizationUser(organizationID, userID int64, role string) error
 	Delete(id int64) error
 	DeleteOrganizationUser(organizationID, userID int64) error
+	DeleteRefreshFamily(familyID string) error
+	DeleteRefreshSessions(userID int64, keepFamilyID string) error
+	DeleteExpiredRefreshSessions() (int64, error)
+	DeleteExpiredTokens() (int64, error)
+	DeletePasswordReset(id int64) error
+}
+
+type TwoFactor interface {
+	GetTOTP(userID int64) (domain.UserTOTP, error)
+	CountRecoveryCodes(userID int64) (int, error)
+	IsTwoFactorRequired(userID int64) (bool, error)
+	CreateTOTP(userID int64, secret string) error
+	EnableTOTP(userID, step int64, codeHashes []string) error
+	UseTOTPStep(userID, step int64) (bool, error)
+	UseRecoveryCode(userID int64, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(userID int64, codeHashes []string) error
+	DeleteTOTP(userID int64) error
+}
+
+type SSO interface {
+	GetConfig(organizationID int64) (domain.SSOConfig, error)
+	GetIdentity(issuer, subject string) (domain.UserIdentity, error)
+	SaveConfig(config domain.SSOConfig) error
+	ProvisionUser(userID int64, user domain.User, identity domain.UserIdentity, organizationID int64, role string) (int64, error)
+	DeleteConfig(organizationID int64) error
+}
+
+type LoginEvent interface {
+	GetByUserID(userID, cursor int64, limit int) ([]domain.LoginEvent, error)
+	HasSuccessfulLogin(userID int64, ua *string) (bool, error)
+	Create(event domain.LoginEvent) (int64, error)
+	DeleteOlderThan(before time.Time) (int64, error)
+}
+
+type Passkey interface {
+	GetByUserID(userID int64) ([]domain.Passkey, error)
+	GetByCredentialID(credentialID []byte) (domain.Passkey, error)
+	Create(passkey domain.Passkey) (int64, error)
+	UpdateSignCount(id int64, signCount uint32) error
+	Delete(userID, id int64) error
+}
+
+type APIKey interface {
+	GetByID(id int64) (domain.APIKey, error)
+	GetByHash(keyHash string) (domain.APIKey, error)
+	GetByUserID(userID int64) ([]domain.APIKey, error)
+	GetByOrganizationID(organizationID int64) ([]domain.APIKey, error)
+	Create(key domain.APIKey) (int64, error)
+	UpdateLastUsed(id int64) error
+	Delete(id int64) error
 }
 
 type Organization interface {
@@ -41,8 +104,12 @@ type Organization interface {
 	GetByUserID(userID int64) ([]domain.Organization, error)
 	Create(image *string, name, city, address, invoiceAddress, plan string, population int, userID int64) (int64, error)
 	CreateTx(tx *sql.Tx, image *string, name, city, address, invoiceAddress, plan string, population int, userID int64) (int64, error)
-	CopyDefaultContent(organizationID int64, plan string) error
+	CopyDefaultContent(organizationID int64, plan, mode string) error
+	GetCopyJob(organizationID int64) (domain.ContentCopyJob, error)
+	RunCopyJob(id int64) error
+	SyncDefaultContent(organizationID int64, dryRun bool) ([]domain.SyncChange, error)
 	Update(id int64, image, name, city, address, invoiceAddress, plan, status null.String, population null.Int) error
+	UpdateRequire2FA(id int64, require bool) error
 	Delete(id int64) error
 }
 
@@ -53,18 +120,31 @@ type OrganizationUser interface {
 type Page interface {
 	GetByID(id int64, fields ...string) (domain.Page, error)
 	GetChildrens(id int64) ([]domain.Page, error)
+	GetPublishedChildrens(id int64) ([]domain.Page, error)
 	GetDefaultPage(pageID int64) ([]domain.DefaultPage, error)
 	GetRootPages(organizationID *int64) ([]domain.Page, error)
 	GetPages(organizationID *int64, fields ...string) ([]domain.Page, error)
+	GetDrafts(organizationID int64) ([]domain.Page, error)
+	GetTree(pageID int64) (domain.PageTreeNode, error)
 	Create(organizationID *int64, parentID int64, languageTag, pageType, theme, status, title string, image, imageHover *string) (int64, error)
 	CreateDefaultPage(pageID int64, plans []string) error
 	Update(id int64, parentID *int64, status, title, image, imageHover *string) error
+	Publish(id int64) error
+	Discard(id int64) error
+	ImportTree(parentID int64, root domain.PageTreeNode) (int64, error)
 	UpdateSort(parentID int64, sort []int) error
 	UpdateUpdatedAt(pageID int64) error
 	Delete(id int64) error
 	DeleteDefaultPage(pageID int64, plans []string) error
 }
 
+type PageAccess interface {
+	GetByPageID(pageID int64) ([]domain.PageAccess, error)
+	GetByOrganizationID(organizationID int64) ([]domain.PageAccess, error)
+	IsRestricted(organizationID int64) (bool, error)
+	Set(pageID int64, restricted bool, entries []domain.PageAccess) error
+}
+
 type Block interface {
 	GetByPageID(pageID int64) ([]domain.Block, error)
 	GetByID(id int64) (domain.Block, error)
@@ -74,6 +154,18 @@ type Block interface {
 	Delete(id int64) error
 }
 
+type Revision interface {
+	GetByID(id int64) (domain.Revision, error)
+	GetByPageID(pageID int64) ([]domain.Revision, error)
+	GetByBlockID(blockID int64) ([]domain.Revision, error)
+	Restore(id int64) error
+}
+
+type Search interface {
+	Find(organizationID *int64, query, languageTag string, published bool, limit int) ([]domain.SearchHit, error)
+	Reindex(organizationID *int64) error
+}
+
 type FileBlock interface {
 	GetByID(id int64) (domain.FileBlock, error)
 	GetByPageID(pageID int64) (domain.FileBlock, error)
@@ -90,14 +182,46 @@ type Address interface {
 	Delete(id int64) error
 }
 
+type Audit interface {
+	Get(organizationID *int64, filter domain.AuditFilter, cursor int64, limit int) ([]domain.AuditEntry, error)
+	Create(entry domain.AuditEntry) (int64, error)
+}
+
+type Role interface {
+	GetByID(id int64) (domain.OrganizationRole, error)
+	GetByOrganizationID(organizationID int64) ([]domain.OrganizationRole, error)
+	GetMemberIDs(id int64) ([]int64, error)
+	Create(organizationID int64, name, permissions string) (int64, error)
+	Update(id int64, name, permissions string) error
+	Assign(organizationID, userID, id int64) error
+	Delete(id int64) error
+}
+
+type SigningKey interface {
+	GetPublished() ([]domain.SigningKey, error)
+	Create(key domain.SigningKey) error
+	DeleteExpired() (int64, error)
+}
+
 type Repository struct {
 	User
+	TwoFactor
+	SSO
+	Passkey
+	LoginEvent
+	APIKey
 	Organization
 	OrganizationUser
 	Page
+	PageAccess
 	Block
+	Revision
+	Search
 	FileBlock
 	Address
+	Audit
+	SigningKey
+	Role
 }
 
 func NewRepository(db *sqlx.DB) *Repository {
@@ -107,11 +231,22 @@ func NewRepository(db *sqlx.DB) *Repository {
 	organizationRepo := NewOrganizationRepo(db, pageRepo, blockRepo, fileBlockRepo)
 	return &Repository{
 		User:             NewUserRepo(db, organizationRepo),
+		TwoFactor:        NewTwoFactorRepo(db),
+		SSO:              NewSSORepo(db),
+		Passkey:          NewPasskeyRepo(db),
+		LoginEvent:       NewLoginEventRepo(db),
+		APIKey:           NewAPIKeyRepo(db),
 		OrganizationUser: NewOrganizationUserRepo(db),
 		Page:             pageRepo,
+		PageAccess:       NewPageAccessRepo(db),
 		Block:            blockRepo,
+		Revision:         NewRevisionRepo(db),
+		Search:           NewSearchRepo(db),
 		Organization:     organizationRepo,
 		FileBlock:        fileBlockRepo,
 		Address:          NewAddressRepo(db),
+		Audit:            NewAuditRepo(db),
+		SigningKey:       NewSigningKeyRepo(db),
+		Role:             NewRoleRepo(db),
 	}
 }
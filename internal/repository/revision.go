@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v4"
+)
+
+type RevisionRepo struct {
+	db *sqlx.DB
+}
+
+func NewRevisionRepo(db *sqlx.DB) *RevisionRepo {
+	return &RevisionRepo{db: db}
+}
+
+func (r *RevisionRepo) GetByID(id int64) (domain.Revision, error) {
+	var revision domain.Revision
+	err := r.db.Get(&revision, "SELECT * FROM revisions WHERE id = ?", id)
+	return revision, err
+}
+
+func (r *RevisionRepo) GetByPageID(pageID int64) ([]domain.Revision, error) {
+	var revisions []domain.Revision
+	err := r.db.Select(&revisions, "SELECT * FROM revisions WHERE page_id = ? ORDER BY created_at DESC, id DESC", pageID)
+	return revisions, err
+}
+
+func (r *RevisionRepo) GetByBlockID(blockID int64) ([]domain.Revision, error) {
+	var revisions []domain.Revision
+	err := r.db.Select(&revisions, "SELECT * FROM revisions WHERE block_id = ? ORDER BY created_at DESC, id DESC", blockID)
+	return revisions, err
+}
+
+// Restore rolls the page of the revision back to the saved snapshot. Current state
+// is saved as a new revision first, so restoring can be undone as well.
+func (r *RevisionRepo) Restore(id int64) error {
+	revision, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	currentRevisionID, err := createRevision(tx, revision.PageID, null.Int{})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = markDraft(tx, revision.PageID, currentRevisionID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = restoreRevision(tx, revision)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = indexPage(tx, revision.PageID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// createRevision saves snapshot of the page and all its blocks. If block ID is specified
+// then revision will be also listed in the block history.
+func createRevision(q sqlx.Ext, pageID int64, blockID null.Int) (int64, error) {
+	data, err := pageContent(q, pageID)
+	if err != nil {
+		return 0, err
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := q.Exec("INSERT INTO revisions (page_id, block_id, data) VALUES (?, ?, ?)", pageID, blockID, string(raw))
+	if err != nil {
+		return 0, err
+	}
+
+	revisionID, _ := result.LastInsertId()
+
+	return revisionID, nil
+}
+
+// pageContent returns page with its blocks in sort order and file.
+func pageContent(q sqlx.Queryer, pageID int64) (domain.RevisionData, error) {
+	data := domain.RevisionData{Blocks: make([]domain.Block, 0)}
+
+	err := sqlx.Get(q, &data.Page, "SELECT * FROM pages WHERE id = ?", pageID)
+	if err != nil {
+		return data, err
+	}
+
+	err = sqlx.Select(q, &data.Blocks, "SELECT * FROM blocks WHERE page_id = ? ORDER BY sort", pageID)
+	if err != nil {
+		return data, err
+	}
+
+	if data.Page.Type == "file" {
+		var file domain.FileBlock
+		err = sqlx.Get(q, &file, "SELECT * FROM files WHERE id = ?", pageID)
+		if err != nil && err != sql.ErrNoRows {
+			return data, err
+		}
+		if err == nil {
+			data.File = &file
+		}
+	}
+
+	return data, nil
+}
+
+// restoreRevision overwrites page content, block set and file with the revision snapshot.
+func restoreRevision(q sqlx.Ext, revision domain.Revision) error {
+	var data domain.RevisionData
+	err := json.Unmarshal([]byte(revision.Data), &data)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec("UPDATE pages SET updated_at = NOW(), status = ?, title = ?, image = ?, image_hover = ? WHERE id = ?",
+		data.Page.Status, data.Page.Title, data.Page.Image, data.Page.ImageHover, revision.PageID)
+	if err != nil {
+		return err
+	}
+
+	// Remove blocks which didn't exist at the moment of the snapshot.
+	deleteArgs := []interface{}{revision.PageID}
+	deleteQuery := "DELETE FROM blocks WHERE page_id = ?"
+	if len(data.Blocks) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(data.Blocks)), ",")
+		deleteQuery += " AND id NOT IN (" + placeholders + ")"
+		for _, block := range data.Blocks {
+			deleteArgs = append(deleteArgs, block.ID)
+		}
+	}
+
+	_, err = q.Exec(deleteQuery, deleteArgs...)
+	if err != nil {
+		return err
+	}
+
+	// Blocks are restored with their original IDs, so "#block-N" links keep working.
+	for _, block := range data.Blocks {
+		_, err = q.Exec(`INSERT 
+			INTO blocks (id, page_id, title, content, readmore, image, image_hover, type, sort) 
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE 
+				title = VALUES(title), content = VALUES(content), readmore = VALUES(readmore), image = VALUES(image), 
+				image_hover = VALUES(image_hover), type = VALUES(type), sort = VALUES(sort)`,
+			block.ID, revision.PageID, block.Title, block.Content, block.Readmore, block.Image, block.ImageHover, block.Type, block.Sort)
+		if err != nil {
+			return err
+		}
+	}
+
+	if data.File != nil {
+		_, err = q.Exec("INSERT INTO files (id, path) VALUES (?, ?) ON DUPLICATE KEY UPDATE path = ?", revision.PageID, data.File.Path, data.File.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markDraft switches organization page into the draft mode before it gets changed. Current
+// content is remembered as published revision, so readers keep seeing it until the
+// changes are published. If revision ID is 0 then snapshot of the current state is created.
+func markDraft(q sqlx.Ext, pageID int64, revisionID int64) error {
+	var page struct {
+		OrganizationID null.Int `db:"organization_id"`
+		Draft          bool     `db:"draft"`
+	}
+	err := sqlx.Get(q, &page, "SELECT organization_id, draft FROM pages WHERE id = ?", pageID)
+	if err != nil {
+		return err
+	}
+
+	// Default content has no publishing workflow.
+	if page.Draft || !page.OrganizationID.Valid {
+		return nil
+	}
+
+	if revisionID == 0 {
+		revisionID, err = createRevision(q, pageID, null.Int{})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = q.Exec("UPDATE pages SET draft = true, published_revision_id = ? WHERE id = ?", revisionID, pageID)
+	return err
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestRestoreDeletedBlock(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db)
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	rootID := testdb.RootPage(t, db, null.IntFrom(organizationID), "precautions")
+
+	// New page is a draft already, so markDraft alone wouldn't save anything.
+	pageID, err := repo.Page.Create(&organizationID, rootID, "de", "content", "precautions", "visible", "Page", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "<p>Text</p>"
+	firstID, err := repo.Block.Create(pageID, "First", "text", &content, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondID, err := repo.Block.Create(pageID, "Second", "text", &content, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.Block.UpdateSort(pageID, []int{int(secondID), int(firstID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.Block.Delete(firstID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revisions, err := repo.Revision.GetByBlockID(firstID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) == 0 {
+		t.Fatal("Deleted block has no revision")
+	}
+
+	err = repo.Revision.Restore(revisions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := repo.Block.GetByPageID(pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[0].ID != secondID || blocks[1].ID != firstID {
+		t.Errorf("Block set and sort order are not restored: %+v", blocks)
+	}
+
+	// Every change of the block set has its own revision.
+	pageRevisions, err := repo.Revision.GetByPageID(pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pageRevisions) < 5 {
+		t.Errorf("Got %d revisions, want revision for every change", len(pageRevisions))
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"errors"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type RoleRepo struct {
+	db *sqlx.DB
+}
+
+func NewRoleRepo(db *sqlx.DB) *RoleRepo {
+	return &RoleRepo{db: db}
+}
+
+func (r *RoleRepo) GetByID(id int64) (domain.OrganizationRole, error) {
+	var role domain.OrganizationRole
+	err := r.db.Get(&role, "SELECT * FROM organization_roles WHERE id = ?", id)
+	return role, err
+}
+
+func (r *RoleRepo) GetByOrganizationID(organizationID int64) ([]domain.OrganizationRole, error) {
+	roles := make([]domain.OrganizationRole, 0)
+	err := r.db.Select(&roles, "SELECT * FROM organization_roles WHERE organization_id = ? ORDER BY name", organizationID)
+	return roles, err
+}
+
+// GetMemberIDs returns IDs of users who have the role.
+func (r *RoleRepo) GetMemberIDs(id int64) ([]int64, error) {
+	ids := make([]int64, 0)
+	err := r.db.Select(&ids, "SELECT user_id FROM organizations_users WHERE role_id = ?", id)
+	return ids, err
+}
+
+func (r *RoleRepo) Create(organizationID int64, name, permissions string) (int64, error) {
+	result, err := r.db.Exec(`INSERT INTO organization_roles (organization_id, name, permissions) VALUES (?, ?, ?)`, organizationID, name, permissions)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (r *RoleRepo) Update(id int64, name, permissions string) error {
+	_, err := r.db.Exec(`UPDATE organization_roles SET name = ?, permissions = ? WHERE id = ?`, name, permissions, id)
+	return err
+}
+
+// Assign gives the custom role to the member of the organization. Base role of the
+// member is set to "user".
+func (r *RoleRepo) Assign(organizationID, userID, id int64) error {
+	result, err := r.db.Exec(`UPDATE organizations_users SET role = "user", role_id = ? WHERE organization_id = ? AND user_id = ?`, id, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("user is not a member of the organization")
+	}
+
+	return nil
+}
+
+func (r *RoleRepo) Delete(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM organization_roles WHERE id = ?`, id)
+	return err
+}
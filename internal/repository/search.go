@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/striphtml"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v4"
+)
+
+type SearchRepo struct {
+	db *sqlx.DB
+}
+
+func NewSearchRepo(db *sqlx.DB) *SearchRepo {
+	return &SearchRepo{db: db}
+}
+
+// Find returns best matching pages and blocks. If published is true then only content
+// visible to readers is searched, otherwise the current (possibly draft) content is used.
+// Only the matching page is checked here, hits below unpublished or hidden pages are
+// dropped by the search service.
+func (r *SearchRepo) Find(organizationID *int64, query, languageTag string, published bool, limit int) ([]domain.SearchHit, error) {
+	hits := make([]domain.SearchHit, 0)
+
+	terms := searchTerms(query)
+	if terms == "" {
+		return hits, nil
+	}
+
+	where := "pages.organization_id <=> ? AND MATCH(si.title, si.content) AGAINST(? IN BOOLEAN MODE)"
+	args := []interface{}{terms, terms, organizationID, terms}
+
+	if published {
+		where += ` AND si.draft = false AND si.status = "visible"`
+	} else {
+		where += ` AND si.draft = pages.draft AND si.status != "deleted"`
+	}
+
+	if languageTag != "" {
+		where += " AND si.language_tag = ?"
+		args = append(args, languageTag)
+	}
+
+	args = append(args, limit)
+
+	// Matches in titles are ranked higher than matches in the text.
+	err := r.db.Select(&hits, `
+		SELECT
+			pages.organization_id, si.page_id, si.block_id, si.title, si.content,
+			(MATCH(si.title) AGAINST(? IN BOOLEAN MODE) * 2 + MATCH(si.title, si.content) AGAINST(? IN BOOLEAN MODE)) AS score
+		FROM search_index AS si
+		INNER JOIN pages ON pages.id = si.page_id
+		WHERE `+where+`
+		ORDER BY score DESC, si.page_id, si.block_id
+		LIMIT ?`, args...)
+
+	return hits, err
+}
+
+// Reindex rebuilds search index of all pages of organization. Nil organization ID means
+// admin pages.
+func (r *SearchRepo) Reindex(organizationID *int64) error {
+	return indexOrganization(r.db, organizationID)
+}
+
+// indexOrganization rebuilds search index of all pages of organization.
+func indexOrganization(q sqlx.Ext, organizationID *int64) error {
+	var pageIDs []int64
+	err := sqlx.Select(q, &pageIDs, "SELECT id FROM pages WHERE organization_id <=> ?", organizationID)
+	if err != nil {
+		return err
+	}
+
+	for _, pageID := range pageIDs {
+		err = indexPage(q, pageID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexPage replaces search index entries of the page. Draft pages get two sets of
+// entries: the current content for editors and the published snapshot for readers.
+func indexPage(q sqlx.Ext, pageID int64) error {
+	var page domain.Page
+	err := sqlx.Get(q, &page, "SELECT * FROM pages WHERE id = ?", pageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	_, err = q.Exec("DELETE FROM search_index WHERE page_id = ?", pageID)
+	if err != nil {
+		return err
+	}
+
+	var blocks []domain.Block
+	err = sqlx.Select(q, &blocks, "SELECT * FROM blocks WHERE page_id = ?", pageID)
+	if err != nil {
+		return err
+	}
+
+	if !page.Draft {
+		return insertSearchEntries(q, page, blocks, false)
+	}
+
+	err = insertSearchEntries(q, page, blocks, true)
+	if err != nil {
+		return err
+	}
+
+	if !page.PublishedRevisionID.Valid {
+		return nil
+	}
+
+	var revision domain.Revision
+	err = sqlx.Get(q, &revision, "SELECT * FROM revisions WHERE id = ?", page.PublishedRevisionID.Int64)
+	if err != nil {
+		return err
+	}
+
+	var data domain.RevisionData
+	err = json.Unmarshal([]byte(revision.Data), &data)
+	if err != nil {
+		return err
+	}
+
+	published := page
+	published.Status = data.Page.Status
+	published.Title = data.Page.Title
+
+	return insertSearchEntries(q, published, data.Blocks, false)
+}
+
+func insertSearchEntries(q sqlx.Ext, page domain.Page, blocks []domain.Block, draft bool) error {
+	_, err := q.Exec(`INSERT 
+		INTO search_index (page_id, block_id, language_tag, status, draft, title, content) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		page.ID, nil, page.LanguageTag, page.Status, draft, page.Title, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		text := strings.TrimSpace(striphtml.Strip(block.Content.String) + " " + striphtml.Strip(block.Readmore.String))
+
+		_, err = q.Exec(`INSERT 
+			INTO search_index (page_id, block_id, language_tag, status, draft, title, content) 
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			page.ID, block.ID, page.LanguageTag, page.Status, draft, block.Title, null.NewString(text, text != ""))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// searchTerms converts user input into boolean mode query, where every word is
+// required and may be a prefix of the indexed word.
+func searchTerms(query string) string {
+	words := strings.FieldsFunc(query, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, "+"+word+"*")
+	}
+
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type SigningKeyRepo struct {
+	db *sqlx.DB
+}
+
+func NewSigningKeyRepo(db *sqlx.DB) *SigningKeyRepo {
+	return &SigningKeyRepo{db: db}
+}
+
+// GetPublished returns keys which are not expired yet, newest first.
+func (r *SigningKeyRepo) GetPublished() ([]domain.SigningKey, error) {
+	keys := make([]domain.SigningKey, 0)
+	err := r.db.Select(&keys, "SELECT * FROM signing_keys WHERE expires_at > NOW() ORDER BY active_from DESC, created_at DESC")
+	return keys, err
+}
+
+func (r *SigningKeyRepo) Create(key domain.SigningKey) error {
+	_, err := r.db.Exec(`INSERT INTO signing_keys (id, algorithm, private_key, active_from, retire_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Algorithm, key.PrivateKey, key.ActiveFrom, key.RetireAt, key.ExpiresAt)
+	return err
+}
+
+// DeleteExpired removes keys which are not published anymore. Returns number of deleted keys.
+func (r *SigningKeyRepo) DeleteExpired() (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM signing_keys WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
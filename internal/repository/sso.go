@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type SSORepo struct {
+	db *sqlx.DB
+}
+
+func NewSSORepo(db *sqlx.DB) *SSORepo {
+	return &SSORepo{db: db}
+}
+
+func (r *SSORepo) GetConfig(organizationID int64) (domain.SSOConfig, error) {
+	var config domain.SSOConfig
+	err := r.db.Get(&config, "SELECT * FROM organization_sso WHERE organization_id = ?", organizationID)
+	return config, err
+}
+
+func (r *SSORepo) GetIdentity(issuer, subject string) (domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+	err := r.db.Get(&identity, "SELECT * FROM user_identities WHERE issuer = ? AND subject = ?", issuer, subject)
+	return identity, err
+}
+
+// SaveConfig creates or updates the configuration. Empty client secret keeps the saved one.
+func (r *SSORepo) SaveConfig(config domain.SSOConfig) error {
+	_, err := r.db.Exec(`INSERT INTO organization_sso
+		(organization_id, issuer, client_id, client_secret, role_claim, role_mapping, default_role, enabled, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+		issuer = VALUES(issuer),
+		client_id = VALUES(client_id),
+		client_secret = IF(VALUES(client_secret) = "", client_secret, VALUES(client_secret)),
+		role_claim = VALUES(role_claim),
+		role_mapping = VALUES(role_mapping),
+		default_role = VALUES(default_role),
+		enabled = VALUES(enabled),
+		updated_by = VALUES(updated_by)`,
+		config.OrganizationID, config.Issuer, config.ClientID, config.ClientSecret, config.RoleClaim, config.RoleMapping, config.DefaultRole, config.Enabled, config.UpdatedBy)
+	return err
+}
+
+// ProvisionUser links the identity to the user and sets role of the user in the
+// organization. New verified user is created if userID is 0. Owners keep their role,
+// so the organization can't lose its owner because of provider settings. Custom roles
+// are assigned in the application and kept too.
+func (r *SSORepo) ProvisionUser(userID int64, user domain.User, identity domain.UserIdentity, organizationID int64, role string) (int64, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	if userID == 0 {
+		result, err := tx.Exec(`INSERT INTO users (firstname, lastname, email) VALUES (?, ?, ?)`, user.Firstname, user.Lastname, user.Email)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		userID, _ = result.LastInsertId()
+
+		// User authenticated by the provider doesn't need to verify email.
+		_, err = tx.Exec(`INSERT INTO user_verifications (id, status) VALUES (?, "verified")`, userID)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT IGNORE INTO user_identities (user_id, issuer, subject) VALUES (?, ?, ?)`, userID, identity.Issuer, identity.Subject)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO organizations_users (organization_id, user_id, role) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE role = IF(role = "owner" OR role_id IS NOT NULL, role, VALUES(role))`, organizationID, userID, role)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (r *SSORepo) DeleteConfig(organizationID int64) error {
+	_, err := r.db.Exec(`DELETE FROM organization_sso WHERE organization_id = ?`, organizationID)
+	return err
+}
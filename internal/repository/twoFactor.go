@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+type TwoFactorRepo struct {
+	db *sqlx.DB
+}
+
+func NewTwoFactorRepo(db *sqlx.DB) *TwoFactorRepo {
+	return &TwoFactorRepo{db: db}
+}
+
+func (r *TwoFactorRepo) GetTOTP(userID int64) (domain.UserTOTP, error) {
+	var totp domain.UserTOTP
+	err := r.db.Get(&totp, "SELECT * FROM user_totp WHERE user_id = ?", userID)
+	return totp, err
+}
+
+// CountRecoveryCodes returns number of unused recovery codes.
+func (r *TwoFactorRepo) CountRecoveryCodes(userID int64) (int, error) {
+	var count int
+	err := r.db.Get(&count, "SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID)
+	return count, err
+}
+
+// IsTwoFactorRequired checks if the user is owner or admin of an organization which
+// requires two-factor authentication. Custom roles which can manage users, roles or
+// security settings count as admin.
+func (r *TwoFactorRepo) IsTwoFactorRequired(userID int64) (bool, error) {
+	var count int
+	err := r.db.Get(&count, `SELECT COUNT(*) FROM organizations_users ou
+		JOIN organizations o ON o.id = ou.organization_id
+		LEFT JOIN organization_roles r ON r.id = ou.role_id
+		WHERE ou.user_id = ? AND o.require_2fa = true AND (
+			ou.role IN ("owner", "admin") OR
+			FIND_IN_SET("users.manage", r.permissions) OR
+			FIND_IN_SET("roles.manage", r.permissions) OR
+			FIND_IN_SET("organization.security", r.permissions)
+		)`, userID)
+	return count != 0, err
+}
+
+// CreateTOTP saves a new not yet enabled secret. Previous unconfirmed secret is replaced.
+func (r *TwoFactorRepo) CreateTOTP(userID int64, secret string) error {
+	_, err := r.db.Exec(`INSERT INTO user_totp (user_id, secret) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE secret = VALUES(secret), last_used_step = 0, created_at = NOW()`, userID, secret)
+	return err
+}
+
+// EnableTOTP enables the secret and replaces recovery codes of the user.
+func (r *TwoFactorRepo) EnableTOTP(userID, step int64, codeHashes []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE user_totp SET enabled_at = NOW(), last_used_step = ? WHERE user_id = ?`, step, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = replaceRecoveryCodes(tx, userID, codeHashes)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep saves the step of the accepted code. False is returned if the same or
+// a later step was already used, so the code is a replay.
+func (r *TwoFactorRepo) UseTOTPStep(userID, step int64) (bool, error) {
+	result, err := r.db.Exec(`UPDATE user_totp SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected != 0, err
+}
+
+// UseRecoveryCode marks the code as used. False is returned if there is no such unused code.
+func (r *TwoFactorRepo) UseRecoveryCode(userID int64, codeHash string) (bool, error) {
+	result, err := r.db.Exec(`UPDATE user_recovery_codes SET used_at = NOW() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected != 0, err
+}
+
+func (r *TwoFactorRepo) ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodes(tx, userID, codeHashes)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTOTP disables two-factor authentication of the user.
+func (r *TwoFactorRepo) DeleteTOTP(userID int64) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(q sqlx.Ext, userID int64, codeHashes []string) error {
+	_, err := q.Exec(`DELETE FROM user_recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err = q.Exec(`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"strings"
 	"time"
 
@@ -9,6 +10,8 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
 type UserRepo struct {
 	db               *sqlx.DB
 	organizationRepo *OrganizationRepo
@@ -36,19 +39,19 @@ func (r *UserRepo) GetByEmail(email string) (domain.User, error) {
 	return user, err
 }
 
-func (r *UserRepo) GetByVerificationToken(token string) (domain.User, error) {
+func (r *UserRepo) GetByVerificationToken(tokenHash string) (domain.User, error) {
 	var user domain.User
 	err := r.db.Get(&user, `SELECT * FROM users WHERE id = (
-			SELECT id FROM user_verifications WHERE token = ?
-		)`, token)
+			SELECT id FROM user_verifications WHERE token_hash = ? AND status = "not_verified" AND expires_at > NOW()
+		)`, tokenHash)
 	return user, err
 }
 
-func (r *UserRepo) GetByPasswordResetToken(token string) (domain.User, error) {
+func (r *UserRepo) GetByPasswordResetToken(tokenHash string) (domain.User, error) {
 	var user domain.User
 	err := r.db.Get(&user, `SELECT * FROM users WHERE id = (
-			SELECT id FROM password_reset WHERE token = ?
-		)`, token)
+			SELECT id FROM password_reset WHERE token_hash = ? AND expires_at > NOW()
+		)`, tokenHash)
 	return user, err
 }
 
@@ -74,7 +77,7 @@ func (r *UserRepo) GetVerification(id int64) (domain.UserVerification, error) {
 
 func (r *UserRepo) GetPasswordReset(email string) (domain.UserPasswordReset, error) {
 	var reset domain.UserPasswordReset
-	err := r.db.Get(&reset, "SELECT * FROM password_reset WHERE email = ?", email)
+	err := r.db.Get(&reset, "SELECT * FROM password_reset WHERE id = (SELECT id FROM users WHERE email = ?)", email)
 	return reset, err
 }
 
@@ -84,6 +87,25 @@ func (r *UserRepo) GetRefreshSession(refreshToken string) (domain.RefreshSession
 	return session, err
 }
 
+func (r *UserRepo) GetRefreshSessionByID(id int64) (domain.RefreshSession, error) {
+	var session domain.RefreshSession
+	err := r.db.Get(&session, "SELECT * FROM refresh_sessions WHERE id = ?", id)
+	return session, err
+}
+
+// GetSessions returns active sessions of the user, last used first.
+func (r *UserRepo) GetSessions(userID int64) ([]domain.Session, error) {
+	var sessions []domain.Session
+	err := r.db.Select(&sessions, `
+		SELECT
+			rs.id, rs.family_id, rs.ua, rs.ip, rs.created_at, rs.expires_at,
+			(SELECT MIN(f.created_at) FROM refresh_sessions AS f WHERE f.family_id = rs.family_id) AS started_at
+		FROM refresh_sessions AS rs
+		WHERE rs.user_id = ? AND rs.rotated_at IS NULL AND rs.expires_at > NOW()
+		ORDER BY rs.created_at DESC`, userID)
+	return sessions, err
+}
+
 func (r *UserRepo) Create(firstname, lastname *string, email string, image *string) (int64, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
@@ -127,7 +149,12 @@ func (r *UserRepo) CreateWithOrganization(firstname, lastname *string, email str
 		return 0, 0, err
 	}
 
-	go r.organizationRepo.CopyDefaultContent(organizationID, plan)
+	jobID, err := r.organizationRepo.CreateCopyJob(organizationID, plan, "all_or_nothing")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	go r.organizationRepo.RunCopyJob(jobID)
 
 	return userID, organizationID, nil
 }
@@ -143,8 +170,13 @@ func (r *UserRepo) CreateTx(tx *sql.Tx, firstname, lastname *string, email strin
 	return userID, nil
 }
 
-func (r *UserRepo) CreateVerification(id int64, token string) error {
-	_, err := r.db.Exec(`INSERT INTO user_verifications (id, token, status) VALUES (?, ?, "not_verified")`, id, token)
+// CreateVerification creates verification of the new user or replaces token of the
+// unverified user.
+func (r *UserRepo) CreateVerification(id int64, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO user_verifications (id, token_hash, status, expires_at) 
+		VALUES (?, ?, "not_verified", ?) 
+		ON DUPLICATE KEY UPDATE token_hash = VALUES(token_hash), expires_at = VALUES(expires_at), created_at = NOW()`, id, tokenHash, expiresAt)
 	if err != nil {
 		return err
 	}
@@ -152,13 +184,13 @@ func (r *UserRepo) CreateVerification(id int64, token string) error {
 	return nil
 }
 
-func (r *UserRepo) CreatePasswordReset(email string, token string) error {
+func (r *UserRepo) CreatePasswordReset(email string, tokenHash string, expiresAt time.Time) error {
 	_, err := r.db.Exec(`
-		INSERT INTO password_reset (id, token) 
+		INSERT INTO password_reset (id, token_hash, expires_at) 
 		VALUES (
 			(SELECT id from users WHERE email = ?)
-			, ?
-		) ON DUPLICATE KEY UPDATE token = ?`, email, token, token)
+			, ?, ?
+		) ON DUPLICATE KEY UPDATE token_hash = VALUES(token_hash), expires_at = VALUES(expires_at), created_at = NOW()`, email, tokenHash, expiresAt)
 	if err != nil {
 		return err
 	}
@@ -166,22 +198,30 @@ func (r *UserRepo) CreatePasswordReset(email string, token string) error {
 	return nil
 }
 
-func (r *UserRepo) CreateRefreshSession(userID int64, refreshToken, ua, fingerprint string, expiresAt time.Time) error {
+// CreateRefreshSession starts a new family of refresh tokens.
+func (r *UserRepo) CreateRefreshSession(userID int64, familyID, refreshToken string, info domain.RequestInfo, expiresAt time.Time) error {
 	var count int
-	err := r.db.Get(&count, `SELECT COUNT(*) FROM refresh_sessions WHERE user_id = ?`, userID)
+	err := r.db.Get(&count, `SELECT COUNT(*) FROM refresh_sessions WHERE user_id = ? AND rotated_at IS NULL`, userID)
 	if err != nil {
 		return err
 	}
 
 	// If session count more than 7, then delete the oldest session.
 	if count >= 7 {
-		_, err := r.db.Exec(`DELETE FROM refresh_sessions WHERE user_id = ? ORDER BY created_at ASC LIMIT 1`, userID)
+		var familyID string
+		err = r.db.Get(&familyID, `SELECT family_id FROM refresh_sessions WHERE user_id = ? AND rotated_at IS NULL ORDER BY created_at ASC LIMIT 1`, userID)
+		if err != nil {
+			return err
+		}
+
+		err = r.DeleteRefreshFamily(familyID)
 		if err != nil {
 			return err
 		}
 	}
 
-	_, err = r.db.Exec(`INSERT INTO refresh_sessions (user_id, refresh_token, ua, fingerprint, expires_at) VALUES (?, ?, ?, ?, ?)`, userID, refreshToken, ua, fingerprint, expiresAt)
+	_, err = r.db.Exec(`INSERT INTO refresh_sessions (user_id, family_id, refresh_token, ua, ip, fingerprint, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, familyID, refreshToken, info.UserAgent, info.IP, info.Fingerprint, expiresAt)
 	return err
 }
 
@@ -194,7 +234,7 @@ func (r *UserRepo) CreateOrganizationUser(organizationID, userID int64, role str
 	return err
 }
 
-func (r *UserRepo) Update(id int64, image, firstname, lastname, email, userType *string) error {
+func (r *UserRepo) Update(id int64, image, firstname, lastname, userType *string) error {
 	updateFields := make([]string, 0)
 	updateArgs := make([]interface{}, 0)
 
@@ -210,10 +250,6 @@ func (r *UserRepo) Update(id int64, image, firstname, lastname, email, userType
 		updateFields = append(updateFields, "lastname = ?")
 		updateArgs = append(updateArgs, *lastname)
 	}
-	if email != nil {
-		updateFields = append(updateFields, "email = ?")
-		updateArgs = append(updateArgs, *email)
-	}
 	if userType != nil {
 		updateFields = append(updateFields, "type = ?")
 		updateArgs = append(updateArgs, *userType)
@@ -235,7 +271,7 @@ func (r *UserRepo) Update(id int64, image, firstname, lastname, email, userType
 }
 
 func (r *UserRepo) UpdateOrganizationUser(organizationID, userID int64, role string) error {
-	_, err := r.db.Exec(`UPDATE organizations_users SET role = ? WHERE organization_id = ? AND user_id = ?`, role, organizationID, userID)
+	_, err := r.db.Exec(`UPDATE organizations_users SET role = ?, role_id = NULL WHERE organization_id = ? AND user_id = ?`, role, organizationID, userID)
 	if err != nil {
 		return err
 	}
@@ -248,13 +284,345 @@ func (r *UserRepo) UpdatePassword(id int64, password string) error {
 	return err
 }
 
-func (r *UserRepo) UpdateVerificationByToken(token, status string) error {
-	_, err := r.db.Exec(`UPDATE user_verifications SET status = ? WHERE token = ?`, status, token)
+// IncrementFailedLogins counts failed login of the user and returns number of failed
+// logins in a row.
+func (r *UserRepo) IncrementFailedLogins(id int64) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET failed_logins = failed_logins + 1 WHERE id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var count int
+	err = tx.Get(&count, `SELECT failed_logins FROM users WHERE id = ?`, id)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return count, tx.Commit()
+}
+
+func (r *UserRepo) Lock(id int64, until time.Time) error {
+	_, err := r.db.Exec(`UPDATE users SET locked_until = ? WHERE id = ?`, until, id)
+	return err
+}
+
+// Unlock resets failed logins and lockout of the user.
+func (r *UserRepo) Unlock(id int64) error {
+	_, err := r.db.Exec(`UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?`, id)
 	return err
 }
 
-func (r *UserRepo) UpdateRefreshSession(id int64, refreshToken, ua, fingerprint string, expiresAt time.Time) error {
-	_, err := r.db.Exec(`UPDATE refresh_sessions SET refresh_token = ?, ua = ?, fingerprint = ?, expires_at = ?, created_at = ? WHERE id = ?`, refreshToken, ua, fingerprint, expiresAt, time.Now(), id)
+// IncrementTokenVersion invalidates all access tokens issued to the user.
+func (r *UserRepo) IncrementTokenVersion(id int64) error {
+	_, err := r.db.Exec(`UPDATE users SET token_version = token_version + 1 WHERE id = ?`, id)
+	return err
+}
+
+// VerifyByToken sets password of the user and marks the user as verified. Token can be
+// used only once, sql.ErrNoRows is returned for used or expired token.
+func (r *UserRepo) VerifyByToken(tokenHash, password string) (int64, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int64
+	err = tx.Get(&userID, `SELECT id FROM user_verifications WHERE token_hash = ? AND status = "not_verified" AND expires_at > NOW() FOR UPDATE`, tokenHash)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE user_verifications SET status = "verified", token_hash = NULL, expires_at = NULL WHERE id = ?`, userID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET password = ? WHERE id = ?`, password, userID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// ResetPasswordByToken sets password of the user and removes the password reset. Token
+// can be used only once, sql.ErrNoRows is returned for used or expired token.
+func (r *UserRepo) ResetPasswordByToken(tokenHash, password string) (int64, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int64
+	err = tx.Get(&userID, `SELECT id FROM password_reset WHERE token_hash = ? AND expires_at > NOW() FOR UPDATE`, tokenHash)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM password_reset WHERE id = ?`, userID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET password = ? WHERE id = ?`, password, userID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// CreateMagicLink saves login link of the user. Previous link of the user stops working.
+func (r *UserRepo) CreateMagicLink(id int64, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`INSERT INTO magic_links (id, token_hash, expires_at) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE token_hash = VALUES(token_hash), expires_at = VALUES(expires_at), created_at = NOW()`, id, tokenHash, expiresAt)
+	return err
+}
+
+// UseMagicLink deletes the link and returns ID of its user. sql.ErrNoRows is returned
+// if the link is unknown, expired or already used.
+func (r *UserRepo) UseMagicLink(tokenHash string) (int64, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int64
+	err = tx.Get(&userID, `SELECT id FROM magic_links WHERE token_hash = ? AND expires_at > NOW() FOR UPDATE`, tokenHash)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM magic_links WHERE id = ?`, userID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// GetPendingEmailChange returns unconfirmed email change of the user which can still be
+// confirmed.
+func (r *UserRepo) GetPendingEmailChange(userID int64) (domain.UserEmailChange, error) {
+	var change domain.UserEmailChange
+	err := r.db.Get(&change, `SELECT * FROM email_changes WHERE user_id = ? AND confirmed_at IS NULL AND expires_at > NOW()`, userID)
+	return change, err
+}
+
+// CreateEmailChange saves email change of the user. Previous unconfirmed change stops
+// working, confirmed changes can still be reverted.
+func (r *UserRepo) CreateEmailChange(change domain.UserEmailChange) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM email_changes WHERE user_id = ? AND confirmed_at IS NULL`, change.UserID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO email_changes (user_id, old_email, new_email, token_hash, revert_token_hash, expires_at, revert_expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, change.UserID, change.OldEmail, change.NewEmail, change.TokenHash, change.RevertTokenHash, change.ExpiresAt, change.RevertExpiresAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmEmailChange sets the new email of the user. Password reset and magic link sent
+// to the old address stop working. sql.ErrNoRows is returned if the change is unknown,
+// expired, already confirmed or the user's email has changed since it was requested.
+func (r *UserRepo) ConfirmEmailChange(tokenHash string) (domain.UserEmailChange, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return domain.UserEmailChange{}, err
+	}
+
+	var change domain.UserEmailChange
+	err = tx.Get(&change, `SELECT * FROM email_changes WHERE token_hash = ? AND confirmed_at IS NULL AND expires_at > NOW() FOR UPDATE`, tokenHash)
+	if err != nil {
+		tx.Rollback()
+		return domain.UserEmailChange{}, err
+	}
+
+	result, err := tx.Exec(`UPDATE users SET email = ? WHERE id = ? AND email = ?`, change.NewEmail, change.UserID, change.OldEmail)
+	if err != nil {
+		tx.Rollback()
+		return domain.UserEmailChange{}, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		return domain.UserEmailChange{}, sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`UPDATE email_changes SET token_hash = NULL, confirmed_at = NOW() WHERE id = ?`, change.ID)
+	if err != nil {
+		tx.Rollback()
+		return domain.UserEmailChange{}, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM password_reset WHERE id = ?`, change.UserID)
+	if err != nil {
+		tx.Rollback()
+		return domain.UserEmailChange{}, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM magic_links WHERE id = ?`, change.UserID)
+	if err != nil {
+		tx.Rollback()
+		return domain.UserEmailChange{}, err
+	}
+
+	return change, tx.Commit()
+}
+
+// RevertEmailChange cancels the change, or restores the old email if it was confirmed.
+// All email changes of the user are removed, so later changes can't be confirmed or
+// reverted. sql.ErrNoRows is returned if the revert link is unknown or expired.
+func (r *UserRepo) RevertEmailChange(revertTokenHash string) (domain.UserEmailChange, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return domain.UserEmailChange{}, err
+	}
+
+	var change domain.UserEmailChange
+	err = tx.Get(&change, `SELECT * FROM email_changes WHERE revert_token_hash = ? AND revert_expires_at > NOW() FOR UPDATE`, revertTokenHash)
+	if err != nil {
+		tx.Rollback()
+		return domain.UserEmailChange{}, err
+	}
+
+	if change.ConfirmedAt.Valid {
+		_, err = tx.Exec(`UPDATE users SET email = ? WHERE id = ?`, change.OldEmail, change.UserID)
+		if err != nil {
+			tx.Rollback()
+			return domain.UserEmailChange{}, err
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM email_changes WHERE user_id = ?`, change.UserID)
+	if err != nil {
+		tx.Rollback()
+		return domain.UserEmailChange{}, err
+	}
+
+	return change, tx.Commit()
+}
+
+// RotateRefreshSession replaces refresh token of the session with a new one in the same
+// family. Old token is kept as rotated until the family expires, so its reuse can be
+// detected. ErrRefreshTokenReused is returned if the token was already rotated.
+func (r *UserRepo) RotateRefreshSession(session domain.RefreshSession, refreshToken string, info domain.RequestInfo) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE refresh_sessions SET rotated_at = NOW() WHERE id = ? AND rotated_at IS NULL`, session.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		return ErrRefreshTokenReused
+	}
+
+	// Family keeps expiration time of the first token, so it can't be prolonged by rotation.
+	_, err = tx.Exec(`INSERT INTO refresh_sessions (user_id, family_id, refresh_token, ua, ip, fingerprint, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.UserID, session.FamilyID, refreshToken, info.UserAgent, info.IP, info.Fingerprint, session.ExpiresAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserRepo) DeleteRefreshFamily(familyID string) error {
+	_, err := r.db.Exec(`DELETE FROM refresh_sessions WHERE family_id = ?`, familyID)
+	return err
+}
+
+// DeleteRefreshSessions revokes all sessions of the user except the session family to keep.
+func (r *UserRepo) DeleteRefreshSessions(userID int64, keepFamilyID string) error {
+	_, err := r.db.Exec(`DELETE FROM refresh_sessions WHERE user_id = ? AND family_id != ?`, userID, keepFamilyID)
+	return err
+}
+
+// DeleteExpiredRefreshSessions removes expired sessions including rotated tokens of
+// expired families. Returns number of deleted rows.
+func (r *UserRepo) DeleteExpiredRefreshSessions() (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM refresh_sessions WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteExpiredTokens removes expired password resets, magic links, email changes and
+// verifications of users who didn't verify in time. Returns number of deleted rows.
+func (r *UserRepo) DeleteExpiredTokens() (int64, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM password_reset WHERE expires_at < NOW()`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	resets, _ := result.RowsAffected()
+
+	result, err = tx.Exec(`DELETE FROM user_verifications WHERE status = "not_verified" AND expires_at < NOW()`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	verifications, _ := result.RowsAffected()
+
+	result, err = tx.Exec(`DELETE FROM magic_links WHERE expires_at < NOW()`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	links, _ := result.RowsAffected()
+
+	result, err = tx.Exec(`DELETE FROM email_changes WHERE revert_expires_at < NOW()`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	emailChanges, _ := result.RowsAffected()
+
+	return resets + verifications + links + emailChanges, tx.Commit()
+}
+
+// DeletePasswordReset invalidates outstanding password reset of the user.
+func (r *UserRepo) DeletePasswordReset(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM password_reset WHERE id = ?`, id)
 	return err
 }
 
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+)
+
+func TestRotateRefreshSession(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db)
+	userID := testdb.User(t, db, "user@example.com", "user")
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	err := repo.User.CreateRefreshSession(userID, "family", "first", domain.RequestInfo{}, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := repo.User.GetRefreshSession("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.User.RotateRefreshSession(first, "second", domain.RequestInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := repo.User.GetRefreshSession("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.FamilyID != first.FamilyID || !second.ExpiresAt.Equal(first.ExpiresAt) || second.RotatedAt.Valid {
+		t.Errorf("Rotated session must continue the family: %+v", second)
+	}
+
+	err = repo.User.RotateRefreshSession(first, "third", domain.RequestInfo{})
+	if err != ErrRefreshTokenReused {
+		t.Errorf("Got %v for rotated token, want ErrRefreshTokenReused", err)
+	}
+
+	err = repo.User.DeleteRefreshFamily(first.FamilyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.User.GetRefreshSession("second")
+	if err == nil {
+		t.Error("Session of the revoked family still exists")
+	}
+}
+
+func TestDeleteExpiredRefreshSessions(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db)
+	userID := testdb.User(t, db, "user@example.com", "user")
+
+	err := repo.User.CreateRefreshSession(userID, "expired-family", "expired", domain.RequestInfo{}, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.User.CreateRefreshSession(userID, "active-family", "active", domain.RequestInfo{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := repo.User.DeleteExpiredRefreshSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Deleted %d sessions, want 1", count)
+	}
+
+	_, err = repo.User.GetRefreshSession("active")
+	if err != nil {
+		t.Errorf("Active session was deleted: %v", err)
+	}
+}
+
+func TestSingleUseTokens(t *testing.T) {
+	db := testdb.New(t)
+	repo := NewRepository(db)
+	userID := testdb.User(t, db, "user@example.com", "user")
+
+	err := repo.User.CreateVerification(userID, "expired", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.User.VerifyByToken("expired", "password")
+	if err != sql.ErrNoRows {
+		t.Errorf("Got %v for expired verification token, want sql.ErrNoRows", err)
+	}
+
+	// New token replaces the expired one.
+	err = repo.User.CreateVerification(userID, "verification", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := repo.User.VerifyByToken("verification", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != userID {
+		t.Errorf("Verified user %d, want %d", id, userID)
+	}
+	_, err = repo.User.VerifyByToken("verification", "password")
+	if err != sql.ErrNoRows {
+		t.Errorf("Got %v for used verification token, want sql.ErrNoRows", err)
+	}
+
+	err = repo.User.CreatePasswordReset("user@example.com", "reset", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.User.ResetPasswordByToken("reset", "new password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.User.ResetPasswordByToken("reset", "new password")
+	if err != sql.ErrNoRows {
+		t.Errorf("Got %v for used password reset token, want sql.ErrNoRows", err)
+	}
+
+	err = repo.User.CreatePasswordReset("user@example.com", "stale", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := repo.User.DeleteExpiredTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Deleted %d tokens, want 1", count)
+	}
+
+	verification, err := repo.User.GetVerification(userID)
+	if err != nil {
+		t.Fatalf("Verification of verified user must be kept: %v", err)
+	}
+	if verification.Status != "verified" || verification.TokenHash.Valid {
+		t.Errorf("Expected verified user without token, got %+v", verification)
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"gopkg.in/guregu/null.v4"
+)
+
+// apiKeyPrefix marks our keys, so they can be found by secret scanners.
+const apiKeyPrefix = "kk_"
+
+// organizationKeyRole is the role of organization keys. What the key can do is limited
+// by its scopes.
+const organizationKeyRole = "editor"
+
+type APIKeyService struct {
+	repo        repository.APIKey
+	authService Auth
+}
+
+func NewAPIKeyService(repo repository.APIKey, authService Auth) *APIKeyService {
+	return &APIKeyService{repo: repo, authService: authService}
+}
+
+func (s *APIKeyService) GetByID(id int64) (domain.APIKey, error) {
+	key, err := s.repo.GetByID(id)
+	return key, err
+}
+
+func (s *APIKeyService) GetByUserID(userID int64) ([]domain.APIKey, error) {
+	keys, err := s.repo.GetByUserID(userID)
+	return keys, err
+}
+
+func (s *APIKeyService) GetByOrganizationID(organizationID int64) ([]domain.APIKey, error) {
+	keys, err := s.repo.GetByOrganizationID(organizationID)
+	return keys, err
+}
+
+// Create creates personal access token if userID is set, otherwise key of the organization.
+func (s *APIKeyService) Create(userID, organizationID null.Int, name string, scopes []string, expiresAt null.Time, createdBy int64) (domain.NewAPIKey, error) {
+	if userID.Valid == organizationID.Valid {
+		return domain.NewAPIKey{}, errors.New("key must belong to a user or an organization")
+	}
+	if strings.TrimSpace(name) == "" {
+		return domain.NewAPIKey{}, errors.New("name is required")
+	}
+	if len(scopes) == 0 {
+		return domain.NewAPIKey{}, errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !isAPIKeyScope(scope) {
+			return domain.NewAPIKey{}, errors.New("invalid scope: " + scope)
+		}
+	}
+	if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
+		return domain.NewAPIKey{}, errors.New("expiration must be in the future")
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return domain.NewAPIKey{}, err
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := domain.APIKey{
+		UserID:         userID,
+		OrganizationID: organizationID,
+		Name:           name,
+		Prefix:         key[:len(apiKeyPrefix)+6],
+		KeyHash:        hashAPIKey(key),
+		Scopes:         strings.Join(scopes, ","),
+		ExpiresAt:      expiresAt,
+		CreatedBy:      null.IntFrom(createdBy),
+	}
+
+	apiKey.ID, err = s.repo.Create(apiKey)
+	if err != nil {
+		return domain.NewAPIKey{}, err
+	}
+
+	apiKey, err = s.repo.GetByID(apiKey.ID)
+	if err != nil {
+		return domain.NewAPIKey{}, err
+	}
+
+	return domain.NewAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+// Authenticate returns claims of the key. Personal access tokens act with current roles
+// of the user, organization keys with the role of an editor of the organization.
+func (s *APIKeyService) Authenticate(key string) (*domain.Claims, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, errors.New("invalid key")
+	}
+
+	apiKey, err := s.repo.GetByHash(hashAPIKey(key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid key")
+		}
+		return nil, err
+	}
+
+	if apiKey.ExpiresAt.Valid && apiKey.ExpiresAt.Time.Before(time.Now()) {
+		return nil, errors.New("key expired")
+	}
+
+	claims := &domain.Claims{
+		APIKeyID: apiKey.ID,
+		Scopes:   strings.Split(apiKey.Scopes, ","),
+	}
+
+	if apiKey.UserID.Valid {
+		access, err := s.authService.GetAccess(apiKey.UserID.Int64)
+		if err != nil {
+			return nil, err
+		}
+
+		claims.UserID = apiKey.UserID.Int64
+		claims.Type = access.Type
+		claims.Roles = access.Roles
+		claims.Permissions = access.Permissions
+	} else {
+		// Changes are logged on behalf of the user who created the key.
+		claims.UserID = apiKey.CreatedBy.Int64
+		claims.Type = "user"
+		claims.Roles = map[int64]string{apiKey.OrganizationID.Int64: organizationKeyRole}
+		claims.Permissions = map[int64][]string{apiKey.OrganizationID.Int64: domain.RolePermissions[organizationKeyRole]}
+	}
+
+	err = s.repo.UpdateLastUsed(apiKey.ID)
+	if err != nil {
+		log.Println("Failed to update last use of API key: ", err)
+	}
+
+	return claims, nil
+}
+
+func (s *APIKeyService) Delete(id int64) error {
+	err := s.repo.Delete(id)
+	return err
+}
+
+func isAPIKeyScope(scope string) bool {
+	for _, s := range domain.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// hashAPIKey hashes the key. Keys are random, so salt isn't needed and the hash can be
+// used for lookup.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
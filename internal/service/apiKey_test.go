@@ -0,0 +1,79 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	auth := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, nil, nil, cache.NewMemoryCache())
+	s := NewAPIKeyService(repo.APIKey, auth)
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	userID := testdb.User(t, db, "admin@example.com", "user")
+	testdb.OrganizationUser(t, db, organizationID, userID, "admin")
+
+	key, err := s.Create(null.Int{}, null.IntFrom(organizationID), "Address sync", []string{domain.ScopeAddressesWrite}, null.Time{}, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := s.Authenticate(key.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.APIKeyID != key.APIKey.ID || claims.Roles[organizationID] != organizationKeyRole || claims.UserID != userID {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+
+	stored, err := repo.APIKey.GetByID(key.APIKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.KeyHash == key.Key || !stored.LastUsedAt.Valid {
+		t.Errorf("Key must be hashed and last use tracked: %+v", stored)
+	}
+
+	_, err = s.Authenticate(key.Key + "x")
+	if err == nil {
+		t.Errorf("Wrong key must be rejected")
+	}
+
+	personal, err := s.Create(null.IntFrom(userID), null.Int{}, "Script", []string{domain.ScopeContentRead}, null.TimeFrom(time.Now().Add(time.Hour)), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err = s.Authenticate(personal.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Roles[organizationID] != "admin" {
+		t.Errorf("Personal token must have roles of the user: %+v", claims)
+	}
+
+	_, err = db.Exec("UPDATE api_keys SET expires_at = NOW() - INTERVAL 1 HOUR WHERE id = ?", personal.APIKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Authenticate(personal.Key)
+	if err == nil {
+		t.Errorf("Expired key must be rejected")
+	}
+
+	err = s.Delete(key.APIKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Authenticate(key.Key)
+	if err == nil {
+		t.Errorf("Revoked key must be rejected")
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Maximum number of audit entries returned at once.
+const AuditLimit = 50
+
+// Fields which are never written to the audit log.
+var auditHiddenFields = []string{"password", "createdAt", "updatedAt"}
+
+type AuditService struct {
+	repo repository.Audit
+}
+
+func NewAuditService(repo repository.Audit) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+func (s *AuditService) Get(organizationID *int64, filter domain.AuditFilter, cursor int64, limit int) ([]domain.AuditEntry, error) {
+	if limit <= 0 || limit > AuditLimit {
+		limit = AuditLimit
+	}
+
+	entries, err := s.repo.Get(organizationID, filter, cursor, limit)
+	return entries, err
+}
+
+// Log saves audit entry. Before and after states of the entity are compared and only
+// changed fields are saved. Both states may be nil. Impersonator is set if superadmin
+// acted as the actor.
+func (s *AuditService) Log(organizationID, actorID, impersonatorID null.Int, action, entityType string, entityID null.Int, before, after interface{}) error {
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.Create(domain.AuditEntry{
+		OrganizationID: organizationID,
+		ActorID:        actorID,
+		ImpersonatorID: impersonatorID,
+		Action:         action,
+		EntityType:     entityType,
+		EntityID:       entityID,
+		Diff:           diff,
+	})
+
+	return err
+}
+
+func auditDiff(before, after interface{}) (string, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return "", err
+	}
+
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return "", err
+	}
+
+	if beforeFields != nil && afterFields != nil {
+		for key := range afterFields {
+			if value, ok := beforeFields[key]; ok && reflect.DeepEqual(value, afterFields[key]) {
+				delete(beforeFields, key)
+				delete(afterFields, key)
+			}
+		}
+	}
+
+	diff, err := json.Marshal(map[string]interface{}{"before": beforeFields, "after": afterFields})
+	return string(diff), err
+}
+
+func auditFields(state interface{}) (map[string]interface{}, error) {
+	if state == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range auditHiddenFields {
+		delete(fields, field)
+	}
+
+	return fields, nil
+}
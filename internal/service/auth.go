@@ -1,36 +1,125 @@
 package service
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"log"
+	"sync"
 	"time"
 
-	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/config"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
 	pass "bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/password"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/randstring"
 	"github.com/dgrijalva/jwt-go"
 )
 
+// RefreshTokenTTL is the lifetime of a refresh token family. Rotation doesn't prolong it.
+const RefreshTokenTTL = time.Hour * 24 * 60
+
+const AccessTokenTTL = time.Minute * 15
+
+// ImpersonationTTL is the lifetime of impersonation token. It can't be refreshed.
+const ImpersonationTTL = time.Minute * 30
+
+// Account is locked after lockoutThreshold failed logins in a row. Every further
+// failure doubles the lockout up to lockoutMax. Failures before that delay the next
+// attempt, starting with failedLoginDelay and doubling with every failure.
+const (
+	failedLoginDelay = time.Second
+	lockoutThreshold = 5
+	lockoutBase      = time.Minute
+	lockoutMax       = time.Hour
+)
+
+var errLoginDelayed = errors.New("too many failed logins, try again in a few seconds")
+
+// accessCacheTTL is the lifetime of cached user access in seconds. Changes made through
+// the services invalidate the cache immediately, TTL only limits how long changes made
+// by other instances or directly in DB stay unnoticed.
+const accessCacheTTL = 60
+
+type accessCacheKey int64
+
 type AuthService struct {
 	userRepo             repository.User
 	organizationUserRepo repository.OrganizationUser
+	twoFactorRepo        repository.TwoFactor
+	loginEventRepo       repository.LoginEvent
+	signingKeys          SigningKey
+	emailService         Email
+	cache                *cache.MemoryCache
+	challengeMu          sync.Mutex
 }
 
-func NewAuthService(userRepo repository.User, organizationUserRepo repository.OrganizationUser) *AuthService {
-	return &AuthService{userRepo: userRepo, organizationUserRepo: organizationUserRepo}
+func NewAuthService(userRepo repository.User, organizationUserRepo repository.OrganizationUser, twoFactorRepo repository.TwoFactor, loginEventRepo repository.LoginEvent, signingKeys SigningKey, emailService Email, cache *cache.MemoryCache) *AuthService {
+	return &AuthService{userRepo: userRepo, organizationUserRepo: organizationUserRepo, twoFactorRepo: twoFactorRepo, loginEventRepo: loginEventRepo, signingKeys: signingKeys, emailService: emailService, cache: cache}
 }
 
-func (s *AuthService) CreateNewSession(userID int64, userType string) (domain.Tokens, error) {
-	tokens, err := s.CreateTokens(userID, userType)
+// GetAccess returns current type, roles and token version of the user.
+func (s *AuthService) GetAccess(userID int64) (domain.UserAccess, error) {
+	if value, err := s.cache.Get(accessCacheKey(userID)); err == nil {
+		return value.(domain.UserAccess), nil
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return domain.UserAccess{}, err
+	}
+
+	userInfo, err := s.organizationUserRepo.GetByUserID(userID)
+	if err != nil {
+		return domain.UserAccess{}, err
+	}
+	roles := make(map[int64]string)
+	permissions := make(map[int64][]string)
+	for _, info := range userInfo {
+		roles[info.OrganizationID] = info.Role
+		permissions[info.OrganizationID] = info.Permissions()
+	}
+
+	access := domain.UserAccess{
+		TokenVersion: user.TokenVersion,
+		Type:         user.Type,
+		Roles:        roles,
+		Permissions:  permissions,
+	}
+	s.cache.Set(accessCacheKey(userID), access, accessCacheTTL)
+
+	return access, nil
+}
+
+// InvalidateAccess has to be called after type or roles of the user were changed.
+func (s *AuthService) InvalidateAccess(userID int64) {
+	s.cache.Delete(accessCacheKey(userID))
+}
+
+// RevokeAccess invalidates all access tokens issued to the user.
+func (s *AuthService) RevokeAccess(userID int64) error {
+	err := s.userRepo.IncrementTokenVersion(userID)
+	if err != nil {
+		return err
+	}
+
+	s.InvalidateAccess(userID)
+
+	return nil
+}
+
+func (s *AuthService) CreateNewSession(userID int64, info domain.RequestInfo) (domain.Tokens, error) {
+	familyID := randstring.RandAlphanumString(32)
+
+	tokens, err := s.CreateTokens(userID, familyID)
 	if err != nil {
 		return tokens, err
 	}
 
 	// Save session in DB.
-	err = s.userRepo.CreateRefreshSession(userID, tokens.RefreshToken, "", "", time.Now().Add(time.Hour*24*60))
+	err = s.userRepo.CreateRefreshSession(userID, familyID, tokens.RefreshToken, info, time.Now().Add(RefreshTokenTTL))
 	if err != nil {
 		return domain.Tokens{}, err
 	}
@@ -38,27 +127,26 @@ func (s *AuthService) CreateNewSession(userID int64, userType string) (domain.To
 	return tokens, nil
 }
 
-func (s *AuthService) CreateTokens(userID int64, userType string) (domain.Tokens, error) {
-	userInfo, err := s.organizationUserRepo.GetByUserID(userID)
+func (s *AuthService) CreateTokens(userID int64, sessionID string) (domain.Tokens, error) {
+	// New tokens always get up to date access.
+	s.InvalidateAccess(userID)
+	access, err := s.GetAccess(userID)
 	if err != nil {
 		return domain.Tokens{}, err
 	}
-	roles := make(map[int64]string)
-	for _, info := range userInfo {
-		roles[info.OrganizationID] = info.Role
-	}
 
 	claims := domain.Claims{
-		UserID: userID,
-		Roles:  roles,
-		Type:   userType,
+		UserID:       userID,
+		Roles:        access.Roles,
+		Type:         access.Type,
+		SessionID:    sessionID,
+		TokenVersion: access.TokenVersion,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Minute * 15).Unix(),
+			ExpiresAt: time.Now().Add(AccessTokenTTL).Unix(),
 			IssuedAt:  time.Now().Unix(),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	accessToken, err := token.SignedString([]byte(config.Get().App.Key))
+	accessToken, err := s.signingKeys.Sign(claims)
 	if err != nil {
 		return domain.Tokens{}, err
 	}
@@ -71,7 +159,7 @@ func (s *AuthService) CreateTokens(userID int64, userType string) (domain.Tokens
 	}, nil
 }
 
-func (s *AuthService) Login(email, password string) (domain.Tokens, error) {
+func (s *AuthService) Login(email, password string, info domain.RequestInfo) (domain.Tokens, error) {
 	user, err := s.userRepo.GetByEmail(email)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -80,27 +168,134 @@ func (s *AuthService) Login(email, password string) (domain.Tokens, error) {
 		return domain.Tokens{}, err
 	}
 
-	// Check if account is verified.
+	// Password is not checked while the account is locked.
+	err = s.checkCanLogin(user)
+	if err != nil {
+		s.recordLogin(user.ID, domain.LoginMethodPassword, err, info)
+		return domain.Tokens{}, err
+	}
+
+	err = pass.CheckPassword(password, user.Password.String)
+	if err != nil {
+		s.recordLogin(user.ID, domain.LoginMethodPassword, err, info)
+		s.registerFailedLogin(user)
+		return domain.Tokens{}, err
+	}
+
+	return s.startSession(user, domain.LoginMethodPassword, info)
+}
+
+// checkCanLogin refuses login of locked and unverified users, whatever the credential.
+func (s *AuthService) checkCanLogin(user domain.User) error {
+	if user.LockedUntil.Valid && time.Now().Before(user.LockedUntil.Time) {
+		if user.FailedLogins < lockoutThreshold {
+			return errLoginDelayed
+		}
+		return errors.New("account is locked, try again later")
+	}
+
 	verification, err := s.userRepo.GetVerification(user.ID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return domain.Tokens{}, errors.New("user not verified")
+			return errors.New("user not verified")
 		}
-		return domain.Tokens{}, err
+		return err
 	}
 	if verification.Status == "not_verified" {
-		return domain.Tokens{}, errors.New("user not verified")
+		return errors.New("user not verified")
 	}
 
-	err = pass.CheckPassword(password, user.Password.String)
+	return nil
+}
+
+// Impersonate returns access token of the user for the superadmin. Claims carry both the
+// user and the superadmin, so actions are audited as impersonated. Superadmins can't be
+// impersonated.
+func (s *AuthService) Impersonate(impersonatorID, userID int64) (domain.Tokens, error) {
+	if impersonatorID == userID {
+		return domain.Tokens{}, errors.New("can't impersonate yourself")
+	}
+
+	access, err := s.GetAccess(userID)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Tokens{}, errors.New("user not found")
+		}
 		return domain.Tokens{}, err
 	}
 
-	return s.CreateNewSession(user.ID, user.Type)
+	if access.Type == "superadmin" {
+		return domain.Tokens{}, errors.New("superadmin can't be impersonated")
+	}
+
+	claims := domain.Claims{
+		UserID:         userID,
+		Roles:          access.Roles,
+		Type:           access.Type,
+		TokenVersion:   access.TokenVersion,
+		ImpersonatorID: impersonatorID,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(ImpersonationTTL).Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+	accessToken, err := s.signingKeys.Sign(claims)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	return domain.Tokens{AccessToken: accessToken}, nil
 }
 
-func (s *AuthService) RefreshToken(refreshToken string) (domain.Tokens, error) {
+// registerFailedLogin delays the next login after a failed one and locks the account
+// after too many failed logins in a row. User is notified when the account gets locked.
+func (s *AuthService) registerFailedLogin(user domain.User) {
+	count, err := s.userRepo.IncrementFailedLogins(user.ID)
+	if err != nil {
+		log.Println("Failed to count failed login: ", err)
+		return
+	}
+
+	until := time.Now().Add(lockoutDuration(count))
+	err = s.userRepo.Lock(user.ID, until)
+	if err != nil {
+		log.Println("Failed to lock user: ", err)
+		return
+	}
+
+	if count < lockoutThreshold {
+		return
+	}
+
+	log.Printf("User %d is locked after %d failed logins", user.ID, count)
+
+	if count == lockoutThreshold {
+		go s.emailService.SendAccountLocked(user.Email, until)
+	}
+}
+
+func lockoutDuration(failures int) time.Duration {
+	if failures < lockoutThreshold {
+		return failedLoginDelay << (failures - 1)
+	}
+
+	duration := lockoutBase
+	for i := lockoutThreshold; i < failures && duration < lockoutMax; i++ {
+		duration *= 2
+	}
+
+	if duration > lockoutMax {
+		return lockoutMax
+	}
+	return duration
+}
+
+// Unlock allows the locked user to log in again.
+func (s *AuthService) Unlock(userID int64) error {
+	return s.userRepo.Unlock(userID)
+}
+
+func (s *AuthService) RefreshToken(refreshToken string, info domain.RequestInfo) (domain.Tokens, error) {
 	session, err := s.userRepo.GetRefreshSession(refreshToken)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -109,56 +304,171 @@ func (s *AuthService) RefreshToken(refreshToken string) (domain.Tokens, error) {
 		return domain.Tokens{}, err
 	}
 
-	// TODO: Check if token expired.
+	// Rotated token is used again, so it was stolen either from the user or by the user
+	// from the attacker. Revoke all tokens of the family, both have to log in again.
+	if session.RotatedAt.Valid {
+		log.Printf("Reuse of refresh token detected for user %d, revoking session family", session.UserID)
+		s.recordLogin(session.UserID, domain.LoginMethodRefresh, repository.ErrRefreshTokenReused, info)
+		err = s.userRepo.DeleteRefreshFamily(session.FamilyID)
+		if err != nil {
+			return domain.Tokens{}, err
+		}
+		return domain.Tokens{}, errors.New("invalid token")
+	}
 
-	user, err := s.userRepo.GetByID(session.UserID)
+	if time.Now().After(session.ExpiresAt) {
+		s.recordLogin(session.UserID, domain.LoginMethodRefresh, errors.New("token expired"), info)
+		err = s.userRepo.DeleteRefreshFamily(session.FamilyID)
+		if err != nil {
+			return domain.Tokens{}, err
+		}
+		return domain.Tokens{}, errors.New("token expired")
+	}
+
+	tokens, err := s.CreateTokens(session.UserID, session.FamilyID)
+	if err != nil {
+		return tokens, err
+	}
+
+	err = s.userRepo.RotateRefreshSession(session, tokens.RefreshToken, info)
+	if err == repository.ErrRefreshTokenReused {
+		// Token was rotated by a concurrent request.
+		log.Printf("Reuse of refresh token detected for user %d, revoking session family", session.UserID)
+		s.recordLogin(session.UserID, domain.LoginMethodRefresh, err, info)
+		err = s.userRepo.DeleteRefreshFamily(session.FamilyID)
+		if err != nil {
+			return domain.Tokens{}, err
+		}
+		return domain.Tokens{}, errors.New("invalid token")
+	}
 	if err != nil {
 		return domain.Tokens{}, err
 	}
 
-	tokens, err := s.CreateTokens(user.ID, user.Type)
+	s.recordLogin(session.UserID, domain.LoginMethodRefresh, nil, info)
+
+	return tokens, nil
+}
+
+// GetSessions returns active sessions of the user. Session with the given ID is marked
+// as current.
+func (s *AuthService) GetSessions(userID int64, currentSessionID string) ([]domain.Session, error) {
+	sessions, err := s.userRepo.GetSessions(userID)
 	if err != nil {
-		return tokens, err
+		return nil, err
 	}
 
-	err = s.userRepo.UpdateRefreshSession(session.ID, tokens.RefreshToken, "", "", time.Now().Add(time.Hour*24*60))
+	for i := range sessions {
+		sessions[i].Current = currentSessionID != "" && sessions[i].FamilyID == currentSessionID
+	}
 
-	return tokens, err
+	return sessions, nil
 }
 
-func (s *AuthService) Verify(token, password string) (domain.Tokens, error) {
-	user, err := s.userRepo.GetByVerificationToken(token)
+// RevokeSession revokes session of the user, so its refresh token can't be used anymore.
+func (s *AuthService) RevokeSession(userID, id int64) error {
+	session, err := s.userRepo.GetRefreshSessionByID(id)
+	if err != nil || session.UserID != userID {
+		return errors.New("session not found")
+	}
+
+	return s.userRepo.DeleteRefreshFamily(session.FamilyID)
+}
+
+// RevokeOtherSessions revokes all sessions of the user except the current one.
+func (s *AuthService) RevokeOtherSessions(userID int64, currentSessionID string) error {
+	if currentSessionID == "" {
+		return errors.New("session not found")
+	}
+
+	return s.userRepo.DeleteRefreshSessions(userID, currentSessionID)
+}
+
+// RevokeUserSessions revokes all sessions and access tokens of the user.
+func (s *AuthService) RevokeUserSessions(userID int64) error {
+	err := s.userRepo.DeleteRefreshSessions(userID, "")
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return domain.Tokens{}, errors.New("access denied")
+		return err
+	}
 
-		}
-		return domain.Tokens{}, err
+	return s.RevokeAccess(userID)
+}
+
+func (s *AuthService) Logout(sessionID string) error {
+	if sessionID == "" {
+		return errors.New("session not found")
 	}
 
-	verification, err := s.userRepo.GetVerification(user.ID)
+	return s.userRepo.DeleteRefreshFamily(sessionID)
+}
+
+// CleanupSessions deletes expired refresh sessions and old login history.
+func (s *AuthService) CleanupSessions() error {
+	count, err := s.userRepo.DeleteExpiredRefreshSessions()
 	if err != nil {
-		return domain.Tokens{}, err
+		return err
 	}
 
-	if verification.Status == "verified" {
-		return domain.Tokens{}, errors.New("access denied")
+	if count != 0 {
+		log.Printf("Deleted %d expired refresh sessions", count)
 	}
 
-	hashedPassword, err := pass.HashPassword(password)
+	count, err = s.loginEventRepo.DeleteOlderThan(time.Now().Add(-loginHistoryRetention))
+	if err != nil {
+		return err
+	}
+
+	if count != 0 {
+		log.Printf("Deleted %d old login events", count)
+	}
+
+	return nil
+}
+
+// CleanupTokens deletes expired verification, password reset and magic link tokens.
+func (s *AuthService) CleanupTokens() error {
+	count, err := s.userRepo.DeleteExpiredTokens()
+	if err != nil {
+		return err
+	}
+
+	if count != 0 {
+		log.Printf("Deleted %d expired tokens", count)
+	}
+
+	return nil
+}
+
+func (s *AuthService) Verify(token, password string, info domain.RequestInfo) (domain.Tokens, error) {
+	user, err := s.userRepo.GetByVerificationToken(hashToken(token))
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Tokens{}, errors.New("access denied")
+
+		}
 		return domain.Tokens{}, err
 	}
 
-	err = s.userRepo.UpdatePassword(user.ID, hashedPassword)
+	hashedPassword, err := pass.HashPassword(password)
 	if err != nil {
 		return domain.Tokens{}, err
 	}
 
-	err = s.userRepo.UpdateVerificationByToken(token, "verified")
+	// Token is consumed together with the password update, so it can't be used twice.
+	_, err = s.userRepo.VerifyByToken(hashToken(token), hashedPassword)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Tokens{}, errors.New("access denied")
+		}
 		return domain.Tokens{}, err
 	}
 
-	return s.CreateNewSession(user.ID, user.Type)
+	return s.startSession(user, domain.LoginMethodVerification, info)
+}
+
+// hashToken hashes random token sent by email, so links can't be used by someone who
+// reads DB.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+)
+
+func TestAccessRevocation(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	auth := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, nil, nil, cache.NewMemoryCache())
+	users := NewUserService(repo.User, NewOrganizationService(repo.Organization), NewEmailService(), auth)
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	userID := testdb.User(t, db, "user@example.com", "user")
+	testdb.OrganizationUser(t, db, organizationID, userID, "admin")
+
+	access, err := auth.GetAccess(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access.Roles[organizationID] != "admin" {
+		t.Fatalf("Expected admin role, got %q", access.Roles[organizationID])
+	}
+
+	// Role change must be visible without waiting for the cache to expire.
+	err = users.UpdateOrganizationUser(organizationID, userID, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err = auth.GetAccess(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access.Roles[organizationID] != "user" {
+		t.Errorf("Expected downgraded role, got %q", access.Roles[organizationID])
+	}
+
+	err = users.DeleteOrganizationUser(organizationID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err = auth.GetAccess(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := access.Roles[organizationID]; ok {
+		t.Errorf("Removed user must lose the role: %+v", access.Roles)
+	}
+
+	version := access.TokenVersion
+	err = auth.RevokeAccess(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err = auth.GetAccess(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access.TokenVersion != version+1 {
+		t.Errorf("Expected token version %d, got %d", version+1, access.TokenVersion)
+	}
+
+	err = users.Delete(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = auth.GetAccess(userID)
+	if err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for deleted user, got %v", err)
+	}
+}
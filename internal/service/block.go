@@ -6,11 +6,12 @@ import (
 )
 
 type BlockService struct {
-	repo repository.Block
+	repo         repository.Block
+	revisionRepo repository.Revision
 }
 
-func NewBlockService(repo repository.Block) *BlockService {
-	return &BlockService{repo: repo}
+func NewBlockService(repo repository.Block, revisionRepo repository.Revision) *BlockService {
+	return &BlockService{repo: repo, revisionRepo: revisionRepo}
 }
 
 func (s *BlockService) GetByPageID(pageID int64) ([]domain.Block, error) {
@@ -18,6 +19,20 @@ func (s *BlockService) GetByPageID(pageID int64) ([]domain.Block, error) {
 	return blocks, err
 }
 
+// GetPublishedByPageID returns blocks of the page the way readers see them.
+func (s *BlockService) GetPublishedByPageID(page domain.Page) ([]domain.Block, error) {
+	if !page.Draft {
+		return s.repo.GetByPageID(page.ID)
+	}
+
+	data, err := publishedData(s.revisionRepo, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.Blocks, nil
+}
+
 func (s *BlockService) GetByID(id int64) (domain.Block, error) {
 	block, err := s.repo.GetByID(id)
 	return block, err
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"net/smtp"
 	"strconv"
+	"time"
 
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/config"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/multitemplate"
 )
 
@@ -95,6 +97,142 @@ func (s *EmailService) SendPasswordResetLink(emailTo, token string) error {
 	return nil
 }
 
+func (s *EmailService) SendMagicLink(emailTo, token string) error {
+	mail := config.Get().Mail
+	auth := smtp.PlainAuth("", mail.SmtpUsername, mail.SmtpPassword, mail.SmtpServer)
+
+	var body bytes.Buffer
+	mimeHeaders := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	subject := "KRISENKOMPASS®: Anmelden"
+	body.Write([]byte(fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n%s\n\n", mail.FromEmail, emailTo, subject, mimeHeaders)))
+
+	link := config.Get().App.Client + "magic-link/" + token
+	err := multitemplate.Render(&body, "userMagicLink", link)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	err = smtp.SendMail(mail.SmtpServer+":"+mail.SmtpPort, auth, mail.FromEmail, []string{emailTo}, body.Bytes())
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *EmailService) SendEmailChangeConfirmation(emailTo, token string) error {
+	mail := config.Get().Mail
+	auth := smtp.PlainAuth("", mail.SmtpUsername, mail.SmtpPassword, mail.SmtpServer)
+
+	var body bytes.Buffer
+	mimeHeaders := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	subject := "KRISENKOMPASS®: E-Mail-Adresse bestätigen"
+	body.Write([]byte(fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n%s\n\n", mail.FromEmail, emailTo, subject, mimeHeaders)))
+
+	link := config.Get().App.Client + "email-change/" + token
+	err := multitemplate.Render(&body, "userEmailChange", link)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	err = smtp.SendMail(mail.SmtpServer+":"+mail.SmtpPort, auth, mail.FromEmail, []string{emailTo}, body.Bytes())
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// SendEmailChangeNotice notifies the old address about the change with link to revert it.
+func (s *EmailService) SendEmailChangeNotice(emailTo, newEmail, token string) error {
+	mail := config.Get().Mail
+	auth := smtp.PlainAuth("", mail.SmtpUsername, mail.SmtpPassword, mail.SmtpServer)
+
+	var body bytes.Buffer
+	mimeHeaders := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	subject := "KRISENKOMPASS®: Änderung der E-Mail-Adresse"
+	body.Write([]byte(fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n%s\n\n", mail.FromEmail, emailTo, subject, mimeHeaders)))
+
+	link := config.Get().App.Client + "email-change/revert/" + token
+	err := multitemplate.Render(&body, "userEmailChangeNotice", map[string]interface{}{
+		"email": newEmail,
+		"link":  link,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	err = smtp.SendMail(mail.SmtpServer+":"+mail.SmtpPort, auth, mail.FromEmail, []string{emailTo}, body.Bytes())
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// SendEmailChangeTaken tells the owner of the address that someone tried to use it for
+// another account.
+func (s *EmailService) SendEmailChangeTaken(emailTo string) error {
+	mail := config.Get().Mail
+	auth := smtp.PlainAuth("", mail.SmtpUsername, mail.SmtpPassword, mail.SmtpServer)
+
+	var body bytes.Buffer
+	mimeHeaders := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	subject := "KRISENKOMPASS®: E-Mail-Adresse bereits registriert"
+	body.Write([]byte(fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n%s\n\n", mail.FromEmail, emailTo, subject, mimeHeaders)))
+
+	link := config.Get().App.Client + "password-reset"
+	err := multitemplate.Render(&body, "userEmailChangeTaken", map[string]interface{}{
+		"link": link,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	err = smtp.SendMail(mail.SmtpServer+":"+mail.SmtpPort, auth, mail.FromEmail, []string{emailTo}, body.Bytes())
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *EmailService) SendAccountLocked(emailTo string, until time.Time) error {
+	mail := config.Get().Mail
+	auth := smtp.PlainAuth("", mail.SmtpUsername, mail.SmtpPassword, mail.SmtpServer)
+
+	var body bytes.Buffer
+	mimeHeaders := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	subject := "KRISENKOMPASS®: Konto vorübergehend gesperrt"
+	body.Write([]byte(fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n%s\n\n", mail.FromEmail, emailTo, subject, mimeHeaders)))
+
+	link := config.Get().App.Client + "password-reset"
+	err := multitemplate.Render(&body, "userAccountLocked", map[string]interface{}{
+		"link":  link,
+		"until": until.Format("02.01.2006 15:04"),
+	})
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	err = smtp.SendMail(mail.SmtpServer+":"+mail.SmtpPort, auth, mail.FromEmail, []string{emailTo}, body.Bytes())
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
 func (s *EmailService) SendUserInvite(emailTo string, organizationID int64, organizationName string) error {
 	mail := config.Get().Mail
 	auth := smtp.PlainAuth("", mail.SmtpUsername, mail.SmtpPassword, mail.SmtpServer)
@@ -198,3 +336,36 @@ func (s *EmailService) SendUserNewOrganization(organizationID int64, plan, email
 
 	return nil
 }
+
+// SendLoginAlert notifies the user about login from a new device or after failed logins.
+func (s *EmailService) SendLoginAlert(emailTo string, at time.Time, info domain.RequestInfo, newDevice bool, failedLogins int) error {
+	mail := config.Get().Mail
+	auth := smtp.PlainAuth("", mail.SmtpUsername, mail.SmtpPassword, mail.SmtpServer)
+
+	var body bytes.Buffer
+	mimeHeaders := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	subject := "KRISENKOMPASS®: Neue Anmeldung bei Ihrem Konto"
+	body.Write([]byte(fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n%s\n\n", mail.FromEmail, emailTo, subject, mimeHeaders)))
+
+	link := config.Get().App.Client + "password-reset"
+	err := multitemplate.Render(&body, "userLoginAlert", map[string]interface{}{
+		"link":         link,
+		"time":         at.Format("02.01.2006 15:04"),
+		"ip":           info.IP,
+		"ua":           info.UserAgent,
+		"newDevice":    newDevice,
+		"failedLogins": failedLogins,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	err = smtp.SendMail(mail.SmtpServer+":"+mail.SmtpPort, auth, mail.FromEmail, []string{emailTo}, body.Bytes())
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+)
+
+type emailChangeEmail struct {
+	Email
+	token       string
+	revertToken string
+	notified    string
+	taken       string
+}
+
+func (e *emailChangeEmail) SendEmailChangeConfirmation(emailTo, token string) error {
+	e.token = token
+	return nil
+}
+
+func (e *emailChangeEmail) SendEmailChangeNotice(emailTo, newEmail, token string) error {
+	e.notified = emailTo
+	e.revertToken = token
+	return nil
+}
+
+func (e *emailChangeEmail) SendEmailChangeTaken(emailTo string) error {
+	e.taken = emailTo
+	return nil
+}
+
+func TestRequestEmailChangeValidation(t *testing.T) {
+	s := NewUserService(nil, nil, nil, nil)
+
+	for _, email := range []string{"", "user", "User <user@example.com>", "user@example.com, other@example.com"} {
+		err := s.RequestEmailChange(1, email)
+		if err == nil || err.Error() != "invalid email" {
+			t.Errorf("Email %q must be invalid, got %v", email, err)
+		}
+	}
+}
+
+func TestEmailChange(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	email := &emailChangeEmail{}
+	auth := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, NewSigningKeyService(repo.SigningKey, "EdDSA", []byte("application key")), email, cache.NewMemoryCache())
+	s := NewUserService(repo.User, nil, email, auth)
+
+	userID := testdb.User(t, db, "old@example.com", "user")
+	testdb.User(t, db, "taken@example.com", "user")
+
+	// Email of another user isn't revealed, its owner is notified instead.
+	err := s.RequestEmailChange(userID, "taken@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.taken != "taken@example.com" || email.token != "" || email.notified != "" {
+		t.Errorf("Only owner of taken address must be notified, got %+v", email)
+	}
+
+	err = s.RequestEmailChange(userID, "new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.notified != "old@example.com" {
+		t.Errorf("Old address is not notified, got %q", email.notified)
+	}
+
+	// Old address stays active until the change is confirmed.
+	user, err := repo.User.GetByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "old@example.com" {
+		t.Errorf("Email changed before confirmation to %q", user.Email)
+	}
+
+	change, err := s.ConfirmEmailChange(email.token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.OldEmail != "old@example.com" || change.NewEmail != "new@example.com" {
+		t.Errorf("Wrong change %+v", change)
+	}
+	user, _ = repo.User.GetByID(userID)
+	if user.Email != "new@example.com" {
+		t.Errorf("Email is not changed, got %q", user.Email)
+	}
+
+	_, err = s.ConfirmEmailChange(email.token)
+	if err == nil {
+		t.Error("Confirmation link must be single-use")
+	}
+
+	_, err = s.RevertEmailChange(email.revertToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, _ = repo.User.GetByID(userID)
+	if user.Email != "old@example.com" {
+		t.Errorf("Email is not reverted, got %q", user.Email)
+	}
+
+	_, err = s.RevertEmailChange(email.revertToken)
+	if err == nil {
+		t.Error("Revert link must be single-use")
+	}
+}
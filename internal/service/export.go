@@ -0,0 +1,328 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+)
+
+var (
+	handbookTemplatePath = "../../templates/export/handbook.html"
+
+	// Matches src attributes of images inside block content.
+	imageSrcRegexp = regexp.MustCompile(`(<img[^>]+src=")([^"]+)(")`)
+	// Matches links to organization pages and blocks, so they can point to the sections of the handbook.
+	pageLinkRegexp = regexp.MustCompile(`href="[^"]*/organization/\d+/page/(\d+)(?:#block-(\d+))?"`)
+)
+
+type ExportService struct {
+	organizationService Organization
+	pageService         Page
+	blockService        Block
+	fileBlockService    FileBlock
+	addressService      Address
+}
+
+func NewExportService(organizationService Organization, pageService Page, blockService Block, fileBlockService FileBlock, addressService Address) *ExportService {
+	return &ExportService{
+		organizationService: organizationService,
+		pageService:         pageService,
+		blockService:        blockService,
+		fileBlockService:    fileBlockService,
+		addressService:      addressService,
+	}
+}
+
+// Handbook collects published and visible pages of the organization, except the pages
+// hidden by restrictions. If language tag is empty pages of all languages are returned.
+func (s *ExportService) Handbook(organizationID int64, languageTag string, restrictions domain.PageRestrictions) (domain.Handbook, error) {
+	organization, err := s.organizationService.GetByID(organizationID)
+	if err != nil {
+		return domain.Handbook{}, errors.New("organization not found")
+	}
+
+	rootPages, err := s.pageService.GetRootPages(&organizationID)
+	if err != nil {
+		return domain.Handbook{}, err
+	}
+
+	pages, err := s.handbookPages(restrictions.Filter(rootPages), languageTag, restrictions)
+	if err != nil {
+		return domain.Handbook{}, err
+	}
+
+	addresses, err := s.addressService.GetByOrganizationID(organizationID)
+	if err != nil {
+		return domain.Handbook{}, err
+	}
+
+	return domain.Handbook{
+		Organization: organization,
+		LanguageTag:  languageTag,
+		Pages:        pages,
+		Addresses:    addresses,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+func (s *ExportService) handbookPages(pages []domain.Page, languageTag string, restrictions domain.PageRestrictions) ([]domain.HandbookPage, error) {
+	pages, err := s.pageService.FilterPublished(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]domain.HandbookPage, 0, len(pages))
+	for _, page := range pages {
+		if page.Status != "visible" || (languageTag != "" && page.LanguageTag != languageTag) {
+			continue
+		}
+
+		handbookPage := domain.HandbookPage{Page: page}
+
+		handbookPage.Blocks, err = s.blockService.GetPublishedByPageID(page)
+		if err != nil {
+			return nil, err
+		}
+
+		if page.Type == "file" {
+			file, err := s.fileBlockService.GetPublishedByPageID(page)
+			if err == nil {
+				handbookPage.File = &file
+			}
+		}
+
+		childrens, err := s.pageService.GetPublishedChildrens(page.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		handbookPage.Childrens, err = s.handbookPages(restrictions.Filter(childrens), languageTag, restrictions)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, handbookPage)
+	}
+
+	return result, nil
+}
+
+type handbookView struct {
+	LanguageTag    string
+	Name           string
+	Image          template.URL
+	AddressesTitle string
+	Pages          []handbookPageView
+	Addresses      []domain.Address
+	CreatedAt      time.Time
+}
+
+type handbookPageView struct {
+	ID        int64
+	Level     int
+	Title     string
+	Heading   template.HTML
+	Image     template.URL
+	Blocks    []handbookBlockView
+	File      template.URL
+	FileName  string
+	Childrens []handbookPageView
+}
+
+type handbookBlockView struct {
+	ID       int64
+	Type     string
+	Title    string
+	Image    template.URL
+	Content  template.HTML
+	Readmore template.HTML
+}
+
+// WriteHandbookHTML renders handbook as a single HTML page with embedded images.
+// Attached files are linked with the files prefix, if it is empty they are linked to
+// the storage of the server.
+func (s *ExportService) WriteHandbookHTML(w io.Writer, handbook domain.Handbook, filesPrefix string) error {
+	tmpl, err := template.ParseFiles(handbookTemplatePath)
+	if err != nil {
+		return err
+	}
+
+	view := handbookView{
+		LanguageTag:    handbook.LanguageTag,
+		Name:           handbook.Organization.Name,
+		Image:          embedImage(handbook.Organization.Image.String),
+		AddressesTitle: "Adressen",
+		Pages:          handbookPageViews(handbook.Pages, 1, filesPrefix),
+		Addresses:      handbook.Addresses,
+		CreatedAt:      handbook.CreatedAt,
+	}
+
+	if handbook.LanguageTag == "" {
+		view.LanguageTag = "de"
+	}
+	if handbook.LanguageTag == "en" {
+		view.AddressesTitle = "Addresses"
+	}
+
+	return tmpl.Execute(w, view)
+}
+
+// WriteHandbookZIP writes archive with the handbook page and all attached files.
+func (s *ExportService) WriteHandbookZIP(w io.Writer, handbook domain.Handbook) error {
+	archive := zip.NewWriter(w)
+
+	index, err := archive.Create("handbook.html")
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteHandbookHTML(index, handbook, "files/")
+	if err != nil {
+		return err
+	}
+
+	err = writeHandbookFiles(archive, handbook.Pages)
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeHandbookFiles(archive *zip.Writer, pages []domain.HandbookPage) error {
+	for _, page := range pages {
+		if page.File != nil {
+			data, err := ioutil.ReadFile(storagePath(page.File.Path))
+			if err == nil {
+				f, err := archive.Create("files/" + handbookFileName(page))
+				if err != nil {
+					return err
+				}
+
+				_, err = f.Write(data)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		err := writeHandbookFiles(archive, page.Childrens)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func handbookPageViews(pages []domain.HandbookPage, level int, filesPrefix string) []handbookPageView {
+	result := make([]handbookPageView, 0, len(pages))
+	for _, page := range pages {
+		headingLevel := level
+		if headingLevel > 3 {
+			headingLevel = 3
+		}
+
+		view := handbookPageView{
+			ID:        page.Page.ID,
+			Level:     level,
+			Title:     page.Page.Title,
+			Heading:   template.HTML(fmt.Sprintf("<h%d>%s</h%d>", headingLevel, html.EscapeString(page.Page.Title), headingLevel)),
+			Image:     embedImage(page.Page.Image.String),
+			Blocks:    make([]handbookBlockView, 0, len(page.Blocks)),
+			Childrens: handbookPageViews(page.Childrens, level+1, filesPrefix),
+		}
+
+		for _, block := range page.Blocks {
+			view.Blocks = append(view.Blocks, handbookBlockView{
+				ID:       block.ID,
+				Type:     block.Type,
+				Title:    block.Title,
+				Image:    embedImage(block.Image.String),
+				Content:  handbookContent(block.Content.String),
+				Readmore: handbookContent(block.Readmore.String),
+			})
+		}
+
+		if page.File != nil {
+			view.FileName = path.Base(page.File.Path)
+			if filesPrefix != "" {
+				view.File = template.URL(filesPrefix + url.PathEscape(handbookFileName(page)))
+			} else {
+				view.File = template.URL(page.File.Path)
+			}
+		}
+
+		result = append(result, view)
+	}
+
+	return result
+}
+
+// handbookContent embeds images of block content and replaces links to pages with
+// links to the sections of the handbook.
+func handbookContent(content string) template.HTML {
+	content = imageSrcRegexp.ReplaceAllStringFunc(content, func(match string) string {
+		parts := imageSrcRegexp.FindStringSubmatch(match)
+		return parts[1] + string(embedImage(html.UnescapeString(parts[2]))) + parts[3]
+	})
+
+	content = pageLinkRegexp.ReplaceAllStringFunc(content, func(match string) string {
+		parts := pageLinkRegexp.FindStringSubmatch(match)
+		if parts[2] != "" {
+			return `href="#block-` + parts[2] + `"`
+		}
+		return `href="#page-` + parts[1] + `"`
+	})
+
+	return template.HTML(content)
+}
+
+// embedImage returns data URI of the image from storage. Images which are not found in
+// the storage are left as is.
+func embedImage(src string) template.URL {
+	if src == "" || strings.HasPrefix(src, "data:") {
+		return template.URL(src)
+	}
+
+	u, err := url.Parse(src)
+	if err != nil {
+		return template.URL(src)
+	}
+
+	data, err := ioutil.ReadFile(storagePath(u.Path))
+	if err != nil {
+		return template.URL(src)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(u.Path))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	return template.URL("data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data))
+}
+
+func handbookFileName(page domain.HandbookPage) string {
+	return fmt.Sprintf("%d-%s", page.Page.ID, path.Base(page.File.Path))
+}
+
+// storagePath returns path of the file in storage. Path is cleaned, so files outside of
+// the storage can't be read.
+func storagePath(p string) string {
+	return "../../storage" + path.Clean("/"+p)
+}
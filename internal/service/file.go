@@ -1,13 +1,14 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
-	"log"
 	"os"
 
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/logger"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/randstring"
 )
 
@@ -42,20 +43,20 @@ func (s *FileService) DeleteFiles(path string) error {
 	return nil
 }
 
-func (s *FileService) CreateFolder(name string, path string) error {
+func (s *FileService) CreateFolder(ctx context.Context, name string, path string) error {
 	fullPath := fmt.Sprintf("../../storage%s/%s", path, name)
 
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 		err := os.MkdirAll(fullPath, os.ModePerm)
 		if err != nil {
-			log.Println(err)
+			logger.Println(ctx, err)
 			return err
 		}
 	} else {
 		fullPath = fullPath + "-" + randstring.RandAlphanumString(5)
 		err := os.MkdirAll(fullPath, os.ModePerm)
 		if err != nil {
-			log.Println(err)
+			logger.Println(ctx, err)
 			return err
 		}
 	}
@@ -64,10 +65,10 @@ func (s *FileService) CreateFolder(name string, path string) error {
 }
 
 // Rename or move file.
-func (s *FileService) RenameFile(fullPath string, newFullPath string) error {
+func (s *FileService) RenameFile(ctx context.Context, fullPath string, newFullPath string) error {
 	err := os.Rename("../../storage"+fullPath, "../../storage"+newFullPath)
 	if err != nil {
-		log.Println(err)
+		logger.Println(ctx, err)
 		return err
 	}
 
@@ -1,16 +1,19 @@
 package service
 
 import (
+	"database/sql"
+
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
 )
 
 type FileBlockService struct {
-	repo repository.FileBlock
+	repo         repository.FileBlock
+	revisionRepo repository.Revision
 }
 
-func NewFileBlockService(repo repository.FileBlock) *FileBlockService {
-	return &FileBlockService{repo: repo}
+func NewFileBlockService(repo repository.FileBlock, revisionRepo repository.Revision) *FileBlockService {
+	return &FileBlockService{repo: repo, revisionRepo: revisionRepo}
 }
 
 func (s *FileBlockService) GetByID(id int64) (domain.FileBlock, error) {
@@ -23,6 +26,24 @@ func (s *FileBlockService) GetByPageID(pageID int64) (domain.FileBlock, error) {
 	return file, err
 }
 
+// GetPublishedByPageID returns file of the page the way readers see it.
+func (s *FileBlockService) GetPublishedByPageID(page domain.Page) (domain.FileBlock, error) {
+	if !page.Draft {
+		return s.repo.GetByPageID(page.ID)
+	}
+
+	data, err := publishedData(s.revisionRepo, page)
+	if err != nil {
+		return domain.FileBlock{}, err
+	}
+
+	if data.File == nil {
+		return domain.FileBlock{}, sql.ErrNoRows
+	}
+
+	return *data.File, nil
+}
+
 func (s *FileBlockService) Create(pageID int64, path string) (int64, error) {
 	id, err := s.repo.Create(pageID, path)
 	return id, err
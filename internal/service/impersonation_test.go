@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestImpersonate(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	signingKeys := NewSigningKeyService(repo.SigningKey, "EdDSA", []byte("application key"))
+	auth := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, signingKeys, nil, cache.NewMemoryCache())
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	superadminID := testdb.User(t, db, "superadmin@example.com", "superadmin")
+	otherSuperadminID := testdb.User(t, db, "other@example.com", "superadmin")
+	userID := testdb.User(t, db, "user@example.com", "user")
+	testdb.OrganizationUser(t, db, organizationID, userID, "editor")
+
+	tokens, err := auth.Impersonate(superadminID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.RefreshToken != "" {
+		t.Error("Impersonation token must not be refreshable")
+	}
+
+	token, err := jwt.ParseWithClaims(tokens.AccessToken, &domain.Claims{}, signingKeys.Keyfunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := token.Claims.(*domain.Claims)
+	if claims.UserID != userID || claims.ImpersonatorID != superadminID || claims.Type != "user" || claims.Roles[organizationID] != "editor" {
+		t.Errorf("Wrong impersonation claims %+v", claims)
+	}
+
+	_, err = auth.Impersonate(superadminID, otherSuperadminID)
+	if err == nil {
+		t.Error("Superadmin must not be impersonated")
+	}
+}
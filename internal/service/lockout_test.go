@@ -0,0 +1,123 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+	pass "bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/password"
+)
+
+type lockedEmail struct {
+	Email
+	sent chan string
+}
+
+func (e lockedEmail) SendAccountLocked(emailTo string, until time.Time) error {
+	e.sent <- emailTo
+	return nil
+}
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{11, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := lockoutDuration(test.failures); got != test.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", test.failures, got, test.want)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	email := lockedEmail{sent: make(chan string, 1)}
+	auth := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, nil, email, cache.NewMemoryCache())
+
+	userID := testdb.User(t, db, "user@example.com", "user")
+	hashedPassword, err := pass.HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.User.CreateVerification(userID, "token", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.User.VerifyByToken("token", hashedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < lockoutThreshold; i++ {
+		_, err = auth.Login("user@example.com", "wrong password", domain.RequestInfo{})
+		if err == nil || err == errLoginDelayed {
+			t.Fatalf("Expected wrong password, got %v", err)
+		}
+
+		if i == lockoutThreshold-1 {
+			break
+		}
+
+		// Next attempt is delayed, even with correct password.
+		_, err = auth.Login("user@example.com", "correct horse battery staple", domain.RequestInfo{})
+		if err != errLoginDelayed {
+			t.Fatalf("Expected delayed login, got %v", err)
+		}
+
+		// Skip the delay.
+		err = repo.User.Lock(userID, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case to := <-email.sent:
+		if to != "user@example.com" {
+			t.Errorf("Lockout email sent to %q", to)
+		}
+	case <-time.After(time.Second):
+		t.Error("Lockout email is not sent")
+	}
+
+	// Correct password is refused while the account is locked.
+	_, err = auth.Login("user@example.com", "correct horse battery staple", domain.RequestInfo{})
+	if err == nil || err.Error() != "account is locked, try again later" {
+		t.Fatalf("Expected locked account, got %v", err)
+	}
+
+	user, err := repo.User.GetByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.FailedLogins != lockoutThreshold || !user.LockedUntil.Valid {
+		t.Errorf("Expected locked user with %d failed logins, got %d, %v", lockoutThreshold, user.FailedLogins, user.LockedUntil)
+	}
+
+	err = auth.Unlock(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err = repo.User.GetByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.FailedLogins != 0 || user.LockedUntil.Valid {
+		t.Errorf("Expected unlocked user, got %d, %v", user.FailedLogins, user.LockedUntil)
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Maximum number of login events returned at once.
+const LoginHistoryLimit = 50
+
+// loginHistoryRetention is how long login events are kept.
+const loginHistoryRetention = 180 * 24 * time.Hour
+
+// User is alerted about successful login after alertFailedLogins failed logins in a row.
+const alertFailedLogins = 3
+
+func (s *AuthService) GetLoginHistory(userID, cursor int64, limit int) ([]domain.LoginEvent, error) {
+	if limit <= 0 || limit > LoginHistoryLimit {
+		limit = LoginHistoryLimit
+	}
+
+	return s.loginEventRepo.GetByUserID(userID, cursor, limit)
+}
+
+// recordLogin saves login event. Errors are only logged, login doesn't depend on history.
+func (s *AuthService) recordLogin(userID int64, method string, loginErr error, info domain.RequestInfo) {
+	event := domain.LoginEvent{
+		UserID:  userID,
+		Method:  method,
+		Success: loginErr == nil,
+		UA:      info.UserAgent,
+		IP:      info.IP,
+	}
+	if loginErr != nil {
+		event.Error = null.StringFrom(loginErr.Error())
+	}
+
+	s.saveLoginEvent(event)
+}
+
+// recordChallenge saves login which passed the first factor and waits for the second.
+func (s *AuthService) recordChallenge(userID int64, method string, info domain.RequestInfo) {
+	s.saveLoginEvent(domain.LoginEvent{
+		UserID:    userID,
+		Method:    method,
+		Challenge: true,
+		UA:        info.UserAgent,
+		IP:        info.IP,
+	})
+}
+
+func (s *AuthService) saveLoginEvent(event domain.LoginEvent) {
+	_, err := s.loginEventRepo.Create(event)
+	if err != nil {
+		log.Println("Failed to record login: ", err)
+	}
+}
+
+// createLoginSession creates session of the user who passed all factors. Login is
+// recorded and failed logins are reset. User is alerted about login from a device which
+// wasn't used before or after several failed logins.
+func (s *AuthService) createLoginSession(user domain.User, method string, info domain.RequestInfo) (domain.Tokens, error) {
+	tokens, err := s.CreateNewSession(user.ID, info)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	newDevice := s.isNewDevice(user.ID, info)
+	s.recordLogin(user.ID, method, nil, info)
+
+	if user.FailedLogins != 0 || user.LockedUntil.Valid {
+		err = s.userRepo.Unlock(user.ID)
+		if err != nil {
+			return domain.Tokens{}, err
+		}
+	}
+
+	if newDevice || user.FailedLogins >= alertFailedLogins {
+		go s.emailService.SendLoginAlert(user.Email, time.Now(), info, newDevice, user.FailedLogins)
+	}
+
+	return tokens, nil
+}
+
+// isNewDevice reports whether the user logs in with the user agent for the first time.
+// The very first login of the user isn't from a new device.
+func (s *AuthService) isNewDevice(userID int64, info domain.RequestInfo) bool {
+	known, err := s.loginEventRepo.HasSuccessfulLogin(userID, &info.UserAgent)
+	if err != nil {
+		log.Println("Failed to check login device: ", err)
+		return false
+	}
+	if known {
+		return false
+	}
+
+	loggedIn, err := s.loginEventRepo.HasSuccessfulLogin(userID, nil)
+	if err != nil {
+		log.Println("Failed to check login device: ", err)
+		return false
+	}
+
+	return loggedIn
+}
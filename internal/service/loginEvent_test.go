@@ -0,0 +1,120 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+	pass "bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/password"
+)
+
+type loginAlert struct {
+	newDevice    bool
+	failedLogins int
+}
+
+type loginAlertEmail struct {
+	Email
+	alerts chan loginAlert
+}
+
+func (e loginAlertEmail) SendLoginAlert(emailTo string, at time.Time, info domain.RequestInfo, newDevice bool, failedLogins int) error {
+	e.alerts <- loginAlert{newDevice, failedLogins}
+	return nil
+}
+
+func TestLoginHistory(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	email := loginAlertEmail{alerts: make(chan loginAlert, 1)}
+	auth := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, NewSigningKeyService(repo.SigningKey, "EdDSA", []byte("application key")), email, cache.NewMemoryCache())
+
+	userID := testdb.User(t, db, "user@example.com", "user")
+	hashedPassword, err := pass.HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.User.CreateVerification(userID, "token", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.User.VerifyByToken("token", hashedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	laptop := domain.RequestInfo{IP: "192.0.2.1", UserAgent: "Laptop"}
+	phone := domain.RequestInfo{IP: "192.0.2.2", UserAgent: "Phone"}
+
+	expectAlert := func(want *loginAlert) {
+		t.Helper()
+		select {
+		case alert := <-email.alerts:
+			if want == nil {
+				t.Errorf("Unexpected alert %+v", alert)
+			} else if alert != *want {
+				t.Errorf("Expected alert %+v, got %+v", *want, alert)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if want != nil {
+				t.Errorf("Alert %+v is not sent", *want)
+			}
+		}
+	}
+
+	// The first login isn't from a new device.
+	_, err = auth.Login("user@example.com", "correct horse battery staple", laptop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAlert(nil)
+
+	_, err = auth.Login("user@example.com", "correct horse battery staple", phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAlert(&loginAlert{newDevice: true})
+
+	for i := 0; i < alertFailedLogins; i++ {
+		_, err = auth.Login("user@example.com", "wrong password", laptop)
+		if err == nil {
+			t.Fatal("Login with wrong password must fail")
+		}
+
+		// Skip the delay after failed login.
+		err = repo.User.Lock(userID, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = auth.Login("user@example.com", "correct horse battery staple", laptop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAlert(&loginAlert{failedLogins: alertFailedLogins})
+
+	events, err := auth.GetLoginHistory(userID, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2+alertFailedLogins+1 {
+		t.Fatalf("Expected %d events, got %d", 2+alertFailedLogins+1, len(events))
+	}
+	if !events[0].Success || events[0].UA != "Laptop" || events[0].IP != "192.0.2.1" {
+		t.Errorf("Wrong newest event %+v", events[0])
+	}
+	if events[1].Success || !events[1].Error.Valid || events[1].Method != domain.LoginMethodPassword {
+		t.Errorf("Wrong failed event %+v", events[1])
+	}
+
+	page, err := auth.GetLoginHistory(userID, events[1].ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != events[2].ID {
+		t.Errorf("Wrong page %+v", page)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+)
+
+const magicLinkTTL = time.Minute * 15
+
+// SendMagicLink emails a single-use login link to the user. Only verified users who
+// aren't locked get the link.
+func (s *AuthService) SendMagicLink(email string) error {
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkCanLogin(user)
+	if err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	err = s.userRepo.CreateMagicLink(user.ID, hashToken(token), time.Now().Add(magicLinkTTL))
+	if err != nil {
+		return err
+	}
+
+	return s.emailService.SendMagicLink(user.Email, token)
+}
+
+// LoginWithMagicLink consumes the link and starts session of its user. Second factor is
+// still required if the user has one.
+func (s *AuthService) LoginWithMagicLink(token string, info domain.RequestInfo) (domain.Tokens, error) {
+	userID, err := s.userRepo.UseMagicLink(hashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Tokens{}, errors.New("access denied")
+		}
+		return domain.Tokens{}, err
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	err = s.checkCanLogin(user)
+	if err != nil {
+		s.recordLogin(user.ID, domain.LoginMethodMagicLink, err, info)
+		return domain.Tokens{}, err
+	}
+
+	return s.startSession(user, domain.LoginMethodMagicLink, info)
+}
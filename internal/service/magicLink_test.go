@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+)
+
+type magicLinkEmail struct {
+	Email
+	token string
+}
+
+func (e *magicLinkEmail) SendMagicLink(emailTo, token string) error {
+	e.token = token
+	return nil
+}
+
+func TestMagicLink(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	email := &magicLinkEmail{}
+	auth := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, NewSigningKeyService(repo.SigningKey, "EdDSA", []byte("application key")), email, cache.NewMemoryCache())
+
+	userID := testdb.User(t, db, "user@example.com", "user")
+
+	// Unverified users don't get the link.
+	err := auth.SendMagicLink("user@example.com")
+	if err == nil {
+		t.Fatal("Link must not be sent to unverified user")
+	}
+
+	err = repo.User.CreateVerification(userID, "token", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.User.VerifyByToken("token", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = auth.SendMagicLink("user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := email.token
+
+	// New link replaces the previous one.
+	err = auth.SendMagicLink("user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = auth.LoginWithMagicLink(first, domain.RequestInfo{})
+	if err == nil {
+		t.Error("Replaced link must not work")
+	}
+
+	tokens, err := auth.LoginWithMagicLink(email.token, domain.RequestInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.AccessToken == "" {
+		t.Error("Access token is empty")
+	}
+
+	_, err = auth.LoginWithMagicLink(email.token, domain.RequestInfo{})
+	if err == nil {
+		t.Error("Link must be single-use")
+	}
+
+	// Expired link doesn't work.
+	err = repo.User.CreateMagicLink(userID, hashToken("expired"), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = auth.LoginWithMagicLink("expired", domain.RequestInfo{})
+	if err == nil {
+		t.Error("Expired link must not work")
+	}
+}
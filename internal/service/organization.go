@@ -1,6 +1,8 @@
 package service
 
 import (
+	"errors"
+
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
 	"gopkg.in/guregu/null.v4"
@@ -34,16 +36,48 @@ func (s *OrganizationService) Create(image *string, name, city, address, invoice
 	return id, err
 }
 
-func (s *OrganizationService) CopyDefaultContent(organizationID int64, plan string) error {
-	err := s.repo.CopyDefaultContent(organizationID, plan)
+func (s *OrganizationService) CopyDefaultContent(organizationID int64, plan, mode string) error {
+	err := s.repo.CopyDefaultContent(organizationID, plan, mode)
 	return err
 }
 
+func (s *OrganizationService) GetCopyJob(organizationID int64) (domain.ContentCopyJob, error) {
+	job, err := s.repo.GetCopyJob(organizationID)
+	return job, err
+}
+
+// RetryCopyJob runs the last copy job of the organization again in background.
+// Pages copied before are skipped. Unfinished job can be retried only when it's stale.
+func (s *OrganizationService) RetryCopyJob(organizationID int64) error {
+	job, err := s.repo.GetCopyJob(organizationID)
+	if err != nil {
+		return err
+	}
+
+	if (job.Status == "running" || job.Status == "pending") && !job.Stale() {
+		return errors.New("job is not finished yet")
+	}
+
+	go s.repo.RunCopyJob(job.ID)
+
+	return nil
+}
+
+func (s *OrganizationService) SyncDefaultContent(organizationID int64, dryRun bool) ([]domain.SyncChange, error) {
+	changes, err := s.repo.SyncDefaultContent(organizationID, dryRun)
+	return changes, err
+}
+
 func (s *OrganizationService) Update(id int64, name, image, city, address, invoiceAddress, plan, status null.String, population null.Int) error {
 	err := s.repo.Update(id, image, name, city, address, invoiceAddress, plan, status, population)
 	return err
 }
 
+func (s *OrganizationService) UpdateRequire2FA(id int64, require bool) error {
+	err := s.repo.UpdateRequire2FA(id, require)
+	return err
+}
+
 func (s *OrganizationService) Delete(id int64) error {
 	err := s.repo.Delete(id)
 	return err
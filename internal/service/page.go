@@ -1,16 +1,21 @@
 package service
 
 import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
 )
 
 type PageService struct {
-	repo repository.Page
+	repo         repository.Page
+	revisionRepo repository.Revision
 }
 
-func NewPageService(repo repository.Page) *PageService {
-	return &PageService{repo: repo}
+func NewPageService(repo repository.Page, revisionRepo repository.Revision) *PageService {
+	return &PageService{repo: repo, revisionRepo: revisionRepo}
 }
 
 func (s *PageService) GetByID(id int64) (domain.Page, error) {
@@ -23,6 +28,26 @@ func (s *PageService) GetChildrens(id int64) ([]domain.Page, error) {
 	return childs, err
 }
 
+// GetPublishedChildrens returns published versions of the children of a page
+// as readers see them, in published sort order.
+func (s *PageService) GetPublishedChildrens(id int64) ([]domain.Page, error) {
+	childs, err := s.repo.GetPublishedChildrens(id)
+	if err != nil {
+		return nil, err
+	}
+
+	childs, err = s.FilterPublished(childs)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(childs, func(i, j int) bool {
+		return childs[i].Sort < childs[j].Sort
+	})
+
+	return childs, nil
+}
+
 func (s *PageService) GetDefaultPage(pageID int64) ([]domain.DefaultPage, error) {
 	pages, err := s.repo.GetDefaultPage(pageID)
 	return pages, err
@@ -38,6 +63,55 @@ func (s *PageService) GetPages(organizationID *int64) ([]domain.Page, error) {
 	return pages, err
 }
 
+func (s *PageService) GetDrafts(organizationID int64) ([]domain.Page, error) {
+	pages, err := s.repo.GetDrafts(organizationID)
+	return pages, err
+}
+
+// GetPublished returns page the way readers see it. False is returned if page
+// has never been published.
+func (s *PageService) GetPublished(page domain.Page) (domain.Page, bool, error) {
+	if !page.Draft {
+		return page, true, nil
+	}
+
+	if !page.PublishedRevisionID.Valid {
+		return domain.Page{}, false, nil
+	}
+
+	data, err := publishedData(s.revisionRepo, page)
+	if err != nil {
+		return domain.Page{}, false, err
+	}
+
+	published := page
+	published.ParentID = data.Page.ParentID
+	published.Sort = data.Page.Sort
+	published.Status = data.Page.Status
+	published.Title = data.Page.Title
+	published.Image = data.Page.Image
+	published.ImageHover = data.Page.ImageHover
+
+	return published, true, nil
+}
+
+// FilterPublished replaces pages with their published versions and drops pages
+// which have never been published.
+func (s *PageService) FilterPublished(pages []domain.Page) ([]domain.Page, error) {
+	result := make([]domain.Page, 0, len(pages))
+	for _, page := range pages {
+		published, ok, err := s.GetPublished(page)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, published)
+		}
+	}
+
+	return result, nil
+}
+
 func (s *PageService) Create(organizationID *int64, parentID int64, languageTag, pageType, theme, status, title string, image, imageHover *string) (int64, error) {
 	id, err := s.repo.Create(organizationID, parentID, languageTag, pageType, theme, status, title, image, imageHover)
 	return id, err
@@ -53,6 +127,16 @@ func (s *PageService) Update(id int64, parentID *int64, status, title, image, im
 	return err
 }
 
+func (s *PageService) Publish(id int64) error {
+	err := s.repo.Publish(id)
+	return err
+}
+
+func (s *PageService) Discard(id int64) error {
+	err := s.repo.Discard(id)
+	return err
+}
+
 func (s *PageService) UpdateSort(parentID int64, sort []int) error {
 	err := s.repo.UpdateSort(parentID, sort)
 	return err
@@ -72,3 +156,20 @@ func (s *PageService) DeleteDefaultPage(pageID int64, plans []string) error {
 	err := s.repo.DeleteDefaultPage(pageID, plans)
 	return err
 }
+
+// publishedData returns snapshot of the page made at the moment of the last publishing.
+func publishedData(revisionRepo repository.Revision, page domain.Page) (domain.RevisionData, error) {
+	var data domain.RevisionData
+
+	if !page.PublishedRevisionID.Valid {
+		return data, sql.ErrNoRows
+	}
+
+	revision, err := revisionRepo.GetByID(page.PublishedRevisionID.Int64)
+	if err != nil {
+		return data, err
+	}
+
+	err = json.Unmarshal([]byte(revision.Data), &data)
+	return data, err
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"gopkg.in/guregu/null.v4"
+)
+
+type PageAccessService struct {
+	repo                 repository.PageAccess
+	pageRepo             repository.Page
+	organizationUserRepo repository.OrganizationUser
+}
+
+func NewPageAccessService(repo repository.PageAccess, pageRepo repository.Page, organizationUserRepo repository.OrganizationUser) *PageAccessService {
+	return &PageAccessService{repo: repo, pageRepo: pageRepo, organizationUserRepo: organizationUserRepo}
+}
+
+func (s *PageAccessService) GetByPageID(pageID int64) ([]domain.PageAccess, error) {
+	entries, err := s.repo.GetByPageID(pageID)
+	return entries, err
+}
+
+// Set restricts the page to the entries. Restricted page without entries is visible
+// only to members who may restrict pages.
+func (s *PageAccessService) Set(pageID int64, restricted bool, entries []domain.PageAccess) error {
+	for _, entry := range entries {
+		set := 0
+		if entry.UserID.Valid {
+			set++
+		}
+		if entry.RoleID.Valid {
+			set++
+		}
+		if entry.Role.Valid {
+			if _, ok := domain.RolePermissions[entry.Role.String]; !ok {
+				return errors.New("unknown role " + entry.Role.String)
+			}
+			set++
+		}
+		if set != 1 {
+			return errors.New("access entry must have either user, role or custom role")
+		}
+	}
+
+	err := s.repo.Set(pageID, restricted, entries)
+	return err
+}
+
+// Restrictions returns pages of the organization hidden from the user of the claims.
+// Restrictions are inherited, so a page is hidden if any of its ancestors doesn't
+// allow the user. API keys never see restricted pages.
+func (s *PageAccessService) Restrictions(organizationID int64, claims *domain.Claims) (domain.PageRestrictions, error) {
+	if claims.Type == "superadmin" {
+		return domain.PageRestrictions{}, nil
+	}
+	for _, permission := range claims.Permissions[organizationID] {
+		if permission == domain.PermissionPagesRestrict {
+			return domain.PageRestrictions{}, nil
+		}
+	}
+
+	restricted, err := s.repo.IsRestricted(organizationID)
+	if err != nil || !restricted {
+		return domain.PageRestrictions{}, err
+	}
+
+	var viewer domain.PageViewer
+	if claims.APIKeyID == 0 {
+		viewer, err = s.viewer(organizationID, claims)
+		if err != nil {
+			return domain.PageRestrictions{}, err
+		}
+	}
+
+	pages, err := s.pageRepo.GetPages(&organizationID, "id", "parent_id", "restricted")
+	if err != nil {
+		return domain.PageRestrictions{}, err
+	}
+
+	entries, err := s.repo.GetByOrganizationID(organizationID)
+	if err != nil {
+		return domain.PageRestrictions{}, err
+	}
+
+	return pageRestrictions(pages, entries, viewer), nil
+}
+
+func (s *PageAccessService) viewer(organizationID int64, claims *domain.Claims) (domain.PageViewer, error) {
+	viewer := domain.PageViewer{UserID: claims.UserID, Role: claims.Roles[organizationID]}
+
+	organizationUsers, err := s.organizationUserRepo.GetByUserID(claims.UserID)
+	if err != nil {
+		return viewer, err
+	}
+	for _, organizationUser := range organizationUsers {
+		if organizationUser.OrganizationID == organizationID {
+			viewer.RoleID = organizationUser.RoleID
+		}
+	}
+
+	return viewer, nil
+}
+
+func pageRestrictions(pages []domain.Page, entries []domain.PageAccess, viewer domain.PageViewer) domain.PageRestrictions {
+	parents := make(map[int64]null.Int, len(pages))
+	restricted := make(map[int64]bool)
+	for _, page := range pages {
+		parents[page.ID] = page.ParentID
+		restricted[page.ID] = page.Restricted
+	}
+
+	allowed := make(map[int64]bool)
+	for _, entry := range entries {
+		if entry.Allows(viewer) {
+			allowed[entry.PageID] = true
+		}
+	}
+
+	hidden := make(map[int64]bool)
+	checked := make(map[int64]bool)
+	var check func(id int64) bool
+	check = func(id int64) bool {
+		if checked[id] {
+			return hidden[id]
+		}
+		checked[id] = true
+
+		if restricted[id] && !allowed[id] {
+			hidden[id] = true
+		} else if parent := parents[id]; parent.Valid {
+			hidden[id] = check(parent.Int64)
+		}
+
+		return hidden[id]
+	}
+
+	for id := range parents {
+		check(id)
+	}
+
+	for id, h := range hidden {
+		if !h {
+			delete(hidden, id)
+		}
+	}
+
+	return domain.PageRestrictions{Hidden: hidden}
+}
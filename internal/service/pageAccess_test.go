@@ -0,0 +1,72 @@
+package service
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestPageRestrictions(t *testing.T) {
+	// 1 -> 2 (restricted to crisis team) -> 3 -> 4 (restricted to user 7)
+	//   -> 5
+	pages := []domain.Page{
+		{ID: 1},
+		{ID: 2, ParentID: null.IntFrom(1), Restricted: true},
+		{ID: 3, ParentID: null.IntFrom(2)},
+		{ID: 4, ParentID: null.IntFrom(3), Restricted: true},
+		{ID: 5, ParentID: null.IntFrom(1)},
+	}
+	entries := []domain.PageAccess{
+		{PageID: 2, RoleID: null.IntFrom(9)},
+		{PageID: 2, UserID: null.IntFrom(7)},
+		{PageID: 4, UserID: null.IntFrom(7)},
+		{PageID: 4, Role: null.StringFrom("editor")},
+	}
+
+	tests := []struct {
+		name   string
+		viewer domain.PageViewer
+		hidden []int64
+	}{
+		{"member", domain.PageViewer{UserID: 1, Role: "user"}, []int64{2, 3, 4}},
+		{"custom role", domain.PageViewer{UserID: 2, Role: "user", RoleID: null.IntFrom(9)}, []int64{4}},
+		{"allowed user", domain.PageViewer{UserID: 7, Role: "user"}, []int64{}},
+		{"role of the child only", domain.PageViewer{UserID: 3, Role: "editor"}, []int64{2, 3, 4}},
+		{"api key", domain.PageViewer{}, []int64{2, 3, 4}},
+	}
+
+	for _, test := range tests {
+		restrictions := pageRestrictions(pages, entries, test.viewer)
+		if len(restrictions.Hidden) != len(test.hidden) {
+			t.Errorf("%s: expected hidden pages %v, got %v", test.name, test.hidden, restrictions.Hidden)
+			continue
+		}
+		for _, id := range test.hidden {
+			if restrictions.Allowed(id) {
+				t.Errorf("%s: page %d must be hidden", test.name, id)
+			}
+		}
+	}
+
+	visible := pageRestrictions(pages, entries, domain.PageViewer{UserID: 1, Role: "user"}).Filter(pages)
+	if len(visible) != 2 || visible[0].ID != 1 || visible[1].ID != 5 {
+		t.Errorf("Wrong visible pages %v", visible)
+	}
+}
+
+func TestSetPageAccessValidation(t *testing.T) {
+	s := NewPageAccessService(nil, nil, nil)
+
+	invalid := [][]domain.PageAccess{
+		{{}},
+		{{UserID: null.IntFrom(1), RoleID: null.IntFrom(2)}},
+		{{Role: null.StringFrom("crisis")}},
+	}
+	for _, entries := range invalid {
+		err := s.Set(1, true, entries)
+		if err == nil {
+			t.Errorf("Entries %+v must be invalid", entries)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/randstring"
+)
+
+var (
+	// Matches src and href attributes inside block content.
+	fileLinkRegexp = regexp.MustCompile(`(?:src|href)="([^"]+)"`)
+	// Matches top level folder of storage paths: common, organization/{id} or user/{id}.
+	storageRootRegexp = regexp.MustCompile(`^\/(?:common|organization\/[0-9]+|user\/[0-9]+)\/`)
+)
+
+// ExportTree returns current content of the page with all childrens and files from
+// storage which are used by the pages. Pages hidden by restrictions are left out.
+func (s *PageService) ExportTree(pageID int64, restrictions domain.PageRestrictions) (domain.PageTree, error) {
+	root, err := s.repo.GetTree(pageID)
+	if err != nil {
+		return domain.PageTree{}, err
+	}
+	root = pruneTree(root, restrictions)
+
+	tree := domain.PageTree{
+		Version: domain.PageTreeVersion,
+		Root:    root,
+		Files:   make(map[string]string),
+	}
+
+	for _, p := range treeFilePaths(root) {
+		if _, ok := tree.Files[p]; ok {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(storagePath(p))
+		if err != nil {
+			continue
+		}
+
+		tree.Files[p] = base64.StdEncoding.EncodeToString(data)
+	}
+
+	return tree, nil
+}
+
+// pruneTree drops hidden childrens of the node with their subtrees.
+func pruneTree(node domain.PageTreeNode, restrictions domain.PageRestrictions) domain.PageTreeNode {
+	childrens := make([]domain.PageTreeNode, 0, len(node.Childrens))
+	for _, child := range node.Childrens {
+		if restrictions.Allowed(child.Page.ID) {
+			childrens = append(childrens, pruneTree(child, restrictions))
+		}
+	}
+	node.Childrens = childrens
+
+	return node
+}
+
+// ImportTree saves files of the tree to the storage of the parent page organization and
+// creates copy of the pages under the parent.
+func (s *PageService) ImportTree(parentID int64, tree domain.PageTree) (int64, error) {
+	if tree.Version != domain.PageTreeVersion {
+		return 0, fmt.Errorf("unsupported page tree version %d", tree.Version)
+	}
+
+	parent, err := s.repo.GetByID(parentID)
+	if err != nil {
+		return 0, errors.New("parent page not found")
+	}
+
+	storageRoot := "/common/"
+	if parent.OrganizationID.Valid {
+		storageRoot = fmt.Sprintf("/organization/%d/", parent.OrganizationID.Int64)
+	}
+
+	// Only files used by the pages are saved.
+	used := make(map[string]bool)
+	for _, p := range treeFilePaths(tree.Root) {
+		used[p] = true
+	}
+
+	paths := make(map[string]string)
+	for oldPath, encoded := range tree.Files {
+		if !used[oldPath] {
+			continue
+		}
+
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return 0, fmt.Errorf("invalid content of file %s", oldPath)
+		}
+
+		newPath, err := saveImportedFile(storageRoot, oldPath, data)
+		if err != nil {
+			return 0, err
+		}
+
+		paths[oldPath] = newPath
+	}
+
+	root := replaceTreeFilePaths(tree.Root, paths)
+
+	id, err := s.repo.ImportTree(parentID, root)
+	return id, err
+}
+
+// saveImportedFile moves file into storage root keeping folders inside of the original
+// root. Existing files with the same content are reused.
+func saveImportedFile(storageRoot, oldPath string, data []byte) (string, error) {
+	newPath := storageRoot + storageRootRegexp.ReplaceAllString(path.Clean("/"+oldPath), "")
+	newPath = path.Clean(newPath)
+
+	if existing, err := ioutil.ReadFile(storagePath(newPath)); err == nil {
+		if bytes.Equal(existing, data) {
+			return newPath, nil
+		}
+
+		extension := path.Ext(newPath)
+		newPath = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(newPath, extension), randstring.RandAlphanumString(5), extension)
+	}
+
+	err := os.MkdirAll(path.Dir(storagePath(newPath)), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+
+	err = ioutil.WriteFile(storagePath(newPath), data, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return newPath, nil
+}
+
+// treeFilePaths returns storage paths of images, attached files and files linked inside
+// of the blocks.
+func treeFilePaths(node domain.PageTreeNode) []string {
+	paths := make([]string, 0)
+
+	add := func(src string) {
+		if src == "" {
+			return
+		}
+
+		u, err := url.Parse(src)
+		if err != nil || u.Path == "" || !storageRootRegexp.MatchString(u.Path) {
+			return
+		}
+
+		paths = append(paths, u.Path)
+	}
+
+	add(node.Page.Image.String)
+	add(node.Page.ImageHover.String)
+
+	for _, block := range node.Blocks {
+		add(block.Image.String)
+		add(block.ImageHover.String)
+
+		for _, text := range []string{block.Content.String, block.Readmore.String} {
+			for _, match := range fileLinkRegexp.FindAllStringSubmatch(text, -1) {
+				add(match[1])
+			}
+		}
+	}
+
+	if node.File != nil {
+		add(node.File.Path)
+	}
+
+	for _, children := range node.Childrens {
+		paths = append(paths, treeFilePaths(children)...)
+	}
+
+	return paths
+}
+
+func replaceTreeFilePaths(node domain.PageTreeNode, paths map[string]string) domain.PageTreeNode {
+	replace := func(text string) string {
+		for oldPath, newPath := range paths {
+			text = strings.Replace(text, oldPath, newPath, -1)
+		}
+		return text
+	}
+
+	node.Page.Image.String = replace(node.Page.Image.String)
+	node.Page.ImageHover.String = replace(node.Page.ImageHover.String)
+
+	blocks := make([]domain.Block, len(node.Blocks))
+	for i, block := range node.Blocks {
+		block.Image.String = replace(block.Image.String)
+		block.ImageHover.String = replace(block.ImageHover.String)
+		block.Content.String = replace(block.Content.String)
+		block.Readmore.String = replace(block.Readmore.String)
+		blocks[i] = block
+	}
+	node.Blocks = blocks
+
+	if node.File != nil {
+		file := *node.File
+		file.Path = replace(file.Path)
+		node.File = &file
+	}
+
+	childrens := make([]domain.PageTreeNode, len(node.Childrens))
+	for i, children := range node.Childrens {
+		childrens[i] = replaceTreeFilePaths(children, paths)
+	}
+	node.Childrens = childrens
+
+	return node
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestPageFilterPublished(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	s := NewPageService(repo.Page, repo.Revision)
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	rootID := testdb.RootPage(t, db, null.IntFrom(organizationID), "precautions")
+
+	publishedID, err := repo.Page.Create(&organizationID, rootID, "de", "content", "precautions", "visible", "Published", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.Page.Create(&organizationID, rootID, "de", "content", "precautions", "visible", "Never published", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.Page.Publish(publishedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	title := "Unpublished change"
+	err = repo.Page.Update(publishedID, nil, nil, &title, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	childrens, err := s.GetChildrens(rootID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := s.FilterPublished(childrens)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pages) != 1 {
+		t.Fatalf("Got %d published pages, want 1", len(pages))
+	}
+	if pages[0].ID != publishedID || pages[0].Title != "Published" {
+		t.Errorf("Got %+v, want published version of page %d", pages[0], publishedID)
+	}
+}
+
+func TestPagePublishedStructure(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	s := NewPageService(repo.Page, repo.Revision)
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	rootID := testdb.RootPage(t, db, null.IntFrom(organizationID), "precautions")
+
+	var sectionIDs []int64
+	for _, title := range []string{"First", "Second"} {
+		id, err := repo.Page.Create(&organizationID, rootID, "de", "content", "precautions", "visible", title, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.Page.Publish(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sectionIDs = append(sectionIDs, id)
+	}
+
+	pageID, err := repo.Page.Create(&organizationID, sectionIDs[0], "de", "content", "precautions", "visible", "Page", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Page.Publish(pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertChildrens := func(parentID int64, want ...int64) {
+		t.Helper()
+
+		childrens, err := s.GetPublishedChildrens(parentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(childrens) != len(want) {
+			t.Fatalf("Got %d published childrens of page %d, want %d", len(childrens), parentID, len(want))
+		}
+		for i, page := range childrens {
+			if page.ID != want[i] {
+				t.Errorf("Got page %d at position %d, want %d", page.ID, i, want[i])
+			}
+			if page.Status != "visible" {
+				t.Errorf("Got status %s for page %d, want visible", page.Status, page.ID)
+			}
+		}
+	}
+
+	err = repo.Page.UpdateSort(rootID, []int{int(sectionIDs[1]), int(sectionIDs[0])})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.Page.Update(pageID, &sectionIDs[1], nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertChildrens(rootID, sectionIDs[0], sectionIDs[1])
+	assertChildrens(sectionIDs[0], pageID)
+	assertChildrens(sectionIDs[1])
+
+	for _, id := range append(sectionIDs, pageID) {
+		err = repo.Page.Publish(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertChildrens(rootID, sectionIDs[1], sectionIDs[0])
+	assertChildrens(sectionIDs[0])
+	assertChildrens(sectionIDs[1], pageID)
+
+	err = repo.Page.Delete(pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertChildrens(sectionIDs[1], pageID)
+
+	err = repo.Page.Publish(pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertChildrens(sectionIDs[1])
+
+	_, err = repo.Page.GetByID(pageID)
+	if err == nil {
+		t.Error("Page still exists after publishing its deletion")
+	}
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/webauthn"
+)
+
+// passkeyChallengeTTL is the time in seconds to finish a ceremony. It matches the
+// timeout given to the browser.
+const passkeyChallengeTTL = webauthn.Timeout / 1000
+
+// Registration challenges are saved by user, login challenges by challenge token.
+type passkeyRegistrationCacheKey int64
+type passkeyLoginCacheKey string
+
+type PasskeyService struct {
+	repo        repository.Passkey
+	userRepo    repository.User
+	authService *AuthService
+	config      webauthn.Config
+	cache       *cache.MemoryCache
+	challengeMu sync.Mutex
+}
+
+func NewPasskeyService(repo repository.Passkey, userRepo repository.User, authService *AuthService, config webauthn.Config, cache *cache.MemoryCache) *PasskeyService {
+	return &PasskeyService{repo: repo, userRepo: userRepo, authService: authService, config: config, cache: cache}
+}
+
+func (s *PasskeyService) GetByUserID(userID int64) ([]domain.Passkey, error) {
+	return s.repo.GetByUserID(userID)
+}
+
+// BeginRegistration returns options for navigator.credentials.create as JSON.
+func (s *PasskeyService) BeginRegistration(userID int64) (string, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return "", err
+	}
+
+	passkeys, err := s.repo.GetByUserID(userID)
+	if err != nil {
+		return "", err
+	}
+	exclude := make([][]byte, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exclude = append(exclude, passkey.CredentialID)
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+	s.cache.Set(passkeyRegistrationCacheKey(userID), challenge, passkeyChallengeTTL)
+
+	displayName := strings.TrimSpace(user.Firstname.String + " " + user.Lastname.String)
+	if displayName == "" {
+		displayName = user.Email
+	}
+	options := s.config.CreationOptions(challenge, userHandle(userID), user.Email, displayName, exclude)
+
+	data, err := json.Marshal(options)
+	return string(data), err
+}
+
+// FinishRegistration verifies response of the authenticator and saves the passkey. Binary
+// values are base64url encoded.
+func (s *PasskeyService) FinishRegistration(userID int64, name, clientDataJSON, attestationObject string) (domain.Passkey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if utf8.RuneCountInString(name) > 64 {
+		return domain.Passkey{}, errors.New("name is too long")
+	}
+
+	value, err := s.takeChallenge(passkeyRegistrationCacheKey(userID))
+	if err != nil {
+		return domain.Passkey{}, err
+	}
+
+	rawClientData, err := base64.RawURLEncoding.DecodeString(clientDataJSON)
+	if err != nil {
+		return domain.Passkey{}, errors.New("invalid client data")
+	}
+	rawAttestation, err := base64.RawURLEncoding.DecodeString(attestationObject)
+	if err != nil {
+		return domain.Passkey{}, errors.New("invalid attestation object")
+	}
+
+	credential, err := s.config.VerifyRegistration(value.([]byte), rawClientData, rawAttestation)
+	if err != nil {
+		return domain.Passkey{}, err
+	}
+
+	_, err = s.repo.Create(domain.Passkey{
+		UserID:       userID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+		Name:         name,
+	})
+	if err != nil {
+		return domain.Passkey{}, err
+	}
+
+	return s.repo.GetByCredentialID(credential.ID)
+}
+
+// BeginLogin returns options for navigator.credentials.get. User isn't known until the
+// authenticator returns the credential.
+func (s *PasskeyService) BeginLogin() (domain.PasskeyLogin, error) {
+	token, err := randomToken()
+	if err != nil {
+		return domain.PasskeyLogin{}, err
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return domain.PasskeyLogin{}, err
+	}
+	s.cache.Set(passkeyLoginCacheKey(token), challenge, passkeyChallengeTTL)
+
+	data, err := json.Marshal(s.config.RequestOptions(challenge))
+	if err != nil {
+		return domain.PasskeyLogin{}, err
+	}
+
+	return domain.PasskeyLogin{ChallengeToken: token, Options: string(data)}, nil
+}
+
+// FinishLogin verifies the assertion and creates a session. Passkeys require user
+// verification on the authenticator, so they count as two factors and no further
+// challenge is created.
+func (s *PasskeyService) FinishLogin(challengeToken, credentialID, clientDataJSON, authenticatorData, signature string, info domain.RequestInfo) (domain.Tokens, error) {
+	value, err := s.takeChallenge(passkeyLoginCacheKey(challengeToken))
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	var raw [4][]byte
+	for i, encoded := range []string{credentialID, clientDataJSON, authenticatorData, signature} {
+		raw[i], err = base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return domain.Tokens{}, errors.New("invalid assertion")
+		}
+	}
+
+	passkey, err := s.repo.GetByCredentialID(raw[0])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.Tokens{}, errors.New("access denied")
+		}
+		return domain.Tokens{}, err
+	}
+
+	credential := webauthn.Credential{ID: passkey.CredentialID, PublicKey: passkey.PublicKey, SignCount: passkey.SignCount}
+	signCount, err := s.config.VerifyAssertion(value.([]byte), credential, raw[1], raw[2], raw[3])
+	if err != nil {
+		s.authService.recordLogin(passkey.UserID, domain.LoginMethodPasskey, err, info)
+		return domain.Tokens{}, errors.New("access denied")
+	}
+
+	user, err := s.userRepo.GetByID(passkey.UserID)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	err = s.authService.checkCanLogin(user)
+	if err != nil {
+		s.authService.recordLogin(user.ID, domain.LoginMethodPasskey, err, info)
+		return domain.Tokens{}, err
+	}
+
+	err = s.repo.UpdateSignCount(passkey.ID, signCount)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	return s.authService.createLoginSession(user, domain.LoginMethodPasskey, info)
+}
+
+func (s *PasskeyService) Delete(userID, id int64) error {
+	err := s.repo.Delete(userID, id)
+	if err == sql.ErrNoRows {
+		return errors.New("passkey not found")
+	}
+	return err
+}
+
+// takeChallenge returns the challenge and removes it, so every challenge is used once.
+func (s *PasskeyService) takeChallenge(key interface{}) (interface{}, error) {
+	s.challengeMu.Lock()
+	defer s.challengeMu.Unlock()
+
+	value, err := s.cache.Get(key)
+	if err != nil {
+		return nil, errors.New("invalid challenge")
+	}
+	s.cache.Delete(key)
+
+	return value, nil
+}
+
+// userHandle identifies the user on the authenticator. It must not contain personal
+// data, so ID of the user is used.
+func userHandle(userID int64) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
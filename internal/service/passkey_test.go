@@ -0,0 +1,32 @@
+package service
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/webauthn"
+)
+
+func TestPasskeyLoginChallenge(t *testing.T) {
+	config := webauthn.Config{RPID: "app.example.com", RPName: "Example", Origin: "https://app.example.com"}
+	s := NewPasskeyService(nil, nil, nil, config, cache.NewMemoryCache())
+
+	login, err := s.BeginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.ChallengeToken == "" || login.Options == "" {
+		t.Fatalf("Wrong login %+v", login)
+	}
+
+	// Invalid assertion still uses up the challenge.
+	_, err = s.FinishLogin(login.ChallengeToken, "!", "", "", "", domain.RequestInfo{})
+	if err == nil || err.Error() != "invalid assertion" {
+		t.Errorf("Expected invalid assertion, got %v", err)
+	}
+	_, err = s.FinishLogin(login.ChallengeToken, "", "", "", "", domain.RequestInfo{})
+	if err == nil || err.Error() != "invalid challenge" {
+		t.Errorf("Expected invalid challenge, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/ratelimit"
+)
+
+var ErrRateLimited = errors.New("too many requests, try again later")
+
+type rateLimits struct {
+	ip      *ratelimit.Limiter
+	account *ratelimit.Limiter
+	// failures limits failed attempts of the account, they are counted with Fail.
+	failures *ratelimit.Limiter
+}
+
+type RateLimitService struct {
+	actions map[string]rateLimits
+}
+
+// NewRateLimitService limits unauthenticated actions per client IP and per account.
+func NewRateLimitService(store ratelimit.Store) *RateLimitService {
+	return &RateLimitService{actions: map[string]rateLimits{
+		"login": {
+			ip:       ratelimit.New(store, 30, 15*time.Minute),
+			failures: ratelimit.New(store, 10, 15*time.Minute),
+		},
+		"signup": {
+			ip: ratelimit.New(store, 5, time.Hour),
+		},
+		"verification": {
+			ip:      ratelimit.New(store, 10, time.Hour),
+			account: ratelimit.New(store, 3, time.Hour),
+		},
+		"password_reset": {
+			ip:      ratelimit.New(store, 10, time.Hour),
+			account: ratelimit.New(store, 3, time.Hour),
+		},
+		"magic_link": {
+			ip:      ratelimit.New(store, 10, time.Hour),
+			account: ratelimit.New(store, 3, time.Hour),
+		},
+		"email_change": {
+			ip:      ratelimit.New(store, 10, time.Hour),
+			account: ratelimit.New(store, 3, time.Hour),
+		},
+	}}
+}
+
+// Check counts the action and returns ErrRateLimited if the client or the account is
+// over the limit. Account is usually email, it's not checked if empty.
+func (s *RateLimitService) Check(action, ip, account string) error {
+	limits, ok := s.actions[action]
+	if !ok {
+		return errors.New("unknown action")
+	}
+
+	if limits.ip != nil && ip != "" {
+		ok, _, err := limits.ip.Allow(action + ":ip:" + ip)
+		if err != nil {
+			// Requests are not blocked if the store fails.
+			log.Println("Failed to check rate limit: ", err)
+		} else if !ok {
+			return ErrRateLimited
+		}
+	}
+
+	if limits.account != nil && account != "" {
+		ok, _, err := limits.account.Allow(action + ":account:" + strings.ToLower(account))
+		if err != nil {
+			log.Println("Failed to check rate limit: ", err)
+		} else if !ok {
+			return ErrRateLimited
+		}
+	}
+
+	if limits.failures != nil && account != "" {
+		exceeded, _, err := limits.failures.Exceeded(action + ":failures:" + strings.ToLower(account))
+		if err != nil {
+			log.Println("Failed to check rate limit: ", err)
+		} else if exceeded {
+			return ErrRateLimited
+		}
+	}
+
+	return nil
+}
+
+// Fail counts failed attempt of the account. Successful attempts don't count against
+// the limit of failures, so users who log in often aren't limited.
+func (s *RateLimitService) Fail(action, account string) {
+	limits, ok := s.actions[action]
+	if !ok || limits.failures == nil || account == "" {
+		return
+	}
+
+	_, _, err := limits.failures.Allow(action + ":failures:" + strings.ToLower(account))
+	if err != nil {
+		log.Println("Failed to count failed attempt: ", err)
+	}
+}
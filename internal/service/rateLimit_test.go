@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/ratelimit"
+)
+
+func TestLoginRateLimitFailures(t *testing.T) {
+	s := NewRateLimitService(ratelimit.NewMemoryStore())
+
+	// Successful logins don't use up the limit of the account.
+	for i := 0; i < 20; i++ {
+		err := s.Check("login", "", "user@example.com")
+		if err != nil {
+			t.Fatalf("Login %d must be allowed, got %v", i+1, err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		s.Fail("login", "User@example.com")
+	}
+
+	err := s.Check("login", "", "user@example.com")
+	if err != ErrRateLimited {
+		t.Errorf("Expected rate limit after failed logins, got %v", err)
+	}
+
+	err = s.Check("login", "", "other@example.com")
+	if err != nil {
+		t.Errorf("Other accounts must not be limited, got %v", err)
+	}
+}
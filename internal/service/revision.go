@@ -0,0 +1,34 @@
+package service
+
+import (
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+)
+
+type RevisionService struct {
+	repo repository.Revision
+}
+
+func NewRevisionService(repo repository.Revision) *RevisionService {
+	return &RevisionService{repo: repo}
+}
+
+func (s *RevisionService) GetByID(id int64) (domain.Revision, error) {
+	revision, err := s.repo.GetByID(id)
+	return revision, err
+}
+
+func (s *RevisionService) GetByPageID(pageID int64) ([]domain.Revision, error) {
+	revisions, err := s.repo.GetByPageID(pageID)
+	return revisions, err
+}
+
+func (s *RevisionService) GetByBlockID(blockID int64) ([]domain.Revision, error) {
+	revisions, err := s.repo.GetByBlockID(blockID)
+	return revisions, err
+}
+
+func (s *RevisionService) Restore(id int64) error {
+	err := s.repo.Restore(id)
+	return err
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+)
+
+// Maximum length of custom role name.
+const roleNameMaxLength = 64
+
+type RoleService struct {
+	repo        repository.Role
+	authService Auth
+}
+
+func NewRoleService(repo repository.Role, authService Auth) *RoleService {
+	return &RoleService{repo: repo, authService: authService}
+}
+
+func (s *RoleService) GetByID(id int64) (domain.OrganizationRole, error) {
+	role, err := s.repo.GetByID(id)
+	return role, err
+}
+
+func (s *RoleService) GetByOrganizationID(organizationID int64) ([]domain.OrganizationRole, error) {
+	roles, err := s.repo.GetByOrganizationID(organizationID)
+	return roles, err
+}
+
+func (s *RoleService) Create(organizationID int64, name string, permissions []string) (int64, error) {
+	name, list, err := validateRole(name, permissions)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := s.repo.Create(organizationID, name, list)
+	return id, err
+}
+
+// Update changes the role. Members of the role get the new permissions on their next
+// request.
+func (s *RoleService) Update(id int64, name string, permissions []string) error {
+	name, list, err := validateRole(name, permissions)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.Update(id, name, list)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateMembers(id)
+
+	return nil
+}
+
+// Delete removes the role. Role which is still given to members can't be deleted.
+func (s *RoleService) Delete(id int64) error {
+	members, err := s.repo.GetMemberIDs(id)
+	if err != nil {
+		return err
+	}
+	if len(members) != 0 {
+		return errors.New("role is assigned to users")
+	}
+
+	err = s.repo.Delete(id)
+	return err
+}
+
+func (s *RoleService) Assign(organizationID, userID, id int64) error {
+	role, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if role.OrganizationID != organizationID {
+		return errors.New("role doesn't belong to the organization")
+	}
+
+	err = s.repo.Assign(organizationID, userID, id)
+	if err != nil {
+		return err
+	}
+
+	s.authService.InvalidateAccess(userID)
+
+	return nil
+}
+
+func (s *RoleService) invalidateMembers(id int64) {
+	members, err := s.repo.GetMemberIDs(id)
+	if err != nil {
+		return
+	}
+
+	for _, userID := range members {
+		s.authService.InvalidateAccess(userID)
+	}
+}
+
+// validateRole returns trimmed name and deduplicated comma separated permissions.
+func validateRole(name string, permissions []string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > roleNameMaxLength {
+		return "", "", errors.New("invalid role name")
+	}
+	if _, ok := domain.RolePermissions[name]; ok {
+		return "", "", errors.New("name of built-in role can't be used")
+	}
+	if len(permissions) == 0 {
+		return "", "", errors.New("role must have permissions")
+	}
+
+	list := make([]string, 0, len(permissions))
+	seen := make(map[string]bool)
+	for _, permission := range permissions {
+		if !domain.IsPermission(permission) {
+			return "", "", errors.New("unknown permission " + permission)
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			list = append(list, permission)
+		}
+	}
+
+	return name, strings.Join(list, ","), nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+)
+
+func TestValidateRole(t *testing.T) {
+	name, permissions, err := validateRole(" Redaktion ", []string{domain.PermissionPagesRead, domain.PermissionPagesWrite, domain.PermissionPagesRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Redaktion" || permissions != "pages.read,pages.write" {
+		t.Errorf("Wrong role %q with permissions %q", name, permissions)
+	}
+
+	invalid := []struct {
+		name        string
+		permissions []string
+	}{
+		{"", []string{domain.PermissionPagesRead}},
+		{"admin", []string{domain.PermissionPagesRead}},
+		{"Redaktion", []string{}},
+		{"Redaktion", []string{"pages.destroy"}},
+	}
+	for _, role := range invalid {
+		_, _, err := validateRole(role.name, role.permissions)
+		if err == nil {
+			t.Errorf("Role %q with %v must be invalid", role.name, role.permissions)
+		}
+	}
+}
+
+func TestCustomRolePermissions(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	signingKeys := NewSigningKeyService(repo.SigningKey, "EdDSA", []byte("application key"))
+	auth := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, signingKeys, nil, cache.NewMemoryCache())
+	roles := NewRoleService(repo.Role, auth)
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	otherOrganizationID := testdb.Organization(t, db, "Stadt", "basic")
+	userID := testdb.User(t, db, "user@example.com", "user")
+	testdb.OrganizationUser(t, db, organizationID, userID, "editor")
+
+	roleID, err := roles.Create(organizationID, "Adressen", []string{domain.PermissionAddressesRead, domain.PermissionAddressesManage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = roles.Assign(otherOrganizationID, userID, roleID)
+	if err == nil {
+		t.Error("Role of other organization must not be assigned")
+	}
+
+	err = roles.Assign(organizationID, userID, roleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := auth.GetAccess(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(access.Permissions[organizationID]) != 2 || access.Permissions[organizationID][1] != domain.PermissionAddressesManage {
+		t.Errorf("Member must have permissions of the custom role, got %v", access.Permissions[organizationID])
+	}
+
+	err = roles.Update(roleID, "Adressen", []string{domain.PermissionAddressesRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	access, err = auth.GetAccess(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(access.Permissions[organizationID]) != 1 {
+		t.Errorf("Updated permissions must apply immediately, got %v", access.Permissions[organizationID])
+	}
+
+	err = roles.Delete(roleID)
+	if err == nil {
+		t.Error("Assigned role must not be deleted")
+	}
+}
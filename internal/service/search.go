@@ -0,0 +1,172 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+)
+
+const (
+	searchLimit   = 50
+	snippetLength = 160
+)
+
+type SearchService struct {
+	repo        repository.Search
+	pageService *PageService
+}
+
+func NewSearchService(repo repository.Search, pageService *PageService) *SearchService {
+	return &SearchService{repo: repo, pageService: pageService}
+}
+
+// Search returns ranked hits with breadcrumbs and links. If published is true then
+// only content visible to readers is searched, and hits below unpublished or hidden
+// pages are dropped.
+func (s *SearchService) Search(organizationID *int64, query, languageTag string, published bool) ([]domain.SearchHit, error) {
+	hits, err := s.repo.Find(organizationID, query, languageTag, published, searchLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pages usually have several matching blocks, so parents are loaded only once.
+	pages := make(map[int64]*domain.Page)
+
+	result := make([]domain.SearchHit, 0, len(hits))
+	for _, hit := range hits {
+		breadcrumbs, err := s.breadcrumbs(hit.PageID, published, pages)
+		if err != nil {
+			return nil, err
+		}
+		if breadcrumbs == nil {
+			continue
+		}
+
+		hit.Breadcrumbs = breadcrumbs
+		hit.Snippet = snippet(hit.Content.String, query)
+
+		if hit.OrganizationID.Valid {
+			hit.Link = fmt.Sprintf("/organization/%d/page/%d", hit.OrganizationID.Int64, hit.PageID)
+		} else {
+			hit.Link = fmt.Sprintf("/admin/page/%d", hit.PageID)
+		}
+
+		if hit.BlockID.Valid {
+			hit.Link += fmt.Sprintf("#block-%d", hit.BlockID.Int64)
+		}
+
+		result = append(result, hit)
+	}
+
+	return result, nil
+}
+
+func (s *SearchService) Reindex(organizationID *int64) error {
+	err := s.repo.Reindex(organizationID)
+	return err
+}
+
+// breadcrumbs returns path from the root page to the page, including the page itself.
+// If published is true and any page on the path is not published or not visible, nil
+// is returned. Such pages are cached as nil.
+func (s *SearchService) breadcrumbs(pageID int64, published bool, pages map[int64]*domain.Page) ([]domain.Page, error) {
+	path := make([]domain.Page, 0)
+
+	id := pageID
+	for {
+		page, ok := pages[id]
+		if !ok {
+			p, err := s.pageService.GetByID(id)
+			if err != nil {
+				return nil, err
+			}
+
+			if published {
+				p, ok, err = s.pageService.GetPublished(p)
+				if err != nil {
+					return nil, err
+				}
+				if !ok || p.Status != "visible" {
+					pages[id] = nil
+					return nil, nil
+				}
+			}
+
+			page = &p
+			pages[id] = page
+		}
+		if page == nil {
+			return nil, nil
+		}
+
+		path = append([]domain.Page{*page}, path...)
+
+		if !page.ParentID.Valid {
+			break
+		}
+		id = page.ParentID.Int64
+	}
+
+	return path, nil
+}
+
+// snippet returns part of the text around the first occurrence of any query word.
+func snippet(text, query string) string {
+	runes := []rune(text)
+	if len(runes) <= snippetLength {
+		return text
+	}
+
+	lower := []rune(strings.ToLower(text))
+	words := strings.FieldsFunc(strings.ToLower(query), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+
+	position := 0
+	for _, word := range words {
+		if i := indexRunes(lower, []rune(word)); i >= 0 {
+			position = i
+			break
+		}
+	}
+
+	start := position - snippetLength/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+		start = end - snippetLength
+	}
+
+	result := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(runes) {
+		result += "…"
+	}
+
+	return result
+}
+
+func indexRunes(s, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestSearchPublishedAncestors(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	s := NewSearchService(repo.Search, NewPageService(repo.Page, repo.Revision))
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	rootID := testdb.RootPage(t, db, null.IntFrom(organizationID), "precautions")
+
+	parentID, err := repo.Page.Create(&organizationID, rootID, "de", "section", "precautions", "visible", "Parent", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	childID, err := repo.Page.Create(&organizationID, parentID, "de", "content", "precautions", "visible", "Evakuierung", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Page.Publish(childID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Child is published, but its parent never was.
+	hits, err := s.Search(&organizationID, "Evakuierung", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 0 {
+		t.Errorf("Got %d hits below unpublished parent, want 0", len(hits))
+	}
+
+	err = repo.Page.Publish(parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err = s.Search(&organizationID, "Evakuierung", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || len(hits[0].Breadcrumbs) != 3 {
+		t.Fatalf("Got %+v, want one hit with 3 breadcrumbs", hits)
+	}
+
+	status := "hidden"
+	err = repo.Page.Update(parentID, nil, &status, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Page.Publish(parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err = s.Search(&organizationID, "Evakuierung", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 0 {
+		t.Errorf("Got %d hits below hidden parent, want 0", len(hits))
+	}
+
+	// Editors still find the page.
+	hits, err = s.Search(&organizationID, "Evakuierung", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 {
+		t.Errorf("Got %d hits for editor, want 1", len(hits))
+	}
+}
@@ -1,18 +1,88 @@
 package service
 
 import (
+	"context"
+	"io"
 	"io/fs"
+	"log"
+	"time"
 
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/config"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/jwk"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/ratelimit"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/webauthn"
+	"github.com/dgrijalva/jwt-go"
 	"gopkg.in/guregu/null.v4"
 )
 
 type Auth interface {
-	Login(email, password string) (domain.Tokens, error)
-	RefreshToken(refreshToken string) (domain.Tokens, error)
-	Verify(token, password string) (domain.Tokens, error)
+	Login(email, password string, info domain.RequestInfo) (domain.Tokens, error)
+	RefreshToken(refreshToken string, info domain.RequestInfo) (domain.Tokens, error)
+	Verify(token, password string, info domain.RequestInfo) (domain.Tokens, error)
+	SendMagicLink(email string) error
+	LoginWithMagicLink(token string, info domain.RequestInfo) (domain.Tokens, error)
+	GetSessions(userID int64, currentSessionID string) ([]domain.Session, error)
+	RevokeSession(userID, id int64) error
+	RevokeOtherSessions(userID int64, currentSessionID string) error
+	RevokeUserSessions(userID int64) error
+	Logout(sessionID string) error
+	CleanupSessions() error
+	CleanupTokens() error
+	GetAccess(userID int64) (domain.UserAccess, error)
+	InvalidateAccess(userID int64)
+	RevokeAccess(userID int64) error
+	Unlock(userID int64) error
+	Impersonate(impersonatorID, userID int64) (domain.Tokens, error)
+	GetLoginHistory(userID, cursor int64, limit int) ([]domain.LoginEvent, error)
+	VerifyTwoFactor(challengeToken, code string, info domain.RequestInfo) (domain.Tokens, error)
+	GetTwoFactor(userID int64) (domain.TwoFactorStatus, error)
+	EnrollTOTP(userID int64) (domain.TOTPEnrollment, error)
+	EnrollTOTPWithChallenge(challengeToken string) (domain.TOTPEnrollment, error)
+	ConfirmTOTP(userID int64, code string) ([]string, error)
+	DisableTOTP(userID int64, code string) error
+	RegenerateRecoveryCodes(userID int64, code string) ([]string, error)
+	ResetTwoFactor(userID int64) error
+}
+
+type Passkey interface {
+	GetByUserID(userID int64) ([]domain.Passkey, error)
+	BeginRegistration(userID int64) (string, error)
+	FinishRegistration(userID int64, name, clientDataJSON, attestationObject string) (domain.Passkey, error)
+	BeginLogin() (domain.PasskeyLogin, error)
+	FinishLogin(challengeToken, credentialID, clientDataJSON, authenticatorData, signature string, info domain.RequestInfo) (domain.Tokens, error)
+	Delete(userID, id int64) error
+}
+
+type SSO interface {
+	GetConfig(organizationID int64) (domain.SSOConfig, error)
+	SaveConfig(config domain.SSOConfig) error
+	DeleteConfig(organizationID int64) error
+	LoginURL(organizationID int64, redirectURL string) (string, error)
+	Callback(code, state string, info domain.RequestInfo) (domain.Tokens, error)
+}
+
+type APIKey interface {
+	GetByID(id int64) (domain.APIKey, error)
+	GetByUserID(userID int64) ([]domain.APIKey, error)
+	GetByOrganizationID(organizationID int64) ([]domain.APIKey, error)
+	Create(userID, organizationID null.Int, name string, scopes []string, expiresAt null.Time, createdBy int64) (domain.NewAPIKey, error)
+	Authenticate(key string) (*domain.Claims, error)
+	Delete(id int64) error
+}
+
+type SigningKey interface {
+	Sign(claims jwt.Claims) (string, error)
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	JWKS() (jwk.Set, error)
+	Rotate() error
+}
+
+type RateLimit interface {
+	Check(action, ip, account string) error
+	Fail(action, account string)
 }
 
 type User interface {
@@ -27,7 +97,13 @@ type User interface {
 	CreateWithOrganization(firstname, lastname *string, email string, name, city, address, invoiceAddress, plan string, population int, role string) (userID int64, organizationID int64, err error)
 	CreateOrganizationUser(organizationID int64, email, role string) error
 	CreatePasswordReset(email string) error
-	Update(id int64, image, firstname, lastname, email, userType *string) error
+	ResendVerification(email string) error
+	ResetPassword(token, password string) (int64, error)
+	Update(id int64, image, firstname, lastname, userType *string) error
+	GetPendingEmailChange(userID int64) (domain.UserEmailChange, error)
+	RequestEmailChange(userID int64, email string) error
+	ConfirmEmailChange(token string) (domain.UserEmailChange, error)
+	RevertEmailChange(token string) (domain.UserEmailChange, error)
 	UpdatePassword(id int64, password string) error
 	UpdateOrganizationUser(organizationID, userID int64, role string) error
 	Delete(id int64) error
@@ -40,8 +116,12 @@ type Organization interface {
 	GetByUserID(userID int64) ([]domain.Organization, error)
 	Create(image *string, name, city, address, invoiceAddress, plan string, population int, userID int64) (int64, error)
 	Update(id int64, image, name, city, address, invoiceAddress, plan, status null.String, population null.Int) error
+	UpdateRequire2FA(id int64, require bool) error
 	Delete(id int64) error
-	CopyDefaultContent(organizationID int64, plan string) error
+	CopyDefaultContent(organizationID int64, plan, mode string) error
+	GetCopyJob(organizationID int64) (domain.ContentCopyJob, error)
+	RetryCopyJob(organizationID int64) error
+	SyncDefaultContent(organizationID int64, dryRun bool) ([]domain.SyncChange, error)
 }
 
 type OrganizationUser interface {
@@ -51,20 +131,35 @@ type OrganizationUser interface {
 type Page interface {
 	GetByID(id int64) (domain.Page, error)
 	GetChildrens(id int64) ([]domain.Page, error)
+	GetPublishedChildrens(id int64) ([]domain.Page, error)
 	GetDefaultPage(pageID int64) ([]domain.DefaultPage, error)
 	GetRootPages(organizationID *int64) ([]domain.Page, error)
 	GetPages(organizationID *int64) ([]domain.Page, error)
+	GetDrafts(organizationID int64) ([]domain.Page, error)
+	GetPublished(page domain.Page) (domain.Page, bool, error)
+	FilterPublished(pages []domain.Page) ([]domain.Page, error)
+	ExportTree(pageID int64, restrictions domain.PageRestrictions) (domain.PageTree, error)
+	ImportTree(parentID int64, tree domain.PageTree) (int64, error)
 	Create(organizationID *int64, parentID int64, languageTag, pageType, theme, status, title string, image, imageHover *string) (int64, error)
 	CreateDefaultPage(pageID int64, plans []string) error
 	Update(id int64, parentID *int64, status, title, image, imageHover *string) error
+	Publish(id int64) error
+	Discard(id int64) error
 	UpdateSort(parentID int64, sort []int) error
 	UpdateUpdatedAt(pageID int64) error
 	Delete(id int64) error
 	DeleteDefaultPage(pageID int64, plans []string) error
 }
 
+type PageAccess interface {
+	GetByPageID(pageID int64) ([]domain.PageAccess, error)
+	Set(pageID int64, restricted bool, entries []domain.PageAccess) error
+	Restrictions(organizationID int64, claims *domain.Claims) (domain.PageRestrictions, error)
+}
+
 type Block interface {
 	GetByPageID(pageID int64) ([]domain.Block, error)
+	GetPublishedByPageID(page domain.Page) ([]domain.Block, error)
 	GetByID(id int64) (domain.Block, error)
 	Create(pageID int64, title, blockType string, content, readmore, image, imageHover *string) (int64, error)
 	Update(id int64, title, content, readmore, image, imageHover *string) error
@@ -72,9 +167,22 @@ type Block interface {
 	Delete(id int64) error
 }
 
+type Revision interface {
+	GetByID(id int64) (domain.Revision, error)
+	GetByPageID(pageID int64) ([]domain.Revision, error)
+	GetByBlockID(blockID int64) ([]domain.Revision, error)
+	Restore(id int64) error
+}
+
+type Search interface {
+	Search(organizationID *int64, query, languageTag string, published bool) ([]domain.SearchHit, error)
+	Reindex(organizationID *int64) error
+}
+
 type FileBlock interface {
 	GetByID(id int64) (domain.FileBlock, error)
 	GetByPageID(pageID int64) (domain.FileBlock, error)
+	GetPublishedByPageID(page domain.Page) (domain.FileBlock, error)
 	Create(pageID int64, path string) (int64, error)
 	Update(id int64, path string) error
 }
@@ -82,8 +190,8 @@ type FileBlock interface {
 type File interface {
 	GetFiles(path string) ([]fs.FileInfo, error)
 	DeleteFiles(path string) error
-	CreateFolder(name string, path string) error
-	RenameFile(fullPath string, newFullPath string) error
+	CreateFolder(ctx context.Context, name string, path string) error
+	RenameFile(ctx context.Context, fullPath string, newFullPath string) error
 }
 
 type Address interface {
@@ -95,6 +203,20 @@ type Address interface {
 	Delete(id int64) error
 }
 
+type Role interface {
+	GetByID(id int64) (domain.OrganizationRole, error)
+	GetByOrganizationID(organizationID int64) ([]domain.OrganizationRole, error)
+	Create(organizationID int64, name string, permissions []string) (int64, error)
+	Update(id int64, name string, permissions []string) error
+	Delete(id int64) error
+	Assign(organizationID, userID, id int64) error
+}
+
+type Audit interface {
+	Get(organizationID *int64, filter domain.AuditFilter, cursor int64, limit int) ([]domain.AuditEntry, error)
+	Log(organizationID, actorID, impersonatorID null.Int, action, entityType string, entityID null.Int, before, after interface{}) error
+}
+
 type Email interface {
 	SendAdminNewOrganization(organizationID int64, plan, email, name, organizationRole, organizationName, website, city string, population int, phone, address, invoiceAddress, notes string) error
 	SendUserNewOrganization(organizationID int64, plan, email, name, organizationRole, organizationName, website, city string, population int, phone, address, invoiceAddress, notes string) error
@@ -102,34 +224,78 @@ type Email interface {
 	SendUserVerificatonLinkWithInvite(emailTo, token string, organizationName string) error
 	SendUserInvite(emailTo string, organizationID int64, organizationName string) error
 	SendPasswordResetLink(emailTo, token string) error
+	SendMagicLink(emailTo, token string) error
+	SendEmailChangeConfirmation(emailTo, token string) error
+	SendEmailChangeNotice(emailTo, newEmail, token string) error
+	SendEmailChangeTaken(emailTo string) error
+	SendAccountLocked(emailTo string, until time.Time) error
+	SendLoginAlert(emailTo string, at time.Time, info domain.RequestInfo, newDevice bool, failedLogins int) error
+}
+
+type Export interface {
+	Handbook(organizationID int64, languageTag string, restrictions domain.PageRestrictions) (domain.Handbook, error)
+	WriteHandbookHTML(w io.Writer, handbook domain.Handbook, filesPrefix string) error
+	WriteHandbookZIP(w io.Writer, handbook domain.Handbook) error
 }
 
 type Service struct {
 	Email
 	Auth
+	SSO
+	Passkey
+	APIKey
 	User
 	Organization
 	OrganizationUser
 	Page
+	PageAccess
 	Block
+	Revision
+	Search
 	FileBlock
 	File
 	Address
+	Audit
+	Export
+	RateLimit
+	SigningKey
+	Role
 }
 
 func NewService(repo *repository.Repository, cache *cache.MemoryCache) *Service {
 	emailService := NewEmailService()
+	signingKeyService := NewSigningKeyService(repo.SigningKey, config.Get().App.SigningAlgorithm, config.Get().App.Key)
+	authService := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, signingKeyService, emailService, cache)
 	organizationService := NewOrganizationService(repo.Organization)
+	pageService := NewPageService(repo.Page, repo.Revision)
+	blockService := NewBlockService(repo.Block, repo.Revision)
+	fileBlockService := NewFileBlockService(repo.FileBlock, repo.Revision)
+	addressService := NewAddressService(repo.Address)
+	webauthnConfig, err := webauthn.ConfigFromURL(config.Get().App.Client, "KRISENKOMPASS")
+	if err != nil {
+		log.Println("Failed to configure passkeys: ", err)
+	}
 	return &Service{
 		Email:            emailService,
-		Auth:             NewAuthService(repo.User, repo.OrganizationUser),
-		User:             NewUserService(repo.User, organizationService, emailService),
+		Auth:             authService,
+		SSO:              NewSSOService(repo.SSO, repo.User, repo.OrganizationUser, authService, cache),
+		Passkey:          NewPasskeyService(repo.Passkey, repo.User, authService, webauthnConfig, cache),
+		APIKey:           NewAPIKeyService(repo.APIKey, authService),
+		User:             NewUserService(repo.User, organizationService, emailService, authService),
 		Organization:     organizationService,
 		OrganizationUser: NewOrganizationUserService(repo.OrganizationUser),
-		Page:             NewPageService(repo.Page),
-		Block:            NewBlockService(repo.Block),
-		FileBlock:        NewFileBlockService(repo.FileBlock),
+		Page:             pageService,
+		PageAccess:       NewPageAccessService(repo.PageAccess, repo.Page, repo.OrganizationUser),
+		Block:            blockService,
+		Revision:         NewRevisionService(repo.Revision),
+		Search:           NewSearchService(repo.Search, pageService),
+		FileBlock:        fileBlockService,
 		File:             NewFileService(),
-		Address:          NewAddressService(repo.Address),
+		Address:          addressService,
+		Audit:            NewAuditService(repo.Audit),
+		Export:           NewExportService(organizationService, pageService, blockService, fileBlockService, addressService),
+		RateLimit:        NewRateLimitService(ratelimit.NewMemoryStore()),
+		SigningKey:       signingKeyService,
+		Role:             NewRoleService(repo.Role, authService),
 	}
 }
@@ -0,0 +1,383 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/jwk"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Access tokens are signed by one active key, which is replaced every signingKeyLifetime.
+// Next key is published signingKeyPublishAhead before it's used, so services caching our
+// JWKS already know it, and retired key stays published for signingKeyOverlap, which is
+// longer than AccessTokenTTL.
+const (
+	signingKeyLifetime     = 30 * 24 * time.Hour
+	signingKeyPublishAhead = 24 * time.Hour
+	signingKeyOverlap      = time.Hour
+	// signingKeysReload limits how long keys created by other instances stay unknown.
+	signingKeysReload = time.Minute
+	// Keys are reloaded early when a token has unknown key ID, but not more often than this.
+	signingKeysMinReload = 10 * time.Second
+)
+
+// DefaultSigningAlgorithm is used if the algorithm is not set in config.
+const DefaultSigningAlgorithm = "RS256"
+
+type signingKey struct {
+	domain.SigningKey
+	method     jwt.SigningMethod
+	privateKey interface{}
+	publicKey  interface{}
+}
+
+type SigningKeyService struct {
+	repo      repository.SigningKey
+	algorithm string
+	secret    []byte
+	mu        sync.RWMutex
+	keys      []signingKey
+	loadedAt  time.Time
+}
+
+// NewSigningKeyService creates keys with the algorithm, RS256 or EdDSA. Private keys
+// are encrypted with a key derived from appKey.
+func NewSigningKeyService(repo repository.SigningKey, algorithm string, appKey []byte) *SigningKeyService {
+	if algorithm == "" {
+		algorithm = DefaultSigningAlgorithm
+	}
+	secret := sha256.Sum256(appKey)
+
+	return &SigningKeyService{repo: repo, algorithm: algorithm, secret: secret[:]}
+}
+
+// Sign signs claims with the active key. Key ID is saved in "kid" header.
+func (s *SigningKeyService) Sign(claims jwt.Claims) (string, error) {
+	key, ok, err := s.activeKey()
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		// Keys are normally rotated in background, it's only needed on the first start.
+		err = s.Rotate()
+		if err != nil {
+			return "", err
+		}
+
+		key, ok, err = s.activeKey()
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", errors.New("no active signing key")
+		}
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.privateKey)
+}
+
+// Keyfunc returns public key for verification of the token, it's used with jwt.Parse.
+func (s *SigningKeyService) Keyfunc(token *jwt.Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	if keyID == "" {
+		return nil, errors.New("token has no key ID")
+	}
+
+	key, ok, err := s.keyByID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("wrong signing method")
+	}
+
+	return key.publicKey, nil
+}
+
+// JWKS returns public keys which can be used to verify tokens, including the next key.
+func (s *SigningKeyService) JWKS() (jwk.Set, error) {
+	keys, err := s.load(false)
+	if err != nil {
+		return jwk.Set{}, err
+	}
+
+	set := jwk.Set{Keys: make([]jwk.Key, 0, len(keys))}
+	for _, key := range keys {
+		publicKey, err := jwk.New(key.ID, key.Algorithm, key.publicKey)
+		if err != nil {
+			return jwk.Set{}, err
+		}
+		set.Keys = append(set.Keys, publicKey)
+	}
+
+	return set, nil
+}
+
+// Rotate creates the active key if there is none and the next key when the active one
+// is going to retire. Expired keys are deleted. It's called periodically by every instance.
+func (s *SigningKeyService) Rotate() error {
+	keys, err := s.load(true)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var active *signingKey
+	hasNext := false
+	for i := range keys {
+		if keys[i].ActiveFrom.After(now) {
+			hasNext = true
+		} else if active == nil && now.Before(keys[i].RetireAt) {
+			active = &keys[i]
+		}
+	}
+
+	if active == nil {
+		key, err := s.create(now)
+		if err != nil {
+			return err
+		}
+		log.Printf("Created signing key %s", key.ID)
+		active = &key
+	}
+
+	if !hasNext && active.RetireAt.Sub(now) < signingKeyPublishAhead {
+		key, err := s.create(active.RetireAt)
+		if err != nil {
+			return err
+		}
+		log.Printf("Created signing key %s active from %s", key.ID, key.ActiveFrom.Format(time.RFC3339))
+	}
+
+	count, err := s.repo.DeleteExpired()
+	if err != nil {
+		return err
+	}
+	if count != 0 {
+		log.Printf("Deleted %d expired signing keys", count)
+	}
+
+	_, err = s.load(true)
+	return err
+}
+
+func (s *SigningKeyService) activeKey() (signingKey, bool, error) {
+	keys, err := s.load(false)
+	if err != nil {
+		return signingKey{}, false, err
+	}
+
+	// Keys are sorted by activation, newest first.
+	now := time.Now()
+	for _, key := range keys {
+		if !key.ActiveFrom.After(now) && now.Before(key.RetireAt) {
+			return key, true, nil
+		}
+	}
+
+	return signingKey{}, false, nil
+}
+
+func (s *SigningKeyService) keyByID(keyID string) (signingKey, bool, error) {
+	keys, err := s.load(false)
+	if err != nil {
+		return signingKey{}, false, err
+	}
+
+	for _, key := range keys {
+		if key.ID == keyID {
+			return key, true, nil
+		}
+	}
+
+	// Key could be just created by another instance.
+	s.mu.RLock()
+	loadedAt := s.loadedAt
+	s.mu.RUnlock()
+	if time.Since(loadedAt) < signingKeysMinReload {
+		return signingKey{}, false, nil
+	}
+
+	keys, err = s.load(true)
+	if err != nil {
+		return signingKey{}, false, err
+	}
+
+	for _, key := range keys {
+		if key.ID == keyID {
+			return key, true, nil
+		}
+	}
+
+	return signingKey{}, false, nil
+}
+
+// load returns published keys. Keys are cached for signingKeysReload unless force is set.
+func (s *SigningKeyService) load(force bool) ([]signingKey, error) {
+	s.mu.RLock()
+	keys, loadedAt := s.keys, s.loadedAt
+	s.mu.RUnlock()
+	if !force && time.Since(loadedAt) < signingKeysReload {
+		return keys, nil
+	}
+
+	rows, err := s.repo.GetPublished()
+	if err != nil {
+		return nil, err
+	}
+
+	keys = make([]signingKey, 0, len(rows))
+	for _, row := range rows {
+		key, err := s.decode(row)
+		if err != nil {
+			// Key encrypted with another application key can't be used, but other keys can.
+			log.Printf("Failed to decode signing key %s: %v", row.ID, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	s.mu.Lock()
+	s.keys, s.loadedAt = keys, time.Now()
+	s.mu.Unlock()
+
+	return keys, nil
+}
+
+func (s *SigningKeyService) create(activeFrom time.Time) (signingKey, error) {
+	var privateKey interface{}
+	switch s.algorithm {
+	case "RS256":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return signingKey{}, err
+		}
+		privateKey = key
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return signingKey{}, err
+		}
+		privateKey = key
+	default:
+		return signingKey{}, errors.New("unsupported signing algorithm")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	encrypted, err := s.encrypt(der)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	keyID, err := randomToken()
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	row := domain.SigningKey{
+		ID:         keyID,
+		Algorithm:  s.algorithm,
+		PrivateKey: encrypted,
+		ActiveFrom: activeFrom,
+		RetireAt:   activeFrom.Add(signingKeyLifetime),
+		ExpiresAt:  activeFrom.Add(signingKeyLifetime + signingKeyOverlap),
+	}
+	err = s.repo.Create(row)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	return s.decode(row)
+}
+
+func (s *SigningKeyService) decode(row domain.SigningKey) (signingKey, error) {
+	der, err := s.decrypt(row.PrivateKey)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	key := signingKey{SigningKey: row, privateKey: privateKey}
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		key.method = jwt.SigningMethodRS256
+		key.publicKey = &privateKey.PublicKey
+	case ed25519.PrivateKey:
+		key.method = jwk.SigningMethodEdDSA
+		key.publicKey = privateKey.Public()
+	default:
+		return signingKey{}, errors.New("unsupported key type")
+	}
+
+	if key.method.Alg() != row.Algorithm {
+		return signingKey{}, errors.New("key doesn't match the algorithm")
+	}
+
+	return key, nil
+}
+
+// encrypt seals data with AES-GCM, nonce is prepended to the result.
+func (s *SigningKeyService) encrypt(data []byte) ([]byte, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func (s *SigningKeyService) decrypt(data []byte) ([]byte, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted key is too short")
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func (s *SigningKeyService) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestSigningKeys(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+
+	for _, algorithm := range []string{"RS256", "EdDSA"} {
+		s := NewSigningKeyService(repo.SigningKey, algorithm, []byte("application key"))
+
+		signed, err := s.Sign(domain.Claims{UserID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := jwt.ParseWithClaims(signed, &domain.Claims{}, s.Keyfunc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Method.Alg() != algorithm || token.Claims.(*domain.Claims).UserID != 1 {
+			t.Errorf("Got %s token with %+v", token.Method.Alg(), token.Claims)
+		}
+
+		set, err := s.JWKS()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, key := range set.Keys {
+			found = found || key.KeyID == token.Header["kid"]
+		}
+		if !found {
+			t.Errorf("Signing key %s is not published", token.Header["kid"])
+		}
+
+		// Keys can't be used without the application key.
+		other := NewSigningKeyService(repo.SigningKey, algorithm, []byte("other key"))
+		_, err = jwt.ParseWithClaims(signed, &domain.Claims{}, other.Keyfunc)
+		if err == nil {
+			t.Error("Token must not be verified with keys encrypted by other application key")
+		}
+
+		_, err = db.Exec("DELETE FROM signing_keys")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	s := NewSigningKeyService(repo.SigningKey, "EdDSA", []byte("application key"))
+
+	// Active key retires in an hour.
+	now := time.Now().Truncate(time.Second)
+	current, err := s.create(now.Add(time.Hour - signingKeyLifetime))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := repo.SigningKey.GetPublished()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Got %d keys, want active and next key", len(keys))
+	}
+	if !keys[0].ActiveFrom.Equal(current.RetireAt) {
+		t.Errorf("Next key is active from %s, want %s", keys[0].ActiveFrom, current.RetireAt)
+	}
+
+	// Current key is used till it retires.
+	signed, err := s.Sign(domain.Claims{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := jwt.ParseWithClaims(signed, &domain.Claims{}, s.Keyfunc)
+	if token.Header["kid"] != current.ID {
+		t.Errorf("Token is signed with %s, want %s", token.Header["kid"], current.ID)
+	}
+
+	// Rotation is idempotent.
+	err = s.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err = repo.SigningKey.GetPublished()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("Got %d keys after second rotation, want 2", len(keys))
+	}
+}
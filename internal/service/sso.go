@@ -0,0 +1,350 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/config"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/oidc"
+	"gopkg.in/guregu/null.v4"
+)
+
+// ssoStateTTL is the time in seconds the user has to log in at the identity provider.
+const ssoStateTTL = 600
+
+type ssoStateCacheKey string
+
+// ssoState is saved between redirect to the provider and the callback.
+type ssoState struct {
+	OrganizationID int64
+	RedirectURL    string
+	Nonce          string
+	CodeVerifier   string
+}
+
+// roleRanks orders organization roles from the least to the most privileged.
+var roleRanks = map[string]int{"user": 1, "editor": 2, "admin": 3, "owner": 4}
+
+type SSOService struct {
+	repo                 repository.SSO
+	userRepo             repository.User
+	organizationUserRepo repository.OrganizationUser
+	authService          *AuthService
+	cache                *cache.MemoryCache
+	// client is used for requests to identity providers. Default client is used if nil.
+	client *http.Client
+}
+
+func NewSSOService(repo repository.SSO, userRepo repository.User, organizationUserRepo repository.OrganizationUser, authService *AuthService, cache *cache.MemoryCache) *SSOService {
+	return &SSOService{repo: repo, userRepo: userRepo, organizationUserRepo: organizationUserRepo, authService: authService, cache: cache}
+}
+
+func (s *SSOService) GetConfig(organizationID int64) (domain.SSOConfig, error) {
+	config, err := s.repo.GetConfig(organizationID)
+	return config, err
+}
+
+func (s *SSOService) SaveConfig(config domain.SSOConfig) error {
+	// Provider configuration is fetched by the server, so plain http is allowed only for
+	// local provider during development.
+	issuer, err := url.Parse(config.Issuer)
+	if err != nil || issuer.Host == "" || (issuer.Scheme != "https" && !(isLocalhost(issuer) && isDevelopment())) {
+		return errors.New("issuer must be https URL")
+	}
+	if config.ClientID == "" {
+		return errors.New("client ID is required")
+	}
+
+	if config.ClientSecret == "" {
+		_, err := s.repo.GetConfig(config.OrganizationID)
+		if err == sql.ErrNoRows {
+			return errors.New("client secret is required")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.RoleMapping == "" {
+		config.RoleMapping = "{}"
+	}
+	roles, err := config.Roles()
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if _, ok := roleRanks[role]; !ok {
+			return errors.New("invalid role in role mapping: " + role)
+		}
+	}
+
+	return s.repo.SaveConfig(config)
+}
+
+func (s *SSOService) DeleteConfig(organizationID int64) error {
+	err := s.repo.DeleteConfig(organizationID)
+	return err
+}
+
+// LoginURL returns URL of the provider login page. Provider redirects back to redirectURL.
+func (s *SSOService) LoginURL(organizationID int64, redirectURL string) (string, error) {
+	config, err := s.repo.GetConfig(organizationID)
+	if err != nil || !config.Enabled {
+		return "", errors.New("single sign-on is not configured")
+	}
+
+	provider, err := oidc.NewProvider(s.client, config.Issuer, config.ClientID, config.ClientSecret, redirectURL)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.cache.Set(ssoStateCacheKey(state), ssoState{
+		OrganizationID: organizationID,
+		RedirectURL:    redirectURL,
+		Nonce:          nonce,
+		CodeVerifier:   codeVerifier,
+	}, ssoStateTTL)
+
+	return provider.AuthCodeURL(state, nonce, codeVerifier), nil
+}
+
+// Callback finishes login at the provider and creates session of the user. Locked users
+// are refused and second factor is required like for password login.
+func (s *SSOService) Callback(code, state string, info domain.RequestInfo) (domain.Tokens, error) {
+	userID, err := s.authenticate(code, state)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	err = s.authService.checkCanLogin(user)
+	if err != nil {
+		s.authService.recordLogin(user.ID, domain.LoginMethodSSO, err, info)
+		return domain.Tokens{}, err
+	}
+
+	return s.authService.startSession(user, domain.LoginMethodSSO, info)
+}
+
+// authenticate redeems the code and provisions the user into the organization.
+func (s *SSOService) authenticate(code, state string) (int64, error) {
+	value, err := s.cache.Get(ssoStateCacheKey(state))
+	if err != nil {
+		return 0, errors.New("invalid state")
+	}
+	// State can be used once.
+	s.cache.Delete(ssoStateCacheKey(state))
+	st := value.(ssoState)
+
+	config, err := s.repo.GetConfig(st.OrganizationID)
+	if err != nil || !config.Enabled {
+		return 0, errors.New("single sign-on is not configured")
+	}
+
+	provider, err := oidc.NewProvider(s.client, config.Issuer, config.ClientID, config.ClientSecret, st.RedirectURL)
+	if err != nil {
+		return 0, err
+	}
+
+	idToken, err := provider.Exchange(code, st.CodeVerifier, st.Nonce)
+	if err != nil {
+		log.Println("Failed to exchange SSO code: ", err)
+		return 0, errors.New("access denied")
+	}
+
+	role, err := mapRole(config, idToken.Claims)
+	if err != nil {
+		return 0, err
+	}
+
+	// Permissions of the admin could be reduced after the config was saved.
+	err = s.checkGrant(config, role)
+	if err != nil {
+		log.Printf("SSO of organization %d can't grant role %s: %v", config.OrganizationID, role, err)
+		return 0, errors.New("access denied")
+	}
+
+	userID, err := s.findUser(idToken, st.OrganizationID)
+	if err != nil {
+		return 0, err
+	}
+
+	user := domain.User{
+		Firstname: null.NewString(idToken.GivenName, idToken.GivenName != ""),
+		Lastname:  null.NewString(idToken.FamilyName, idToken.FamilyName != ""),
+		Email:     strings.ToLower(idToken.Email),
+	}
+	identity := domain.UserIdentity{Issuer: idToken.Issuer, Subject: idToken.Subject}
+
+	userID, err = s.repo.ProvisionUser(userID, user, identity, st.OrganizationID, role)
+	if err != nil {
+		return 0, err
+	}
+
+	s.authService.InvalidateAccess(userID)
+
+	return userID, nil
+}
+
+// findUser returns ID of the user linked to the identity, or of the member of the
+// organization with the same email if the provider verified it. Provider is chosen by
+// organization admin, so other accounts are never linked by email and superadmins can't
+// log in with SSO at all. 0 is returned if a new user has to be created.
+func (s *SSOService) findUser(idToken oidc.IDToken, organizationID int64) (int64, error) {
+	identity, err := s.repo.GetIdentity(idToken.Issuer, idToken.Subject)
+	if err == nil {
+		user, err := s.userRepo.GetByID(identity.UserID)
+		if err != nil {
+			return 0, err
+		}
+		if user.Type == "superadmin" {
+			return 0, errors.New("access denied")
+		}
+		return user.ID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	if idToken.Email == "" {
+		return 0, errors.New("identity provider didn't return email")
+	}
+
+	user, err := s.userRepo.GetByEmail(strings.ToLower(idToken.Email))
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Otherwise anyone who can set email at the provider could take over the account.
+	if !idToken.EmailVerified {
+		return 0, errors.New("email is not verified by identity provider")
+	}
+
+	if user.Type == "superadmin" {
+		return 0, errors.New("access denied")
+	}
+
+	organizationUsers, err := s.organizationUserRepo.GetByUserID(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	for _, organizationUser := range organizationUsers {
+		if organizationUser.OrganizationID == organizationID {
+			return user.ID, nil
+		}
+	}
+
+	return 0, errors.New("user with this email is not a member of the organization")
+}
+
+// checkGrant checks that the user who saved the config still has all permissions of the
+// role in the organization, like when roles are assigned in the application.
+func (s *SSOService) checkGrant(config domain.SSOConfig, role string) error {
+	if !config.UpdatedBy.Valid {
+		return errors.New("config has to be saved again")
+	}
+
+	user, err := s.userRepo.GetByID(config.UpdatedBy.Int64)
+	if err != nil {
+		return err
+	}
+	if user.Type == "superadmin" {
+		return nil
+	}
+
+	organizationUsers, err := s.organizationUserRepo.GetByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+
+	own := make(map[string]bool)
+	for _, organizationUser := range organizationUsers {
+		if organizationUser.OrganizationID == config.OrganizationID {
+			for _, permission := range organizationUser.Permissions() {
+				own[permission] = true
+			}
+		}
+	}
+
+	for _, permission := range domain.RolePermissions[role] {
+		if !own[permission] {
+			return errors.New("permission " + permission + " can't be granted")
+		}
+	}
+
+	return nil
+}
+
+// mapRole returns the most privileged role mapped from the role claim.
+func mapRole(config domain.SSOConfig, claims map[string]interface{}) (string, error) {
+	var mapping map[string]string
+	err := json.Unmarshal([]byte(config.RoleMapping), &mapping)
+	if err != nil {
+		return "", err
+	}
+
+	var values []string
+	switch value := claims[config.RoleClaim].(type) {
+	case string:
+		values = []string{value}
+	case []interface{}:
+		for _, v := range value {
+			if v, ok := v.(string); ok {
+				values = append(values, v)
+			}
+		}
+	}
+
+	role := ""
+	for _, value := range values {
+		if mapped, ok := mapping[value]; ok && roleRanks[mapped] > roleRanks[role] {
+			role = mapped
+		}
+	}
+
+	if role == "" {
+		if !config.DefaultRole.Valid {
+			return "", errors.New("access denied")
+		}
+		role = config.DefaultRole.String
+	}
+
+	return role, nil
+}
+
+func isDevelopment() bool {
+	return config.Get().App.Mode == "development"
+}
+
+func isLocalhost(u *url.URL) bool {
+	host := u.Hostname()
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
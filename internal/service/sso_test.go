@@ -0,0 +1,215 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/oidc/oidctest"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestSSOProvisioning(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	c := cache.NewMemoryCache()
+	auth := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, nil, nil, c)
+	s := NewSSOService(repo.SSO, repo.User, repo.OrganizationUser, auth, c)
+
+	idp, err := oidctest.NewServer("krisenkompass", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idp.Close()
+
+	// Test provider runs on plain http, which only development mode accepts.
+	organizationID := testdb.Organization(t, db, "Kanton", "pro")
+	adminID := testdb.User(t, db, "admin@example.com", "user")
+	testdb.OrganizationUser(t, db, organizationID, adminID, "admin")
+	err = repo.SSO.SaveConfig(domain.SSOConfig{
+		OrganizationID: organizationID,
+		Issuer:         idp.URL,
+		ClientID:       "krisenkompass",
+		ClientSecret:   "secret",
+		RoleClaim:      "groups",
+		RoleMapping:    `{"krisenstab": "editor", "fuehrung": "admin", "eigentuemer": "owner"}`,
+		Enabled:        true,
+		UpdatedBy:      null.IntFrom(adminID),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(claims map[string]interface{}) (int64, error) {
+		idp.SetClaims(claims)
+
+		loginURL, err := s.LoginURL(organizationID, "https://api.example.com/sso/callback")
+		if err != nil {
+			t.Fatal(err)
+		}
+		callback, err := idp.Authorize(loginURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s.authenticate(callback.Query().Get("code"), callback.Query().Get("state"))
+	}
+
+	userID, err := login(map[string]interface{}{
+		"sub":            "anna",
+		"email":          "Anna@Example.com",
+		"email_verified": true,
+		"given_name":     "Anna",
+		"groups":         []interface{}{"krisenstab", "fuehrung"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := repo.User.GetByEmail("anna@example.com")
+	if err != nil || user.ID != userID || user.Firstname.String != "Anna" {
+		t.Fatalf("User must be provisioned: %+v, %v", user, err)
+	}
+	access, err := auth.GetAccess(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access.Roles[organizationID] != "admin" {
+		t.Errorf("Most privileged mapped role expected, got %q", access.Roles[organizationID])
+	}
+
+	// Next login finds the user by identity and updates the role.
+	secondID, err := login(map[string]interface{}{
+		"sub":    "anna",
+		"email":  "anna@example.com",
+		"groups": []interface{}{"krisenstab"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondID != userID {
+		t.Errorf("Same user expected, got %d and %d", userID, secondID)
+	}
+	access, err = auth.GetAccess(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access.Roles[organizationID] != "editor" {
+		t.Errorf("Role must follow the provider, got %q", access.Roles[organizationID])
+	}
+
+	// Existing account is not linked by unverified email.
+	testdb.User(t, db, "existing@example.com", "user")
+	_, err = login(map[string]interface{}{
+		"sub":    "mallory",
+		"email":  "existing@example.com",
+		"groups": "krisenstab",
+	})
+	if err == nil {
+		t.Errorf("Unverified email must not be linked to existing user")
+	}
+
+	// Admin who saved the config can't make anyone owner.
+	_, err = login(map[string]interface{}{
+		"sub":    "anna",
+		"email":  "anna@example.com",
+		"groups": []interface{}{"eigentuemer"},
+	})
+	if err == nil {
+		t.Errorf("Role with more permissions than the admin has must be denied")
+	}
+
+	// Verified email links only members of the organization.
+	memberID := testdb.User(t, db, "member@example.com", "user")
+	testdb.OrganizationUser(t, db, organizationID, memberID, "user")
+	linkedID, err := login(map[string]interface{}{
+		"sub":            "member",
+		"email":          "member@example.com",
+		"email_verified": true,
+		"groups":         "krisenstab",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linkedID != memberID {
+		t.Errorf("Member must be linked, got user %d, want %d", linkedID, memberID)
+	}
+
+	testdb.User(t, db, "outsider@example.com", "user")
+	testdb.User(t, db, "root@example.com", "superadmin")
+	for _, email := range []string{"outsider@example.com", "root@example.com"} {
+		_, err = login(map[string]interface{}{
+			"sub":            email,
+			"email":          email,
+			"email_verified": true,
+			"groups":         "krisenstab",
+		})
+		if err == nil {
+			t.Errorf("Account %s must not be linked by email", email)
+		}
+	}
+
+	_, err = login(map[string]interface{}{
+		"sub":            "bob",
+		"email":          "bob@example.com",
+		"email_verified": true,
+	})
+	if err == nil {
+		t.Errorf("User without mapped role must be denied")
+	}
+}
+
+func TestSSOIssuer(t *testing.T) {
+	s := NewSSOService(nil, nil, nil, nil, nil)
+
+	for _, issuer := range []string{"http://idp.example.com", "ftp://idp.example.com", "https://"} {
+		err := s.SaveConfig(domain.SSOConfig{Issuer: issuer, ClientID: "krisenkompass"})
+		if err == nil || err.Error() != "issuer must be https URL" {
+			t.Errorf("Issuer %q must be refused, got %v", issuer, err)
+		}
+	}
+}
+
+func TestSSOConfigRoles(t *testing.T) {
+	config := domain.SSOConfig{
+		RoleMapping: `{"staff": "user", "lead": "admin"}`,
+		DefaultRole: null.StringFrom("editor"),
+	}
+
+	roles, err := config.Roles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(roles)
+	if strings.Join(roles, ",") != "admin,editor,user" {
+		t.Errorf("Got roles %v", roles)
+	}
+
+	config.RoleMapping = "[]"
+	_, err = config.Roles()
+	if err == nil {
+		t.Error("Role mapping must be JSON object")
+	}
+}
+
+func TestMapRole(t *testing.T) {
+	config := domain.SSOConfig{
+		RoleClaim:   "roles",
+		RoleMapping: `{"staff": "user", "lead": "admin"}`,
+		DefaultRole: null.StringFrom("user"),
+	}
+
+	role, err := mapRole(config, map[string]interface{}{"roles": "lead"})
+	if err != nil || role != "admin" {
+		t.Errorf("Expected admin, got %q, %v", role, err)
+	}
+
+	role, err = mapRole(config, map[string]interface{}{"roles": []interface{}{"other"}})
+	if err != nil || role != "user" {
+		t.Errorf("Expected default role, got %q, %v", role, err)
+	}
+}
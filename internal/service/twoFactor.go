@@ -0,0 +1,409 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/totp"
+)
+
+const totpIssuer = "Krisenkompass"
+
+// challengeTTL is the lifetime of the login challenge in seconds.
+const challengeTTL = 300
+
+// maxChallengeAttempts limits number of codes which can be tried with one challenge.
+const maxChallengeAttempts = 5
+
+const recoveryCodesCount = 10
+
+type challengeCacheKey string
+
+var errInvalidCode = errors.New("invalid code")
+
+// challenge is a login which passed the first factor and waits for the second one.
+// Method is the login method of the first factor. Secret is the TOTP secret generated
+// for enrollment, it's kept for the lifetime of the challenge.
+type challenge struct {
+	UserID    int64
+	Method    string
+	Enroll    bool
+	Secret    string
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+// startSession creates a session or a challenge if the user has to pass second factor.
+// Login counts as successful only once the session is created.
+func (s *AuthService) startSession(user domain.User, method string, info domain.RequestInfo) (domain.Tokens, error) {
+	userTOTP, err := s.twoFactorRepo.GetTOTP(user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return domain.Tokens{}, err
+	}
+	if err == nil && userTOTP.EnabledAt.Valid {
+		return s.createChallenge(user.ID, method, false, info)
+	}
+
+	required, err := s.twoFactorRepo.IsTwoFactorRequired(user.ID)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	if required {
+		return s.createChallenge(user.ID, method, true, info)
+	}
+
+	return s.createLoginSession(user, method, info)
+}
+
+func (s *AuthService) createChallenge(userID int64, method string, enroll bool, info domain.RequestInfo) (domain.Tokens, error) {
+	token, err := randomToken()
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	s.cache.Set(challengeCacheKey(token), challenge{
+		UserID:    userID,
+		Method:    method,
+		Enroll:    enroll,
+		ExpiresAt: time.Now().Add(challengeTTL * time.Second),
+	}, challengeTTL)
+
+	s.recordChallenge(userID, method, info)
+
+	tokens := domain.Tokens{ChallengeToken: token, TwoFactor: "required"}
+	if enroll {
+		tokens.TwoFactor = "enrollment_required"
+	}
+
+	return tokens, nil
+}
+
+// useChallenge counts an attempt to pass the challenge.
+func (s *AuthService) useChallenge(token string) (challenge, error) {
+	return s.updateChallenge(token, nil)
+}
+
+// updateChallenge counts an attempt to pass the challenge and lets update change it
+// before it's saved. Update fails the attempt if it returns an error.
+func (s *AuthService) updateChallenge(token string, update func(*challenge) error) (challenge, error) {
+	s.challengeMu.Lock()
+	defer s.challengeMu.Unlock()
+
+	value, err := s.cache.Get(challengeCacheKey(token))
+	if err != nil {
+		return challenge{}, errors.New("invalid token")
+	}
+	ch := value.(challenge)
+
+	ttl := int64(time.Until(ch.ExpiresAt).Seconds())
+	if ttl <= 0 || ch.Attempts >= maxChallengeAttempts {
+		s.cache.Delete(challengeCacheKey(token))
+		return challenge{}, errors.New("invalid token")
+	}
+
+	ch.Attempts++
+	if update != nil {
+		err = update(&ch)
+	}
+	s.cache.Set(challengeCacheKey(token), ch, ttl)
+
+	return ch, err
+}
+
+// VerifyTwoFactor finishes login with TOTP or recovery code. If the user had to enroll,
+// the code confirms the new secret and recovery codes are returned with tokens. Wrong
+// code counts as failed login, so new challenges don't give more guesses than lockout
+// allows.
+func (s *AuthService) VerifyTwoFactor(challengeToken, code string, info domain.RequestInfo) (domain.Tokens, error) {
+	ch, err := s.useChallenge(challengeToken)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	user, err := s.userRepo.GetByID(ch.UserID)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	// Account can get locked by wrong codes while the challenge is valid.
+	err = s.checkCanLogin(user)
+	if err != nil {
+		s.recordLogin(user.ID, ch.Method, err, info)
+		return domain.Tokens{}, err
+	}
+
+	var recoveryCodes []string
+	if ch.Enroll {
+		recoveryCodes, err = s.ConfirmTOTP(ch.UserID, code)
+	} else {
+		var ok bool
+		ok, err = s.checkSecondFactor(ch.UserID, code)
+		if err == nil && !ok {
+			err = errInvalidCode
+		}
+	}
+	if err == errInvalidCode {
+		s.recordLogin(user.ID, ch.Method, err, info)
+		s.registerFailedLogin(user)
+		return domain.Tokens{}, err
+	}
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	s.cache.Delete(challengeCacheKey(challengeToken))
+
+	tokens, err := s.createLoginSession(user, ch.Method, info)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	tokens.RecoveryCodes = recoveryCodes
+
+	return tokens, nil
+}
+
+// checkSecondFactor accepts TOTP code or unused recovery code. Every code can be used once.
+func (s *AuthService) checkSecondFactor(userID int64, code string) (bool, error) {
+	userTOTP, err := s.twoFactorRepo.GetTOTP(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	if !userTOTP.EnabledAt.Valid {
+		return false, nil
+	}
+
+	if step, ok := totp.Validate(code, userTOTP.Secret, time.Now()); ok {
+		return s.twoFactorRepo.UseTOTPStep(userID, step)
+	}
+
+	return s.twoFactorRepo.UseRecoveryCode(userID, hashRecoveryCode(code))
+}
+
+func (s *AuthService) GetTwoFactor(userID int64) (domain.TwoFactorStatus, error) {
+	var status domain.TwoFactorStatus
+
+	required, err := s.twoFactorRepo.IsTwoFactorRequired(userID)
+	if err != nil {
+		return status, err
+	}
+	status.Required = required
+
+	userTOTP, err := s.twoFactorRepo.GetTOTP(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return status, nil
+		}
+		return status, err
+	}
+	status.Enabled = userTOTP.EnabledAt.Valid
+
+	if status.Enabled {
+		status.RecoveryCodesLeft, err = s.twoFactorRepo.CountRecoveryCodes(userID)
+		if err != nil {
+			return status, err
+		}
+	}
+
+	return status, nil
+}
+
+// EnrollTOTP creates a new secret. It's enabled after the user confirms it with a code.
+func (s *AuthService) EnrollTOTP(userID int64) (domain.TOTPEnrollment, error) {
+	userTOTP, err := s.twoFactorRepo.GetTOTP(userID)
+	if err != nil && err != sql.ErrNoRows {
+		return domain.TOTPEnrollment{}, err
+	}
+	if err == nil && userTOTP.EnabledAt.Valid {
+		return domain.TOTPEnrollment{}, errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	return s.saveTOTP(userID, secret)
+}
+
+// EnrollTOTPWithChallenge starts enrollment during login of user who is required to use
+// two-factor authentication but hasn't set it up yet. Every call counts as an attempt of
+// the challenge and returns the secret generated by the first one, so the secret can't
+// be rerolled while the challenge is valid.
+func (s *AuthService) EnrollTOTPWithChallenge(challengeToken string) (domain.TOTPEnrollment, error) {
+	ch, err := s.updateChallenge(challengeToken, func(ch *challenge) error {
+		if !ch.Enroll {
+			return errors.New("invalid token")
+		}
+		if ch.Secret != "" {
+			return nil
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			return err
+		}
+		ch.Secret = secret
+
+		return nil
+	})
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	userTOTP, err := s.twoFactorRepo.GetTOTP(ch.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		return domain.TOTPEnrollment{}, err
+	}
+	if err == nil && userTOTP.EnabledAt.Valid {
+		return domain.TOTPEnrollment{}, errors.New("two-factor authentication is already enabled")
+	}
+
+	return s.saveTOTP(ch.UserID, ch.Secret)
+}
+
+// saveTOTP saves the secret which isn't enabled yet and returns it for the user to set up.
+func (s *AuthService) saveTOTP(userID int64, secret string) (domain.TOTPEnrollment, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	err = s.twoFactorRepo.CreateTOTP(userID, secret)
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	return domain.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables the secret created by EnrollTOTP and returns recovery codes.
+func (s *AuthService) ConfirmTOTP(userID int64, code string) ([]string, error) {
+	userTOTP, err := s.twoFactorRepo.GetTOTP(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("enrollment not started")
+		}
+		return nil, err
+	}
+	if userTOTP.EnabledAt.Valid {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	step, ok := totp.Validate(code, userTOTP.Secret, time.Now())
+	if !ok {
+		return nil, errInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.twoFactorRepo.EnableTOTP(userID, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns off two-factor authentication. It's not allowed if an organization
+// of the user requires it.
+func (s *AuthService) DisableTOTP(userID int64, code string) error {
+	required, err := s.twoFactorRepo.IsTwoFactorRequired(userID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return errors.New("two-factor authentication is required by organization")
+	}
+
+	ok, err := s.checkSecondFactor(userID, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidCode
+	}
+
+	return s.twoFactorRepo.DeleteTOTP(userID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user with new ones.
+func (s *AuthService) RegenerateRecoveryCodes(userID int64, code string) ([]string, error) {
+	ok, err := s.checkSecondFactor(userID, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.twoFactorRepo.ReplaceRecoveryCodes(userID, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// ResetTwoFactor removes TOTP and recovery codes of the user who lost access to them.
+func (s *AuthService) ResetTwoFactor(userID int64) error {
+	return s.twoFactorRepo.DeleteTOTP(userID)
+}
+
+// newRecoveryCodes returns codes to show to the user and their hashes to save.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+
+	for i := range codes {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes normalized code. Codes are random, so salt isn't needed.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
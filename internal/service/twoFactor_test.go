@@ -0,0 +1,290 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/testdb"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/cache"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/totp"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestTwoFactor(t *testing.T) {
+	db := testdb.New(t)
+	repo := repository.NewRepository(db)
+	auth := NewAuthService(repo.User, repo.OrganizationUser, repo.TwoFactor, repo.LoginEvent, nil, nil, cache.NewMemoryCache())
+
+	organizationID := testdb.Organization(t, db, "Gemeinde", "basic")
+	userID := testdb.User(t, db, "admin@example.com", "user")
+	testdb.OrganizationUser(t, db, organizationID, userID, "admin")
+
+	err := repo.Organization.UpdateRequire2FA(organizationID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Admin without TOTP has to enroll before getting tokens.
+	tokens, err := auth.startSession(domain.User{ID: userID}, domain.LoginMethodPassword, domain.RequestInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.TwoFactor != "enrollment_required" || tokens.ChallengeToken == "" || tokens.AccessToken != "" {
+		t.Fatalf("Expected enrollment challenge, got %+v", tokens)
+	}
+
+	enrollment, err := auth.EnrollTOTPWithChallenge(tokens.ChallengeToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := auth.ConfirmTOTP(userID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recoveryCodes) != recoveryCodesCount {
+		t.Fatalf("Expected %d recovery codes, got %d", recoveryCodesCount, len(recoveryCodes))
+	}
+
+	// Code used for enrollment can't be used again.
+	ok, err := auth.checkSecondFactor(userID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Errorf("TOTP code must be accepted only once")
+	}
+
+	ok, err = auth.checkSecondFactor(userID, recoveryCodes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Errorf("Recovery code must be accepted")
+	}
+	ok, err = auth.checkSecondFactor(userID, recoveryCodes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Errorf("Recovery code must be accepted only once")
+	}
+
+	tokens, err = auth.startSession(domain.User{ID: userID}, domain.LoginMethodPassword, domain.RequestInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.TwoFactor != "required" {
+		t.Errorf("Expected code challenge, got %+v", tokens)
+	}
+
+	err = auth.DisableTOTP(userID, recoveryCodes[1])
+	if err == nil {
+		t.Errorf("TOTP must not be disabled while organization requires it")
+	}
+
+	status, err := auth.GetTwoFactor(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Enabled || !status.Required || status.RecoveryCodesLeft != recoveryCodesCount-1 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+// loginEvents records login events in memory.
+type loginEvents struct {
+	repository.LoginEvent
+	events []domain.LoginEvent
+}
+
+func (r *loginEvents) Create(event domain.LoginEvent) (int64, error) {
+	r.events = append(r.events, event)
+	return int64(len(r.events)), nil
+}
+
+func TestChallengeAttempts(t *testing.T) {
+	events := &loginEvents{}
+	auth := NewAuthService(nil, nil, nil, events, nil, nil, cache.NewMemoryCache())
+
+	tokens, err := auth.createChallenge(1, domain.LoginMethodPassword, false, domain.RequestInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxChallengeAttempts; i++ {
+		_, err = auth.useChallenge(tokens.ChallengeToken)
+		if err != nil {
+			t.Fatalf("Attempt %d must be allowed: %v", i+1, err)
+		}
+	}
+
+	_, err = auth.useChallenge(tokens.ChallengeToken)
+	if err == nil {
+		t.Errorf("Challenge must be invalid after %d attempts", maxChallengeAttempts)
+	}
+
+	// Correct first factor alone isn't a successful login.
+	if len(events.events) != 1 || !events.events[0].Challenge || events.events[0].Success {
+		t.Errorf("Expected challenge event, got %+v", events.events)
+	}
+}
+
+// lockoutUsers keeps failed logins of a verified user in memory.
+type lockoutUsers struct {
+	repository.User
+	user domain.User
+}
+
+func (r *lockoutUsers) GetByID(id int64) (domain.User, error) {
+	return r.user, nil
+}
+
+func (r *lockoutUsers) GetVerification(id int64) (domain.UserVerification, error) {
+	return domain.UserVerification{Status: "verified"}, nil
+}
+
+func (r *lockoutUsers) IncrementFailedLogins(id int64) (int, error) {
+	r.user.FailedLogins++
+	return r.user.FailedLogins, nil
+}
+
+func (r *lockoutUsers) Lock(id int64, until time.Time) error {
+	r.user.LockedUntil = null.TimeFrom(until)
+	return nil
+}
+
+// noTOTP is two factor repository of user without TOTP, so every code is wrong.
+type noTOTP struct {
+	repository.TwoFactor
+}
+
+func (r noTOTP) GetTOTP(userID int64) (domain.UserTOTP, error) {
+	return domain.UserTOTP{}, sql.ErrNoRows
+}
+
+func TestVerifyTwoFactorLockout(t *testing.T) {
+	users := &lockoutUsers{user: domain.User{ID: 1, Email: "admin@example.com"}}
+	events := &loginEvents{}
+	email := lockedEmail{sent: make(chan string, 1)}
+	auth := NewAuthService(users, nil, noTOTP{}, events, nil, email, cache.NewMemoryCache())
+
+	// New challenge for every guess mustn't give more guesses than lockout allows.
+	for i := 0; i < lockoutThreshold-1; i++ {
+		tokens, err := auth.createChallenge(1, domain.LoginMethodPassword, false, domain.RequestInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = auth.VerifyTwoFactor(tokens.ChallengeToken, "000000", domain.RequestInfo{})
+		if err != errInvalidCode {
+			t.Fatalf("Expected invalid code, got %v", err)
+		}
+
+		if !users.user.LockedUntil.Valid || time.Until(users.user.LockedUntil.Time) > lockoutDuration(i+1) {
+			t.Fatalf("Expected next attempt delayed by %v, got %v", lockoutDuration(i+1), users.user.LockedUntil)
+		}
+
+		// Skip the delay.
+		users.user.LockedUntil = null.Time{}
+	}
+	if users.user.FailedLogins != lockoutThreshold-1 {
+		t.Errorf("Expected %d failed logins, got %d", lockoutThreshold-1, users.user.FailedLogins)
+	}
+
+	failed := 0
+	for _, event := range events.events {
+		if !event.Challenge && !event.Success {
+			failed++
+		}
+	}
+	if failed != lockoutThreshold-1 {
+		t.Errorf("Expected %d failed login events, got %d", lockoutThreshold-1, failed)
+	}
+
+	tokens, err := auth.createChallenge(1, domain.LoginMethodPassword, false, domain.RequestInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = auth.VerifyTwoFactor(tokens.ChallengeToken, "000000", domain.RequestInfo{})
+	if err != errInvalidCode {
+		t.Fatalf("Expected invalid code, got %v", err)
+	}
+	if !users.user.LockedUntil.Valid || time.Until(users.user.LockedUntil.Time) <= lockoutDuration(lockoutThreshold-1) {
+		t.Fatalf("User must be locked after %d wrong codes", lockoutThreshold)
+	}
+
+	select {
+	case <-email.sent:
+	case <-time.After(time.Second):
+		t.Error("Lockout email is not sent")
+	}
+
+	// Locked user can't use challenge issued before lockout.
+	_, err = auth.VerifyTwoFactor(tokens.ChallengeToken, "000000", domain.RequestInfo{})
+	if err == nil || err == errInvalidCode {
+		t.Errorf("Expected locked account error, got %v", err)
+	}
+}
+
+// enrollingTOTP is two factor repository of user who hasn't enabled TOTP yet.
+type enrollingTOTP struct {
+	noTOTP
+	secrets []string
+}
+
+func (r *enrollingTOTP) CreateTOTP(userID int64, secret string) error {
+	r.secrets = append(r.secrets, secret)
+	return nil
+}
+
+func TestEnrollTOTPWithChallenge(t *testing.T) {
+	users := &lockoutUsers{user: domain.User{ID: 1, Email: "admin@example.com"}}
+	twoFactor := &enrollingTOTP{}
+	auth := NewAuthService(users, nil, twoFactor, &loginEvents{}, nil, nil, cache.NewMemoryCache())
+
+	tokens, err := auth.createChallenge(1, domain.LoginMethodPassword, true, domain.RequestInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var secret string
+	for i := 0; i < maxChallengeAttempts; i++ {
+		enrollment, err := auth.EnrollTOTPWithChallenge(tokens.ChallengeToken)
+		if err != nil {
+			t.Fatalf("Enrollment %d must be allowed: %v", i+1, err)
+		}
+		if secret == "" {
+			secret = enrollment.Secret
+		}
+		if enrollment.Secret != secret {
+			t.Fatalf("Secret must be kept for the challenge, got %s and %s", secret, enrollment.Secret)
+		}
+	}
+
+	_, err = auth.EnrollTOTPWithChallenge(tokens.ChallengeToken)
+	if err == nil {
+		t.Errorf("Enrollment must count against %d attempts of the challenge", maxChallengeAttempts)
+	}
+
+	tokens, err = auth.createChallenge(1, domain.LoginMethodPassword, false, domain.RequestInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = auth.EnrollTOTPWithChallenge(tokens.ChallengeToken)
+	if err == nil {
+		t.Errorf("Challenge without enrollment must be refused")
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	if hashRecoveryCode("abcd-efgh") != hashRecoveryCode("ABCD EFGH") {
+		t.Errorf("Recovery code must be normalized before hashing")
+	}
+}
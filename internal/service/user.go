@@ -3,21 +3,39 @@ package service
 import (
 	"database/sql"
 	"errors"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
 
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/domain"
 	"bitbucket.org/ibros_nsk/krisenkompass-backend/internal/repository"
 	pass "bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/password"
-	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/randstring"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Verification links are also used for invites, so they live longer than password reset
+// links.
+const (
+	verificationTokenTTL  = 7 * 24 * time.Hour
+	passwordResetTokenTTL = time.Hour
+)
+
+// New address has a day to confirm email change, old address can revert it for a week.
+const (
+	emailChangeTokenTTL  = 24 * time.Hour
+	emailChangeRevertTTL = 7 * 24 * time.Hour
 )
 
 type UserService struct {
 	repo                repository.User
 	organizationService Organization
 	emailService        Email
+	authService         Auth
 }
 
-func NewUserService(repo repository.User, organizationService Organization, emailService Email) *UserService {
-	return &UserService{repo: repo, organizationService: organizationService, emailService: emailService}
+func NewUserService(repo repository.User, organizationService Organization, emailService Email, authService Auth) *UserService {
+	return &UserService{repo: repo, organizationService: organizationService, emailService: emailService, authService: authService}
 }
 
 func (s *UserService) GetAll() ([]domain.User, error) {
@@ -36,7 +54,7 @@ func (s *UserService) GetByEmail(email string) (domain.User, error) {
 }
 
 func (s *UserService) GetByPasswordResetToken(token string) (domain.User, error) {
-	user, err := s.repo.GetByPasswordResetToken(token)
+	user, err := s.repo.GetByPasswordResetToken(hashToken(token))
 	return user, err
 }
 
@@ -56,13 +74,17 @@ func (s *UserService) GetPasswordReset(email string) (domain.UserPasswordReset,
 }
 
 func (s *UserService) Create(firstname, lastname *string, email string, image *string) (int64, error) {
+	token, err := randomToken()
+	if err != nil {
+		return 0, err
+	}
+
 	userID, err := s.repo.Create(firstname, lastname, email, image)
 	if err != nil {
 		return 0, err
 	}
 
-	token := randstring.RandAlphanumString(32)
-	err = s.repo.CreateVerification(userID, token)
+	err = s.repo.CreateVerification(userID, hashToken(token), time.Now().Add(verificationTokenTTL))
 	if err != nil {
 		return 0, err
 	}
@@ -78,13 +100,17 @@ func (s *UserService) Create(firstname, lastname *string, email string, image *s
 }
 
 func (s *UserService) CreateWithOrganization(firstname, lastname *string, email string, name, city, address, invoiceAddress, plan string, population int, role string) (userID int64, organizationID int64, err error) {
+	token, err := randomToken()
+	if err != nil {
+		return 0, 0, err
+	}
+
 	userID, organizationID, err = s.repo.CreateWithOrganization(firstname, lastname, email, name, city, address, invoiceAddress, plan, population)
 	if err != nil {
 		return 0, 0, err
 	}
 
-	token := randstring.RandAlphanumString(32)
-	err = s.repo.CreateVerification(userID, token)
+	err = s.repo.CreateVerification(userID, hashToken(token), time.Now().Add(verificationTokenTTL))
 	if err != nil {
 		return 0, 0, err
 	}
@@ -116,13 +142,17 @@ func (s *UserService) CreateOrganizationUser(organizationID int64, email, role s
 		// If user doesn't exist then create new one.
 		isNewUser = true
 
+		token, err = randomToken()
+		if err != nil {
+			return errors.New("failed to invite user")
+		}
+
 		userID, err := s.repo.Create(nil, nil, email, nil)
 		if err != nil {
 			return errors.New("failed to invite user")
 		}
 
-		token = randstring.RandAlphanumString(32)
-		err = s.repo.CreateVerification(userID, token)
+		err = s.repo.CreateVerification(userID, hashToken(token), time.Now().Add(verificationTokenTTL))
 		if err != nil {
 			// Rollback user creation
 			go s.Delete(userID)
@@ -145,6 +175,8 @@ func (s *UserService) CreateOrganizationUser(organizationID int64, email, role s
 		return errors.New("failed to invite user")
 	}
 
+	s.authService.InvalidateAccess(user.ID)
+
 	// Send email
 	if isNewUser {
 		err = s.emailService.SendUserVerificatonLinkWithInvite(email, token, organization.Name)
@@ -164,8 +196,11 @@ func (s *UserService) CreateOrganizationUser(organizationID int64, email, role s
 }
 
 func (s *UserService) CreatePasswordReset(email string) error {
-	token := randstring.RandAlphanumString(32)
-	err := s.repo.CreatePasswordReset(email, token)
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	err = s.repo.CreatePasswordReset(email, hashToken(token), time.Now().Add(passwordResetTokenTTL))
 	if err != nil {
 		return err
 	}
@@ -178,10 +213,153 @@ func (s *UserService) CreatePasswordReset(email string) error {
 	return err
 }
 
-func (s *UserService) Update(id int64, image, firstname, lastname, email, userType *string) error {
-	err := s.repo.Update(id, image, firstname, lastname, email, userType)
+// ResendVerification sends a new verification link to the unverified user. Previous
+// link stops working.
+func (s *UserService) ResendVerification(email string) error {
+	user, err := s.repo.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	verification, err := s.repo.GetVerification(user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil && verification.Status == "verified" {
+		return errors.New("user already verified")
+	}
 
-	return err
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	err = s.repo.CreateVerification(user.ID, hashToken(token), time.Now().Add(verificationTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	return s.emailService.SendUserVerificatonLink(email, token)
+}
+
+// ResetPassword sets new password using password reset token and returns ID of the user.
+func (s *UserService) ResetPassword(token, password string) (int64, error) {
+	hashedPassword, err := pass.HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := s.repo.ResetPasswordByToken(hashToken(token), hashedPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, s.repo.Unlock(userID)
+}
+
+func (s *UserService) Update(id int64, image, firstname, lastname, userType *string) error {
+	err := s.repo.Update(id, image, firstname, lastname, userType)
+	if err != nil {
+		return err
+	}
+
+	if userType != nil {
+		s.authService.InvalidateAccess(id)
+	}
+
+	return nil
+}
+
+func (s *UserService) GetPendingEmailChange(userID int64) (domain.UserEmailChange, error) {
+	return s.repo.GetPendingEmailChange(userID)
+}
+
+// RequestEmailChange sends confirmation link to the new address and revert link to the
+// old one. Email stays unchanged until the new address confirms. If the new address
+// belongs to another user, its owner is notified instead and the result is the same,
+// so registered addresses can't be discovered this way.
+func (s *UserService) RequestEmailChange(userID int64, email string) error {
+	email = strings.TrimSpace(email)
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return errors.New("invalid email")
+	}
+
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(user.Email, email) {
+		return errors.New("email is not changed")
+	}
+
+	_, err = s.repo.GetByEmail(email)
+	if err == nil {
+		return s.emailService.SendEmailChangeTaken(email)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	revertToken, err := randomToken()
+	if err != nil {
+		return err
+	}
+	err = s.repo.CreateEmailChange(domain.UserEmailChange{
+		UserID:          userID,
+		OldEmail:        user.Email,
+		NewEmail:        email,
+		TokenHash:       null.StringFrom(hashToken(token)),
+		RevertTokenHash: hashToken(revertToken),
+		ExpiresAt:       time.Now().Add(emailChangeTokenTTL),
+		RevertExpiresAt: time.Now().Add(emailChangeRevertTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.emailService.SendEmailChangeConfirmation(email, token)
+	if err != nil {
+		return err
+	}
+
+	err = s.emailService.SendEmailChangeNotice(user.Email, email, revertToken)
+	if err != nil {
+		log.Println("Failed to notify about email change: ", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange applies the change confirmed by the new address.
+func (s *UserService) ConfirmEmailChange(token string) (domain.UserEmailChange, error) {
+	change, err := s.repo.ConfirmEmailChange(hashToken(token))
+	if err == sql.ErrNoRows {
+		return domain.UserEmailChange{}, errors.New("invalid token")
+	}
+	return change, err
+}
+
+// RevertEmailChange cancels or undoes the change from the old address. Change the user
+// didn't make means somebody else has access to the account, so all sessions are revoked.
+func (s *UserService) RevertEmailChange(token string) (domain.UserEmailChange, error) {
+	change, err := s.repo.RevertEmailChange(hashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.UserEmailChange{}, errors.New("invalid token")
+		}
+		return domain.UserEmailChange{}, err
+	}
+
+	err = s.authService.RevokeUserSessions(change.UserID)
+	if err != nil {
+		return domain.UserEmailChange{}, err
+	}
+
+	return change, nil
 }
 
 func (s *UserService) UpdatePassword(id int64, password string) error {
@@ -195,23 +373,44 @@ func (s *UserService) UpdatePassword(id int64, password string) error {
 		return err
 	}
 
-	return nil
+	// Reset link requested before the password change must not work anymore.
+	err = s.repo.DeletePasswordReset(id)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Unlock(id)
 }
 
 func (s *UserService) UpdateOrganizationUser(organizationID, userID int64, role string) error {
 	err := s.repo.UpdateOrganizationUser(organizationID, userID, role)
+	if err != nil {
+		return err
+	}
 
-	return err
+	s.authService.InvalidateAccess(userID)
+
+	return nil
 }
 
 func (s *UserService) Delete(id int64) error {
 	err := s.repo.Delete(id)
+	if err != nil {
+		return err
+	}
 
-	return err
+	s.authService.InvalidateAccess(id)
+
+	return nil
 }
 
 func (s *UserService) DeleteOrganizationUser(organizationID, userID int64) error {
 	err := s.repo.DeleteOrganizationUser(organizationID, userID)
+	if err != nil {
+		return err
+	}
 
-	return err
+	s.authService.InvalidateAccess(userID)
+
+	return nil
 }
@@ -0,0 +1,185 @@
+package testdb
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Themes are the themes of root pages, every organization has a root page for each of them.
+var Themes = []string{"precautions", "deal_with", "e_restore", "e_avoid", "e_gfs", "e_school"}
+
+// Page describes a page of the tree created by PageTree. Type defaults to content, or to
+// section if the page has childrens. Status defaults to visible.
+type Page struct {
+	Title     string
+	Type      string
+	Status    string
+	Draft     bool
+	Plans     []string
+	Blocks    []Block
+	File      string
+	Childrens []Page
+}
+
+// Block describes a block of the page. Type defaults to default.
+type Block struct {
+	Title    string
+	Type     string
+	Content  string
+	Readmore string
+}
+
+func User(t *testing.T, db *sqlx.DB, email, userType string) int64 {
+	t.Helper()
+
+	result, err := db.Exec(`INSERT INTO users (firstname, lastname, email, type) VALUES ("Test", "User", ?, ?)`, email, userType)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	id, _ := result.LastInsertId()
+
+	return id
+}
+
+// Organization creates organization with root pages for all themes.
+func Organization(t *testing.T, db *sqlx.DB, name, plan string) int64 {
+	t.Helper()
+
+	result, err := db.Exec(`INSERT 
+		INTO organizations (name, city, population, address, invoice_address, plan) 
+		VALUES (?, "Stans", 1000, "Address", "Invoice address", ?)`, name, plan)
+	if err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+
+	id, _ := result.LastInsertId()
+	RootPages(t, db, null.IntFrom(id))
+
+	return id
+}
+
+func OrganizationUser(t *testing.T, db *sqlx.DB, organizationID, userID int64, role string) {
+	t.Helper()
+
+	_, err := db.Exec("INSERT INTO organizations_users (organization_id, user_id, role) VALUES (?, ?, ?)", organizationID, userID, role)
+	if err != nil {
+		t.Fatalf("Failed to add user to organization: %v", err)
+	}
+}
+
+// RootPages creates root pages of the organization, or admin root pages if organization
+// is null, and returns their IDs by theme.
+func RootPages(t *testing.T, db *sqlx.DB, organizationID null.Int) map[string]int64 {
+	t.Helper()
+
+	ids := make(map[string]int64)
+	for i, theme := range Themes {
+		result, err := db.Exec(`INSERT 
+			INTO pages (organization_id, language_tag, pages.type, theme, pages.status, title, sort) 
+			VALUES (?, "de", "section", ?, "visible", ?, ?)`, organizationID, theme, theme, i+1)
+		if err != nil {
+			t.Fatalf("Failed to create root page: %v", err)
+		}
+
+		ids[theme], _ = result.LastInsertId()
+	}
+
+	return ids
+}
+
+// RootPage returns ID of the root page of the organization, or admin root page if
+// organization is null.
+func RootPage(t *testing.T, db *sqlx.DB, organizationID null.Int, theme string) int64 {
+	t.Helper()
+
+	var id int64
+	err := db.Get(&id, "SELECT id FROM pages WHERE organization_id <=> ? AND parent_id IS NULL AND theme = ?", organizationID, theme)
+	if err != nil {
+		t.Fatalf("Failed to get root page: %v", err)
+	}
+
+	return id
+}
+
+// PageTree creates pages under the parent and returns IDs of created pages and blocks by
+// their titles. Titles are expected to be unique inside of the tree.
+func PageTree(t *testing.T, db *sqlx.DB, parentID int64, pages ...Page) (map[string]int64, map[string]int64) {
+	t.Helper()
+
+	var parent struct {
+		OrganizationID null.Int `db:"organization_id"`
+		Theme          string   `db:"theme"`
+	}
+	err := db.Get(&parent, "SELECT organization_id, theme FROM pages WHERE id = ?", parentID)
+	if err != nil {
+		t.Fatalf("Failed to get parent page: %v", err)
+	}
+
+	pageIDs := make(map[string]int64)
+	blockIDs := make(map[string]int64)
+
+	var create func(parentID int64, pages []Page)
+	create = func(parentID int64, pages []Page) {
+		for i, page := range pages {
+			if page.Type == "" {
+				page.Type = "content"
+				if len(page.Childrens) != 0 {
+					page.Type = "section"
+				}
+			}
+			if page.Status == "" {
+				page.Status = "visible"
+			}
+
+			result, err := db.Exec(`INSERT 
+				INTO pages (organization_id, parent_id, language_tag, pages.type, theme, pages.status, title, draft, pages.sort) 
+				VALUES (?, ?, "de", ?, ?, ?, ?, ?, ?)`,
+				parent.OrganizationID, parentID, page.Type, parent.Theme, page.Status, page.Title, page.Draft, i+1)
+			if err != nil {
+				t.Fatalf("Failed to create page %s: %v", page.Title, err)
+			}
+
+			pageID, _ := result.LastInsertId()
+			pageIDs[page.Title] = pageID
+
+			for _, plan := range page.Plans {
+				_, err = db.Exec("INSERT INTO default_pages (id, plan) VALUES (?, ?)", pageID, plan)
+				if err != nil {
+					t.Fatalf("Failed to add page %s to plan: %v", page.Title, err)
+				}
+			}
+
+			for j, block := range page.Blocks {
+				if block.Type == "" {
+					block.Type = "default"
+				}
+
+				result, err := db.Exec(`INSERT 
+					INTO blocks (page_id, title, content, readmore, type, sort) 
+					VALUES (?, ?, ?, ?, ?, ?)`,
+					pageID, block.Title, null.NewString(block.Content, block.Content != ""), null.NewString(block.Readmore, block.Readmore != ""), block.Type, j+1)
+				if err != nil {
+					t.Fatalf("Failed to create block %s: %v", block.Title, err)
+				}
+
+				blockIDs[block.Title], _ = result.LastInsertId()
+			}
+
+			if page.File != "" {
+				_, err = db.Exec("INSERT INTO files (id, path) VALUES (?, ?)", pageID, page.File)
+				if err != nil {
+					t.Fatalf("Failed to create file of page %s: %v", page.Title, err)
+				}
+			}
+
+			create(pageID, page.Childrens)
+		}
+	}
+
+	create(parentID, pages)
+
+	return pageIDs, blockIDs
+}
@@ -0,0 +1,86 @@
+// Package testdb creates disposable databases for integration tests of repositories
+// and services.
+//
+// Tests are skipped unless TEST_DATABASE_DSN points to a MariaDB or MySQL server, e.g.
+// TEST_DATABASE_DSN="root:secret@tcp(127.0.0.1:3306)/". Every call of New creates a new
+// database with all migrations applied, which is dropped when the test finishes.
+package testdb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	schema "bitbucket.org/ibros_nsk/krisenkompass-backend/db"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/randstring"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+const dsnEnv = "TEST_DATABASE_DSN"
+
+func New(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skip(dsnEnv + " is not set")
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("Invalid %s: %v", dsnEnv, err)
+	}
+	cfg.DBName = ""
+	cfg.ParseTime = true
+
+	server, err := sqlx.Connect("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("Failed to connect to test DB server: %v", err)
+	}
+
+	name := "krisenkompass_test_" + strings.ToLower(randstring.RandAlphanumString(10))
+	_, err = server.Exec("CREATE DATABASE `" + name + "` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci")
+	if err != nil {
+		server.Close()
+		t.Fatalf("Failed to create test DB: %v", err)
+	}
+
+	cfg.DBName = name
+	db, err := sqlx.Connect("mysql", cfg.FormatDSN())
+	if err != nil {
+		drop(server, name)
+		t.Fatalf("Failed to connect to test DB: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		drop(server, name)
+	})
+
+	migrator, err := schema.NewMigrator(db.DB)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	_, err = migrator.Up()
+	if err != nil {
+		t.Fatalf("Failed to migrate test DB: %v", err)
+	}
+
+	_, err = db.Exec(`INSERT INTO languages (tag) VALUES ("de"), ("en")`)
+	if err != nil {
+		t.Fatalf("Failed to insert languages: %v", err)
+	}
+
+	return db
+}
+
+func drop(server *sqlx.DB, name string) {
+	_, err := server.Exec("DROP DATABASE IF EXISTS `" + name + "`")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to drop test DB %s: %v\n", name, err)
+	}
+	server.Close()
+}
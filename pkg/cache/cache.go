@@ -61,3 +61,9 @@ func (c *MemoryCache) Get(key interface{}) (interface{}, error) {
 
 	return item.value, nil
 }
+
+func (c *MemoryCache) Delete(key interface{}) {
+	c.Lock()
+	delete(c.cache, key)
+	c.Unlock()
+}
@@ -0,0 +1,92 @@
+package jwk
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestEdDSA(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := jwt.NewWithClaims(SigningMethodEdDSA, jwt.StandardClaims{Subject: "1"})
+	token.Header["kid"] = "key"
+	signed, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := New("key", "EdDSA", publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(Set{Keys: []Key{key}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var set Set
+	err = json.Unmarshal(data, &set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := set.Keys[0].PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := jwt.ParseWithClaims(signed, &jwt.StandardClaims{}, func(t *jwt.Token) (interface{}, error) {
+		return decoded, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Method.Alg() != "EdDSA" || parsed.Claims.(*jwt.StandardClaims).Subject != "1" {
+		t.Errorf("Got %s token with %+v", parsed.Method.Alg(), parsed.Claims)
+	}
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := jwt.NewWithClaims(SigningMethodEdDSA, jwt.StandardClaims{Subject: "2"}).SignedString(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jwt.Parse(forged, func(t *jwt.Token) (interface{}, error) {
+		return decoded, nil
+	})
+	if err == nil {
+		t.Error("Token signed with other key must be rejected")
+	}
+}
+
+func TestRSA(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := New("key", "RS256", &privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.KeyType != "RSA" || key.E != "AQAB" {
+		t.Errorf("Wrong RSA key %+v", key)
+	}
+
+	decoded, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !privateKey.PublicKey.Equal(decoded) {
+		t.Error("Decoded key differs from the original")
+	}
+}
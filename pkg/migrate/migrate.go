@@ -0,0 +1,346 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownVersion is returned when database has migrations which are not known to the
+// application, e.g. after rollback of the application to the older version.
+var ErrUnknownVersion = errors.New("database schema version is unknown")
+
+var fileRegexp = regexp.MustCompile(`^([0-9]+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	// Databases created before migrations are recognised by this table. First
+	// migration is marked as applied for them instead of being run.
+	BaselineTable string
+}
+
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Load reads migrations from the directory. Files are named {version}_{name}.up.sql
+// and {version}_{name}.down.sql, both files are required.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		if version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up statements", migration.Version, migration.Name)
+		}
+		if strings.TrimSpace(migration.Down) == "" {
+			return nil, fmt.Errorf("migration %d_%s has no down statements", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Split returns statements of the SQL script. Statements are separated by semicolons
+// outside of quotes and comments.
+func Split(script string) []string {
+	statements := make([]string, 0)
+
+	var current strings.Builder
+	var quote rune
+	lineComment := false
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		switch {
+		case lineComment:
+			if c == '\n' {
+				lineComment = false
+				current.WriteRune(c)
+			}
+			continue
+		case quote != 0:
+			current.WriteRune(c)
+			if c == '\\' && quote != '`' && i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			lineComment = true
+			continue
+		case c == '#':
+			lineComment = true
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == ';':
+			if statement := strings.TrimSpace(current.String()); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+			continue
+		}
+
+		current.WriteRune(c)
+	}
+
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+
+	return statements
+}
+
+// Version returns the last applied migration.
+func (m *Migrator) Version() (int, error) {
+	err := m.init()
+	if err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	err = m.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version)
+	return int(version.Int64), err
+}
+
+// Check returns ErrUnknownVersion if database has migrations newer than known ones.
+func (m *Migrator) Check() error {
+	version, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	if version > m.latest() {
+		return fmt.Errorf("%w: %d, latest known is %d", ErrUnknownVersion, version, m.latest())
+	}
+
+	return nil
+}
+
+// Up applies all pending migrations and returns them.
+func (m *Migrator) Up() ([]Migration, error) {
+	err := m.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]Migration, 0)
+	for _, migration := range m.migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		err = m.exec(migration.Up)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err = m.db.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name)
+		if err != nil {
+			return applied, err
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// Down reverts the last applied migration and returns it.
+func (m *Migrator) Down() (Migration, error) {
+	err := m.Check()
+	if err != nil {
+		return Migration{}, err
+	}
+
+	version, err := m.Version()
+	if err != nil {
+		return Migration{}, err
+	}
+
+	if version == 0 {
+		return Migration{}, errors.New("no migrations to revert")
+	}
+
+	migration := m.migrations[version-1]
+
+	err = m.exec(migration.Down)
+	if err != nil {
+		return Migration{}, fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err = m.db.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	return migration, nil
+}
+
+// Status returns all known migrations with time they were applied.
+func (m *Migrator) Status() ([]Status, error) {
+	err := m.init()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		err = rows.Scan(&version, &at)
+		if err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		at, ok := appliedAt[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: at})
+	}
+
+	return statuses, nil
+}
+
+func (m *Migrator) latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) exec(script string) error {
+	for _, statement := range Split(script) {
+		_, err := m.db.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// init creates migrations table and marks first migration as applied for databases
+// which were created before migrations.
+func (m *Migrator) init() error {
+	_, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version int PRIMARY KEY,
+		name varchar(256) NOT NULL,
+		applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+
+	if m.BaselineTable == "" || len(m.migrations) == 0 {
+		return nil
+	}
+
+	var count int
+	err = m.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count)
+	if err != nil || count != 0 {
+		return err
+	}
+
+	err = m.db.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", m.BaselineTable).Scan(&count)
+	if err != nil || count == 0 {
+		return err
+	}
+
+	_, err = m.db.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.migrations[0].Version, m.migrations[0].Name)
+	return err
+}
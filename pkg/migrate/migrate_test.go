@@ -0,0 +1,83 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"migrations/0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"migrations/0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id int);")},
+		"migrations/0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+	}
+
+	migrations, err := Load(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 {
+		t.Fatalf("Got %d migrations, want 2", len(migrations))
+	}
+	if migrations[0].Version != 1 || migrations[0].Name != "first" || migrations[0].Down != "DROP TABLE a;" {
+		t.Errorf("Wrong first migration %+v", migrations[0])
+	}
+	if migrations[1].Version != 2 || migrations[1].Name != "second" || migrations[1].Up != "CREATE TABLE b (id int);" {
+		t.Errorf("Wrong second migration %+v", migrations[1])
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"m/0001_first.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"missing version": {
+			"m/0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+			"m/0001_first.down.sql": {Data: []byte("SELECT 1;")},
+			"m/0003_third.up.sql":   {Data: []byte("SELECT 1;")},
+			"m/0003_third.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"duplicate version": {
+			"m/0001_first.up.sql":   {Data: []byte("SELECT 1;")},
+			"m/0001_first.down.sql": {Data: []byte("SELECT 1;")},
+			"m/0001_other.up.sql":   {Data: []byte("SELECT 1;")},
+		},
+		"wrong name": {
+			"m/first.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+
+	for name, fsys := range tests {
+		_, err := Load(fsys, "m")
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{}},
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"SELECT 1;\n\nSELECT 2;\n", []string{"SELECT 1", "SELECT 2"}},
+		{"-- comment; with semicolon\nSELECT 1;", []string{"SELECT 1"}},
+		{"# comment\nSELECT 1;", []string{"SELECT 1"}},
+		{"INSERT INTO t VALUES ('a;b', \"c;d\");", []string{"INSERT INTO t VALUES ('a;b', \"c;d\")"}},
+		{"INSERT INTO t VALUES ('it\\'s;');SELECT 2", []string{"INSERT INTO t VALUES ('it\\'s;')", "SELECT 2"}},
+		{"CREATE TABLE `a;b` (id int);", []string{"CREATE TABLE `a;b` (id int)"}},
+	}
+
+	for _, test := range tests {
+		got := Split(test.in)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Split(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Package oidc implements the authorization code flow of OpenID Connect with PKCE
+// for confidential clients. Only RS256 signed ID tokens are supported.
+package oidc
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Discovery is the provider metadata from /.well-known/openid-configuration.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDToken contains verified claims of the ID token. All claims are available in Claims,
+// e.g. groups or roles used for role mapping.
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Claims        map[string]interface{}
+}
+
+type Provider struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Client       *http.Client
+
+	discovery Discovery
+}
+
+// NewProvider loads metadata of the issuer.
+func NewProvider(client *http.Client, issuer, clientID, clientSecret, redirectURL string) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Client:       client,
+	}
+
+	err := p.getJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &p.discovery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider metadata: %w", err)
+	}
+
+	if p.discovery.Issuer != issuer {
+		return nil, fmt.Errorf("issuer %q doesn't match %q", p.discovery.Issuer, issuer)
+	}
+
+	return p, nil
+}
+
+// CodeChallenge returns S256 PKCE challenge of the verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns URL of the provider login page.
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.discovery.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange redeems the authorization code and returns verified ID token.
+func (p *Provider) Exchange(code, codeVerifier, nonce string) (IDToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest("POST", p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return IDToken{}, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return IDToken{}, fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return IDToken{}, fmt.Errorf("token request failed: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return IDToken{}, errors.New("token response has no id_token")
+	}
+
+	return p.Verify(body.IDToken, nonce)
+}
+
+// Verify checks signature, issuer, audience, expiration and nonce of the ID token.
+func (p *Provider) Verify(rawIDToken, nonce string) (IDToken, error) {
+	keys, err := p.keys()
+	if err != nil {
+		return IDToken{}, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok || t.Method.Alg() != "RS256" {
+			return nil, errors.New("unexpected signing method")
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		// Token without kid is accepted if the provider has a single key.
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key, nil
+			}
+		}
+		return nil, errors.New("unknown signing key")
+	})
+	if err != nil {
+		return IDToken{}, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if !claims.VerifyIssuer(p.discovery.Issuer, true) {
+		return IDToken{}, errors.New("invalid id_token issuer")
+	}
+	if !verifyAudience(claims["aud"], p.ClientID) {
+		return IDToken{}, errors.New("invalid id_token audience")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return IDToken{}, errors.New("id_token has no expiration")
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return IDToken{}, errors.New("invalid id_token nonce")
+	}
+
+	token := IDToken{Claims: claims}
+	token.Issuer, _ = claims["iss"].(string)
+	token.Subject, _ = claims["sub"].(string)
+	token.Email, _ = claims["email"].(string)
+	token.EmailVerified, _ = claims["email_verified"].(bool)
+	token.GivenName, _ = claims["given_name"].(string)
+	token.FamilyName, _ = claims["family_name"].(string)
+
+	if token.Subject == "" {
+		return IDToken{}, errors.New("id_token has no subject")
+	}
+
+	return token, nil
+}
+
+func verifyAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keys loads RSA signing keys of the provider by key ID.
+func (p *Provider) keys() (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	err := p.getJSON(p.discovery.JWKSURI, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			continue
+		}
+
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("provider has no RSA signing keys")
+	}
+
+	return keys, nil
+}
+
+func (p *Provider) getJSON(url string, v interface{}) error {
+	resp, err := p.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,110 @@
+package oidc_test
+
+import (
+	"testing"
+
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/oidc"
+	"bitbucket.org/ibros_nsk/krisenkompass-backend/pkg/oidc/oidctest"
+)
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp, err := oidctest.NewServer("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idp.Close()
+
+	idp.SetClaims(map[string]interface{}{
+		"sub":            "12345",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"given_name":     "Anna",
+		"groups":         []interface{}{"crisis-staff"},
+	})
+
+	provider, err := oidc.NewProvider(nil, idp.URL, "client", "secret", "https://app.example.com/sso/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback, err := idp.Authorize(provider.AuthCodeURL("state", "nonce", "verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.Query().Get("state") != "state" {
+		t.Fatalf("State must be returned: %s", callback)
+	}
+
+	// Code can't be redeemed without the right PKCE verifier.
+	_, err = provider.Exchange(callback.Query().Get("code"), "wrong", "nonce")
+	if err == nil {
+		t.Errorf("Exchange with wrong code verifier must fail")
+	}
+
+	callback, err = idp.Authorize(provider.AuthCodeURL("state", "nonce", "verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := provider.Exchange(callback.Query().Get("code"), "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Subject != "12345" || token.Email != "user@example.com" || !token.EmailVerified || token.GivenName != "Anna" {
+		t.Errorf("Unexpected token: %+v", token)
+	}
+	if groups, _ := token.Claims["groups"].([]interface{}); len(groups) != 1 {
+		t.Errorf("Custom claims must be available: %+v", token.Claims)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	idp, err := oidctest.NewServer("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idp.Close()
+
+	provider, err := oidc.NewProvider(nil, idp.URL, "client", "secret", "https://app.example.com/sso/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := idp.IDToken(map[string]interface{}{"sub": "12345"}, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.Verify(raw, "nonce")
+	if err != nil {
+		t.Errorf("Valid token must be accepted: %v", err)
+	}
+
+	_, err = provider.Verify(raw, "other")
+	if err == nil {
+		t.Errorf("Token with wrong nonce must be rejected")
+	}
+
+	raw, err = idp.IDToken(map[string]interface{}{"sub": "12345", "aud": "other-client"}, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.Verify(raw, "nonce")
+	if err == nil {
+		t.Errorf("Token for other client must be rejected")
+	}
+
+	other, err := oidctest.NewServer("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	raw, err = other.IDToken(map[string]interface{}{"sub": "12345", "iss": idp.URL}, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.Verify(raw, "nonce")
+	if err == nil {
+		t.Errorf("Token signed with unknown key must be rejected")
+	}
+}
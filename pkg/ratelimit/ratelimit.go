@@ -0,0 +1,129 @@
+// Package ratelimit limits number of events per key in a fixed time window.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Store counts events. MemoryStore works for a single instance, a shared store like
+// Redis can be plugged in when the server is scaled out.
+type Store interface {
+	// Incr increments counter of the key and returns its value and the end of the
+	// window. New window is started if the previous one is over.
+	Incr(key string, window time.Duration) (int, time.Time, error)
+	// Get returns counter of the key and the end of the window without incrementing.
+	Get(key string) (int, time.Time, error)
+	Reset(key string) error
+}
+
+type Limiter struct {
+	Store  Store
+	Limit  int
+	Window time.Duration
+}
+
+func New(store Store, limit int, window time.Duration) *Limiter {
+	return &Limiter{Store: store, Limit: limit, Window: window}
+}
+
+// Allow counts the event and reports whether it's within the limit. If not, time until
+// the window is over is returned.
+func (l *Limiter) Allow(key string) (bool, time.Duration, error) {
+	count, resetAt, err := l.Store.Incr(key, l.Window)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if count > l.Limit {
+		return false, time.Until(resetAt), nil
+	}
+
+	return true, 0, nil
+}
+
+// Exceeded reports whether the key has reached the limit without counting an event.
+// It's used when only some events, like failed attempts, are counted with Allow.
+func (l *Limiter) Exceeded(key string) (bool, time.Duration, error) {
+	count, resetAt, err := l.Store.Get(key)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if count >= l.Limit {
+		return true, time.Until(resetAt), nil
+	}
+
+	return false, 0, nil
+}
+
+func (l *Limiter) Reset(key string) error {
+	return l.Store.Reset(key)
+}
+
+type counter struct {
+	count   int
+	resetAt time.Time
+}
+
+type MemoryStore struct {
+	counters map[string]*counter
+	sync.Mutex
+}
+
+// NewMemoryStore keeps counters in memory. Outdated counters are removed every minute.
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{counters: make(map[string]*counter)}
+	go s.cleanup()
+	return s
+}
+
+func (s *MemoryStore) Incr(key string, window time.Duration) (int, time.Time, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.resetAt) {
+		c = &counter{resetAt: now.Add(window)}
+		s.counters[key] = c
+	}
+	c.count++
+
+	return c.count, c.resetAt, nil
+}
+
+func (s *MemoryStore) Get(key string) (int, time.Time, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok || !time.Now().Before(c.resetAt) {
+		return 0, time.Time{}, nil
+	}
+
+	return c.count, c.resetAt, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.Lock()
+	delete(s.counters, key)
+	s.Unlock()
+
+	return nil
+}
+
+func (s *MemoryStore) cleanup() {
+	for {
+		<-time.After(time.Minute)
+
+		s.Lock()
+		now := time.Now()
+		for k, c := range s.counters {
+			if !now.Before(c.resetAt) {
+				delete(s.counters, k)
+			}
+		}
+		s.Unlock()
+	}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(NewMemoryStore(), 3, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		ok, _, err := l.Allow("ip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("Event %d must be allowed", i+1)
+		}
+	}
+
+	ok, retryAfter, err := l.Allow("ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || retryAfter <= 0 {
+		t.Errorf("Event over the limit must be denied with retry time, got %v %v", ok, retryAfter)
+	}
+
+	ok, _, _ = l.Allow("other")
+	if !ok {
+		t.Errorf("Keys must be limited separately")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	ok, _, _ = l.Allow("ip")
+	if !ok {
+		t.Errorf("Event must be allowed in the next window")
+	}
+
+	l.Allow("ip")
+	l.Allow("ip")
+	l.Reset("ip")
+	ok, _, _ = l.Allow("ip")
+	if !ok {
+		t.Errorf("Event must be allowed after reset")
+	}
+}
+
+func TestExceeded(t *testing.T) {
+	l := New(NewMemoryStore(), 2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		exceeded, _, err := l.Exceeded("account")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exceeded {
+			t.Fatalf("Limit must not be exceeded after %d events", i)
+		}
+
+		l.Allow("account")
+	}
+
+	exceeded, retryAfter, err := l.Exceeded("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exceeded || retryAfter <= 0 {
+		t.Errorf("Limit must be exceeded with retry time, got %v %v", exceeded, retryAfter)
+	}
+}
@@ -0,0 +1,52 @@
+package striphtml
+
+import (
+	"html"
+	"strings"
+)
+
+// Strip removes tags from HTML and returns plain text with collapsed whitespace.
+// Contents of script and style elements are dropped.
+func Strip(s string) string {
+	var b strings.Builder
+
+	skip := ""
+	for len(s) > 0 {
+		start := strings.IndexByte(s, '<')
+		if start < 0 {
+			if skip == "" {
+				b.WriteString(s)
+			}
+			break
+		}
+
+		if skip == "" {
+			b.WriteString(s[:start])
+		}
+
+		end := strings.IndexByte(s[start:], '>')
+		if end < 0 {
+			break
+		}
+
+		tag := strings.ToLower(strings.TrimSpace(s[start+1 : start+end]))
+		name := strings.TrimPrefix(tag, "/")
+		if i := strings.IndexAny(name, " \t\r\n/"); i >= 0 {
+			name = name[:i]
+		}
+
+		if skip != "" {
+			if strings.HasPrefix(tag, "/") && name == skip {
+				skip = ""
+			}
+		} else if (name == "script" || name == "style") && !strings.HasPrefix(tag, "/") {
+			skip = name
+		}
+
+		// Tags separate words, e.g. "<p>one</p><p>two</p>".
+		b.WriteByte(' ')
+		s = s[start+end+1:]
+	}
+
+	return strings.Join(strings.Fields(html.UnescapeString(b.String())), " ")
+}
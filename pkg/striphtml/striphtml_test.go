@@ -0,0 +1,27 @@
+package striphtml
+
+import "testing"
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"plain text", "plain text"},
+		{"<p>Hello <b>world</b></p>", "Hello world"},
+		{"<p>one</p><p>two</p>", "one two"},
+		{"<a href=\"/organization/1/page/2#block-3\">Link</a>", "Link"},
+		{"Fish &amp; chips&nbsp;&lt;3", "Fish & chips <3"},
+		{"before<script>alert('x')</script>after", "before after"},
+		{"<style type=\"text/css\">p { color: red }</style>Text", "Text"},
+		{"broken <b tag", "broken"},
+	}
+
+	for _, test := range tests {
+		got := Strip(test.in)
+		if got != test.want {
+			t.Errorf("Strip(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors of RFC 6238 for SHA1, truncated to 6 digits.
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		code, err := Code(secret, Step(time.Unix(test.time, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.code {
+			t.Errorf("Code at %d: expected %s, got %s", test.time, test.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1600000000, 0)
+	code, err := Code(secret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(code, secret, now)
+	if !ok || step != Step(now) {
+		t.Errorf("Current code must be valid")
+	}
+
+	_, ok = Validate(code, secret, now.Add(Period*time.Second))
+	if !ok {
+		t.Errorf("Code of the previous period must be valid")
+	}
+
+	_, ok = Validate(code, secret, now.Add(3*Period*time.Second))
+	if ok {
+		t.Errorf("Outdated code must be invalid")
+	}
+
+	_, ok = Validate("12345", secret, now)
+	if ok {
+		t.Errorf("Code with wrong length must be invalid")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Krisenkompass", "user@example.com", "JBSWY3DPEHPK3PXP")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Krisenkompass:user@example.com?") {
+		t.Errorf("Unexpected URI: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=Krisenkompass") {
+		t.Errorf("URI must contain secret and issuer: %s", uri)
+	}
+}
@@ -0,0 +1,151 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// maxCBORDepth limits nesting of decoded items. Attestation objects and COSE keys are
+// only a few levels deep.
+const maxCBORDepth = 8
+
+var errCBOR = errors.New("invalid CBOR")
+
+// cborDecoder decodes the subset of CBOR (RFC 8949) used by WebAuthn: integers, byte and
+// text strings, arrays, maps and simple values. Indefinite lengths and floats are not
+// supported. Integers are decoded as int64, maps as map[interface{}]interface{}.
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeCBOR decodes the first item of data and returns it with the number of bytes it
+// takes.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := &cborDecoder{data: data}
+	value, err := d.decode(0)
+	return value, d.pos, err
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxCBORDepth {
+		return nil, errCBOR
+	}
+
+	if d.pos >= len(d.data) {
+		return nil, errCBOR
+	}
+	major := d.data[d.pos] >> 5
+	info := d.data[d.pos] & 0x1f
+	d.pos++
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+		return nil, errCBOR
+	}
+
+	arg, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, errCBOR
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, errCBOR
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errCBOR
+		}
+		value := d.data[d.pos : d.pos+int(arg)]
+		d.pos += int(arg)
+		if major == 3 {
+			return string(value), nil
+		}
+		return append([]byte{}, value...), nil
+	case 4:
+		// Every item takes at least one byte.
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errCBOR
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case 5:
+		if arg > uint64(len(d.data)-d.pos)/2 {
+			return nil, errCBOR
+		}
+		items := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errCBOR
+			}
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items[key] = value
+		}
+		return items, nil
+	case 6:
+		// Tags aren't used by WebAuthn, the tagged item is returned.
+		return d.decode(depth + 1)
+	}
+
+	return nil, errCBOR
+}
+
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	if info < 24 {
+		return uint64(info), nil
+	}
+
+	size := 0
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		return 0, errCBOR
+	}
+
+	if d.pos+size > len(d.data) {
+		return 0, errCBOR
+	}
+	buf := make([]byte, 8)
+	copy(buf[8-size:], d.data[d.pos:d.pos+size])
+	d.pos += size
+
+	return binary.BigEndian.Uint64(buf), nil
+}
@@ -0,0 +1,309 @@
+// Package webauthn implements registration and authentication ceremonies of Web
+// Authentication (W3C WebAuthn Level 2) for passkeys. Attestation statements are not
+// verified, so "none" attestation is requested and credentials are trusted as the
+// user's own. User verification is required in both ceremonies.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/url"
+)
+
+// ChallengeSize is the number of random bytes in a challenge.
+const ChallengeSize = 32
+
+// Timeout of ceremonies in the browser in milliseconds.
+const Timeout = 300000
+
+// Flags of authenticator data.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+var encoding = base64.RawURLEncoding
+
+// Config describes the relying party. Origin is where the frontend runs, RPID is its
+// host name unless credentials are shared with subdomains.
+type Config struct {
+	RPID   string
+	RPName string
+	Origin string
+}
+
+// ConfigFromURL returns config of the frontend at the URL.
+func ConfigFromURL(client, name string) (Config, error) {
+	u, err := url.Parse(client)
+	if err != nil || u.Host == "" {
+		return Config{}, errors.New("invalid client URL")
+	}
+
+	return Config{RPID: u.Hostname(), RPName: name, Origin: u.Scheme + "://" + u.Host}, nil
+}
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type User struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are passed to navigator.credentials.create as publicKey. Binary values
+// are base64url encoded and have to be decoded by the client.
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   User                   `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are passed to navigator.credentials.get as publicKey. Allowed
+// credentials are empty, so the user picks one of the passkeys saved for the site.
+type RequestOptions struct {
+	Challenge        string `json:"challenge"`
+	Timeout          int    `json:"timeout"`
+	RPID             string `json:"rpId"`
+	UserVerification string `json:"userVerification"`
+}
+
+// Credential is a public key credential created by the authenticator.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	// Set only in registration.
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	_, err := rand.Read(challenge)
+	return challenge, err
+}
+
+// CreationOptions returns options of the registration. Credentials of the user are
+// excluded, so the same authenticator isn't registered twice.
+func (c Config) CreationOptions(challenge, userHandle []byte, name, displayName string, exclude [][]byte) CreationOptions {
+	options := CreationOptions{
+		Challenge: encoding.EncodeToString(challenge),
+		RP:        RelyingParty{ID: c.RPID, Name: c.RPName},
+		User: User{
+			ID:          encoding.EncodeToString(userHandle),
+			Name:        name,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Algorithm: algES256},
+			{Type: "public-key", Algorithm: algEdDSA},
+			{Type: "public-key", Algorithm: algRS256},
+		},
+		Timeout:            Timeout,
+		ExcludeCredentials: make([]CredentialDescriptor, 0, len(exclude)),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+
+	for _, id := range exclude {
+		options.ExcludeCredentials = append(options.ExcludeCredentials, CredentialDescriptor{Type: "public-key", ID: encoding.EncodeToString(id)})
+	}
+
+	return options
+}
+
+func (c Config) RequestOptions(challenge []byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        encoding.EncodeToString(challenge),
+		Timeout:          Timeout,
+		RPID:             c.RPID,
+		UserVerification: "required",
+	}
+}
+
+// VerifyRegistration checks response of navigator.credentials.create and returns the
+// new credential.
+func (c Config) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (Credential, error) {
+	err := c.verifyClientData(clientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	value, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return Credential{}, err
+	}
+	object, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return Credential{}, errors.New("invalid attestation object")
+	}
+	rawAuthData, ok := object["authData"].([]byte)
+	if !ok {
+		return Credential{}, errors.New("invalid attestation object")
+	}
+
+	authData, err := c.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if authData.Flags&flagAttestedData == 0 || authData.CredentialID == nil {
+		return Credential{}, errors.New("credential data is missing")
+	}
+
+	_, err = parsePublicKey(authData.PublicKey)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:        authData.CredentialID,
+		PublicKey: authData.PublicKey,
+		SignCount: authData.SignCount,
+	}, nil
+}
+
+// VerifyAssertion checks response of navigator.credentials.get signed with the saved
+// credential and returns the new signature counter.
+func (c Config) VerifyAssertion(challenge []byte, credential Credential, clientDataJSON, rawAuthData, signature []byte) (uint32, error) {
+	err := c.verifyClientData(clientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	authData, err := c.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	err = key.verify(signed, signature)
+	if err != nil {
+		return 0, err
+	}
+
+	// Authenticators which don't count signatures always return 0. Counter which
+	// doesn't grow means the credential could have been cloned.
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		return 0, errors.New("signature counter didn't increase")
+	}
+
+	return authData.SignCount, nil
+}
+
+func (c Config) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var data clientData
+	err := json.Unmarshal(clientDataJSON, &data)
+	if err != nil {
+		return errors.New("invalid client data")
+	}
+
+	if data.Type != ceremony {
+		return errors.New("wrong ceremony type")
+	}
+
+	received, err := encoding.DecodeString(data.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return errors.New("wrong challenge")
+	}
+
+	if data.Origin != c.Origin {
+		return errors.New("wrong origin")
+	}
+
+	return nil
+}
+
+// parseAuthenticatorData parses authenticator data and checks that it's made for the
+// relying party with user present and verified.
+func (c Config) parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, errors.New("invalid authenticator data")
+	}
+
+	authData := authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rpIDHash := sha256.Sum256([]byte(c.RPID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return authenticatorData{}, errors.New("wrong relying party")
+	}
+	if authData.Flags&flagUserPresent == 0 || authData.Flags&flagUserVerified == 0 {
+		return authenticatorData{}, errors.New("user wasn't verified")
+	}
+
+	if authData.Flags&flagAttestedData != 0 {
+		// AAGUID (16 bytes), length of credential ID (2 bytes), credential ID and the key.
+		rest := data[37:]
+		if len(rest) < 18 {
+			return authenticatorData{}, errors.New("invalid credential data")
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return authenticatorData{}, errors.New("invalid credential ID")
+		}
+		authData.CredentialID = append([]byte{}, rest[:idLength]...)
+
+		_, keyLength, err := decodeCBOR(rest[idLength:])
+		if err != nil {
+			return authenticatorData{}, errors.New("invalid credential public key")
+		}
+		authData.PublicKey = append([]byte{}, rest[idLength:idLength+keyLength]...)
+	}
+
+	return authData, nil
+}
@@ -0,0 +1,208 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+var testConfig = Config{RPID: "app.example.com", RPName: "Example", Origin: "https://app.example.com"}
+
+// encodeCBOR encodes the values used in tests: int, int64, string, []byte and maps.
+func encodeCBOR(value interface{}) []byte {
+	head := func(major byte, arg uint64) []byte {
+		switch {
+		case arg < 24:
+			return []byte{major<<5 | byte(arg)}
+		case arg < 1<<8:
+			return []byte{major<<5 | 24, byte(arg)}
+		default:
+			return []byte{major<<5 | 25, byte(arg >> 8), byte(arg)}
+		}
+	}
+
+	switch v := value.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case map[interface{}]interface{}:
+		out := head(5, uint64(len(v)))
+		for key, item := range v {
+			out = append(out, encodeCBOR(key)...)
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	}
+	panic("unsupported value")
+}
+
+func padded(b []byte) []byte {
+	out := make([]byte, 32)
+	copy(out[32-len(b):], b)
+	return out
+}
+
+func authData(flags byte, signCount uint32, credentialID, publicKey []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testConfig.RPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, signCount)
+	data = append(data, counter...)
+
+	if credentialID != nil {
+		data = append(data, make([]byte, 16)...)
+		length := make([]byte, 2)
+		binary.BigEndian.PutUint16(length, uint16(len(credentialID)))
+		data = append(data, length...)
+		data = append(data, credentialID...)
+		data = append(data, publicKey...)
+	}
+
+	return data
+}
+
+func clientDataJSON(ceremony string, challenge []byte, origin string) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": encoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	return data
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coseKey := encodeCBOR(map[interface{}]interface{}{
+		1:  ktyEC2,
+		3:  algES256,
+		-1: crvP256,
+		-2: padded(privateKey.X.Bytes()),
+		-3: padded(privateKey.Y.Bytes()),
+	})
+	credentialID := []byte("credential-1")
+
+	challenge, _ := NewChallenge()
+	attestation := encodeCBOR(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": authData(flagUserPresent|flagUserVerified|flagAttestedData, 0, credentialID, coseKey),
+	})
+
+	credential, err := testConfig.VerifyRegistration(challenge, clientDataJSON("webauthn.create", challenge, testConfig.Origin), attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(credential.ID) != string(credentialID) {
+		t.Errorf("Wrong credential ID %q", credential.ID)
+	}
+
+	otherChallenge, _ := NewChallenge()
+	_, err = testConfig.VerifyRegistration(otherChallenge, clientDataJSON("webauthn.create", challenge, testConfig.Origin), attestation)
+	if err == nil {
+		t.Error("Wrong challenge must be rejected")
+	}
+
+	sign := func(challenge []byte, origin string, flags byte, signCount uint32) ([]byte, []byte, []byte) {
+		clientData := clientDataJSON("webauthn.get", challenge, origin)
+		data := authData(flags, signCount, nil, nil)
+		hash := sha256.Sum256(clientData)
+		digest := sha256.Sum256(append(append([]byte{}, data...), hash[:]...))
+		signature, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return clientData, data, signature
+	}
+
+	challenge, _ = NewChallenge()
+	clientData, data, signature := sign(challenge, testConfig.Origin, flagUserPresent|flagUserVerified, 5)
+	signCount, err := testConfig.VerifyAssertion(challenge, credential, clientData, data, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signCount != 5 {
+		t.Errorf("Wrong signature counter %d", signCount)
+	}
+
+	credential.SignCount = signCount
+	_, err = testConfig.VerifyAssertion(challenge, credential, clientData, data, signature)
+	if err == nil {
+		t.Error("Replayed assertion must be rejected")
+	}
+
+	clientData, data, signature = sign(challenge, "https://evil.example.com", flagUserPresent|flagUserVerified, 6)
+	_, err = testConfig.VerifyAssertion(challenge, credential, clientData, data, signature)
+	if err == nil {
+		t.Error("Wrong origin must be rejected")
+	}
+
+	clientData, data, signature = sign(challenge, testConfig.Origin, flagUserPresent, 7)
+	_, err = testConfig.VerifyAssertion(challenge, credential, clientData, data, signature)
+	if err == nil {
+		t.Error("Assertion without user verification must be rejected")
+	}
+
+	clientData, data, signature = sign(challenge, testConfig.Origin, flagUserPresent|flagUserVerified, 8)
+	signature[len(signature)-1] ^= 1
+	_, err = testConfig.VerifyAssertion(challenge, credential, clientData, data, signature)
+	if err == nil {
+		t.Error("Invalid signature must be rejected")
+	}
+}
+
+func TestEd25519Key(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coseKey := encodeCBOR(map[interface{}]interface{}{1: ktyOKP, 3: algEdDSA, -1: crvEd25519, -2: []byte(public)})
+
+	key, err := parsePublicKey(coseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = key.verify([]byte("data"), ed25519.Sign(private, []byte("data")))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeCBORErrors(t *testing.T) {
+	invalid := [][]byte{
+		{},
+		{0x5a, 0xff, 0xff, 0xff, 0xff}, // byte string longer than data
+		{0x9f},                         // indefinite array
+		{0xb9, 0xff, 0xff},             // map with too many items
+		{0xa1, 0x41, 0x00, 0x01},       // byte string map key
+		{0xfb, 0, 0, 0, 0, 0, 0, 0, 0}, // float
+		{0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x00}, // too deep
+	}
+	for _, data := range invalid {
+		_, _, err := decodeCBOR(data)
+		if err == nil {
+			t.Errorf("CBOR % x must be invalid", data)
+		}
+	}
+
+	config, err := ConfigFromURL("https://app.example.com/", "Example")
+	if err != nil || config != testConfig {
+		t.Errorf("Wrong config %+v: %v", config, err)
+	}
+}